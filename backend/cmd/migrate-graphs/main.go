@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+// row is a stored graph, or data tied to one. version is the row version,
+// zero for tables that have none. graph is the graph data describes, for
+// scene state.
+type row struct {
+	id      uuid.UUID
+	version int32
+	data    []byte
+	graph   []byte
+}
+
+// table pages through the rows of one table holding graph data and writes
+// migrated data back, reporting whether the row was updated. upgrade
+// defaults to graph.Migrate.
+type table struct {
+	name    string
+	list    func(ctx context.Context, after uuid.UUID, limit int32) ([]row, error)
+	upgrade func(r row) ([]byte, bool, error)
+	store   func(ctx context.Context, r row, data []byte) (bool, error)
+}
+
+func tables(q *sqlc.Queries) []table {
+	return []table{
+		{
+			name: "tracks",
+			list: func(ctx context.Context, after uuid.UUID, limit int32) ([]row, error) {
+				rows, err := q.ListTrackGraphs(ctx, sqlc.ListTrackGraphsParams{ID: after, Limit: limit})
+				result := make([]row, 0, len(rows))
+				for _, r := range rows {
+					result = append(result, row{id: r.ID, version: r.Version, data: r.GraphData})
+				}
+				return result, err
+			},
+			store: func(ctx context.Context, r row, data []byte) (bool, error) {
+				n, err := q.MigrateTrackGraph(ctx, sqlc.MigrateTrackGraphParams{ID: r.id, Version: r.version, GraphData: data})
+				return n > 0, err
+			},
+		},
+		{
+			name: "track_revisions",
+			list: func(ctx context.Context, after uuid.UUID, limit int32) ([]row, error) {
+				rows, err := q.ListRevisionGraphs(ctx, sqlc.ListRevisionGraphsParams{ID: after, Limit: limit})
+				result := make([]row, 0, len(rows))
+				for _, r := range rows {
+					result = append(result, row{id: r.ID, data: r.GraphData})
+				}
+				return result, err
+			},
+			store: func(ctx context.Context, r row, data []byte) (bool, error) {
+				err := q.MigrateRevisionGraph(ctx, sqlc.MigrateRevisionGraphParams{ID: r.id, GraphData: data})
+				return err == nil, err
+			},
+		},
+		{
+			name: "track_templates",
+			list: func(ctx context.Context, after uuid.UUID, limit int32) ([]row, error) {
+				rows, err := q.ListTemplateGraphs(ctx, sqlc.ListTemplateGraphsParams{ID: after, Limit: limit})
+				result := make([]row, 0, len(rows))
+				for _, r := range rows {
+					result = append(result, row{id: r.ID, data: r.GraphData})
+				}
+				return result, err
+			},
+			store: func(ctx context.Context, r row, data []byte) (bool, error) {
+				err := q.MigrateTemplateGraph(ctx, sqlc.MigrateTemplateGraphParams{ID: r.id, GraphData: data})
+				return err == nil, err
+			},
+		},
+		// Scenes store node params by node id, which the graph migrations
+		// upgrade using the node types of the track's graph.
+		{
+			name: "scenes",
+			list: func(ctx context.Context, after uuid.UUID, limit int32) ([]row, error) {
+				rows, err := q.ListSceneStates(ctx, sqlc.ListSceneStatesParams{ID: after, Limit: limit})
+				result := make([]row, 0, len(rows))
+				for _, r := range rows {
+					result = append(result, row{id: r.ID, version: r.Version, data: r.StateData, graph: r.GraphData})
+				}
+				return result, err
+			},
+			upgrade: upgradeSceneState,
+			store: func(ctx context.Context, r row, data []byte) (bool, error) {
+				n, err := q.MigrateSceneState(ctx, sqlc.MigrateSceneStateParams{ID: r.id, Version: r.version, StateData: data})
+				return n > 0, err
+			},
+		},
+		{
+			name: "track_templates scenes",
+			list: func(ctx context.Context, after uuid.UUID, limit int32) ([]row, error) {
+				rows, err := q.ListTemplateGraphs(ctx, sqlc.ListTemplateGraphsParams{ID: after, Limit: limit})
+				result := make([]row, 0, len(rows))
+				for _, r := range rows {
+					result = append(result, row{id: r.ID, data: r.Scenes, graph: r.GraphData})
+				}
+				return result, err
+			},
+			upgrade: upgradeTemplateScenes,
+			store: func(ctx context.Context, r row, data []byte) (bool, error) {
+				err := q.MigrateTemplateScenes(ctx, sqlc.MigrateTemplateScenesParams{ID: r.id, Scenes: data})
+				return err == nil, err
+			},
+		},
+	}
+}
+
+func upgradeGraph(r row) ([]byte, bool, error) {
+	return graph.Migrate(r.data)
+}
+
+func upgradeSceneState(r row) ([]byte, bool, error) {
+	g, err := graph.Parse(r.graph)
+	if err != nil {
+		return nil, false, err
+	}
+	return graph.MigrateSceneState(r.data, g)
+}
+
+// upgradeTemplateScenes migrates the state of each of a template's default
+// scenes, stored as [{name, position, state}].
+func upgradeTemplateScenes(r row) ([]byte, bool, error) {
+	g, err := graph.Parse(r.graph)
+	if err != nil {
+		return nil, false, err
+	}
+	var scenes []map[string]json.RawMessage
+	if err := json.Unmarshal(r.data, &scenes); err != nil {
+		return nil, false, fmt.Errorf("failed to parse template scenes: %w", err)
+	}
+
+	changed := false
+	for _, scene := range scenes {
+		state, ok := scene["state"]
+		if !ok {
+			continue
+		}
+		migrated, stateChanged, err := graph.MigrateSceneState(state, g)
+		if err != nil {
+			return nil, false, err
+		}
+		if stateChanged {
+			scene["state"] = migrated
+			changed = true
+		}
+	}
+	if !changed {
+		return r.data, false, nil
+	}
+	data, err := json.Marshal(scenes)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// migrate upgrades every stored graph in t. Graphs that fail to migrate are
+// logged and left alone; they still fail the same way when read.
+func migrate(ctx context.Context, t table, batch int32, dryRun bool) {
+	upgrade := t.upgrade
+	if upgrade == nil {
+		upgrade = upgradeGraph
+	}
+
+	var scanned, migrated, skipped, failed int
+	after := uuid.Nil
+	for {
+		rows, err := t.list(ctx, after, batch)
+		if err != nil {
+			log.Fatalf("Unable to list %s: %v\n", t.name, err)
+		}
+
+		for _, r := range rows {
+			scanned++
+			data, changed, err := upgrade(r)
+			if err != nil {
+				log.Printf("Warning: %s %s: %v\n", t.name, r.id, err)
+				failed++
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if dryRun {
+				migrated++
+				continue
+			}
+
+			updated, err := t.store(ctx, r, data)
+			if err != nil {
+				log.Fatalf("Unable to update %s %s: %v\n", t.name, r.id, err)
+			}
+			if updated {
+				migrated++
+			} else {
+				skipped++
+			}
+		}
+
+		if len(rows) < int(batch) {
+			break
+		}
+		after = rows[len(rows)-1].id
+	}
+
+	log.Printf("%s: %d scanned, %d migrated, %d changed since read, %d failed\n", t.name, scanned, migrated, skipped, failed)
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	batch := flag.Int("batch", 200, "rows read per query")
+	flag.Parse()
+
+	if *batch <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v\n", err)
+	}
+	defer pool.Close()
+
+	if err := pool.Ping(ctx); err != nil {
+		log.Fatalf("Unable to ping database: %v\n", err)
+	}
+
+	log.Printf("Upgrading stored graphs to version %d\n", graph.CurrentVersion)
+	for _, t := range tables(sqlc.New(pool)) {
+		migrate(ctx, t, int32(*batch), *dryRun)
+	}
+}
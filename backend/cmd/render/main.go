@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/theosov/hexa/pkg/graph"
+	"github.com/theosov/hexa/pkg/render"
+)
+
+func main() {
+	in := flag.String("in", "-", "graph_data JSON file, or a track JSON with a graph_data field (- for stdin)")
+	out := flag.String("out", "render.wav", "output WAV file")
+	duration := flag.Duration("duration", 0, "render length (default: 4 bars at -bpm)")
+	bpm := flag.Int("bpm", render.DefaultBPM, "track tempo")
+	sampleRate := flag.Int("sample-rate", render.DefaultSampleRate, "output sample rate")
+	seed := flag.Int64("seed", 1, "seed for sequencer step probabilities")
+	flag.Parse()
+
+	var src io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatalf("Unable to open input: %v\n", err)
+		}
+		defer f.Close()
+		src = f
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		log.Fatalf("Unable to read input: %v\n", err)
+	}
+
+	var track struct {
+		BPM       int             `json:"bpm"`
+		GraphData json.RawMessage `json:"graph_data"`
+	}
+	if err := json.Unmarshal(data, &track); err == nil && len(track.GraphData) > 0 {
+		data = track.GraphData
+		if track.BPM > 0 {
+			*bpm = track.BPM
+		}
+	}
+
+	g, err := graph.Parse(data)
+	if err != nil {
+		log.Fatalf("Unable to parse graph: %v\n", err)
+	}
+
+	buf, err := render.Render(context.Background(), g, render.Options{
+		SampleRate: *sampleRate,
+		Duration:   *duration,
+		BPM:        *bpm,
+		Seed:       *seed,
+	})
+	if err != nil {
+		log.Fatalf("Render failed: %v\n", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Unable to create output: %v\n", err)
+	}
+	defer f.Close()
+
+	if err := render.WriteWAV(f, buf); err != nil {
+		log.Fatalf("Unable to write WAV: %v\n", err)
+	}
+
+	log.Printf("✓ Rendered %s to %s\n", buf.Duration(), *out)
+}
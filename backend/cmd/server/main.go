@@ -16,12 +16,19 @@ import (
 	"github.com/joho/godotenv"
 
 	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/collab"
 	"github.com/theosov/hexa/internal/handlers"
+	"github.com/theosov/hexa/internal/jobs"
 	"github.com/theosov/hexa/pkg/auth"
 	"github.com/theosov/hexa/pkg/cache"
 	"github.com/theosov/hexa/pkg/storage"
+	"github.com/theosov/hexa/pkg/upload"
 )
 
+// uploadTimeout is how long routes with large request or response bodies
+// may take to transfer them.
+const uploadTimeout = 5 * time.Minute
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
@@ -114,17 +121,93 @@ func main() {
 		frontendURL,
 	)
 
-	tracksHandler := handlers.NewTracksHandler(queries)
-	samplesHandler := handlers.NewSamplesHandler(queries, minioClient)
+	hub := collab.NewHub(queries, pool)
+
+	tracksHandler := handlers.NewTracksHandler(queries, pool, minioClient)
+	revisionsHandler := handlers.NewRevisionsHandler(queries, pool)
+	membersHandler := handlers.NewMembersHandler(queries, pool, hub, frontendURL)
+	publicHandler := handlers.NewPublicHandler(queries, minioClient)
+	forksHandler := handlers.NewForksHandler(queries, pool, minioClient)
+	bundlesHandler := handlers.NewBundlesHandler(queries, pool, minioClient)
+	templatesHandler := handlers.NewTemplatesHandler(queries, pool, minioClient)
+	foldersHandler := handlers.NewFoldersHandler(queries)
+	tagsHandler := handlers.NewTagsHandler(queries)
+	collabHandler := handlers.NewCollabHandler(queries, hub)
 	impulsesHandler := handlers.NewImpulsesHandler(queries, minioClient)
-	exportHandler := handlers.NewExportHandler()
+	exportWorkers, err := strconv.Atoi(os.Getenv("EXPORT_WORKERS"))
+	if err != nil || exportWorkers < 1 {
+		exportWorkers = 2
+	}
+	exportWorker := jobs.NewExportWorker(queries, minioClient, exportWorkers)
+	exportWorker.Start(ctx)
+
+	transcodeWorkers, err := strconv.Atoi(os.Getenv("TRANSCODE_WORKERS"))
+	if err != nil || transcodeWorkers < 1 {
+		transcodeWorkers = 1
+	}
+	transcodeWorker := jobs.NewTranscodeWorker(queries, minioClient, transcodeWorkers)
+	transcodeWorker.Start(ctx)
+	samplesHandler := handlers.NewSamplesHandler(queries, minioClient, transcodeWorker)
+
+	trashRetentionDays, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || trashRetentionDays < 1 {
+		trashRetentionDays = 30
+	}
+	trashCollector := jobs.NewTrashCollector(queries, pool, minioClient, time.Duration(trashRetentionDays)*24*time.Hour)
+	trashCollector.Start(ctx)
+	trashHandler := handlers.NewTrashHandler(queries, trashCollector)
+
+	exportHandler := handlers.NewExportHandler(queries, minioClient, exportWorker)
 	scenesHandler := handlers.NewScenesHandler(queries)
 
+	// Routes that take uploads larger than the default body limit get their
+	// own, and more time to receive them; request bodies are streamed so they
+	// are not held in memory. The bundle download gets more time to send.
+	limits := handlers.NewLimits(fiber.DefaultBodyLimit,
+		handlers.RouteLimit{
+			Method:  fiber.MethodPost,
+			Path:    "/api/export",
+			MaxBody: handlers.ExportMaxFileSize + handlers.FormOverhead,
+			Timeout: uploadTimeout,
+		},
+		handlers.RouteLimit{
+			Method:  fiber.MethodPost,
+			Path:    "/api/tracks/import",
+			MaxBody: handlers.BundleMaxSize + handlers.FormOverhead,
+			Timeout: uploadTimeout,
+		},
+		handlers.RouteLimit{
+			Method:  fiber.MethodGet,
+			Path:    "/api/tracks/:id/bundle",
+			Timeout: uploadTimeout,
+		},
+		handlers.RouteLimit{
+			Method:  fiber.MethodPost,
+			Path:    "/api/tracks/:id/cover",
+			MaxBody: handlers.CoverMaxFileSize + handlers.FormOverhead,
+		},
+		handlers.RouteLimit{
+			Method:  fiber.MethodPost,
+			Path:    "/api/samples/upload",
+			MaxBody: upload.Samples.MaxSize() + handlers.FormOverhead,
+			Timeout: uploadTimeout,
+		},
+		handlers.RouteLimit{
+			Method:  fiber.MethodPost,
+			Path:    "/api/impulses/upload",
+			MaxBody: upload.Impulses.MaxSize() + handlers.FormOverhead,
+			Timeout: uploadTimeout,
+		},
+	)
+
 	app := fiber.New(fiber.Config{
-		AppName:      "Hexa API v1.0",
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		AppName:                      "Hexa API v1.0",
+		ReadTimeout:                  10 * time.Second,
+		WriteTimeout:                 10 * time.Second,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
+	app.Server().HeaderReceived = limits.HeaderReceived
 
 	app.Use(recover.New())
 	app.Use(logger.New(logger.Config{
@@ -133,9 +216,12 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     frontendURL,
 		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, If-Match",
+		ExposeHeaders:    "ETag",
 	}))
 
+	app.Use(limits.Handler)
+
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"status":  "ok",
@@ -152,6 +238,10 @@ func main() {
 	authGroup.Get("/github/callback", authHandler.GitHubCallback)
 	authGroup.Post("/refresh", authHandler.RefreshToken)
 
+	publicGroup := app.Group("/public")
+	publicGroup.Get("/tracks", publicHandler.ListPublicTracks)
+	publicGroup.Get("/tracks/:slug", publicHandler.GetPublicTrack)
+
 	authMiddleware := auth.AuthMiddleware(jwtManager)
 
 	protected := app.Group("/api", authMiddleware)
@@ -160,27 +250,84 @@ func main() {
 
 	protected.Get("/tracks", tracksHandler.ListTracks)
 	protected.Post("/tracks", tracksHandler.CreateTrack)
+	protected.Post("/tracks/validate", tracksHandler.ValidateGraph)
+	protected.Post("/tracks/organize", tracksHandler.OrganizeTracks)
+	protected.Post("/tracks/import", bundlesHandler.ImportBundle)
 	protected.Get("/tracks/:id", tracksHandler.GetTrack)
 	protected.Put("/tracks/:id", tracksHandler.UpdateTrack)
 	protected.Patch("/tracks/:id/graph", tracksHandler.UpdateTrackGraph)
 	protected.Delete("/tracks/:id", tracksHandler.DeleteTrack)
+	protected.Put("/tracks/:id/visibility", tracksHandler.SetVisibility)
+	protected.Post("/tracks/:id/cover", tracksHandler.UploadCover)
+	protected.Delete("/tracks/:id/cover", tracksHandler.DeleteCover)
+	protected.Get("/tracks/:id/analysis", tracksHandler.AnalyzeTrack)
+	protected.Post("/tracks/:id/fork", forksHandler.ForkTrack)
+	protected.Get("/tracks/:id/lineage", forksHandler.Lineage)
+	protected.Get("/tracks/:id/bundle", bundlesHandler.ExportBundle)
+
+	protected.Get("/tracks/:id/live", collabHandler.Upgrade, collabHandler.Session())
+
+	protected.Get("/tracks/:id/revisions", revisionsHandler.ListRevisions)
+	protected.Get("/tracks/:id/revisions/diff", revisionsHandler.DiffRevisions)
+	protected.Get("/tracks/:id/revisions/:revisionId", revisionsHandler.GetRevision)
+	protected.Post("/tracks/:id/revisions/:revisionId/restore", revisionsHandler.RestoreRevision)
+
+	protected.Get("/tracks/:id/members", membersHandler.ListMembers)
+	protected.Put("/tracks/:id/members/:userId", membersHandler.UpdateMember)
+	protected.Delete("/tracks/:id/members/:userId", membersHandler.RemoveMember)
+	protected.Get("/tracks/:id/invites", membersHandler.ListInvites)
+	protected.Post("/tracks/:id/invites", membersHandler.CreateInvite)
+	protected.Delete("/tracks/:id/invites/:inviteId", membersHandler.RevokeInvite)
+	protected.Get("/invites", membersHandler.ListMyInvites)
+	protected.Post("/invites/:token/accept", membersHandler.AcceptInvite)
+
+	protected.Get("/templates", templatesHandler.ListTemplates)
+	protected.Post("/templates", templatesHandler.CreateTemplate)
+	protected.Get("/templates/:id", templatesHandler.GetTemplate)
+	protected.Delete("/templates/:id", templatesHandler.DeleteTemplate)
+
+	protected.Get("/trash", trashHandler.ListTrash)
+	protected.Delete("/trash", trashHandler.EmptyTrash)
+	protected.Post("/trash/:id/restore", trashHandler.RestoreTrack)
+	protected.Delete("/trash/:id", trashHandler.PurgeTrack)
+
+	protected.Get("/folders", foldersHandler.ListFolders)
+	protected.Post("/folders", foldersHandler.CreateFolder)
+	protected.Put("/folders/:id", foldersHandler.UpdateFolder)
+	protected.Delete("/folders/:id", foldersHandler.DeleteFolder)
+
+	protected.Get("/tags", tagsHandler.ListTags)
+	protected.Post("/tags", tagsHandler.CreateTag)
+	protected.Put("/tags/:id", tagsHandler.UpdateTag)
+	protected.Delete("/tags/:id", tagsHandler.DeleteTag)
 
 	protected.Post("/samples/upload", samplesHandler.UploadSample)
+	protected.Get("/samples/library", samplesHandler.ListLibrarySamples)
 	protected.Get("/samples/:id", samplesHandler.GetSample)
+	protected.Get("/samples/:id/peaks", samplesHandler.GetSamplePeaks)
 	protected.Delete("/samples/:id", samplesHandler.DeleteSample)
 	protected.Get("/tracks/:trackId/samples", samplesHandler.ListTrackSamples)
+	protected.Post("/tracks/:trackId/samples/:id", samplesHandler.AttachSample)
+	protected.Delete("/tracks/:trackId/samples/:id", samplesHandler.DetachSample)
 
 	protected.Post("/impulses/upload", impulsesHandler.UploadImpulse)
 	protected.Get("/impulses/:id", impulsesHandler.GetImpulse)
+	protected.Get("/impulses/:id/peaks", impulsesHandler.GetImpulsePeaks)
 	protected.Delete("/impulses/:id", impulsesHandler.DeleteImpulse)
 	protected.Get("/tracks/:trackId/impulses", impulsesHandler.ListTrackImpulses)
 
 	protected.Get("/tracks/:trackId/scenes", scenesHandler.ListScenes)
 	protected.Post("/tracks/:trackId/scenes", scenesHandler.CreateScene)
+	protected.Get("/scenes/:sceneId", scenesHandler.GetScene)
 	protected.Put("/scenes/:sceneId", scenesHandler.UpdateScene)
 	protected.Delete("/scenes/:sceneId", scenesHandler.DeleteScene)
 
 	protected.Post("/export/mp3", exportHandler.ExportMP3)
+	protected.Get("/export/formats", exportHandler.ListFormats)
+	protected.Post("/export", exportHandler.CreateExport)
+	protected.Get("/export/:jobId", exportHandler.GetExport)
+	protected.Get("/export/:jobId/events", exportHandler.ExportEvents)
+	protected.Get("/export/:jobId/peaks", exportHandler.GetExportPeaks)
 
 	protected.Get("/ping", func(c *fiber.Ctx) error {
 		email := c.Locals("email").(string)
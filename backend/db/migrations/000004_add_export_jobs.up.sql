@@ -0,0 +1,19 @@
+CREATE TABLE export_jobs (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  track_id UUID REFERENCES tracks(id) ON DELETE SET NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'queued',
+  progress DOUBLE PRECISION NOT NULL DEFAULT 0,
+  options JSONB NOT NULL DEFAULT '{}',
+  input_s3_key TEXT,
+  output_s3_key TEXT,
+  filename VARCHAR(255) NOT NULL,
+  error TEXT,
+  created_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW(),
+  started_at TIMESTAMP,
+  finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_export_jobs_user_id ON export_jobs(user_id);
+CREATE INDEX idx_export_jobs_status ON export_jobs(status, created_at);
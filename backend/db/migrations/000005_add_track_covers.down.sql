@@ -0,0 +1 @@
+ALTER TABLE tracks DROP COLUMN IF EXISTS cover_s3_key;
@@ -0,0 +1 @@
+ALTER TABLE tracks ADD COLUMN cover_s3_key TEXT;
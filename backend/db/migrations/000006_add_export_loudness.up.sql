@@ -0,0 +1 @@
+ALTER TABLE export_jobs ADD COLUMN loudness_report JSONB;
@@ -0,0 +1,14 @@
+CREATE TABLE track_revisions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+  author_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  label VARCHAR(100),
+  graph_data JSONB NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_track_revisions_track_id ON track_revisions(track_id, created_at DESC);
+
+-- Seed each existing track with its current graph so history starts from now.
+INSERT INTO track_revisions (track_id, author_id, label, graph_data)
+SELECT id, user_id, 'Initial', graph_data FROM tracks;
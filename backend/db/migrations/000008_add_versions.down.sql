@@ -0,0 +1,2 @@
+ALTER TABLE scenes DROP COLUMN IF EXISTS version;
+ALTER TABLE tracks DROP COLUMN IF EXISTS version;
@@ -0,0 +1,2 @@
+ALTER TABLE tracks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE scenes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
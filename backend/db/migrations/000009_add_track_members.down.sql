@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS track_invites;
+DROP TABLE IF EXISTS track_members;
@@ -0,0 +1,29 @@
+CREATE TABLE track_members (
+  track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL,
+  invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (track_id, user_id)
+);
+
+CREATE INDEX idx_track_members_user_id ON track_members(user_id);
+
+-- Invites with an email are single-use and can only be accepted by that
+-- account; invites without one are shareable links valid until they expire
+-- or are revoked.
+CREATE TABLE track_invites (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL,
+  email VARCHAR(255),
+  token VARCHAR(64) UNIQUE NOT NULL,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMP NOT NULL,
+  accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  accepted_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_track_invites_track_id ON track_invites(track_id);
+CREATE INDEX idx_track_invites_email ON track_invites(LOWER(email)) WHERE email IS NOT NULL;
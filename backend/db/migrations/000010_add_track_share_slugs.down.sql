@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tracks_published_at;
+ALTER TABLE tracks DROP COLUMN IF EXISTS published_at;
+ALTER TABLE tracks DROP COLUMN IF EXISTS share_slug;
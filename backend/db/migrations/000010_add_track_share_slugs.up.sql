@@ -0,0 +1,9 @@
+ALTER TABLE tracks ADD COLUMN share_slug VARCHAR(32) UNIQUE;
+ALTER TABLE tracks ADD COLUMN published_at TIMESTAMP;
+
+UPDATE tracks
+SET share_slug = substr(md5(random()::text || id::text), 1, 10),
+    published_at = updated_at
+WHERE is_public = true;
+
+CREATE INDEX idx_tracks_published_at ON tracks(published_at DESC) WHERE is_public = true;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tracks_forked_from;
+ALTER TABLE tracks DROP COLUMN IF EXISTS forked_from;
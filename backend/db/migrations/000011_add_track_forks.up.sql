@@ -0,0 +1,3 @@
+ALTER TABLE tracks ADD COLUMN forked_from UUID REFERENCES tracks(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_tracks_forked_from ON tracks(forked_from) WHERE forked_from IS NOT NULL;
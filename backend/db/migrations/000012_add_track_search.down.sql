@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_tracks_user_updated;
+DROP INDEX IF EXISTS idx_tracks_graph_data;
+DROP INDEX IF EXISTS idx_tracks_search;
+DROP FUNCTION IF EXISTS track_search_vector(TEXT, TEXT);
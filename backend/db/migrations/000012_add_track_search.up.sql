@@ -0,0 +1,13 @@
+-- The search document is an expression index rather than a stored column so
+-- that it stays out of SELECT * on tracks. Queries must call the same
+-- function for the index to be used.
+CREATE FUNCTION track_search_vector(title TEXT, description TEXT) RETURNS tsvector
+  LANGUAGE sql IMMUTABLE PARALLEL SAFE
+  AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce(description, '')), 'B')
+  $$;
+
+CREATE INDEX idx_tracks_search ON tracks USING GIN (track_search_vector(title, description));
+CREATE INDEX idx_tracks_graph_data ON tracks USING GIN (graph_data jsonb_path_ops);
+CREATE INDEX idx_tracks_user_updated ON tracks(user_id, updated_at DESC, id DESC);
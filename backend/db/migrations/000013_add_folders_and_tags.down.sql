@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS track_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS folder_tracks;
+DROP TABLE IF EXISTS folders;
@@ -0,0 +1,43 @@
+-- Folders and tags belong to a user rather than a track, so collaborators can
+-- organize shared tracks their own way.
+CREATE TABLE folders (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_folders_user_id ON folders(user_id);
+CREATE INDEX idx_folders_parent_id ON folders(parent_id);
+
+-- A track sits in at most one folder per user; tracks without a row here are
+-- at the root.
+CREATE TABLE folder_tracks (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+  folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+  PRIMARY KEY (user_id, track_id)
+);
+
+CREATE INDEX idx_folder_tracks_folder_id ON folder_tracks(folder_id);
+
+CREATE TABLE tags (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(50) NOT NULL,
+  color VARCHAR(7),
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_tags_user_name ON tags(user_id, LOWER(name));
+
+CREATE TABLE track_tags (
+  tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+  created_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (tag_id, track_id)
+);
+
+CREATE INDEX idx_track_tags_track_id ON track_tags(track_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tracks_deleted_at;
+
+ALTER TABLE tracks DROP COLUMN IF EXISTS deleted_at;
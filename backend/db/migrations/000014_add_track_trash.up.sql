@@ -0,0 +1,5 @@
+-- Deleted tracks stay in the trash until restored or purged; deleted_at is
+-- NULL for live tracks.
+ALTER TABLE tracks ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_tracks_deleted_at ON tracks(deleted_at) WHERE deleted_at IS NOT NULL;
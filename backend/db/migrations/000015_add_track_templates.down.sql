@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS template_files;
+DROP TABLE IF EXISTS track_templates;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,35 @@
+-- Admins curate the templates every user sees. There is no UI for granting
+-- it; set the flag directly in the database.
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE track_templates (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  curated BOOLEAN NOT NULL DEFAULT false,
+  name VARCHAR(255) NOT NULL,
+  description TEXT,
+  bpm INTEGER NOT NULL DEFAULT 120,
+  graph_data JSONB NOT NULL,
+  -- Default scenes as [{name, position, state}], created with each track.
+  scenes JSONB NOT NULL DEFAULT '[]',
+  created_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_track_templates_user_id ON track_templates(user_id);
+CREATE INDEX idx_track_templates_curated ON track_templates(curated) WHERE curated;
+
+-- Samples and impulses bundled with a template. The template's graph and
+-- scenes refer to them by id; tracks created from it get their own copies.
+CREATE TABLE template_files (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  template_id UUID NOT NULL REFERENCES track_templates(id) ON DELETE CASCADE,
+  kind VARCHAR(20) NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  file_size BIGINT NOT NULL,
+  s3_key TEXT NOT NULL,
+  mime_type VARCHAR(100),
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_template_files_template_id ON template_files(template_id);
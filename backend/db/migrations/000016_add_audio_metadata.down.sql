@@ -0,0 +1,20 @@
+ALTER TABLE template_files
+  DROP COLUMN IF EXISTS duration,
+  DROP COLUMN IF EXISTS sample_rate,
+  DROP COLUMN IF EXISTS channels,
+  DROP COLUMN IF EXISTS bit_depth,
+  DROP COLUMN IF EXISTS codec;
+
+ALTER TABLE reverb_impulses
+  DROP COLUMN IF EXISTS duration,
+  DROP COLUMN IF EXISTS sample_rate,
+  DROP COLUMN IF EXISTS channels,
+  DROP COLUMN IF EXISTS bit_depth,
+  DROP COLUMN IF EXISTS codec;
+
+ALTER TABLE samples
+  DROP COLUMN IF EXISTS duration,
+  DROP COLUMN IF EXISTS sample_rate,
+  DROP COLUMN IF EXISTS channels,
+  DROP COLUMN IF EXISTS bit_depth,
+  DROP COLUMN IF EXISTS codec;
@@ -0,0 +1,22 @@
+-- Audio metadata read from uploads by ffprobe. Rows uploaded before this
+-- migration have none and leave the columns NULL.
+ALTER TABLE samples
+  ADD COLUMN duration DOUBLE PRECISION,
+  ADD COLUMN sample_rate INTEGER,
+  ADD COLUMN channels INTEGER,
+  ADD COLUMN bit_depth INTEGER,
+  ADD COLUMN codec VARCHAR(32);
+
+ALTER TABLE reverb_impulses
+  ADD COLUMN duration DOUBLE PRECISION,
+  ADD COLUMN sample_rate INTEGER,
+  ADD COLUMN channels INTEGER,
+  ADD COLUMN bit_depth INTEGER,
+  ADD COLUMN codec VARCHAR(32);
+
+ALTER TABLE template_files
+  ADD COLUMN duration DOUBLE PRECISION,
+  ADD COLUMN sample_rate INTEGER,
+  ADD COLUMN channels INTEGER,
+  ADD COLUMN bit_depth INTEGER,
+  ADD COLUMN codec VARCHAR(32);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_samples_transcode_queued;
+
+ALTER TABLE samples
+  DROP COLUMN IF EXISTS transcode_status,
+  DROP COLUMN IF EXISTS transcode_error,
+  DROP COLUMN IF EXISTS transcode_updated_at,
+  DROP COLUMN IF EXISTS playback_s3_key,
+  DROP COLUMN IF EXISTS preview_s3_key;
@@ -0,0 +1,11 @@
+-- Samples are transcoded in the background to a 48kHz float WAV for playback
+-- and an Opus preview, stored next to the original. Existing samples start
+-- out queued, so the worker backfills them.
+ALTER TABLE samples
+  ADD COLUMN transcode_status VARCHAR(20) NOT NULL DEFAULT 'queued',
+  ADD COLUMN transcode_error TEXT,
+  ADD COLUMN transcode_updated_at TIMESTAMP DEFAULT NOW(),
+  ADD COLUMN playback_s3_key TEXT,
+  ADD COLUMN preview_s3_key TEXT;
+
+CREATE INDEX idx_samples_transcode_queued ON samples(created_at) WHERE transcode_status = 'queued';
@@ -0,0 +1,3 @@
+ALTER TABLE export_jobs DROP COLUMN IF EXISTS peaks_s3_key;
+ALTER TABLE reverb_impulses DROP COLUMN IF EXISTS peaks_s3_key;
+ALTER TABLE samples DROP COLUMN IF EXISTS peaks_s3_key;
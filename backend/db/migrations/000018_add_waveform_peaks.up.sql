@@ -0,0 +1,5 @@
+-- Waveform peaks are stored in MinIO as JSON next to the audio they
+-- describe. Files without peaks have them generated on first request.
+ALTER TABLE samples ADD COLUMN peaks_s3_key TEXT;
+ALTER TABLE reverb_impulses ADD COLUMN peaks_s3_key TEXT;
+ALTER TABLE export_jobs ADD COLUMN peaks_s3_key TEXT;
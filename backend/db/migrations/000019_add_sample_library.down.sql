@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_samples_library;
+DROP TABLE IF EXISTS track_samples;
@@ -0,0 +1,12 @@
+-- Samples uploaded without a track (track_id NULL) make up their uploader's
+-- library. A library sample is stored and counted towards storage once and
+-- attached to any number of tracks.
+CREATE TABLE track_samples (
+  track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+  sample_id UUID NOT NULL REFERENCES samples(id) ON DELETE CASCADE,
+  created_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (track_id, sample_id)
+);
+
+CREATE INDEX idx_track_samples_sample_id ON track_samples(sample_id);
+CREATE INDEX idx_samples_library ON samples(user_id, created_at DESC) WHERE track_id IS NULL;
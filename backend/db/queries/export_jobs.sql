@@ -0,0 +1,44 @@
+-- name: CreateExportJob :one
+INSERT INTO export_jobs (
+  user_id, track_id, options, input_s3_key, filename
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetUserExportJob :one
+SELECT * FROM export_jobs
+WHERE id = $1 AND user_id = $2
+LIMIT 1;
+
+-- name: ClaimExportJob :one
+UPDATE export_jobs
+SET status = 'running', started_at = NOW(), updated_at = NOW()
+WHERE id = (
+  SELECT id FROM export_jobs
+  WHERE status = 'queued'
+  ORDER BY created_at ASC
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateExportJobProgress :exec
+UPDATE export_jobs
+SET progress = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: CompleteExportJob :exec
+UPDATE export_jobs
+SET status = 'completed', progress = 1, output_s3_key = $2, loudness_report = $3, peaks_s3_key = $4, updated_at = NOW(), finished_at = NOW()
+WHERE id = $1;
+
+-- name: FailExportJob :exec
+UPDATE export_jobs
+SET status = 'failed', error = $2, updated_at = NOW(), finished_at = NOW()
+WHERE id = $1;
+
+-- name: RequeueStaleExportJobs :exec
+UPDATE export_jobs
+SET status = 'queued', progress = 0, started_at = NULL, updated_at = NOW()
+WHERE status = 'running' AND updated_at < $1;
@@ -0,0 +1,52 @@
+-- name: ListUserFolders :many
+SELECT f.*, (
+  SELECT COUNT(*) FROM folder_tracks ft
+  JOIN tracks t ON t.id = ft.track_id
+  WHERE ft.folder_id = f.id AND t.deleted_at IS NULL
+) AS track_count
+FROM folders f
+WHERE f.user_id = $1
+ORDER BY f.name ASC;
+
+-- name: GetUserFolder :one
+SELECT * FROM folders
+WHERE id = $1 AND user_id = $2
+LIMIT 1;
+
+-- name: CreateFolder :one
+INSERT INTO folders (
+  user_id, parent_id, name
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: UpdateFolder :one
+UPDATE folders
+SET name = $3, parent_id = $4, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteFolder :exec
+DELETE FROM folders
+WHERE id = $1 AND user_id = $2;
+
+-- name: IsFolderInSubtree :one
+-- Reports whether candidate is root or one of its descendants, which would
+-- make moving root under candidate a cycle.
+WITH RECURSIVE subtree AS (
+  SELECT f.id FROM folders f WHERE f.id = sqlc.arg(root)::uuid
+  UNION ALL
+  SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+)
+SELECT EXISTS (SELECT 1 FROM subtree WHERE subtree.id = sqlc.arg(candidate)::uuid)::boolean;
+
+-- name: MoveTracksToFolder :exec
+INSERT INTO folder_tracks (user_id, track_id, folder_id)
+SELECT sqlc.arg(user_id)::uuid, track_id, sqlc.arg(folder_id)::uuid
+FROM unnest(sqlc.arg(track_ids)::uuid[]) AS track_id
+ON CONFLICT (user_id, track_id) DO UPDATE SET folder_id = EXCLUDED.folder_id;
+
+-- name: RemoveTracksFromFolders :exec
+DELETE FROM folder_tracks
+WHERE user_id = sqlc.arg(user_id) AND track_id = ANY(sqlc.arg(track_ids)::uuid[]);
@@ -1,8 +1,10 @@
 -- name: CreateImpulse :one
 INSERT INTO reverb_impulses (
-  user_id, track_id, filename, file_size, s3_key, mime_type
+  user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
 ) VALUES (
-  $1, $2, $3, $4, $5, $6
+  $1, $2, $3, $4, $5, $6,
+  $7, $8, $9, $10, $11
 )
 RETURNING *;
 
@@ -21,6 +23,20 @@ SELECT * FROM reverb_impulses
 WHERE track_id = $1
 ORDER BY created_at DESC;
 
+-- name: SetImpulsePeaks :execrows
+UPDATE reverb_impulses
+SET peaks_s3_key = $2
+WHERE id = $1;
+
 -- name: DeleteImpulse :exec
 DELETE FROM reverb_impulses
-WHERE id = $1 AND user_id = $2;
\ No newline at end of file
+WHERE id = $1;
+-- name: CopyImpulse :one
+INSERT INTO reverb_impulses (
+  id, user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7,
+  $8, $9, $10, $11, $12
+)
+RETURNING *;
@@ -1,8 +1,10 @@
 -- name: CreateSample :one
 INSERT INTO samples (
-  user_id, track_id, filename, file_size, s3_key, mime_type
+  user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
 ) VALUES (
-  $1, $2, $3, $4, $5, $6
+  $1, $2, $3, $4, $5, $6,
+  $7, $8, $9, $10, $11
 )
 RETURNING *;
 
@@ -16,19 +18,28 @@ WHERE id = $1 AND user_id = $2
 LIMIT 1;
 
 -- name: ListTrackSamples :many
+-- Samples uploaded to the track and library samples attached to it.
+SELECT * FROM samples
+WHERE samples.track_id = $1
+  OR id IN (SELECT sample_id FROM track_samples WHERE track_samples.track_id = $1)
+ORDER BY created_at DESC;
+
+-- name: ListTrackUploadedSamples :many
 SELECT * FROM samples
 WHERE track_id = $1
 ORDER BY created_at DESC;
 
 -- name: ListUserSamples :many
+-- The user's library, optionally filtered by a filename pattern.
 SELECT * FROM samples
-WHERE user_id = $1
+WHERE user_id = sqlc.arg(user_id) AND track_id IS NULL
+  AND (sqlc.narg(filename)::text IS NULL OR filename ILIKE sqlc.narg(filename)::text)
 ORDER BY created_at DESC
-LIMIT $2 OFFSET $3;
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
 
 -- name: DeleteSample :exec
 DELETE FROM samples
-WHERE id = $1 AND user_id = $2;
+WHERE id = $1;
 
 -- name: GetUserTotalStorage :one
 SELECT COALESCE(SUM(file_size), 0) as total_size
@@ -37,4 +48,46 @@ WHERE user_id = $1;
 
 -- name: DeleteTrackSamples :exec
 DELETE FROM samples
-WHERE track_id = $1;
\ No newline at end of file
+WHERE track_id = $1;
+-- name: CopySample :one
+INSERT INTO samples (
+  id, user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7,
+  $8, $9, $10, $11, $12
+)
+RETURNING *;
+
+-- name: ClaimSampleTranscode :one
+UPDATE samples
+SET transcode_status = 'running', transcode_updated_at = NOW()
+WHERE id = (
+  SELECT id FROM samples
+  WHERE transcode_status = 'queued'
+  ORDER BY created_at ASC
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteSampleTranscode :execrows
+UPDATE samples
+SET transcode_status = 'completed', transcode_error = NULL, transcode_updated_at = NOW(),
+  playback_s3_key = $2, preview_s3_key = $3, peaks_s3_key = $4
+WHERE id = $1;
+
+-- name: SetSamplePeaks :execrows
+UPDATE samples
+SET peaks_s3_key = $2
+WHERE id = $1;
+
+-- name: FailSampleTranscode :exec
+UPDATE samples
+SET transcode_status = 'failed', transcode_error = $2, transcode_updated_at = NOW()
+WHERE id = $1;
+
+-- name: RequeueStaleSampleTranscodes :exec
+UPDATE samples
+SET transcode_status = 'queued', transcode_updated_at = NOW()
+WHERE transcode_status = 'running' AND transcode_updated_at < $1;
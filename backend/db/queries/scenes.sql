@@ -1,11 +1,11 @@
 -- name: ListScenesByTrack :many
-SELECT id, track_id, name, state_data, position, created_at
+SELECT id, track_id, name, state_data, position, version, created_at
 FROM scenes
 WHERE track_id = $1
 ORDER BY position ASC, created_at ASC;
 
 -- name: GetScene :one
-SELECT id, track_id, name, state_data, position, created_at
+SELECT id, track_id, name, state_data, position, version, created_at
 FROM scenes
 WHERE id = $1
 LIMIT 1;
@@ -13,16 +13,34 @@ LIMIT 1;
 -- name: CreateScene :one
 INSERT INTO scenes (id, track_id, name, state_data, position)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, track_id, name, state_data, position, created_at;
+RETURNING id, track_id, name, state_data, position, version, created_at;
 
 -- name: UpdateScene :one
 UPDATE scenes
-SET name = $2,
-    state_data = $3,
-    position = $4
-WHERE id = $1
-RETURNING id, track_id, name, state_data, position, created_at;
+SET name = sqlc.arg(name),
+    state_data = sqlc.arg(state_data),
+    position = sqlc.arg(position),
+    version = version + 1
+WHERE id = sqlc.arg(id)
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)::int)
+RETURNING id, track_id, name, state_data, position, version, created_at;
 
 -- name: DeleteScene :exec
 DELETE FROM scenes
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: ListSceneStates :many
+-- Pages through every scene with its track's graph, for graph migrations.
+SELECT s.id, s.version, s.state_data, t.graph_data
+FROM scenes s
+JOIN tracks t ON t.id = s.track_id
+WHERE s.id > $1
+ORDER BY s.id ASC
+LIMIT $2;
+
+-- name: MigrateSceneState :execrows
+-- Rewrites state_data in place without bumping the version. Matching on the
+-- version skips scenes edited since they were read.
+UPDATE scenes
+SET state_data = $3
+WHERE id = $1 AND version = $2;
@@ -0,0 +1,49 @@
+-- name: ListUserTags :many
+SELECT t.*, (
+  SELECT COUNT(*) FROM track_tags tt
+  JOIN tracks tr ON tr.id = tt.track_id
+  WHERE tt.tag_id = t.id AND tr.deleted_at IS NULL
+) AS track_count
+FROM tags t
+WHERE t.user_id = $1
+ORDER BY LOWER(t.name) ASC;
+
+-- name: GetUserTag :one
+SELECT * FROM tags
+WHERE id = $1 AND user_id = $2
+LIMIT 1;
+
+-- name: CreateTag :one
+INSERT INTO tags (
+  user_id, name, color
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: UpdateTag :one
+UPDATE tags
+SET name = $3, color = $4
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteTag :exec
+DELETE FROM tags
+WHERE id = $1 AND user_id = $2;
+
+-- name: TagTracks :exec
+INSERT INTO track_tags (tag_id, track_id)
+SELECT sqlc.arg(tag_id)::uuid, track_id
+FROM unnest(sqlc.arg(track_ids)::uuid[]) AS track_id
+ON CONFLICT (tag_id, track_id) DO NOTHING;
+
+-- name: UntagTracks :exec
+DELETE FROM track_tags
+WHERE tag_id = sqlc.arg(tag_id) AND track_id = ANY(sqlc.arg(track_ids)::uuid[]);
+
+-- name: ListTagsForTracks :many
+SELECT tt.track_id, t.id, t.name, t.color
+FROM track_tags tt
+JOIN tags t ON t.id = tt.tag_id
+WHERE t.user_id = sqlc.arg(user_id) AND tt.track_id = ANY(sqlc.arg(track_ids)::uuid[])
+ORDER BY LOWER(t.name) ASC;
@@ -0,0 +1,61 @@
+-- name: ListTemplates :many
+-- Curated templates and the user's own, optionally narrowed to one of them
+-- by scope ('curated' or 'mine').
+SELECT t.id, t.user_id, t.curated, t.name, t.description, t.bpm, t.created_at, t.updated_at,
+  jsonb_array_length(t.scenes)::int AS scene_count,
+  (SELECT COUNT(*) FROM template_files f WHERE f.template_id = t.id) AS file_count,
+  u.display_name AS author_name
+FROM track_templates t
+LEFT JOIN users u ON u.id = t.user_id
+WHERE (t.curated OR t.user_id = sqlc.arg(user_id))
+  AND (sqlc.arg(scope)::text <> 'curated' OR t.curated)
+  AND (sqlc.arg(scope)::text <> 'mine' OR t.user_id = sqlc.arg(user_id))
+ORDER BY t.curated DESC, t.name ASC;
+
+-- name: GetTemplate :one
+SELECT * FROM track_templates
+WHERE id = $1
+LIMIT 1;
+
+-- name: CreateTemplate :one
+INSERT INTO track_templates (
+  user_id, curated, name, description, bpm, graph_data, scenes
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: DeleteTemplate :exec
+DELETE FROM track_templates
+WHERE id = $1;
+
+-- name: CreateTemplateFile :one
+INSERT INTO template_files (
+  id, template_id, kind, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7,
+  $8, $9, $10, $11, $12
+)
+RETURNING *;
+
+-- name: ListTemplateFiles :many
+SELECT * FROM template_files
+WHERE template_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListTemplateGraphs :many
+SELECT id, graph_data, scenes FROM track_templates
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: MigrateTemplateGraph :exec
+UPDATE track_templates
+SET graph_data = $2
+WHERE id = $1;
+
+-- name: MigrateTemplateScenes :exec
+UPDATE track_templates
+SET scenes = $2
+WHERE id = $1;
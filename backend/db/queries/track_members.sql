@@ -0,0 +1,112 @@
+-- name: GetTrackAccess :one
+SELECT sqlc.embed(t), COALESCE(m.role, '')::text AS member_role
+FROM tracks t
+LEFT JOIN track_members m ON m.track_id = t.id AND m.user_id = sqlc.arg(user_id)
+WHERE t.id = sqlc.arg(track_id) AND t.deleted_at IS NULL
+LIMIT 1;
+
+-- name: SearchAccessibleTracks :many
+-- Tracks the user owns or is a member of, filtered and keyset-paginated. The
+-- cursor columns that apply depend on sort; see the public variant in
+-- tracks.sql, which must be kept in step.
+SELECT sqlc.embed(t), COALESCE(m.role, 'owner')::text AS role, ft.folder_id,
+  ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', sqlc.arg(query)::text))::float8 AS rank
+FROM tracks t
+LEFT JOIN track_members m ON m.track_id = t.id AND m.user_id = sqlc.arg(user_id)
+LEFT JOIN folder_tracks ft ON ft.track_id = t.id AND ft.user_id = sqlc.arg(user_id)
+WHERE (t.user_id = sqlc.arg(user_id) OR m.user_id IS NOT NULL) AND t.deleted_at IS NULL
+  AND (sqlc.narg(folder_id)::uuid IS NULL OR ft.folder_id = sqlc.narg(folder_id)::uuid)
+  AND (NOT sqlc.arg(unfiled)::boolean OR ft.folder_id IS NULL)
+  AND NOT EXISTS (
+    SELECT 1 FROM unnest(sqlc.arg(tag_ids)::uuid[]) AS tg(tag_id)
+    WHERE NOT EXISTS (SELECT 1 FROM track_tags tt WHERE tt.track_id = t.id AND tt.tag_id = tg.tag_id)
+  )
+  AND (sqlc.arg(query)::text = '' OR track_search_vector(t.title, t.description) @@ websearch_to_tsquery('english', sqlc.arg(query)::text))
+  AND (sqlc.narg(bpm_min)::int IS NULL OR t.bpm >= sqlc.narg(bpm_min)::int)
+  AND (sqlc.narg(bpm_max)::int IS NULL OR t.bpm <= sqlc.narg(bpm_max)::int)
+  AND (sqlc.narg(created_after)::timestamp IS NULL OR t.created_at >= sqlc.narg(created_after)::timestamp)
+  AND (sqlc.narg(created_before)::timestamp IS NULL OR t.created_at < sqlc.narg(created_before)::timestamp)
+  AND (sqlc.narg(updated_after)::timestamp IS NULL OR t.updated_at >= sqlc.narg(updated_after)::timestamp)
+  AND (sqlc.narg(updated_before)::timestamp IS NULL OR t.updated_at < sqlc.narg(updated_before)::timestamp)
+  AND NOT EXISTS (
+    SELECT 1 FROM unnest(sqlc.arg(block_types)::text[]) AS bt(block_type)
+    WHERE NOT t.graph_data @> jsonb_build_object('nodes', jsonb_build_array(jsonb_build_object('type', bt.block_type)))
+  )
+  AND (sqlc.narg(cursor_id)::uuid IS NULL OR CASE sqlc.arg(sort)::text
+    WHEN 'title' THEN (t.title, t.id) > (sqlc.narg(cursor_title)::text, sqlc.narg(cursor_id)::uuid)
+    WHEN 'relevance' THEN (ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', sqlc.arg(query)::text))::float8, t.id)
+      < (sqlc.narg(cursor_rank)::float8, sqlc.narg(cursor_id)::uuid)
+    WHEN 'created' THEN (t.created_at, t.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid)
+    WHEN 'published' THEN (t.published_at, t.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid)
+    ELSE (t.updated_at, t.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid)
+  END)
+ORDER BY
+  CASE WHEN sqlc.arg(sort)::text = 'title' THEN t.title END ASC,
+  CASE WHEN sqlc.arg(sort)::text = 'title' THEN t.id END ASC,
+  CASE WHEN sqlc.arg(sort)::text = 'relevance' THEN ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', sqlc.arg(query)::text))::float8 END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'created' THEN t.created_at END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'published' THEN t.published_at END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'updated' THEN t.updated_at END DESC,
+  t.id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: ListTrackMembers :many
+SELECT m.track_id, m.user_id, m.role, m.created_at, u.email, u.display_name, u.avatar_url
+FROM track_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.track_id = $1
+ORDER BY m.created_at ASC;
+
+-- name: UpsertTrackMember :one
+INSERT INTO track_members (
+  track_id, user_id, role, invited_by
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (track_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING *;
+
+-- name: UpdateTrackMemberRole :one
+UPDATE track_members
+SET role = $3
+WHERE track_id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: RemoveTrackMember :exec
+DELETE FROM track_members
+WHERE track_id = $1 AND user_id = $2;
+
+-- name: CreateTrackInvite :one
+INSERT INTO track_invites (
+  track_id, role, email, token, created_by, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetTrackInviteByToken :one
+SELECT * FROM track_invites
+WHERE token = $1
+LIMIT 1;
+
+-- name: ListTrackInvites :many
+SELECT * FROM track_invites
+WHERE track_id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: ListPendingInvitesByEmail :many
+SELECT i.*, t.title AS track_title
+FROM track_invites i
+JOIN tracks t ON t.id = i.track_id
+WHERE LOWER(i.email) = LOWER(sqlc.arg(email)) AND i.accepted_at IS NULL AND i.expires_at > NOW()
+  AND t.deleted_at IS NULL
+ORDER BY i.created_at DESC;
+
+-- name: MarkTrackInviteAccepted :exec
+UPDATE track_invites
+SET accepted_by = $2, accepted_at = NOW()
+WHERE id = $1 AND accepted_at IS NULL;
+
+-- name: DeleteTrackInvite :exec
+DELETE FROM track_invites
+WHERE id = $1 AND track_id = $2;
@@ -0,0 +1,47 @@
+-- name: CreateTrackRevision :execrows
+-- Skips the insert when the graph is identical to the latest revision.
+INSERT INTO track_revisions (track_id, author_id, label, graph_data)
+SELECT sqlc.arg(track_id)::uuid, sqlc.narg(author_id)::uuid, sqlc.narg(label)::varchar, sqlc.arg(graph_data)::jsonb
+WHERE NOT EXISTS (
+  SELECT 1 FROM (
+    SELECT r.graph_data FROM track_revisions r
+    WHERE r.track_id = sqlc.arg(track_id)::uuid
+    ORDER BY r.created_at DESC, r.id DESC
+    LIMIT 1
+  ) latest
+  WHERE latest.graph_data = sqlc.arg(graph_data)::jsonb
+);
+
+-- name: PruneTrackRevisions :exec
+-- Deletes all but the newest keep revisions of a track.
+DELETE FROM track_revisions
+WHERE id IN (
+  SELECT r.id FROM track_revisions r
+  WHERE r.track_id = sqlc.arg(track_id)
+  ORDER BY r.created_at DESC, r.id DESC
+  OFFSET sqlc.arg(keep)::int
+);
+
+-- name: ListTrackRevisions :many
+SELECT r.id, r.track_id, r.author_id, r.label, r.created_at, u.display_name AS author_name
+FROM track_revisions r
+LEFT JOIN users u ON u.id = r.author_id
+WHERE r.track_id = $1
+ORDER BY r.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetTrackRevision :one
+SELECT * FROM track_revisions
+WHERE id = $1 AND track_id = $2
+LIMIT 1;
+
+-- name: ListRevisionGraphs :many
+SELECT id, graph_data FROM track_revisions
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: MigrateRevisionGraph :exec
+UPDATE track_revisions
+SET graph_data = $2
+WHERE id = $1;
@@ -0,0 +1,12 @@
+-- name: AttachTrackSample :exec
+INSERT INTO track_samples (track_id, sample_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DetachTrackSample :execrows
+DELETE FROM track_samples
+WHERE track_id = $1 AND sample_id = $2;
+
+-- name: ListSampleTrackIDs :many
+SELECT track_id FROM track_samples
+WHERE sample_id = $1;
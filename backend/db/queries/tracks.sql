@@ -5,13 +5,20 @@ ORDER BY updated_at DESC;
 
 -- name: GetTrack :one
 SELECT * FROM tracks
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND deleted_at IS NULL
+LIMIT 1;
 
 -- name: GetUserTrack :one
 SELECT * FROM tracks
 WHERE id = $1 AND user_id = $2
 LIMIT 1;
 
+-- name: GetTrackForUpdate :one
+SELECT * FROM tracks
+WHERE id = $1 AND deleted_at IS NULL
+LIMIT 1
+FOR UPDATE;
+
 -- name: CreateTrack :one
 INSERT INTO tracks (
   user_id, title, description, bpm, graph_data
@@ -22,33 +29,163 @@ RETURNING *;
 
 -- name: UpdateTrack :one
 UPDATE tracks
-SET title = $2, description = $3, bpm = $4, graph_data = $5, updated_at = NOW()
-WHERE id = $1 AND user_id = $6
+SET title = sqlc.arg(title), description = sqlc.arg(description), bpm = sqlc.arg(bpm),
+    graph_data = sqlc.arg(graph_data), version = version + 1, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)::int)
 RETURNING *;
 
 -- name: UpdateTrackGraph :one
 UPDATE tracks
-SET graph_data = $2, updated_at = NOW()
-WHERE id = $1 AND user_id = $3
+SET graph_data = sqlc.arg(graph_data), version = version + 1, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)::int)
 RETURNING *;
 
--- name: DeleteTrack :exec
-DELETE FROM tracks
-WHERE id = $1 AND user_id = $2;
+-- name: TrashTrack :one
+UPDATE tracks
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
 
--- name: SetTrackPublic :one
+-- name: RestoreTrack :one
 UPDATE tracks
-SET is_public = $2, updated_at = NOW()
-WHERE id = $1 AND user_id = $3
+SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
 RETURNING *;
 
--- name: GetPublicTrack :one
+-- name: GetTrashedTrack :one
 SELECT * FROM tracks
-WHERE id = $1 AND is_public = true
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
 LIMIT 1;
 
--- name: ListPublicTracks :many
+-- name: ListTrashedTracks :many
+SELECT * FROM tracks
+WHERE user_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC;
+
+-- name: ListExpiredTrashedTracks :many
 SELECT * FROM tracks
-WHERE is_public = true
-ORDER BY updated_at DESC
-LIMIT $1 OFFSET $2;
\ No newline at end of file
+WHERE deleted_at IS NOT NULL AND deleted_at < $1
+ORDER BY deleted_at ASC
+LIMIT $2;
+
+-- name: PurgeTrack :execrows
+-- Only trashed tracks can be purged, so a restore that wins a race with the
+-- purge job keeps the track.
+DELETE FROM tracks
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: SetTrackPublic :one
+-- The slug is assigned on first publish and kept afterwards, so a track that
+-- is unpublished and published again keeps its share link.
+UPDATE tracks
+SET is_public = sqlc.arg(is_public),
+    share_slug = COALESCE(share_slug, sqlc.narg(share_slug)),
+    published_at = CASE
+      WHEN sqlc.arg(is_public) AND NOT COALESCE(is_public, false) THEN NOW()
+      ELSE published_at
+    END,
+    version = version + 1, updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetPublicTrackBySlug :one
+SELECT sqlc.embed(t), u.display_name AS author_name, u.avatar_url AS author_avatar_url
+FROM tracks t
+LEFT JOIN users u ON u.id = t.user_id
+WHERE t.share_slug = $1 AND t.is_public = true AND t.deleted_at IS NULL
+LIMIT 1;
+
+-- name: SearchPublicTracks :many
+SELECT sqlc.embed(t), u.display_name AS author_name, u.avatar_url AS author_avatar_url,
+  ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', sqlc.arg(query)::text))::float8 AS rank
+FROM tracks t
+LEFT JOIN users u ON u.id = t.user_id
+WHERE t.is_public = true AND t.deleted_at IS NULL
+  AND (sqlc.arg(query)::text = '' OR track_search_vector(t.title, t.description) @@ websearch_to_tsquery('english', sqlc.arg(query)::text))
+  AND (sqlc.narg(bpm_min)::int IS NULL OR t.bpm >= sqlc.narg(bpm_min)::int)
+  AND (sqlc.narg(bpm_max)::int IS NULL OR t.bpm <= sqlc.narg(bpm_max)::int)
+  AND (sqlc.narg(created_after)::timestamp IS NULL OR t.created_at >= sqlc.narg(created_after)::timestamp)
+  AND (sqlc.narg(created_before)::timestamp IS NULL OR t.created_at < sqlc.narg(created_before)::timestamp)
+  AND (sqlc.narg(updated_after)::timestamp IS NULL OR t.updated_at >= sqlc.narg(updated_after)::timestamp)
+  AND (sqlc.narg(updated_before)::timestamp IS NULL OR t.updated_at < sqlc.narg(updated_before)::timestamp)
+  AND NOT EXISTS (
+    SELECT 1 FROM unnest(sqlc.arg(block_types)::text[]) AS bt(block_type)
+    WHERE NOT t.graph_data @> jsonb_build_object('nodes', jsonb_build_array(jsonb_build_object('type', bt.block_type)))
+  )
+  AND (sqlc.narg(cursor_id)::uuid IS NULL OR CASE sqlc.arg(sort)::text
+    WHEN 'title' THEN (t.title, t.id) > (sqlc.narg(cursor_title)::text, sqlc.narg(cursor_id)::uuid)
+    WHEN 'relevance' THEN (ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', sqlc.arg(query)::text))::float8, t.id)
+      < (sqlc.narg(cursor_rank)::float8, sqlc.narg(cursor_id)::uuid)
+    WHEN 'created' THEN (t.created_at, t.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid)
+    WHEN 'published' THEN (t.published_at, t.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid)
+    ELSE (t.updated_at, t.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.narg(cursor_id)::uuid)
+  END)
+ORDER BY
+  CASE WHEN sqlc.arg(sort)::text = 'title' THEN t.title END ASC,
+  CASE WHEN sqlc.arg(sort)::text = 'title' THEN t.id END ASC,
+  CASE WHEN sqlc.arg(sort)::text = 'relevance' THEN ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', sqlc.arg(query)::text))::float8 END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'created' THEN t.created_at END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'published' THEN t.published_at END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'updated' THEN t.updated_at END DESC,
+  t.id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: SetTrackCover :one
+UPDATE tracks
+SET cover_s3_key = $2, version = version + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateForkedTrack :one
+INSERT INTO tracks (
+  user_id, title, description, bpm, graph_data, forked_from
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: ListTrackForks :many
+SELECT t.id, t.user_id, t.title, t.is_public, t.share_slug, t.created_at, u.display_name AS author_name
+FROM tracks t
+LEFT JOIN users u ON u.id = t.user_id
+LEFT JOIN track_members m ON m.track_id = t.id AND m.user_id = sqlc.arg(user_id)
+WHERE t.forked_from = sqlc.arg(track_id) AND t.deleted_at IS NULL
+  AND (t.is_public = true OR t.user_id = sqlc.arg(user_id) OR m.user_id IS NOT NULL)
+ORDER BY t.created_at ASC;
+
+-- name: ListTrackAncestors :many
+-- Walks forked_from upwards, nearest parent first. Ancestors the user cannot
+-- see are still returned so the depth is right, but flagged as not visible.
+WITH RECURSIVE chain AS (
+  SELECT p.id, p.user_id, p.title, p.is_public, p.share_slug, p.forked_from, p.created_at, p.deleted_at, 1 AS depth
+  FROM tracks c
+  JOIN tracks p ON p.id = c.forked_from
+  WHERE c.id = sqlc.arg(track_id)
+  UNION ALL
+  SELECT p.id, p.user_id, p.title, p.is_public, p.share_slug, p.forked_from, p.created_at, p.deleted_at, a.depth + 1
+  FROM chain a
+  JOIN tracks p ON p.id = a.forked_from
+  WHERE a.depth < 50
+)
+SELECT a.id, a.title, COALESCE(CASE WHEN a.is_public THEN a.share_slug END, '')::text AS share_slug, a.created_at, a.depth, u.display_name AS author_name,
+  (a.deleted_at IS NULL AND (COALESCE(a.is_public, false) OR a.user_id = sqlc.arg(user_id)::uuid OR m.user_id IS NOT NULL))::boolean AS visible
+FROM chain a
+LEFT JOIN users u ON u.id = a.user_id
+LEFT JOIN track_members m ON m.track_id = a.id AND m.user_id = sqlc.arg(user_id)::uuid
+ORDER BY a.depth ASC;
+
+-- name: ListTrackGraphs :many
+-- Pages through every track, trashed ones included, for graph migrations.
+SELECT id, version, graph_data FROM tracks
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: MigrateTrackGraph :execrows
+-- Rewrites graph_data in place without bumping the version. Matching on the
+-- version skips tracks edited since they were read.
+UPDATE tracks
+SET graph_data = $3
+WHERE id = $1 AND version = $2;
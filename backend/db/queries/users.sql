@@ -30,6 +30,19 @@ UPDATE users
 SET storage_used = $2, updated_at = NOW()
 WHERE id = $1;
 
+-- name: ChargeUserStorage :execrows
+-- Adds amount to the user's storage unless that would take them over their
+-- limit, in which case no row is updated.
+UPDATE users
+SET storage_used = COALESCE(storage_used, 0) + sqlc.arg(amount)::bigint, updated_at = NOW()
+WHERE id = sqlc.arg(id)
+  AND COALESCE(storage_used, 0) + sqlc.arg(amount)::bigint <= COALESCE(storage_limit, 0);
+
+-- name: ReleaseUserStorage :exec
+UPDATE users
+SET storage_used = GREATEST(COALESCE(storage_used, 0) - sqlc.arg(amount)::bigint, 0), updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
 -- name: DeleteUser :exec
 DELETE FROM users
 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,198 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: export_jobs.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const claimExportJob = `-- name: ClaimExportJob :one
+UPDATE export_jobs
+SET status = 'running', started_at = NOW(), updated_at = NOW()
+WHERE id = (
+  SELECT id FROM export_jobs
+  WHERE status = 'queued'
+  ORDER BY created_at ASC
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, track_id, status, progress, options, input_s3_key, output_s3_key, filename, error, created_at, updated_at, started_at, finished_at, loudness_report, peaks_s3_key
+`
+
+func (q *Queries) ClaimExportJob(ctx context.Context) (ExportJob, error) {
+	row := q.db.QueryRow(ctx, claimExportJob)
+	var i ExportJob
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TrackID,
+		&i.Status,
+		&i.Progress,
+		&i.Options,
+		&i.InputS3Key,
+		&i.OutputS3Key,
+		&i.Filename,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.LoudnessReport,
+		&i.PeaksS3Key,
+	)
+	return i, err
+}
+
+const completeExportJob = `-- name: CompleteExportJob :exec
+UPDATE export_jobs
+SET status = 'completed', progress = 1, output_s3_key = $2, loudness_report = $3, peaks_s3_key = $4, updated_at = NOW(), finished_at = NOW()
+WHERE id = $1
+`
+
+type CompleteExportJobParams struct {
+	ID             uuid.UUID   `json:"id"`
+	OutputS3Key    pgtype.Text `json:"output_s3_key"`
+	LoudnessReport []byte      `json:"loudness_report"`
+	PeaksS3Key     pgtype.Text `json:"peaks_s3_key"`
+}
+
+func (q *Queries) CompleteExportJob(ctx context.Context, arg CompleteExportJobParams) error {
+	_, err := q.db.Exec(ctx, completeExportJob,
+		arg.ID,
+		arg.OutputS3Key,
+		arg.LoudnessReport,
+		arg.PeaksS3Key,
+	)
+	return err
+}
+
+const createExportJob = `-- name: CreateExportJob :one
+INSERT INTO export_jobs (
+  user_id, track_id, options, input_s3_key, filename
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING id, user_id, track_id, status, progress, options, input_s3_key, output_s3_key, filename, error, created_at, updated_at, started_at, finished_at, loudness_report, peaks_s3_key
+`
+
+type CreateExportJobParams struct {
+	UserID     uuid.UUID   `json:"user_id"`
+	TrackID    pgtype.UUID `json:"track_id"`
+	Options    []byte      `json:"options"`
+	InputS3Key pgtype.Text `json:"input_s3_key"`
+	Filename   string      `json:"filename"`
+}
+
+func (q *Queries) CreateExportJob(ctx context.Context, arg CreateExportJobParams) (ExportJob, error) {
+	row := q.db.QueryRow(ctx, createExportJob,
+		arg.UserID,
+		arg.TrackID,
+		arg.Options,
+		arg.InputS3Key,
+		arg.Filename,
+	)
+	var i ExportJob
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TrackID,
+		&i.Status,
+		&i.Progress,
+		&i.Options,
+		&i.InputS3Key,
+		&i.OutputS3Key,
+		&i.Filename,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.LoudnessReport,
+		&i.PeaksS3Key,
+	)
+	return i, err
+}
+
+const failExportJob = `-- name: FailExportJob :exec
+UPDATE export_jobs
+SET status = 'failed', error = $2, updated_at = NOW(), finished_at = NOW()
+WHERE id = $1
+`
+
+type FailExportJobParams struct {
+	ID    uuid.UUID   `json:"id"`
+	Error pgtype.Text `json:"error"`
+}
+
+func (q *Queries) FailExportJob(ctx context.Context, arg FailExportJobParams) error {
+	_, err := q.db.Exec(ctx, failExportJob, arg.ID, arg.Error)
+	return err
+}
+
+const getUserExportJob = `-- name: GetUserExportJob :one
+SELECT id, user_id, track_id, status, progress, options, input_s3_key, output_s3_key, filename, error, created_at, updated_at, started_at, finished_at, loudness_report, peaks_s3_key FROM export_jobs
+WHERE id = $1 AND user_id = $2
+LIMIT 1
+`
+
+type GetUserExportJobParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetUserExportJob(ctx context.Context, arg GetUserExportJobParams) (ExportJob, error) {
+	row := q.db.QueryRow(ctx, getUserExportJob, arg.ID, arg.UserID)
+	var i ExportJob
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TrackID,
+		&i.Status,
+		&i.Progress,
+		&i.Options,
+		&i.InputS3Key,
+		&i.OutputS3Key,
+		&i.Filename,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.LoudnessReport,
+		&i.PeaksS3Key,
+	)
+	return i, err
+}
+
+const requeueStaleExportJobs = `-- name: RequeueStaleExportJobs :exec
+UPDATE export_jobs
+SET status = 'queued', progress = 0, started_at = NULL, updated_at = NOW()
+WHERE status = 'running' AND updated_at < $1
+`
+
+func (q *Queries) RequeueStaleExportJobs(ctx context.Context, updatedAt pgtype.Timestamp) error {
+	_, err := q.db.Exec(ctx, requeueStaleExportJobs, updatedAt)
+	return err
+}
+
+const updateExportJobProgress = `-- name: UpdateExportJobProgress :exec
+UPDATE export_jobs
+SET progress = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateExportJobProgressParams struct {
+	ID       uuid.UUID `json:"id"`
+	Progress float64   `json:"progress"`
+}
+
+func (q *Queries) UpdateExportJobProgress(ctx context.Context, arg UpdateExportJobProgressParams) error {
+	_, err := q.db.Exec(ctx, updateExportJobProgress, arg.ID, arg.Progress)
+	return err
+}
@@ -0,0 +1,220 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: folders.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createFolder = `-- name: CreateFolder :one
+INSERT INTO folders (
+  user_id, parent_id, name
+) VALUES (
+  $1, $2, $3
+)
+RETURNING id, user_id, parent_id, name, created_at, updated_at
+`
+
+type CreateFolderParams struct {
+	UserID   uuid.UUID   `json:"user_id"`
+	ParentID pgtype.UUID `json:"parent_id"`
+	Name     string      `json:"name"`
+}
+
+func (q *Queries) CreateFolder(ctx context.Context, arg CreateFolderParams) (Folder, error) {
+	row := q.db.QueryRow(ctx, createFolder, arg.UserID, arg.ParentID, arg.Name)
+	var i Folder
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ParentID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteFolder = `-- name: DeleteFolder :exec
+DELETE FROM folders
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteFolderParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteFolder(ctx context.Context, arg DeleteFolderParams) error {
+	_, err := q.db.Exec(ctx, deleteFolder, arg.ID, arg.UserID)
+	return err
+}
+
+const getUserFolder = `-- name: GetUserFolder :one
+SELECT id, user_id, parent_id, name, created_at, updated_at FROM folders
+WHERE id = $1 AND user_id = $2
+LIMIT 1
+`
+
+type GetUserFolderParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetUserFolder(ctx context.Context, arg GetUserFolderParams) (Folder, error) {
+	row := q.db.QueryRow(ctx, getUserFolder, arg.ID, arg.UserID)
+	var i Folder
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ParentID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const isFolderInSubtree = `-- name: IsFolderInSubtree :one
+WITH RECURSIVE subtree AS (
+  SELECT f.id FROM folders f WHERE f.id = $2::uuid
+  UNION ALL
+  SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+)
+SELECT EXISTS (SELECT 1 FROM subtree WHERE subtree.id = $1::uuid)::boolean
+`
+
+type IsFolderInSubtreeParams struct {
+	Candidate uuid.UUID `json:"candidate"`
+	Root      uuid.UUID `json:"root"`
+}
+
+// Reports whether candidate is root or one of its descendants, which would
+// make moving root under candidate a cycle.
+func (q *Queries) IsFolderInSubtree(ctx context.Context, arg IsFolderInSubtreeParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isFolderInSubtree, arg.Candidate, arg.Root)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const listUserFolders = `-- name: ListUserFolders :many
+SELECT f.id, f.user_id, f.parent_id, f.name, f.created_at, f.updated_at, (
+  SELECT COUNT(*) FROM folder_tracks ft
+  JOIN tracks t ON t.id = ft.track_id
+  WHERE ft.folder_id = f.id AND t.deleted_at IS NULL
+) AS track_count
+FROM folders f
+WHERE f.user_id = $1
+ORDER BY f.name ASC
+`
+
+type ListUserFoldersRow struct {
+	ID         uuid.UUID        `json:"id"`
+	UserID     uuid.UUID        `json:"user_id"`
+	ParentID   pgtype.UUID      `json:"parent_id"`
+	Name       string           `json:"name"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	UpdatedAt  pgtype.Timestamp `json:"updated_at"`
+	TrackCount int64            `json:"track_count"`
+}
+
+func (q *Queries) ListUserFolders(ctx context.Context, userID uuid.UUID) ([]ListUserFoldersRow, error) {
+	rows, err := q.db.Query(ctx, listUserFolders, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserFoldersRow
+	for rows.Next() {
+		var i ListUserFoldersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ParentID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TrackCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const moveTracksToFolder = `-- name: MoveTracksToFolder :exec
+INSERT INTO folder_tracks (user_id, track_id, folder_id)
+SELECT $1::uuid, track_id, $2::uuid
+FROM unnest($3::uuid[]) AS track_id
+ON CONFLICT (user_id, track_id) DO UPDATE SET folder_id = EXCLUDED.folder_id
+`
+
+type MoveTracksToFolderParams struct {
+	UserID   uuid.UUID   `json:"user_id"`
+	FolderID uuid.UUID   `json:"folder_id"`
+	TrackIds []uuid.UUID `json:"track_ids"`
+}
+
+func (q *Queries) MoveTracksToFolder(ctx context.Context, arg MoveTracksToFolderParams) error {
+	_, err := q.db.Exec(ctx, moveTracksToFolder, arg.UserID, arg.FolderID, arg.TrackIds)
+	return err
+}
+
+const removeTracksFromFolders = `-- name: RemoveTracksFromFolders :exec
+DELETE FROM folder_tracks
+WHERE user_id = $1 AND track_id = ANY($2::uuid[])
+`
+
+type RemoveTracksFromFoldersParams struct {
+	UserID   uuid.UUID   `json:"user_id"`
+	TrackIds []uuid.UUID `json:"track_ids"`
+}
+
+func (q *Queries) RemoveTracksFromFolders(ctx context.Context, arg RemoveTracksFromFoldersParams) error {
+	_, err := q.db.Exec(ctx, removeTracksFromFolders, arg.UserID, arg.TrackIds)
+	return err
+}
+
+const updateFolder = `-- name: UpdateFolder :one
+UPDATE folders
+SET name = $3, parent_id = $4, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, parent_id, name, created_at, updated_at
+`
+
+type UpdateFolderParams struct {
+	ID       uuid.UUID   `json:"id"`
+	UserID   uuid.UUID   `json:"user_id"`
+	Name     string      `json:"name"`
+	ParentID pgtype.UUID `json:"parent_id"`
+}
+
+func (q *Queries) UpdateFolder(ctx context.Context, arg UpdateFolderParams) (Folder, error) {
+	row := q.db.QueryRow(ctx, updateFolder,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.ParentID,
+	)
+	var i Folder
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ParentID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
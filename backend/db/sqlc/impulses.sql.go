@@ -12,22 +12,90 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const copyImpulse = `-- name: CopyImpulse :one
+INSERT INTO reverb_impulses (
+  id, user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7,
+  $8, $9, $10, $11, $12
+)
+RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, peaks_s3_key
+`
+
+type CopyImpulseParams struct {
+	ID         uuid.UUID     `json:"id"`
+	UserID     pgtype.UUID   `json:"user_id"`
+	TrackID    pgtype.UUID   `json:"track_id"`
+	Filename   string        `json:"filename"`
+	FileSize   int64         `json:"file_size"`
+	S3Key      string        `json:"s3_key"`
+	MimeType   pgtype.Text   `json:"mime_type"`
+	Duration   pgtype.Float8 `json:"duration"`
+	SampleRate pgtype.Int4   `json:"sample_rate"`
+	Channels   pgtype.Int4   `json:"channels"`
+	BitDepth   pgtype.Int4   `json:"bit_depth"`
+	Codec      pgtype.Text   `json:"codec"`
+}
+
+func (q *Queries) CopyImpulse(ctx context.Context, arg CopyImpulseParams) (ReverbImpulse, error) {
+	row := q.db.QueryRow(ctx, copyImpulse,
+		arg.ID,
+		arg.UserID,
+		arg.TrackID,
+		arg.Filename,
+		arg.FileSize,
+		arg.S3Key,
+		arg.MimeType,
+		arg.Duration,
+		arg.SampleRate,
+		arg.Channels,
+		arg.BitDepth,
+		arg.Codec,
+	)
+	var i ReverbImpulse
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TrackID,
+		&i.Filename,
+		&i.FileSize,
+		&i.S3Key,
+		&i.MimeType,
+		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.PeaksS3Key,
+	)
+	return i, err
+}
+
 const createImpulse = `-- name: CreateImpulse :one
 INSERT INTO reverb_impulses (
-  user_id, track_id, filename, file_size, s3_key, mime_type
+  user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
 ) VALUES (
-  $1, $2, $3, $4, $5, $6
+  $1, $2, $3, $4, $5, $6,
+  $7, $8, $9, $10, $11
 )
-RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at
+RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, peaks_s3_key
 `
 
 type CreateImpulseParams struct {
-	UserID   pgtype.UUID `json:"user_id"`
-	TrackID  pgtype.UUID `json:"track_id"`
-	Filename string      `json:"filename"`
-	FileSize int64       `json:"file_size"`
-	S3Key    string      `json:"s3_key"`
-	MimeType pgtype.Text `json:"mime_type"`
+	UserID     pgtype.UUID   `json:"user_id"`
+	TrackID    pgtype.UUID   `json:"track_id"`
+	Filename   string        `json:"filename"`
+	FileSize   int64         `json:"file_size"`
+	S3Key      string        `json:"s3_key"`
+	MimeType   pgtype.Text   `json:"mime_type"`
+	Duration   pgtype.Float8 `json:"duration"`
+	SampleRate pgtype.Int4   `json:"sample_rate"`
+	Channels   pgtype.Int4   `json:"channels"`
+	BitDepth   pgtype.Int4   `json:"bit_depth"`
+	Codec      pgtype.Text   `json:"codec"`
 }
 
 func (q *Queries) CreateImpulse(ctx context.Context, arg CreateImpulseParams) (ReverbImpulse, error) {
@@ -38,6 +106,11 @@ func (q *Queries) CreateImpulse(ctx context.Context, arg CreateImpulseParams) (R
 		arg.FileSize,
 		arg.S3Key,
 		arg.MimeType,
+		arg.Duration,
+		arg.SampleRate,
+		arg.Channels,
+		arg.BitDepth,
+		arg.Codec,
 	)
 	var i ReverbImpulse
 	err := row.Scan(
@@ -49,27 +122,28 @@ func (q *Queries) CreateImpulse(ctx context.Context, arg CreateImpulseParams) (R
 		&i.S3Key,
 		&i.MimeType,
 		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.PeaksS3Key,
 	)
 	return i, err
 }
 
 const deleteImpulse = `-- name: DeleteImpulse :exec
 DELETE FROM reverb_impulses
-WHERE id = $1 AND user_id = $2
+WHERE id = $1
 `
 
-type DeleteImpulseParams struct {
-	ID     uuid.UUID   `json:"id"`
-	UserID pgtype.UUID `json:"user_id"`
-}
-
-func (q *Queries) DeleteImpulse(ctx context.Context, arg DeleteImpulseParams) error {
-	_, err := q.db.Exec(ctx, deleteImpulse, arg.ID, arg.UserID)
+func (q *Queries) DeleteImpulse(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteImpulse, id)
 	return err
 }
 
 const getImpulse = `-- name: GetImpulse :one
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM reverb_impulses
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, peaks_s3_key FROM reverb_impulses
 WHERE id = $1
 LIMIT 1
 `
@@ -86,12 +160,18 @@ func (q *Queries) GetImpulse(ctx context.Context, id uuid.UUID) (ReverbImpulse,
 		&i.S3Key,
 		&i.MimeType,
 		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.PeaksS3Key,
 	)
 	return i, err
 }
 
 const getUserImpulse = `-- name: GetUserImpulse :one
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM reverb_impulses
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, peaks_s3_key FROM reverb_impulses
 WHERE id = $1 AND user_id = $2
 LIMIT 1
 `
@@ -113,12 +193,18 @@ func (q *Queries) GetUserImpulse(ctx context.Context, arg GetUserImpulseParams)
 		&i.S3Key,
 		&i.MimeType,
 		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.PeaksS3Key,
 	)
 	return i, err
 }
 
 const listTrackImpulses = `-- name: ListTrackImpulses :many
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM reverb_impulses
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, peaks_s3_key FROM reverb_impulses
 WHERE track_id = $1
 ORDER BY created_at DESC
 `
@@ -141,6 +227,12 @@ func (q *Queries) ListTrackImpulses(ctx context.Context, trackID pgtype.UUID) ([
 			&i.S3Key,
 			&i.MimeType,
 			&i.CreatedAt,
+			&i.Duration,
+			&i.SampleRate,
+			&i.Channels,
+			&i.BitDepth,
+			&i.Codec,
+			&i.PeaksS3Key,
 		); err != nil {
 			return nil, err
 		}
@@ -151,3 +243,22 @@ func (q *Queries) ListTrackImpulses(ctx context.Context, trackID pgtype.UUID) ([
 	}
 	return items, nil
 }
+
+const setImpulsePeaks = `-- name: SetImpulsePeaks :execrows
+UPDATE reverb_impulses
+SET peaks_s3_key = $2
+WHERE id = $1
+`
+
+type SetImpulsePeaksParams struct {
+	ID         uuid.UUID   `json:"id"`
+	PeaksS3Key pgtype.Text `json:"peaks_s3_key"`
+}
+
+func (q *Queries) SetImpulsePeaks(ctx context.Context, arg SetImpulsePeaksParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setImpulsePeaks, arg.ID, arg.PeaksS3Key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -9,6 +9,40 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ExportJob struct {
+	ID             uuid.UUID        `json:"id"`
+	UserID         uuid.UUID        `json:"user_id"`
+	TrackID        pgtype.UUID      `json:"track_id"`
+	Status         string           `json:"status"`
+	Progress       float64          `json:"progress"`
+	Options        []byte           `json:"options"`
+	InputS3Key     pgtype.Text      `json:"input_s3_key"`
+	OutputS3Key    pgtype.Text      `json:"output_s3_key"`
+	Filename       string           `json:"filename"`
+	Error          pgtype.Text      `json:"error"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	StartedAt      pgtype.Timestamp `json:"started_at"`
+	FinishedAt     pgtype.Timestamp `json:"finished_at"`
+	LoudnessReport []byte           `json:"loudness_report"`
+	PeaksS3Key     pgtype.Text      `json:"peaks_s3_key"`
+}
+
+type Folder struct {
+	ID        uuid.UUID        `json:"id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	ParentID  pgtype.UUID      `json:"parent_id"`
+	Name      string           `json:"name"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+type FolderTrack struct {
+	UserID   uuid.UUID `json:"user_id"`
+	TrackID  uuid.UUID `json:"track_id"`
+	FolderID uuid.UUID `json:"folder_id"`
+}
+
 type RefreshToken struct {
 	ID        uuid.UUID        `json:"id"`
 	UserID    uuid.UUID        `json:"user_id"`
@@ -19,25 +53,42 @@ type RefreshToken struct {
 }
 
 type ReverbImpulse struct {
-	ID        uuid.UUID        `json:"id"`
-	UserID    pgtype.UUID      `json:"user_id"`
-	TrackID   pgtype.UUID      `json:"track_id"`
-	Filename  string           `json:"filename"`
-	FileSize  int64            `json:"file_size"`
-	S3Key     string           `json:"s3_key"`
-	MimeType  pgtype.Text      `json:"mime_type"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
+	ID         uuid.UUID        `json:"id"`
+	UserID     pgtype.UUID      `json:"user_id"`
+	TrackID    pgtype.UUID      `json:"track_id"`
+	Filename   string           `json:"filename"`
+	FileSize   int64            `json:"file_size"`
+	S3Key      string           `json:"s3_key"`
+	MimeType   pgtype.Text      `json:"mime_type"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	Duration   pgtype.Float8    `json:"duration"`
+	SampleRate pgtype.Int4      `json:"sample_rate"`
+	Channels   pgtype.Int4      `json:"channels"`
+	BitDepth   pgtype.Int4      `json:"bit_depth"`
+	Codec      pgtype.Text      `json:"codec"`
+	PeaksS3Key pgtype.Text      `json:"peaks_s3_key"`
 }
 
 type Sample struct {
-	ID        uuid.UUID        `json:"id"`
-	UserID    pgtype.UUID      `json:"user_id"`
-	TrackID   pgtype.UUID      `json:"track_id"`
-	Filename  string           `json:"filename"`
-	FileSize  int64            `json:"file_size"`
-	S3Key     string           `json:"s3_key"`
-	MimeType  pgtype.Text      `json:"mime_type"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
+	ID                 uuid.UUID        `json:"id"`
+	UserID             pgtype.UUID      `json:"user_id"`
+	TrackID            pgtype.UUID      `json:"track_id"`
+	Filename           string           `json:"filename"`
+	FileSize           int64            `json:"file_size"`
+	S3Key              string           `json:"s3_key"`
+	MimeType           pgtype.Text      `json:"mime_type"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	Duration           pgtype.Float8    `json:"duration"`
+	SampleRate         pgtype.Int4      `json:"sample_rate"`
+	Channels           pgtype.Int4      `json:"channels"`
+	BitDepth           pgtype.Int4      `json:"bit_depth"`
+	Codec              pgtype.Text      `json:"codec"`
+	TranscodeStatus    string           `json:"transcode_status"`
+	TranscodeError     pgtype.Text      `json:"transcode_error"`
+	TranscodeUpdatedAt pgtype.Timestamp `json:"transcode_updated_at"`
+	PlaybackS3Key      pgtype.Text      `json:"playback_s3_key"`
+	PreviewS3Key       pgtype.Text      `json:"preview_s3_key"`
+	PeaksS3Key         pgtype.Text      `json:"peaks_s3_key"`
 }
 
 type Scene struct {
@@ -47,6 +98,31 @@ type Scene struct {
 	StateData []byte           `json:"state_data"`
 	Position  pgtype.Int4      `json:"position"`
 	CreatedAt pgtype.Timestamp `json:"created_at"`
+	Version   int32            `json:"version"`
+}
+
+type Tag struct {
+	ID        uuid.UUID        `json:"id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Name      string           `json:"name"`
+	Color     pgtype.Text      `json:"color"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type TemplateFile struct {
+	ID         uuid.UUID        `json:"id"`
+	TemplateID uuid.UUID        `json:"template_id"`
+	Kind       string           `json:"kind"`
+	Filename   string           `json:"filename"`
+	FileSize   int64            `json:"file_size"`
+	S3Key      string           `json:"s3_key"`
+	MimeType   pgtype.Text      `json:"mime_type"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	Duration   pgtype.Float8    `json:"duration"`
+	SampleRate pgtype.Int4      `json:"sample_rate"`
+	Channels   pgtype.Int4      `json:"channels"`
+	BitDepth   pgtype.Int4      `json:"bit_depth"`
+	Codec      pgtype.Text      `json:"codec"`
 }
 
 type Track struct {
@@ -59,6 +135,67 @@ type Track struct {
 	GraphData   []byte           `json:"graph_data"`
 	CreatedAt   pgtype.Timestamp `json:"created_at"`
 	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	CoverS3Key  pgtype.Text      `json:"cover_s3_key"`
+	Version     int32            `json:"version"`
+	ShareSlug   pgtype.Text      `json:"share_slug"`
+	PublishedAt pgtype.Timestamp `json:"published_at"`
+	ForkedFrom  pgtype.UUID      `json:"forked_from"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+}
+
+type TrackInvite struct {
+	ID         uuid.UUID        `json:"id"`
+	TrackID    uuid.UUID        `json:"track_id"`
+	Role       string           `json:"role"`
+	Email      pgtype.Text      `json:"email"`
+	Token      string           `json:"token"`
+	CreatedBy  pgtype.UUID      `json:"created_by"`
+	ExpiresAt  pgtype.Timestamp `json:"expires_at"`
+	AcceptedBy pgtype.UUID      `json:"accepted_by"`
+	AcceptedAt pgtype.Timestamp `json:"accepted_at"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+}
+
+type TrackMember struct {
+	TrackID   uuid.UUID        `json:"track_id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Role      string           `json:"role"`
+	InvitedBy pgtype.UUID      `json:"invited_by"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type TrackRevision struct {
+	ID        uuid.UUID        `json:"id"`
+	TrackID   uuid.UUID        `json:"track_id"`
+	AuthorID  pgtype.UUID      `json:"author_id"`
+	Label     pgtype.Text      `json:"label"`
+	GraphData []byte           `json:"graph_data"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type TrackSample struct {
+	TrackID   uuid.UUID        `json:"track_id"`
+	SampleID  uuid.UUID        `json:"sample_id"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type TrackTag struct {
+	TagID     uuid.UUID        `json:"tag_id"`
+	TrackID   uuid.UUID        `json:"track_id"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type TrackTemplate struct {
+	ID          uuid.UUID        `json:"id"`
+	UserID      uuid.UUID        `json:"user_id"`
+	Curated     bool             `json:"curated"`
+	Name        string           `json:"name"`
+	Description pgtype.Text      `json:"description"`
+	Bpm         int32            `json:"bpm"`
+	GraphData   []byte           `json:"graph_data"`
+	Scenes      []byte           `json:"scenes"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
 }
 
 type User struct {
@@ -72,4 +209,5 @@ type User struct {
 	StorageLimit  pgtype.Int8      `json:"storage_limit"`
 	CreatedAt     pgtype.Timestamp `json:"created_at"`
 	UpdatedAt     pgtype.Timestamp `json:"updated_at"`
+	IsAdmin       bool             `json:"is_admin"`
 }
@@ -12,22 +12,162 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const claimSampleTranscode = `-- name: ClaimSampleTranscode :one
+UPDATE samples
+SET transcode_status = 'running', transcode_updated_at = NOW()
+WHERE id = (
+  SELECT id FROM samples
+  WHERE transcode_status = 'queued'
+  ORDER BY created_at ASC
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key
+`
+
+func (q *Queries) ClaimSampleTranscode(ctx context.Context) (Sample, error) {
+	row := q.db.QueryRow(ctx, claimSampleTranscode)
+	var i Sample
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TrackID,
+		&i.Filename,
+		&i.FileSize,
+		&i.S3Key,
+		&i.MimeType,
+		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.TranscodeStatus,
+		&i.TranscodeError,
+		&i.TranscodeUpdatedAt,
+		&i.PlaybackS3Key,
+		&i.PreviewS3Key,
+		&i.PeaksS3Key,
+	)
+	return i, err
+}
+
+const completeSampleTranscode = `-- name: CompleteSampleTranscode :execrows
+UPDATE samples
+SET transcode_status = 'completed', transcode_error = NULL, transcode_updated_at = NOW(),
+  playback_s3_key = $2, preview_s3_key = $3, peaks_s3_key = $4
+WHERE id = $1
+`
+
+type CompleteSampleTranscodeParams struct {
+	ID            uuid.UUID   `json:"id"`
+	PlaybackS3Key pgtype.Text `json:"playback_s3_key"`
+	PreviewS3Key  pgtype.Text `json:"preview_s3_key"`
+	PeaksS3Key    pgtype.Text `json:"peaks_s3_key"`
+}
+
+func (q *Queries) CompleteSampleTranscode(ctx context.Context, arg CompleteSampleTranscodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, completeSampleTranscode,
+		arg.ID,
+		arg.PlaybackS3Key,
+		arg.PreviewS3Key,
+		arg.PeaksS3Key,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const copySample = `-- name: CopySample :one
+INSERT INTO samples (
+  id, user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7,
+  $8, $9, $10, $11, $12
+)
+RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key
+`
+
+type CopySampleParams struct {
+	ID         uuid.UUID     `json:"id"`
+	UserID     pgtype.UUID   `json:"user_id"`
+	TrackID    pgtype.UUID   `json:"track_id"`
+	Filename   string        `json:"filename"`
+	FileSize   int64         `json:"file_size"`
+	S3Key      string        `json:"s3_key"`
+	MimeType   pgtype.Text   `json:"mime_type"`
+	Duration   pgtype.Float8 `json:"duration"`
+	SampleRate pgtype.Int4   `json:"sample_rate"`
+	Channels   pgtype.Int4   `json:"channels"`
+	BitDepth   pgtype.Int4   `json:"bit_depth"`
+	Codec      pgtype.Text   `json:"codec"`
+}
+
+func (q *Queries) CopySample(ctx context.Context, arg CopySampleParams) (Sample, error) {
+	row := q.db.QueryRow(ctx, copySample,
+		arg.ID,
+		arg.UserID,
+		arg.TrackID,
+		arg.Filename,
+		arg.FileSize,
+		arg.S3Key,
+		arg.MimeType,
+		arg.Duration,
+		arg.SampleRate,
+		arg.Channels,
+		arg.BitDepth,
+		arg.Codec,
+	)
+	var i Sample
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TrackID,
+		&i.Filename,
+		&i.FileSize,
+		&i.S3Key,
+		&i.MimeType,
+		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.TranscodeStatus,
+		&i.TranscodeError,
+		&i.TranscodeUpdatedAt,
+		&i.PlaybackS3Key,
+		&i.PreviewS3Key,
+		&i.PeaksS3Key,
+	)
+	return i, err
+}
+
 const createSample = `-- name: CreateSample :one
 INSERT INTO samples (
-  user_id, track_id, filename, file_size, s3_key, mime_type
+  user_id, track_id, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
 ) VALUES (
-  $1, $2, $3, $4, $5, $6
+  $1, $2, $3, $4, $5, $6,
+  $7, $8, $9, $10, $11
 )
-RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at
+RETURNING id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key
 `
 
 type CreateSampleParams struct {
-	UserID   pgtype.UUID `json:"user_id"`
-	TrackID  pgtype.UUID `json:"track_id"`
-	Filename string      `json:"filename"`
-	FileSize int64       `json:"file_size"`
-	S3Key    string      `json:"s3_key"`
-	MimeType pgtype.Text `json:"mime_type"`
+	UserID     pgtype.UUID   `json:"user_id"`
+	TrackID    pgtype.UUID   `json:"track_id"`
+	Filename   string        `json:"filename"`
+	FileSize   int64         `json:"file_size"`
+	S3Key      string        `json:"s3_key"`
+	MimeType   pgtype.Text   `json:"mime_type"`
+	Duration   pgtype.Float8 `json:"duration"`
+	SampleRate pgtype.Int4   `json:"sample_rate"`
+	Channels   pgtype.Int4   `json:"channels"`
+	BitDepth   pgtype.Int4   `json:"bit_depth"`
+	Codec      pgtype.Text   `json:"codec"`
 }
 
 func (q *Queries) CreateSample(ctx context.Context, arg CreateSampleParams) (Sample, error) {
@@ -38,6 +178,11 @@ func (q *Queries) CreateSample(ctx context.Context, arg CreateSampleParams) (Sam
 		arg.FileSize,
 		arg.S3Key,
 		arg.MimeType,
+		arg.Duration,
+		arg.SampleRate,
+		arg.Channels,
+		arg.BitDepth,
+		arg.Codec,
 	)
 	var i Sample
 	err := row.Scan(
@@ -49,22 +194,28 @@ func (q *Queries) CreateSample(ctx context.Context, arg CreateSampleParams) (Sam
 		&i.S3Key,
 		&i.MimeType,
 		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.TranscodeStatus,
+		&i.TranscodeError,
+		&i.TranscodeUpdatedAt,
+		&i.PlaybackS3Key,
+		&i.PreviewS3Key,
+		&i.PeaksS3Key,
 	)
 	return i, err
 }
 
 const deleteSample = `-- name: DeleteSample :exec
 DELETE FROM samples
-WHERE id = $1 AND user_id = $2
+WHERE id = $1
 `
 
-type DeleteSampleParams struct {
-	ID     uuid.UUID   `json:"id"`
-	UserID pgtype.UUID `json:"user_id"`
-}
-
-func (q *Queries) DeleteSample(ctx context.Context, arg DeleteSampleParams) error {
-	_, err := q.db.Exec(ctx, deleteSample, arg.ID, arg.UserID)
+func (q *Queries) DeleteSample(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteSample, id)
 	return err
 }
 
@@ -78,8 +229,24 @@ func (q *Queries) DeleteTrackSamples(ctx context.Context, trackID pgtype.UUID) e
 	return err
 }
 
+const failSampleTranscode = `-- name: FailSampleTranscode :exec
+UPDATE samples
+SET transcode_status = 'failed', transcode_error = $2, transcode_updated_at = NOW()
+WHERE id = $1
+`
+
+type FailSampleTranscodeParams struct {
+	ID             uuid.UUID   `json:"id"`
+	TranscodeError pgtype.Text `json:"transcode_error"`
+}
+
+func (q *Queries) FailSampleTranscode(ctx context.Context, arg FailSampleTranscodeParams) error {
+	_, err := q.db.Exec(ctx, failSampleTranscode, arg.ID, arg.TranscodeError)
+	return err
+}
+
 const getSample = `-- name: GetSample :one
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM samples
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key FROM samples
 WHERE id = $1 LIMIT 1
 `
 
@@ -95,12 +262,23 @@ func (q *Queries) GetSample(ctx context.Context, id uuid.UUID) (Sample, error) {
 		&i.S3Key,
 		&i.MimeType,
 		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.TranscodeStatus,
+		&i.TranscodeError,
+		&i.TranscodeUpdatedAt,
+		&i.PlaybackS3Key,
+		&i.PreviewS3Key,
+		&i.PeaksS3Key,
 	)
 	return i, err
 }
 
 const getUserSample = `-- name: GetUserSample :one
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM samples
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key FROM samples
 WHERE id = $1 AND user_id = $2
 LIMIT 1
 `
@@ -122,6 +300,17 @@ func (q *Queries) GetUserSample(ctx context.Context, arg GetUserSampleParams) (S
 		&i.S3Key,
 		&i.MimeType,
 		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+		&i.TranscodeStatus,
+		&i.TranscodeError,
+		&i.TranscodeUpdatedAt,
+		&i.PlaybackS3Key,
+		&i.PreviewS3Key,
+		&i.PeaksS3Key,
 	)
 	return i, err
 }
@@ -140,11 +329,13 @@ func (q *Queries) GetUserTotalStorage(ctx context.Context, userID pgtype.UUID) (
 }
 
 const listTrackSamples = `-- name: ListTrackSamples :many
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM samples
-WHERE track_id = $1
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key FROM samples
+WHERE samples.track_id = $1
+  OR id IN (SELECT sample_id FROM track_samples WHERE track_samples.track_id = $1)
 ORDER BY created_at DESC
 `
 
+// Samples uploaded to the track and library samples attached to it.
 func (q *Queries) ListTrackSamples(ctx context.Context, trackID pgtype.UUID) ([]Sample, error) {
 	rows, err := q.db.Query(ctx, listTrackSamples, trackID)
 	if err != nil {
@@ -163,6 +354,63 @@ func (q *Queries) ListTrackSamples(ctx context.Context, trackID pgtype.UUID) ([]
 			&i.S3Key,
 			&i.MimeType,
 			&i.CreatedAt,
+			&i.Duration,
+			&i.SampleRate,
+			&i.Channels,
+			&i.BitDepth,
+			&i.Codec,
+			&i.TranscodeStatus,
+			&i.TranscodeError,
+			&i.TranscodeUpdatedAt,
+			&i.PlaybackS3Key,
+			&i.PreviewS3Key,
+			&i.PeaksS3Key,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackUploadedSamples = `-- name: ListTrackUploadedSamples :many
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key FROM samples
+WHERE track_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListTrackUploadedSamples(ctx context.Context, trackID pgtype.UUID) ([]Sample, error) {
+	rows, err := q.db.Query(ctx, listTrackUploadedSamples, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Sample
+	for rows.Next() {
+		var i Sample
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.TrackID,
+			&i.Filename,
+			&i.FileSize,
+			&i.S3Key,
+			&i.MimeType,
+			&i.CreatedAt,
+			&i.Duration,
+			&i.SampleRate,
+			&i.Channels,
+			&i.BitDepth,
+			&i.Codec,
+			&i.TranscodeStatus,
+			&i.TranscodeError,
+			&i.TranscodeUpdatedAt,
+			&i.PlaybackS3Key,
+			&i.PreviewS3Key,
+			&i.PeaksS3Key,
 		); err != nil {
 			return nil, err
 		}
@@ -175,20 +423,28 @@ func (q *Queries) ListTrackSamples(ctx context.Context, trackID pgtype.UUID) ([]
 }
 
 const listUserSamples = `-- name: ListUserSamples :many
-SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at FROM samples
-WHERE user_id = $1
+SELECT id, user_id, track_id, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec, transcode_status, transcode_error, transcode_updated_at, playback_s3_key, preview_s3_key, peaks_s3_key FROM samples
+WHERE user_id = $1 AND track_id IS NULL
+  AND ($2::text IS NULL OR filename ILIKE $2::text)
 ORDER BY created_at DESC
-LIMIT $2 OFFSET $3
+LIMIT $4 OFFSET $3
 `
 
 type ListUserSamplesParams struct {
-	UserID pgtype.UUID `json:"user_id"`
-	Limit  int32       `json:"limit"`
-	Offset int32       `json:"offset"`
+	UserID    pgtype.UUID `json:"user_id"`
+	Filename  pgtype.Text `json:"filename"`
+	RowOffset int32       `json:"row_offset"`
+	RowLimit  int32       `json:"row_limit"`
 }
 
+// The user's library, optionally filtered by a filename pattern.
 func (q *Queries) ListUserSamples(ctx context.Context, arg ListUserSamplesParams) ([]Sample, error) {
-	rows, err := q.db.Query(ctx, listUserSamples, arg.UserID, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listUserSamples,
+		arg.UserID,
+		arg.Filename,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -205,6 +461,17 @@ func (q *Queries) ListUserSamples(ctx context.Context, arg ListUserSamplesParams
 			&i.S3Key,
 			&i.MimeType,
 			&i.CreatedAt,
+			&i.Duration,
+			&i.SampleRate,
+			&i.Channels,
+			&i.BitDepth,
+			&i.Codec,
+			&i.TranscodeStatus,
+			&i.TranscodeError,
+			&i.TranscodeUpdatedAt,
+			&i.PlaybackS3Key,
+			&i.PreviewS3Key,
+			&i.PeaksS3Key,
 		); err != nil {
 			return nil, err
 		}
@@ -215,3 +482,33 @@ func (q *Queries) ListUserSamples(ctx context.Context, arg ListUserSamplesParams
 	}
 	return items, nil
 }
+
+const requeueStaleSampleTranscodes = `-- name: RequeueStaleSampleTranscodes :exec
+UPDATE samples
+SET transcode_status = 'queued', transcode_updated_at = NOW()
+WHERE transcode_status = 'running' AND transcode_updated_at < $1
+`
+
+func (q *Queries) RequeueStaleSampleTranscodes(ctx context.Context, transcodeUpdatedAt pgtype.Timestamp) error {
+	_, err := q.db.Exec(ctx, requeueStaleSampleTranscodes, transcodeUpdatedAt)
+	return err
+}
+
+const setSamplePeaks = `-- name: SetSamplePeaks :execrows
+UPDATE samples
+SET peaks_s3_key = $2
+WHERE id = $1
+`
+
+type SetSamplePeaksParams struct {
+	ID         uuid.UUID   `json:"id"`
+	PeaksS3Key pgtype.Text `json:"peaks_s3_key"`
+}
+
+func (q *Queries) SetSamplePeaks(ctx context.Context, arg SetSamplePeaksParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setSamplePeaks, arg.ID, arg.PeaksS3Key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
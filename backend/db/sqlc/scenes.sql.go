@@ -15,7 +15,7 @@ import (
 const createScene = `-- name: CreateScene :one
 INSERT INTO scenes (id, track_id, name, state_data, position)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, track_id, name, state_data, position, created_at
+RETURNING id, track_id, name, state_data, position, version, created_at
 `
 
 type CreateSceneParams struct {
@@ -26,7 +26,17 @@ type CreateSceneParams struct {
 	Position  pgtype.Int4 `json:"position"`
 }
 
-func (q *Queries) CreateScene(ctx context.Context, arg CreateSceneParams) (Scene, error) {
+type CreateSceneRow struct {
+	ID        uuid.UUID        `json:"id"`
+	TrackID   pgtype.UUID      `json:"track_id"`
+	Name      string           `json:"name"`
+	StateData []byte           `json:"state_data"`
+	Position  pgtype.Int4      `json:"position"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) CreateScene(ctx context.Context, arg CreateSceneParams) (CreateSceneRow, error) {
 	row := q.db.QueryRow(ctx, createScene,
 		arg.ID,
 		arg.TrackID,
@@ -34,13 +44,14 @@ func (q *Queries) CreateScene(ctx context.Context, arg CreateSceneParams) (Scene
 		arg.StateData,
 		arg.Position,
 	)
-	var i Scene
+	var i CreateSceneRow
 	err := row.Scan(
 		&i.ID,
 		&i.TrackID,
 		&i.Name,
 		&i.StateData,
 		&i.Position,
+		&i.Version,
 		&i.CreatedAt,
 	)
 	return i, err
@@ -57,48 +68,117 @@ func (q *Queries) DeleteScene(ctx context.Context, id uuid.UUID) error {
 }
 
 const getScene = `-- name: GetScene :one
-SELECT id, track_id, name, state_data, position, created_at
+SELECT id, track_id, name, state_data, position, version, created_at
 FROM scenes
 WHERE id = $1
 LIMIT 1
 `
 
-func (q *Queries) GetScene(ctx context.Context, id uuid.UUID) (Scene, error) {
+type GetSceneRow struct {
+	ID        uuid.UUID        `json:"id"`
+	TrackID   pgtype.UUID      `json:"track_id"`
+	Name      string           `json:"name"`
+	StateData []byte           `json:"state_data"`
+	Position  pgtype.Int4      `json:"position"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) GetScene(ctx context.Context, id uuid.UUID) (GetSceneRow, error) {
 	row := q.db.QueryRow(ctx, getScene, id)
-	var i Scene
+	var i GetSceneRow
 	err := row.Scan(
 		&i.ID,
 		&i.TrackID,
 		&i.Name,
 		&i.StateData,
 		&i.Position,
+		&i.Version,
 		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const listSceneStates = `-- name: ListSceneStates :many
+SELECT s.id, s.version, s.state_data, t.graph_data
+FROM scenes s
+JOIN tracks t ON t.id = s.track_id
+WHERE s.id > $1
+ORDER BY s.id ASC
+LIMIT $2
+`
+
+type ListSceneStatesParams struct {
+	ID    uuid.UUID `json:"id"`
+	Limit int32     `json:"limit"`
+}
+
+type ListSceneStatesRow struct {
+	ID        uuid.UUID `json:"id"`
+	Version   int32     `json:"version"`
+	StateData []byte    `json:"state_data"`
+	GraphData []byte    `json:"graph_data"`
+}
+
+// Pages through every scene with its track's graph, for graph migrations.
+func (q *Queries) ListSceneStates(ctx context.Context, arg ListSceneStatesParams) ([]ListSceneStatesRow, error) {
+	rows, err := q.db.Query(ctx, listSceneStates, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSceneStatesRow
+	for rows.Next() {
+		var i ListSceneStatesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Version,
+			&i.StateData,
+			&i.GraphData,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listScenesByTrack = `-- name: ListScenesByTrack :many
-SELECT id, track_id, name, state_data, position, created_at
+SELECT id, track_id, name, state_data, position, version, created_at
 FROM scenes
 WHERE track_id = $1
 ORDER BY position ASC, created_at ASC
 `
 
-func (q *Queries) ListScenesByTrack(ctx context.Context, trackID pgtype.UUID) ([]Scene, error) {
+type ListScenesByTrackRow struct {
+	ID        uuid.UUID        `json:"id"`
+	TrackID   pgtype.UUID      `json:"track_id"`
+	Name      string           `json:"name"`
+	StateData []byte           `json:"state_data"`
+	Position  pgtype.Int4      `json:"position"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) ListScenesByTrack(ctx context.Context, trackID pgtype.UUID) ([]ListScenesByTrackRow, error) {
 	rows, err := q.db.Query(ctx, listScenesByTrack, trackID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Scene
+	var items []ListScenesByTrackRow
 	for rows.Next() {
-		var i Scene
+		var i ListScenesByTrackRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.TrackID,
 			&i.Name,
 			&i.StateData,
 			&i.Position,
+			&i.Version,
 			&i.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -111,36 +191,73 @@ func (q *Queries) ListScenesByTrack(ctx context.Context, trackID pgtype.UUID) ([
 	return items, nil
 }
 
+const migrateSceneState = `-- name: MigrateSceneState :execrows
+UPDATE scenes
+SET state_data = $3
+WHERE id = $1 AND version = $2
+`
+
+type MigrateSceneStateParams struct {
+	ID        uuid.UUID `json:"id"`
+	Version   int32     `json:"version"`
+	StateData []byte    `json:"state_data"`
+}
+
+// Rewrites state_data in place without bumping the version. Matching on the
+// version skips scenes edited since they were read.
+func (q *Queries) MigrateSceneState(ctx context.Context, arg MigrateSceneStateParams) (int64, error) {
+	result, err := q.db.Exec(ctx, migrateSceneState, arg.ID, arg.Version, arg.StateData)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateScene = `-- name: UpdateScene :one
 UPDATE scenes
-SET name = $2,
-    state_data = $3,
-    position = $4
-WHERE id = $1
-RETURNING id, track_id, name, state_data, position, created_at
+SET name = $1,
+    state_data = $2,
+    position = $3,
+    version = version + 1
+WHERE id = $4
+  AND ($5::int IS NULL OR version = $5::int)
+RETURNING id, track_id, name, state_data, position, version, created_at
 `
 
 type UpdateSceneParams struct {
-	ID        uuid.UUID   `json:"id"`
-	Name      string      `json:"name"`
-	StateData []byte      `json:"state_data"`
-	Position  pgtype.Int4 `json:"position"`
+	Name            string      `json:"name"`
+	StateData       []byte      `json:"state_data"`
+	Position        pgtype.Int4 `json:"position"`
+	ID              uuid.UUID   `json:"id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
+}
+
+type UpdateSceneRow struct {
+	ID        uuid.UUID        `json:"id"`
+	TrackID   pgtype.UUID      `json:"track_id"`
+	Name      string           `json:"name"`
+	StateData []byte           `json:"state_data"`
+	Position  pgtype.Int4      `json:"position"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
-func (q *Queries) UpdateScene(ctx context.Context, arg UpdateSceneParams) (Scene, error) {
+func (q *Queries) UpdateScene(ctx context.Context, arg UpdateSceneParams) (UpdateSceneRow, error) {
 	row := q.db.QueryRow(ctx, updateScene,
-		arg.ID,
 		arg.Name,
 		arg.StateData,
 		arg.Position,
+		arg.ID,
+		arg.ExpectedVersion,
 	)
-	var i Scene
+	var i UpdateSceneRow
 	err := row.Scan(
 		&i.ID,
 		&i.TrackID,
 		&i.Name,
 		&i.StateData,
 		&i.Position,
+		&i.Version,
 		&i.CreatedAt,
 	)
 	return i, err
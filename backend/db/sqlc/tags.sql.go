@@ -0,0 +1,236 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: tags.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createTag = `-- name: CreateTag :one
+INSERT INTO tags (
+  user_id, name, color
+) VALUES (
+  $1, $2, $3
+)
+RETURNING id, user_id, name, color, created_at
+`
+
+type CreateTagParams struct {
+	UserID uuid.UUID   `json:"user_id"`
+	Name   string      `json:"name"`
+	Color  pgtype.Text `json:"color"`
+}
+
+func (q *Queries) CreateTag(ctx context.Context, arg CreateTagParams) (Tag, error) {
+	row := q.db.QueryRow(ctx, createTag, arg.UserID, arg.Name, arg.Color)
+	var i Tag
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Color,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteTag = `-- name: DeleteTag :exec
+DELETE FROM tags
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteTagParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteTag(ctx context.Context, arg DeleteTagParams) error {
+	_, err := q.db.Exec(ctx, deleteTag, arg.ID, arg.UserID)
+	return err
+}
+
+const getUserTag = `-- name: GetUserTag :one
+SELECT id, user_id, name, color, created_at FROM tags
+WHERE id = $1 AND user_id = $2
+LIMIT 1
+`
+
+type GetUserTagParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetUserTag(ctx context.Context, arg GetUserTagParams) (Tag, error) {
+	row := q.db.QueryRow(ctx, getUserTag, arg.ID, arg.UserID)
+	var i Tag
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Color,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listTagsForTracks = `-- name: ListTagsForTracks :many
+SELECT tt.track_id, t.id, t.name, t.color
+FROM track_tags tt
+JOIN tags t ON t.id = tt.tag_id
+WHERE t.user_id = $1 AND tt.track_id = ANY($2::uuid[])
+ORDER BY LOWER(t.name) ASC
+`
+
+type ListTagsForTracksParams struct {
+	UserID   uuid.UUID   `json:"user_id"`
+	TrackIds []uuid.UUID `json:"track_ids"`
+}
+
+type ListTagsForTracksRow struct {
+	TrackID uuid.UUID   `json:"track_id"`
+	ID      uuid.UUID   `json:"id"`
+	Name    string      `json:"name"`
+	Color   pgtype.Text `json:"color"`
+}
+
+func (q *Queries) ListTagsForTracks(ctx context.Context, arg ListTagsForTracksParams) ([]ListTagsForTracksRow, error) {
+	rows, err := q.db.Query(ctx, listTagsForTracks, arg.UserID, arg.TrackIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTagsForTracksRow
+	for rows.Next() {
+		var i ListTagsForTracksRow
+		if err := rows.Scan(
+			&i.TrackID,
+			&i.ID,
+			&i.Name,
+			&i.Color,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserTags = `-- name: ListUserTags :many
+SELECT t.id, t.user_id, t.name, t.color, t.created_at, (
+  SELECT COUNT(*) FROM track_tags tt
+  JOIN tracks tr ON tr.id = tt.track_id
+  WHERE tt.tag_id = t.id AND tr.deleted_at IS NULL
+) AS track_count
+FROM tags t
+WHERE t.user_id = $1
+ORDER BY LOWER(t.name) ASC
+`
+
+type ListUserTagsRow struct {
+	ID         uuid.UUID        `json:"id"`
+	UserID     uuid.UUID        `json:"user_id"`
+	Name       string           `json:"name"`
+	Color      pgtype.Text      `json:"color"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	TrackCount int64            `json:"track_count"`
+}
+
+func (q *Queries) ListUserTags(ctx context.Context, userID uuid.UUID) ([]ListUserTagsRow, error) {
+	rows, err := q.db.Query(ctx, listUserTags, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserTagsRow
+	for rows.Next() {
+		var i ListUserTagsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.Color,
+			&i.CreatedAt,
+			&i.TrackCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tagTracks = `-- name: TagTracks :exec
+INSERT INTO track_tags (tag_id, track_id)
+SELECT $1::uuid, track_id
+FROM unnest($2::uuid[]) AS track_id
+ON CONFLICT (tag_id, track_id) DO NOTHING
+`
+
+type TagTracksParams struct {
+	TagID    uuid.UUID   `json:"tag_id"`
+	TrackIds []uuid.UUID `json:"track_ids"`
+}
+
+func (q *Queries) TagTracks(ctx context.Context, arg TagTracksParams) error {
+	_, err := q.db.Exec(ctx, tagTracks, arg.TagID, arg.TrackIds)
+	return err
+}
+
+const untagTracks = `-- name: UntagTracks :exec
+DELETE FROM track_tags
+WHERE tag_id = $1 AND track_id = ANY($2::uuid[])
+`
+
+type UntagTracksParams struct {
+	TagID    uuid.UUID   `json:"tag_id"`
+	TrackIds []uuid.UUID `json:"track_ids"`
+}
+
+func (q *Queries) UntagTracks(ctx context.Context, arg UntagTracksParams) error {
+	_, err := q.db.Exec(ctx, untagTracks, arg.TagID, arg.TrackIds)
+	return err
+}
+
+const updateTag = `-- name: UpdateTag :one
+UPDATE tags
+SET name = $3, color = $4
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, name, color, created_at
+`
+
+type UpdateTagParams struct {
+	ID     uuid.UUID   `json:"id"`
+	UserID uuid.UUID   `json:"user_id"`
+	Name   string      `json:"name"`
+	Color  pgtype.Text `json:"color"`
+}
+
+func (q *Queries) UpdateTag(ctx context.Context, arg UpdateTagParams) (Tag, error) {
+	row := q.db.QueryRow(ctx, updateTag,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.Color,
+	)
+	var i Tag
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Color,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,328 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: templates.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createTemplate = `-- name: CreateTemplate :one
+INSERT INTO track_templates (
+  user_id, curated, name, description, bpm, graph_data, scenes
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING id, user_id, curated, name, description, bpm, graph_data, scenes, created_at, updated_at
+`
+
+type CreateTemplateParams struct {
+	UserID      uuid.UUID   `json:"user_id"`
+	Curated     bool        `json:"curated"`
+	Name        string      `json:"name"`
+	Description pgtype.Text `json:"description"`
+	Bpm         int32       `json:"bpm"`
+	GraphData   []byte      `json:"graph_data"`
+	Scenes      []byte      `json:"scenes"`
+}
+
+func (q *Queries) CreateTemplate(ctx context.Context, arg CreateTemplateParams) (TrackTemplate, error) {
+	row := q.db.QueryRow(ctx, createTemplate,
+		arg.UserID,
+		arg.Curated,
+		arg.Name,
+		arg.Description,
+		arg.Bpm,
+		arg.GraphData,
+		arg.Scenes,
+	)
+	var i TrackTemplate
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Curated,
+		&i.Name,
+		&i.Description,
+		&i.Bpm,
+		&i.GraphData,
+		&i.Scenes,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createTemplateFile = `-- name: CreateTemplateFile :one
+INSERT INTO template_files (
+  id, template_id, kind, filename, file_size, s3_key, mime_type,
+  duration, sample_rate, channels, bit_depth, codec
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7,
+  $8, $9, $10, $11, $12
+)
+RETURNING id, template_id, kind, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec
+`
+
+type CreateTemplateFileParams struct {
+	ID         uuid.UUID     `json:"id"`
+	TemplateID uuid.UUID     `json:"template_id"`
+	Kind       string        `json:"kind"`
+	Filename   string        `json:"filename"`
+	FileSize   int64         `json:"file_size"`
+	S3Key      string        `json:"s3_key"`
+	MimeType   pgtype.Text   `json:"mime_type"`
+	Duration   pgtype.Float8 `json:"duration"`
+	SampleRate pgtype.Int4   `json:"sample_rate"`
+	Channels   pgtype.Int4   `json:"channels"`
+	BitDepth   pgtype.Int4   `json:"bit_depth"`
+	Codec      pgtype.Text   `json:"codec"`
+}
+
+func (q *Queries) CreateTemplateFile(ctx context.Context, arg CreateTemplateFileParams) (TemplateFile, error) {
+	row := q.db.QueryRow(ctx, createTemplateFile,
+		arg.ID,
+		arg.TemplateID,
+		arg.Kind,
+		arg.Filename,
+		arg.FileSize,
+		arg.S3Key,
+		arg.MimeType,
+		arg.Duration,
+		arg.SampleRate,
+		arg.Channels,
+		arg.BitDepth,
+		arg.Codec,
+	)
+	var i TemplateFile
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.Kind,
+		&i.Filename,
+		&i.FileSize,
+		&i.S3Key,
+		&i.MimeType,
+		&i.CreatedAt,
+		&i.Duration,
+		&i.SampleRate,
+		&i.Channels,
+		&i.BitDepth,
+		&i.Codec,
+	)
+	return i, err
+}
+
+const deleteTemplate = `-- name: DeleteTemplate :exec
+DELETE FROM track_templates
+WHERE id = $1
+`
+
+func (q *Queries) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteTemplate, id)
+	return err
+}
+
+const getTemplate = `-- name: GetTemplate :one
+SELECT id, user_id, curated, name, description, bpm, graph_data, scenes, created_at, updated_at FROM track_templates
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetTemplate(ctx context.Context, id uuid.UUID) (TrackTemplate, error) {
+	row := q.db.QueryRow(ctx, getTemplate, id)
+	var i TrackTemplate
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Curated,
+		&i.Name,
+		&i.Description,
+		&i.Bpm,
+		&i.GraphData,
+		&i.Scenes,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listTemplateFiles = `-- name: ListTemplateFiles :many
+SELECT id, template_id, kind, filename, file_size, s3_key, mime_type, created_at, duration, sample_rate, channels, bit_depth, codec FROM template_files
+WHERE template_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListTemplateFiles(ctx context.Context, templateID uuid.UUID) ([]TemplateFile, error) {
+	rows, err := q.db.Query(ctx, listTemplateFiles, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TemplateFile
+	for rows.Next() {
+		var i TemplateFile
+		if err := rows.Scan(
+			&i.ID,
+			&i.TemplateID,
+			&i.Kind,
+			&i.Filename,
+			&i.FileSize,
+			&i.S3Key,
+			&i.MimeType,
+			&i.CreatedAt,
+			&i.Duration,
+			&i.SampleRate,
+			&i.Channels,
+			&i.BitDepth,
+			&i.Codec,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTemplateGraphs = `-- name: ListTemplateGraphs :many
+SELECT id, graph_data, scenes FROM track_templates
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2
+`
+
+type ListTemplateGraphsParams struct {
+	ID    uuid.UUID `json:"id"`
+	Limit int32     `json:"limit"`
+}
+
+type ListTemplateGraphsRow struct {
+	ID        uuid.UUID `json:"id"`
+	GraphData []byte    `json:"graph_data"`
+	Scenes    []byte    `json:"scenes"`
+}
+
+func (q *Queries) ListTemplateGraphs(ctx context.Context, arg ListTemplateGraphsParams) ([]ListTemplateGraphsRow, error) {
+	rows, err := q.db.Query(ctx, listTemplateGraphs, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTemplateGraphsRow
+	for rows.Next() {
+		var i ListTemplateGraphsRow
+		if err := rows.Scan(&i.ID, &i.GraphData, &i.Scenes); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTemplates = `-- name: ListTemplates :many
+SELECT t.id, t.user_id, t.curated, t.name, t.description, t.bpm, t.created_at, t.updated_at,
+  jsonb_array_length(t.scenes)::int AS scene_count,
+  (SELECT COUNT(*) FROM template_files f WHERE f.template_id = t.id) AS file_count,
+  u.display_name AS author_name
+FROM track_templates t
+LEFT JOIN users u ON u.id = t.user_id
+WHERE (t.curated OR t.user_id = $1)
+  AND ($2::text <> 'curated' OR t.curated)
+  AND ($2::text <> 'mine' OR t.user_id = $1)
+ORDER BY t.curated DESC, t.name ASC
+`
+
+type ListTemplatesParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Scope  string    `json:"scope"`
+}
+
+type ListTemplatesRow struct {
+	ID          uuid.UUID        `json:"id"`
+	UserID      uuid.UUID        `json:"user_id"`
+	Curated     bool             `json:"curated"`
+	Name        string           `json:"name"`
+	Description pgtype.Text      `json:"description"`
+	Bpm         int32            `json:"bpm"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	SceneCount  int32            `json:"scene_count"`
+	FileCount   int64            `json:"file_count"`
+	AuthorName  pgtype.Text      `json:"author_name"`
+}
+
+// Curated templates and the user's own, optionally narrowed to one of them
+// by scope ('curated' or 'mine').
+func (q *Queries) ListTemplates(ctx context.Context, arg ListTemplatesParams) ([]ListTemplatesRow, error) {
+	rows, err := q.db.Query(ctx, listTemplates, arg.UserID, arg.Scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTemplatesRow
+	for rows.Next() {
+		var i ListTemplatesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Curated,
+			&i.Name,
+			&i.Description,
+			&i.Bpm,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SceneCount,
+			&i.FileCount,
+			&i.AuthorName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const migrateTemplateGraph = `-- name: MigrateTemplateGraph :exec
+UPDATE track_templates
+SET graph_data = $2
+WHERE id = $1
+`
+
+type MigrateTemplateGraphParams struct {
+	ID        uuid.UUID `json:"id"`
+	GraphData []byte    `json:"graph_data"`
+}
+
+func (q *Queries) MigrateTemplateGraph(ctx context.Context, arg MigrateTemplateGraphParams) error {
+	_, err := q.db.Exec(ctx, migrateTemplateGraph, arg.ID, arg.GraphData)
+	return err
+}
+
+const migrateTemplateScenes = `-- name: MigrateTemplateScenes :exec
+UPDATE track_templates
+SET scenes = $2
+WHERE id = $1
+`
+
+type MigrateTemplateScenesParams struct {
+	ID     uuid.UUID `json:"id"`
+	Scenes []byte    `json:"scenes"`
+}
+
+func (q *Queries) MigrateTemplateScenes(ctx context.Context, arg MigrateTemplateScenesParams) error {
+	_, err := q.db.Exec(ctx, migrateTemplateScenes, arg.ID, arg.Scenes)
+	return err
+}
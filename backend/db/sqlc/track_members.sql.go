@@ -0,0 +1,499 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: track_members.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createTrackInvite = `-- name: CreateTrackInvite :one
+INSERT INTO track_invites (
+  track_id, role, email, token, created_by, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, track_id, role, email, token, created_by, expires_at, accepted_by, accepted_at, created_at
+`
+
+type CreateTrackInviteParams struct {
+	TrackID   uuid.UUID        `json:"track_id"`
+	Role      string           `json:"role"`
+	Email     pgtype.Text      `json:"email"`
+	Token     string           `json:"token"`
+	CreatedBy pgtype.UUID      `json:"created_by"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+}
+
+func (q *Queries) CreateTrackInvite(ctx context.Context, arg CreateTrackInviteParams) (TrackInvite, error) {
+	row := q.db.QueryRow(ctx, createTrackInvite,
+		arg.TrackID,
+		arg.Role,
+		arg.Email,
+		arg.Token,
+		arg.CreatedBy,
+		arg.ExpiresAt,
+	)
+	var i TrackInvite
+	err := row.Scan(
+		&i.ID,
+		&i.TrackID,
+		&i.Role,
+		&i.Email,
+		&i.Token,
+		&i.CreatedBy,
+		&i.ExpiresAt,
+		&i.AcceptedBy,
+		&i.AcceptedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteTrackInvite = `-- name: DeleteTrackInvite :exec
+DELETE FROM track_invites
+WHERE id = $1 AND track_id = $2
+`
+
+type DeleteTrackInviteParams struct {
+	ID      uuid.UUID `json:"id"`
+	TrackID uuid.UUID `json:"track_id"`
+}
+
+func (q *Queries) DeleteTrackInvite(ctx context.Context, arg DeleteTrackInviteParams) error {
+	_, err := q.db.Exec(ctx, deleteTrackInvite, arg.ID, arg.TrackID)
+	return err
+}
+
+const getTrackAccess = `-- name: GetTrackAccess :one
+SELECT t.id, t.user_id, t.title, t.description, t.is_public, t.bpm, t.graph_data, t.created_at, t.updated_at, t.cover_s3_key, t.version, t.share_slug, t.published_at, t.forked_from, t.deleted_at, COALESCE(m.role, '')::text AS member_role
+FROM tracks t
+LEFT JOIN track_members m ON m.track_id = t.id AND m.user_id = $1
+WHERE t.id = $2 AND t.deleted_at IS NULL
+LIMIT 1
+`
+
+type GetTrackAccessParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	TrackID uuid.UUID `json:"track_id"`
+}
+
+type GetTrackAccessRow struct {
+	Track      Track  `json:"track"`
+	MemberRole string `json:"member_role"`
+}
+
+func (q *Queries) GetTrackAccess(ctx context.Context, arg GetTrackAccessParams) (GetTrackAccessRow, error) {
+	row := q.db.QueryRow(ctx, getTrackAccess, arg.UserID, arg.TrackID)
+	var i GetTrackAccessRow
+	err := row.Scan(
+		&i.Track.ID,
+		&i.Track.UserID,
+		&i.Track.Title,
+		&i.Track.Description,
+		&i.Track.IsPublic,
+		&i.Track.Bpm,
+		&i.Track.GraphData,
+		&i.Track.CreatedAt,
+		&i.Track.UpdatedAt,
+		&i.Track.CoverS3Key,
+		&i.Track.Version,
+		&i.Track.ShareSlug,
+		&i.Track.PublishedAt,
+		&i.Track.ForkedFrom,
+		&i.Track.DeletedAt,
+		&i.MemberRole,
+	)
+	return i, err
+}
+
+const getTrackInviteByToken = `-- name: GetTrackInviteByToken :one
+SELECT id, track_id, role, email, token, created_by, expires_at, accepted_by, accepted_at, created_at FROM track_invites
+WHERE token = $1
+LIMIT 1
+`
+
+func (q *Queries) GetTrackInviteByToken(ctx context.Context, token string) (TrackInvite, error) {
+	row := q.db.QueryRow(ctx, getTrackInviteByToken, token)
+	var i TrackInvite
+	err := row.Scan(
+		&i.ID,
+		&i.TrackID,
+		&i.Role,
+		&i.Email,
+		&i.Token,
+		&i.CreatedBy,
+		&i.ExpiresAt,
+		&i.AcceptedBy,
+		&i.AcceptedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listPendingInvitesByEmail = `-- name: ListPendingInvitesByEmail :many
+SELECT i.id, i.track_id, i.role, i.email, i.token, i.created_by, i.expires_at, i.accepted_by, i.accepted_at, i.created_at, t.title AS track_title
+FROM track_invites i
+JOIN tracks t ON t.id = i.track_id
+WHERE LOWER(i.email) = LOWER($1) AND i.accepted_at IS NULL AND i.expires_at > NOW()
+  AND t.deleted_at IS NULL
+ORDER BY i.created_at DESC
+`
+
+type ListPendingInvitesByEmailRow struct {
+	ID         uuid.UUID        `json:"id"`
+	TrackID    uuid.UUID        `json:"track_id"`
+	Role       string           `json:"role"`
+	Email      pgtype.Text      `json:"email"`
+	Token      string           `json:"token"`
+	CreatedBy  pgtype.UUID      `json:"created_by"`
+	ExpiresAt  pgtype.Timestamp `json:"expires_at"`
+	AcceptedBy pgtype.UUID      `json:"accepted_by"`
+	AcceptedAt pgtype.Timestamp `json:"accepted_at"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	TrackTitle string           `json:"track_title"`
+}
+
+func (q *Queries) ListPendingInvitesByEmail(ctx context.Context, email string) ([]ListPendingInvitesByEmailRow, error) {
+	rows, err := q.db.Query(ctx, listPendingInvitesByEmail, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPendingInvitesByEmailRow
+	for rows.Next() {
+		var i ListPendingInvitesByEmailRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TrackID,
+			&i.Role,
+			&i.Email,
+			&i.Token,
+			&i.CreatedBy,
+			&i.ExpiresAt,
+			&i.AcceptedBy,
+			&i.AcceptedAt,
+			&i.CreatedAt,
+			&i.TrackTitle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackInvites = `-- name: ListTrackInvites :many
+SELECT id, track_id, role, email, token, created_by, expires_at, accepted_by, accepted_at, created_at FROM track_invites
+WHERE track_id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListTrackInvites(ctx context.Context, trackID uuid.UUID) ([]TrackInvite, error) {
+	rows, err := q.db.Query(ctx, listTrackInvites, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TrackInvite
+	for rows.Next() {
+		var i TrackInvite
+		if err := rows.Scan(
+			&i.ID,
+			&i.TrackID,
+			&i.Role,
+			&i.Email,
+			&i.Token,
+			&i.CreatedBy,
+			&i.ExpiresAt,
+			&i.AcceptedBy,
+			&i.AcceptedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackMembers = `-- name: ListTrackMembers :many
+SELECT m.track_id, m.user_id, m.role, m.created_at, u.email, u.display_name, u.avatar_url
+FROM track_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.track_id = $1
+ORDER BY m.created_at ASC
+`
+
+type ListTrackMembersRow struct {
+	TrackID     uuid.UUID        `json:"track_id"`
+	UserID      uuid.UUID        `json:"user_id"`
+	Role        string           `json:"role"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	Email       string           `json:"email"`
+	DisplayName pgtype.Text      `json:"display_name"`
+	AvatarUrl   pgtype.Text      `json:"avatar_url"`
+}
+
+func (q *Queries) ListTrackMembers(ctx context.Context, trackID uuid.UUID) ([]ListTrackMembersRow, error) {
+	rows, err := q.db.Query(ctx, listTrackMembers, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrackMembersRow
+	for rows.Next() {
+		var i ListTrackMembersRow
+		if err := rows.Scan(
+			&i.TrackID,
+			&i.UserID,
+			&i.Role,
+			&i.CreatedAt,
+			&i.Email,
+			&i.DisplayName,
+			&i.AvatarUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markTrackInviteAccepted = `-- name: MarkTrackInviteAccepted :exec
+UPDATE track_invites
+SET accepted_by = $2, accepted_at = NOW()
+WHERE id = $1 AND accepted_at IS NULL
+`
+
+type MarkTrackInviteAcceptedParams struct {
+	ID         uuid.UUID   `json:"id"`
+	AcceptedBy pgtype.UUID `json:"accepted_by"`
+}
+
+func (q *Queries) MarkTrackInviteAccepted(ctx context.Context, arg MarkTrackInviteAcceptedParams) error {
+	_, err := q.db.Exec(ctx, markTrackInviteAccepted, arg.ID, arg.AcceptedBy)
+	return err
+}
+
+const removeTrackMember = `-- name: RemoveTrackMember :exec
+DELETE FROM track_members
+WHERE track_id = $1 AND user_id = $2
+`
+
+type RemoveTrackMemberParams struct {
+	TrackID uuid.UUID `json:"track_id"`
+	UserID  uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) RemoveTrackMember(ctx context.Context, arg RemoveTrackMemberParams) error {
+	_, err := q.db.Exec(ctx, removeTrackMember, arg.TrackID, arg.UserID)
+	return err
+}
+
+const searchAccessibleTracks = `-- name: SearchAccessibleTracks :many
+SELECT t.id, t.user_id, t.title, t.description, t.is_public, t.bpm, t.graph_data, t.created_at, t.updated_at, t.cover_s3_key, t.version, t.share_slug, t.published_at, t.forked_from, t.deleted_at, COALESCE(m.role, 'owner')::text AS role, ft.folder_id,
+  ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', $1::text))::float8 AS rank
+FROM tracks t
+LEFT JOIN track_members m ON m.track_id = t.id AND m.user_id = $2
+LEFT JOIN folder_tracks ft ON ft.track_id = t.id AND ft.user_id = $2
+WHERE (t.user_id = $2 OR m.user_id IS NOT NULL) AND t.deleted_at IS NULL
+  AND ($3::uuid IS NULL OR ft.folder_id = $3::uuid)
+  AND (NOT $4::boolean OR ft.folder_id IS NULL)
+  AND NOT EXISTS (
+    SELECT 1 FROM unnest($5::uuid[]) AS tg(tag_id)
+    WHERE NOT EXISTS (SELECT 1 FROM track_tags tt WHERE tt.track_id = t.id AND tt.tag_id = tg.tag_id)
+  )
+  AND ($1::text = '' OR track_search_vector(t.title, t.description) @@ websearch_to_tsquery('english', $1::text))
+  AND ($6::int IS NULL OR t.bpm >= $6::int)
+  AND ($7::int IS NULL OR t.bpm <= $7::int)
+  AND ($8::timestamp IS NULL OR t.created_at >= $8::timestamp)
+  AND ($9::timestamp IS NULL OR t.created_at < $9::timestamp)
+  AND ($10::timestamp IS NULL OR t.updated_at >= $10::timestamp)
+  AND ($11::timestamp IS NULL OR t.updated_at < $11::timestamp)
+  AND NOT EXISTS (
+    SELECT 1 FROM unnest($12::text[]) AS bt(block_type)
+    WHERE NOT t.graph_data @> jsonb_build_object('nodes', jsonb_build_array(jsonb_build_object('type', bt.block_type)))
+  )
+  AND ($13::uuid IS NULL OR CASE $14::text
+    WHEN 'title' THEN (t.title, t.id) > ($15::text, $13::uuid)
+    WHEN 'relevance' THEN (ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', $1::text))::float8, t.id)
+      < ($16::float8, $13::uuid)
+    WHEN 'created' THEN (t.created_at, t.id) < ($17::timestamp, $13::uuid)
+    WHEN 'published' THEN (t.published_at, t.id) < ($17::timestamp, $13::uuid)
+    ELSE (t.updated_at, t.id) < ($17::timestamp, $13::uuid)
+  END)
+ORDER BY
+  CASE WHEN $14::text = 'title' THEN t.title END ASC,
+  CASE WHEN $14::text = 'title' THEN t.id END ASC,
+  CASE WHEN $14::text = 'relevance' THEN ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', $1::text))::float8 END DESC,
+  CASE WHEN $14::text = 'created' THEN t.created_at END DESC,
+  CASE WHEN $14::text = 'published' THEN t.published_at END DESC,
+  CASE WHEN $14::text = 'updated' THEN t.updated_at END DESC,
+  t.id DESC
+LIMIT $18
+`
+
+type SearchAccessibleTracksParams struct {
+	Query         string           `json:"query"`
+	UserID        uuid.UUID        `json:"user_id"`
+	FolderID      pgtype.UUID      `json:"folder_id"`
+	Unfiled       bool             `json:"unfiled"`
+	TagIds        []uuid.UUID      `json:"tag_ids"`
+	BpmMin        pgtype.Int4      `json:"bpm_min"`
+	BpmMax        pgtype.Int4      `json:"bpm_max"`
+	CreatedAfter  pgtype.Timestamp `json:"created_after"`
+	CreatedBefore pgtype.Timestamp `json:"created_before"`
+	UpdatedAfter  pgtype.Timestamp `json:"updated_after"`
+	UpdatedBefore pgtype.Timestamp `json:"updated_before"`
+	BlockTypes    []string         `json:"block_types"`
+	CursorID      pgtype.UUID      `json:"cursor_id"`
+	Sort          string           `json:"sort"`
+	CursorTitle   pgtype.Text      `json:"cursor_title"`
+	CursorRank    pgtype.Float8    `json:"cursor_rank"`
+	CursorTime    pgtype.Timestamp `json:"cursor_time"`
+	RowLimit      int32            `json:"row_limit"`
+}
+
+type SearchAccessibleTracksRow struct {
+	Track    Track       `json:"track"`
+	Role     string      `json:"role"`
+	FolderID pgtype.UUID `json:"folder_id"`
+	Rank     float64     `json:"rank"`
+}
+
+// Tracks the user owns or is a member of, filtered and keyset-paginated. The
+// cursor columns that apply depend on sort; see the public variant in
+// tracks.sql, which must be kept in step.
+func (q *Queries) SearchAccessibleTracks(ctx context.Context, arg SearchAccessibleTracksParams) ([]SearchAccessibleTracksRow, error) {
+	rows, err := q.db.Query(ctx, searchAccessibleTracks,
+		arg.Query,
+		arg.UserID,
+		arg.FolderID,
+		arg.Unfiled,
+		arg.TagIds,
+		arg.BpmMin,
+		arg.BpmMax,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.UpdatedAfter,
+		arg.UpdatedBefore,
+		arg.BlockTypes,
+		arg.CursorID,
+		arg.Sort,
+		arg.CursorTitle,
+		arg.CursorRank,
+		arg.CursorTime,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchAccessibleTracksRow
+	for rows.Next() {
+		var i SearchAccessibleTracksRow
+		if err := rows.Scan(
+			&i.Track.ID,
+			&i.Track.UserID,
+			&i.Track.Title,
+			&i.Track.Description,
+			&i.Track.IsPublic,
+			&i.Track.Bpm,
+			&i.Track.GraphData,
+			&i.Track.CreatedAt,
+			&i.Track.UpdatedAt,
+			&i.Track.CoverS3Key,
+			&i.Track.Version,
+			&i.Track.ShareSlug,
+			&i.Track.PublishedAt,
+			&i.Track.ForkedFrom,
+			&i.Track.DeletedAt,
+			&i.Role,
+			&i.FolderID,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateTrackMemberRole = `-- name: UpdateTrackMemberRole :one
+UPDATE track_members
+SET role = $3
+WHERE track_id = $1 AND user_id = $2
+RETURNING track_id, user_id, role, invited_by, created_at
+`
+
+type UpdateTrackMemberRoleParams struct {
+	TrackID uuid.UUID `json:"track_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Role    string    `json:"role"`
+}
+
+func (q *Queries) UpdateTrackMemberRole(ctx context.Context, arg UpdateTrackMemberRoleParams) (TrackMember, error) {
+	row := q.db.QueryRow(ctx, updateTrackMemberRole, arg.TrackID, arg.UserID, arg.Role)
+	var i TrackMember
+	err := row.Scan(
+		&i.TrackID,
+		&i.UserID,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const upsertTrackMember = `-- name: UpsertTrackMember :one
+INSERT INTO track_members (
+  track_id, user_id, role, invited_by
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (track_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING track_id, user_id, role, invited_by, created_at
+`
+
+type UpsertTrackMemberParams struct {
+	TrackID   uuid.UUID   `json:"track_id"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Role      string      `json:"role"`
+	InvitedBy pgtype.UUID `json:"invited_by"`
+}
+
+func (q *Queries) UpsertTrackMember(ctx context.Context, arg UpsertTrackMemberParams) (TrackMember, error) {
+	row := q.db.QueryRow(ctx, upsertTrackMember,
+		arg.TrackID,
+		arg.UserID,
+		arg.Role,
+		arg.InvitedBy,
+	)
+	var i TrackMember
+	err := row.Scan(
+		&i.TrackID,
+		&i.UserID,
+		&i.Role,
+		&i.InvitedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
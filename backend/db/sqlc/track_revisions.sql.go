@@ -0,0 +1,198 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: track_revisions.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createTrackRevision = `-- name: CreateTrackRevision :execrows
+INSERT INTO track_revisions (track_id, author_id, label, graph_data)
+SELECT $1::uuid, $2::uuid, $3::varchar, $4::jsonb
+WHERE NOT EXISTS (
+  SELECT 1 FROM (
+    SELECT r.graph_data FROM track_revisions r
+    WHERE r.track_id = $1::uuid
+    ORDER BY r.created_at DESC, r.id DESC
+    LIMIT 1
+  ) latest
+  WHERE latest.graph_data = $4::jsonb
+)
+`
+
+type CreateTrackRevisionParams struct {
+	TrackID   uuid.UUID   `json:"track_id"`
+	AuthorID  pgtype.UUID `json:"author_id"`
+	Label     pgtype.Text `json:"label"`
+	GraphData []byte      `json:"graph_data"`
+}
+
+// Skips the insert when the graph is identical to the latest revision.
+func (q *Queries) CreateTrackRevision(ctx context.Context, arg CreateTrackRevisionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createTrackRevision,
+		arg.TrackID,
+		arg.AuthorID,
+		arg.Label,
+		arg.GraphData,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getTrackRevision = `-- name: GetTrackRevision :one
+SELECT id, track_id, author_id, label, graph_data, created_at FROM track_revisions
+WHERE id = $1 AND track_id = $2
+LIMIT 1
+`
+
+type GetTrackRevisionParams struct {
+	ID      uuid.UUID `json:"id"`
+	TrackID uuid.UUID `json:"track_id"`
+}
+
+func (q *Queries) GetTrackRevision(ctx context.Context, arg GetTrackRevisionParams) (TrackRevision, error) {
+	row := q.db.QueryRow(ctx, getTrackRevision, arg.ID, arg.TrackID)
+	var i TrackRevision
+	err := row.Scan(
+		&i.ID,
+		&i.TrackID,
+		&i.AuthorID,
+		&i.Label,
+		&i.GraphData,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listRevisionGraphs = `-- name: ListRevisionGraphs :many
+SELECT id, graph_data FROM track_revisions
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2
+`
+
+type ListRevisionGraphsParams struct {
+	ID    uuid.UUID `json:"id"`
+	Limit int32     `json:"limit"`
+}
+
+type ListRevisionGraphsRow struct {
+	ID        uuid.UUID `json:"id"`
+	GraphData []byte    `json:"graph_data"`
+}
+
+func (q *Queries) ListRevisionGraphs(ctx context.Context, arg ListRevisionGraphsParams) ([]ListRevisionGraphsRow, error) {
+	rows, err := q.db.Query(ctx, listRevisionGraphs, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRevisionGraphsRow
+	for rows.Next() {
+		var i ListRevisionGraphsRow
+		if err := rows.Scan(&i.ID, &i.GraphData); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackRevisions = `-- name: ListTrackRevisions :many
+SELECT r.id, r.track_id, r.author_id, r.label, r.created_at, u.display_name AS author_name
+FROM track_revisions r
+LEFT JOIN users u ON u.id = r.author_id
+WHERE r.track_id = $1
+ORDER BY r.created_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListTrackRevisionsParams struct {
+	TrackID uuid.UUID `json:"track_id"`
+	Limit   int32     `json:"limit"`
+	Offset  int32     `json:"offset"`
+}
+
+type ListTrackRevisionsRow struct {
+	ID         uuid.UUID        `json:"id"`
+	TrackID    uuid.UUID        `json:"track_id"`
+	AuthorID   pgtype.UUID      `json:"author_id"`
+	Label      pgtype.Text      `json:"label"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	AuthorName pgtype.Text      `json:"author_name"`
+}
+
+func (q *Queries) ListTrackRevisions(ctx context.Context, arg ListTrackRevisionsParams) ([]ListTrackRevisionsRow, error) {
+	rows, err := q.db.Query(ctx, listTrackRevisions, arg.TrackID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrackRevisionsRow
+	for rows.Next() {
+		var i ListTrackRevisionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TrackID,
+			&i.AuthorID,
+			&i.Label,
+			&i.CreatedAt,
+			&i.AuthorName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const migrateRevisionGraph = `-- name: MigrateRevisionGraph :exec
+UPDATE track_revisions
+SET graph_data = $2
+WHERE id = $1
+`
+
+type MigrateRevisionGraphParams struct {
+	ID        uuid.UUID `json:"id"`
+	GraphData []byte    `json:"graph_data"`
+}
+
+func (q *Queries) MigrateRevisionGraph(ctx context.Context, arg MigrateRevisionGraphParams) error {
+	_, err := q.db.Exec(ctx, migrateRevisionGraph, arg.ID, arg.GraphData)
+	return err
+}
+
+const pruneTrackRevisions = `-- name: PruneTrackRevisions :exec
+DELETE FROM track_revisions
+WHERE id IN (
+  SELECT r.id FROM track_revisions r
+  WHERE r.track_id = $1
+  ORDER BY r.created_at DESC, r.id DESC
+  OFFSET $2::int
+)
+`
+
+type PruneTrackRevisionsParams struct {
+	TrackID uuid.UUID `json:"track_id"`
+	Keep    int32     `json:"keep"`
+}
+
+// Deletes all but the newest keep revisions of a track.
+func (q *Queries) PruneTrackRevisions(ctx context.Context, arg PruneTrackRevisionsParams) error {
+	_, err := q.db.Exec(ctx, pruneTrackRevisions, arg.TrackID, arg.Keep)
+	return err
+}
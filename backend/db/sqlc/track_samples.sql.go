@@ -0,0 +1,71 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: track_samples.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const attachTrackSample = `-- name: AttachTrackSample :exec
+INSERT INTO track_samples (track_id, sample_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type AttachTrackSampleParams struct {
+	TrackID  uuid.UUID `json:"track_id"`
+	SampleID uuid.UUID `json:"sample_id"`
+}
+
+func (q *Queries) AttachTrackSample(ctx context.Context, arg AttachTrackSampleParams) error {
+	_, err := q.db.Exec(ctx, attachTrackSample, arg.TrackID, arg.SampleID)
+	return err
+}
+
+const detachTrackSample = `-- name: DetachTrackSample :execrows
+DELETE FROM track_samples
+WHERE track_id = $1 AND sample_id = $2
+`
+
+type DetachTrackSampleParams struct {
+	TrackID  uuid.UUID `json:"track_id"`
+	SampleID uuid.UUID `json:"sample_id"`
+}
+
+func (q *Queries) DetachTrackSample(ctx context.Context, arg DetachTrackSampleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, detachTrackSample, arg.TrackID, arg.SampleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listSampleTrackIDs = `-- name: ListSampleTrackIDs :many
+SELECT track_id FROM track_samples
+WHERE sample_id = $1
+`
+
+func (q *Queries) ListSampleTrackIDs(ctx context.Context, sampleID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, listSampleTrackIDs, sampleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var track_id uuid.UUID
+		if err := rows.Scan(&track_id); err != nil {
+			return nil, err
+		}
+		items = append(items, track_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -12,13 +12,61 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const createForkedTrack = `-- name: CreateForkedTrack :one
+INSERT INTO tracks (
+  user_id, title, description, bpm, graph_data, forked_from
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
+`
+
+type CreateForkedTrackParams struct {
+	UserID      pgtype.UUID `json:"user_id"`
+	Title       string      `json:"title"`
+	Description pgtype.Text `json:"description"`
+	Bpm         pgtype.Int4 `json:"bpm"`
+	GraphData   []byte      `json:"graph_data"`
+	ForkedFrom  pgtype.UUID `json:"forked_from"`
+}
+
+func (q *Queries) CreateForkedTrack(ctx context.Context, arg CreateForkedTrackParams) (Track, error) {
+	row := q.db.QueryRow(ctx, createForkedTrack,
+		arg.UserID,
+		arg.Title,
+		arg.Description,
+		arg.Bpm,
+		arg.GraphData,
+		arg.ForkedFrom,
+	)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.IsPublic,
+		&i.Bpm,
+		&i.GraphData,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const createTrack = `-- name: CreateTrack :one
 INSERT INTO tracks (
   user_id, title, description, bpm, graph_data
 ) VALUES (
   $1, $2, $3, $4, $5
 )
-RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
 `
 
 type CreateTrackParams struct {
@@ -48,33 +96,63 @@ func (q *Queries) CreateTrack(ctx context.Context, arg CreateTrackParams) (Track
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteTrack = `-- name: DeleteTrack :exec
-DELETE FROM tracks
-WHERE id = $1 AND user_id = $2
+const getPublicTrackBySlug = `-- name: GetPublicTrackBySlug :one
+SELECT t.id, t.user_id, t.title, t.description, t.is_public, t.bpm, t.graph_data, t.created_at, t.updated_at, t.cover_s3_key, t.version, t.share_slug, t.published_at, t.forked_from, t.deleted_at, u.display_name AS author_name, u.avatar_url AS author_avatar_url
+FROM tracks t
+LEFT JOIN users u ON u.id = t.user_id
+WHERE t.share_slug = $1 AND t.is_public = true AND t.deleted_at IS NULL
+LIMIT 1
 `
 
-type DeleteTrackParams struct {
-	ID     uuid.UUID   `json:"id"`
-	UserID pgtype.UUID `json:"user_id"`
+type GetPublicTrackBySlugRow struct {
+	Track           Track       `json:"track"`
+	AuthorName      pgtype.Text `json:"author_name"`
+	AuthorAvatarUrl pgtype.Text `json:"author_avatar_url"`
 }
 
-func (q *Queries) DeleteTrack(ctx context.Context, arg DeleteTrackParams) error {
-	_, err := q.db.Exec(ctx, deleteTrack, arg.ID, arg.UserID)
-	return err
+func (q *Queries) GetPublicTrackBySlug(ctx context.Context, shareSlug pgtype.Text) (GetPublicTrackBySlugRow, error) {
+	row := q.db.QueryRow(ctx, getPublicTrackBySlug, shareSlug)
+	var i GetPublicTrackBySlugRow
+	err := row.Scan(
+		&i.Track.ID,
+		&i.Track.UserID,
+		&i.Track.Title,
+		&i.Track.Description,
+		&i.Track.IsPublic,
+		&i.Track.Bpm,
+		&i.Track.GraphData,
+		&i.Track.CreatedAt,
+		&i.Track.UpdatedAt,
+		&i.Track.CoverS3Key,
+		&i.Track.Version,
+		&i.Track.ShareSlug,
+		&i.Track.PublishedAt,
+		&i.Track.ForkedFrom,
+		&i.Track.DeletedAt,
+		&i.AuthorName,
+		&i.AuthorAvatarUrl,
+	)
+	return i, err
 }
 
-const getPublicTrack = `-- name: GetPublicTrack :one
-SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at FROM tracks
-WHERE id = $1 AND is_public = true
+const getTrack = `-- name: GetTrack :one
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
+WHERE id = $1 AND deleted_at IS NULL
 LIMIT 1
 `
 
-func (q *Queries) GetPublicTrack(ctx context.Context, id uuid.UUID) (Track, error) {
-	row := q.db.QueryRow(ctx, getPublicTrack, id)
+func (q *Queries) GetTrack(ctx context.Context, id uuid.UUID) (Track, error) {
+	row := q.db.QueryRow(ctx, getTrack, id)
 	var i Track
 	err := row.Scan(
 		&i.ID,
@@ -86,17 +164,59 @@ func (q *Queries) GetPublicTrack(ctx context.Context, id uuid.UUID) (Track, erro
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const getTrack = `-- name: GetTrack :one
-SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at FROM tracks
-WHERE id = $1 LIMIT 1
+const getTrackForUpdate = `-- name: GetTrackForUpdate :one
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
+WHERE id = $1 AND deleted_at IS NULL
+LIMIT 1
+FOR UPDATE
 `
 
-func (q *Queries) GetTrack(ctx context.Context, id uuid.UUID) (Track, error) {
-	row := q.db.QueryRow(ctx, getTrack, id)
+func (q *Queries) GetTrackForUpdate(ctx context.Context, id uuid.UUID) (Track, error) {
+	row := q.db.QueryRow(ctx, getTrackForUpdate, id)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.IsPublic,
+		&i.Bpm,
+		&i.GraphData,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getTrashedTrack = `-- name: GetTrashedTrack :one
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+LIMIT 1
+`
+
+type GetTrashedTrackParams struct {
+	ID     uuid.UUID   `json:"id"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetTrashedTrack(ctx context.Context, arg GetTrashedTrackParams) (Track, error) {
+	row := q.db.QueryRow(ctx, getTrashedTrack, arg.ID, arg.UserID)
 	var i Track
 	err := row.Scan(
 		&i.ID,
@@ -108,12 +228,18 @@ func (q *Queries) GetTrack(ctx context.Context, id uuid.UUID) (Track, error) {
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUserTrack = `-- name: GetUserTrack :one
-SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at FROM tracks
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
 WHERE id = $1 AND user_id = $2
 LIMIT 1
 `
@@ -136,24 +262,30 @@ func (q *Queries) GetUserTrack(ctx context.Context, arg GetUserTrackParams) (Tra
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const listPublicTracks = `-- name: ListPublicTracks :many
-SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at FROM tracks
-WHERE is_public = true
-ORDER BY updated_at DESC
-LIMIT $1 OFFSET $2
+const listExpiredTrashedTracks = `-- name: ListExpiredTrashedTracks :many
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
+WHERE deleted_at IS NOT NULL AND deleted_at < $1
+ORDER BY deleted_at ASC
+LIMIT $2
 `
 
-type ListPublicTracksParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+type ListExpiredTrashedTracksParams struct {
+	DeletedAt pgtype.Timestamp `json:"deleted_at"`
+	Limit     int32            `json:"limit"`
 }
 
-func (q *Queries) ListPublicTracks(ctx context.Context, arg ListPublicTracksParams) ([]Track, error) {
-	rows, err := q.db.Query(ctx, listPublicTracks, arg.Limit, arg.Offset)
+func (q *Queries) ListExpiredTrashedTracks(ctx context.Context, arg ListExpiredTrashedTracksParams) ([]Track, error) {
+	rows, err := q.db.Query(ctx, listExpiredTrashedTracks, arg.DeletedAt, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -171,6 +303,211 @@ func (q *Queries) ListPublicTracks(ctx context.Context, arg ListPublicTracksPara
 			&i.GraphData,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CoverS3Key,
+			&i.Version,
+			&i.ShareSlug,
+			&i.PublishedAt,
+			&i.ForkedFrom,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackAncestors = `-- name: ListTrackAncestors :many
+WITH RECURSIVE chain AS (
+  SELECT p.id, p.user_id, p.title, p.is_public, p.share_slug, p.forked_from, p.created_at, p.deleted_at, 1 AS depth
+  FROM tracks c
+  JOIN tracks p ON p.id = c.forked_from
+  WHERE c.id = $2
+  UNION ALL
+  SELECT p.id, p.user_id, p.title, p.is_public, p.share_slug, p.forked_from, p.created_at, p.deleted_at, a.depth + 1
+  FROM chain a
+  JOIN tracks p ON p.id = a.forked_from
+  WHERE a.depth < 50
+)
+SELECT a.id, a.title, COALESCE(CASE WHEN a.is_public THEN a.share_slug END, '')::text AS share_slug, a.created_at, a.depth, u.display_name AS author_name,
+  (a.deleted_at IS NULL AND (COALESCE(a.is_public, false) OR a.user_id = $1::uuid OR m.user_id IS NOT NULL))::boolean AS visible
+FROM chain a
+LEFT JOIN users u ON u.id = a.user_id
+LEFT JOIN track_members m ON m.track_id = a.id AND m.user_id = $1::uuid
+ORDER BY a.depth ASC
+`
+
+type ListTrackAncestorsParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	TrackID uuid.UUID `json:"track_id"`
+}
+
+type ListTrackAncestorsRow struct {
+	ID         uuid.UUID        `json:"id"`
+	Title      string           `json:"title"`
+	ShareSlug  string           `json:"share_slug"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	Depth      int32            `json:"depth"`
+	AuthorName pgtype.Text      `json:"author_name"`
+	Visible    bool             `json:"visible"`
+}
+
+// Walks forked_from upwards, nearest parent first. Ancestors the user cannot
+// see are still returned so the depth is right, but flagged as not visible.
+func (q *Queries) ListTrackAncestors(ctx context.Context, arg ListTrackAncestorsParams) ([]ListTrackAncestorsRow, error) {
+	rows, err := q.db.Query(ctx, listTrackAncestors, arg.UserID, arg.TrackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrackAncestorsRow
+	for rows.Next() {
+		var i ListTrackAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.ShareSlug,
+			&i.CreatedAt,
+			&i.Depth,
+			&i.AuthorName,
+			&i.Visible,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackForks = `-- name: ListTrackForks :many
+SELECT t.id, t.user_id, t.title, t.is_public, t.share_slug, t.created_at, u.display_name AS author_name
+FROM tracks t
+LEFT JOIN users u ON u.id = t.user_id
+LEFT JOIN track_members m ON m.track_id = t.id AND m.user_id = $1
+WHERE t.forked_from = $2 AND t.deleted_at IS NULL
+  AND (t.is_public = true OR t.user_id = $1 OR m.user_id IS NOT NULL)
+ORDER BY t.created_at ASC
+`
+
+type ListTrackForksParams struct {
+	UserID  uuid.UUID   `json:"user_id"`
+	TrackID pgtype.UUID `json:"track_id"`
+}
+
+type ListTrackForksRow struct {
+	ID         uuid.UUID        `json:"id"`
+	UserID     pgtype.UUID      `json:"user_id"`
+	Title      string           `json:"title"`
+	IsPublic   pgtype.Bool      `json:"is_public"`
+	ShareSlug  pgtype.Text      `json:"share_slug"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	AuthorName pgtype.Text      `json:"author_name"`
+}
+
+func (q *Queries) ListTrackForks(ctx context.Context, arg ListTrackForksParams) ([]ListTrackForksRow, error) {
+	rows, err := q.db.Query(ctx, listTrackForks, arg.UserID, arg.TrackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrackForksRow
+	for rows.Next() {
+		var i ListTrackForksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Title,
+			&i.IsPublic,
+			&i.ShareSlug,
+			&i.CreatedAt,
+			&i.AuthorName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackGraphs = `-- name: ListTrackGraphs :many
+SELECT id, version, graph_data FROM tracks
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2
+`
+
+type ListTrackGraphsParams struct {
+	ID    uuid.UUID `json:"id"`
+	Limit int32     `json:"limit"`
+}
+
+type ListTrackGraphsRow struct {
+	ID        uuid.UUID `json:"id"`
+	Version   int32     `json:"version"`
+	GraphData []byte    `json:"graph_data"`
+}
+
+// Pages through every track, trashed ones included, for graph migrations.
+func (q *Queries) ListTrackGraphs(ctx context.Context, arg ListTrackGraphsParams) ([]ListTrackGraphsRow, error) {
+	rows, err := q.db.Query(ctx, listTrackGraphs, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrackGraphsRow
+	for rows.Next() {
+		var i ListTrackGraphsRow
+		if err := rows.Scan(&i.ID, &i.Version, &i.GraphData); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrashedTracks = `-- name: ListTrashedTracks :many
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
+WHERE user_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC
+`
+
+func (q *Queries) ListTrashedTracks(ctx context.Context, userID pgtype.UUID) ([]Track, error) {
+	rows, err := q.db.Query(ctx, listTrashedTracks, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Track
+	for rows.Next() {
+		var i Track
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Title,
+			&i.Description,
+			&i.IsPublic,
+			&i.Bpm,
+			&i.GraphData,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CoverS3Key,
+			&i.Version,
+			&i.ShareSlug,
+			&i.PublishedAt,
+			&i.ForkedFrom,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -183,7 +520,7 @@ func (q *Queries) ListPublicTracks(ctx context.Context, arg ListPublicTracksPara
 }
 
 const listUserTracks = `-- name: ListUserTracks :many
-SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at FROM tracks
+SELECT id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at FROM tracks
 WHERE user_id = $1
 ORDER BY updated_at DESC
 `
@@ -207,6 +544,12 @@ func (q *Queries) ListUserTracks(ctx context.Context, userID pgtype.UUID) ([]Tra
 			&i.GraphData,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CoverS3Key,
+			&i.Version,
+			&i.ShareSlug,
+			&i.PublishedAt,
+			&i.ForkedFrom,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -218,21 +561,250 @@ func (q *Queries) ListUserTracks(ctx context.Context, userID pgtype.UUID) ([]Tra
 	return items, nil
 }
 
+const migrateTrackGraph = `-- name: MigrateTrackGraph :execrows
+UPDATE tracks
+SET graph_data = $3
+WHERE id = $1 AND version = $2
+`
+
+type MigrateTrackGraphParams struct {
+	ID        uuid.UUID `json:"id"`
+	Version   int32     `json:"version"`
+	GraphData []byte    `json:"graph_data"`
+}
+
+// Rewrites graph_data in place without bumping the version. Matching on the
+// version skips tracks edited since they were read.
+func (q *Queries) MigrateTrackGraph(ctx context.Context, arg MigrateTrackGraphParams) (int64, error) {
+	result, err := q.db.Exec(ctx, migrateTrackGraph, arg.ID, arg.Version, arg.GraphData)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeTrack = `-- name: PurgeTrack :execrows
+DELETE FROM tracks
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+// Only trashed tracks can be purged, so a restore that wins a race with the
+// purge job keeps the track.
+func (q *Queries) PurgeTrack(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeTrack, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreTrack = `-- name: RestoreTrack :one
+UPDATE tracks
+SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
+`
+
+type RestoreTrackParams struct {
+	ID     uuid.UUID   `json:"id"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+func (q *Queries) RestoreTrack(ctx context.Context, arg RestoreTrackParams) (Track, error) {
+	row := q.db.QueryRow(ctx, restoreTrack, arg.ID, arg.UserID)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.IsPublic,
+		&i.Bpm,
+		&i.GraphData,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const searchPublicTracks = `-- name: SearchPublicTracks :many
+SELECT t.id, t.user_id, t.title, t.description, t.is_public, t.bpm, t.graph_data, t.created_at, t.updated_at, t.cover_s3_key, t.version, t.share_slug, t.published_at, t.forked_from, t.deleted_at, u.display_name AS author_name, u.avatar_url AS author_avatar_url,
+  ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', $1::text))::float8 AS rank
+FROM tracks t
+LEFT JOIN users u ON u.id = t.user_id
+WHERE t.is_public = true AND t.deleted_at IS NULL
+  AND ($1::text = '' OR track_search_vector(t.title, t.description) @@ websearch_to_tsquery('english', $1::text))
+  AND ($2::int IS NULL OR t.bpm >= $2::int)
+  AND ($3::int IS NULL OR t.bpm <= $3::int)
+  AND ($4::timestamp IS NULL OR t.created_at >= $4::timestamp)
+  AND ($5::timestamp IS NULL OR t.created_at < $5::timestamp)
+  AND ($6::timestamp IS NULL OR t.updated_at >= $6::timestamp)
+  AND ($7::timestamp IS NULL OR t.updated_at < $7::timestamp)
+  AND NOT EXISTS (
+    SELECT 1 FROM unnest($8::text[]) AS bt(block_type)
+    WHERE NOT t.graph_data @> jsonb_build_object('nodes', jsonb_build_array(jsonb_build_object('type', bt.block_type)))
+  )
+  AND ($9::uuid IS NULL OR CASE $10::text
+    WHEN 'title' THEN (t.title, t.id) > ($11::text, $9::uuid)
+    WHEN 'relevance' THEN (ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', $1::text))::float8, t.id)
+      < ($12::float8, $9::uuid)
+    WHEN 'created' THEN (t.created_at, t.id) < ($13::timestamp, $9::uuid)
+    WHEN 'published' THEN (t.published_at, t.id) < ($13::timestamp, $9::uuid)
+    ELSE (t.updated_at, t.id) < ($13::timestamp, $9::uuid)
+  END)
+ORDER BY
+  CASE WHEN $10::text = 'title' THEN t.title END ASC,
+  CASE WHEN $10::text = 'title' THEN t.id END ASC,
+  CASE WHEN $10::text = 'relevance' THEN ts_rank(track_search_vector(t.title, t.description), websearch_to_tsquery('english', $1::text))::float8 END DESC,
+  CASE WHEN $10::text = 'created' THEN t.created_at END DESC,
+  CASE WHEN $10::text = 'published' THEN t.published_at END DESC,
+  CASE WHEN $10::text = 'updated' THEN t.updated_at END DESC,
+  t.id DESC
+LIMIT $14
+`
+
+type SearchPublicTracksParams struct {
+	Query         string           `json:"query"`
+	BpmMin        pgtype.Int4      `json:"bpm_min"`
+	BpmMax        pgtype.Int4      `json:"bpm_max"`
+	CreatedAfter  pgtype.Timestamp `json:"created_after"`
+	CreatedBefore pgtype.Timestamp `json:"created_before"`
+	UpdatedAfter  pgtype.Timestamp `json:"updated_after"`
+	UpdatedBefore pgtype.Timestamp `json:"updated_before"`
+	BlockTypes    []string         `json:"block_types"`
+	CursorID      pgtype.UUID      `json:"cursor_id"`
+	Sort          string           `json:"sort"`
+	CursorTitle   pgtype.Text      `json:"cursor_title"`
+	CursorRank    pgtype.Float8    `json:"cursor_rank"`
+	CursorTime    pgtype.Timestamp `json:"cursor_time"`
+	RowLimit      int32            `json:"row_limit"`
+}
+
+type SearchPublicTracksRow struct {
+	Track           Track       `json:"track"`
+	AuthorName      pgtype.Text `json:"author_name"`
+	AuthorAvatarUrl pgtype.Text `json:"author_avatar_url"`
+	Rank            float64     `json:"rank"`
+}
+
+func (q *Queries) SearchPublicTracks(ctx context.Context, arg SearchPublicTracksParams) ([]SearchPublicTracksRow, error) {
+	rows, err := q.db.Query(ctx, searchPublicTracks,
+		arg.Query,
+		arg.BpmMin,
+		arg.BpmMax,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.UpdatedAfter,
+		arg.UpdatedBefore,
+		arg.BlockTypes,
+		arg.CursorID,
+		arg.Sort,
+		arg.CursorTitle,
+		arg.CursorRank,
+		arg.CursorTime,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPublicTracksRow
+	for rows.Next() {
+		var i SearchPublicTracksRow
+		if err := rows.Scan(
+			&i.Track.ID,
+			&i.Track.UserID,
+			&i.Track.Title,
+			&i.Track.Description,
+			&i.Track.IsPublic,
+			&i.Track.Bpm,
+			&i.Track.GraphData,
+			&i.Track.CreatedAt,
+			&i.Track.UpdatedAt,
+			&i.Track.CoverS3Key,
+			&i.Track.Version,
+			&i.Track.ShareSlug,
+			&i.Track.PublishedAt,
+			&i.Track.ForkedFrom,
+			&i.Track.DeletedAt,
+			&i.AuthorName,
+			&i.AuthorAvatarUrl,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setTrackCover = `-- name: SetTrackCover :one
+UPDATE tracks
+SET cover_s3_key = $2, version = version + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
+`
+
+type SetTrackCoverParams struct {
+	ID         uuid.UUID   `json:"id"`
+	CoverS3Key pgtype.Text `json:"cover_s3_key"`
+}
+
+func (q *Queries) SetTrackCover(ctx context.Context, arg SetTrackCoverParams) (Track, error) {
+	row := q.db.QueryRow(ctx, setTrackCover, arg.ID, arg.CoverS3Key)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.IsPublic,
+		&i.Bpm,
+		&i.GraphData,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const setTrackPublic = `-- name: SetTrackPublic :one
 UPDATE tracks
-SET is_public = $2, updated_at = NOW()
-WHERE id = $1 AND user_id = $3
-RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at
+SET is_public = $1,
+    share_slug = COALESCE(share_slug, $2),
+    published_at = CASE
+      WHEN $1 AND NOT COALESCE(is_public, false) THEN NOW()
+      ELSE published_at
+    END,
+    version = version + 1, updated_at = NOW()
+WHERE id = $3
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
 `
 
 type SetTrackPublicParams struct {
-	ID       uuid.UUID   `json:"id"`
-	IsPublic pgtype.Bool `json:"is_public"`
-	UserID   pgtype.UUID `json:"user_id"`
+	IsPublic  pgtype.Bool `json:"is_public"`
+	ShareSlug pgtype.Text `json:"share_slug"`
+	ID        uuid.UUID   `json:"id"`
 }
 
+// The slug is assigned on first publish and kept afterwards, so a track that
+// is unpublished and published again keeps its share link.
 func (q *Queries) SetTrackPublic(ctx context.Context, arg SetTrackPublicParams) (Track, error) {
-	row := q.db.QueryRow(ctx, setTrackPublic, arg.ID, arg.IsPublic, arg.UserID)
+	row := q.db.QueryRow(ctx, setTrackPublic, arg.IsPublic, arg.ShareSlug, arg.ID)
 	var i Track
 	err := row.Scan(
 		&i.ID,
@@ -244,34 +816,72 @@ func (q *Queries) SetTrackPublic(ctx context.Context, arg SetTrackPublicParams)
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const trashTrack = `-- name: TrashTrack :one
+UPDATE tracks
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
+`
+
+func (q *Queries) TrashTrack(ctx context.Context, id uuid.UUID) (Track, error) {
+	row := q.db.QueryRow(ctx, trashTrack, id)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.IsPublic,
+		&i.Bpm,
+		&i.GraphData,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const updateTrack = `-- name: UpdateTrack :one
 UPDATE tracks
-SET title = $2, description = $3, bpm = $4, graph_data = $5, updated_at = NOW()
-WHERE id = $1 AND user_id = $6
-RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at
+SET title = $1, description = $2, bpm = $3,
+    graph_data = $4, version = version + 1, updated_at = NOW()
+WHERE id = $5 AND deleted_at IS NULL
+  AND ($6::int IS NULL OR version = $6::int)
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
 `
 
 type UpdateTrackParams struct {
-	ID          uuid.UUID   `json:"id"`
-	Title       string      `json:"title"`
-	Description pgtype.Text `json:"description"`
-	Bpm         pgtype.Int4 `json:"bpm"`
-	GraphData   []byte      `json:"graph_data"`
-	UserID      pgtype.UUID `json:"user_id"`
+	Title           string      `json:"title"`
+	Description     pgtype.Text `json:"description"`
+	Bpm             pgtype.Int4 `json:"bpm"`
+	GraphData       []byte      `json:"graph_data"`
+	ID              uuid.UUID   `json:"id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
 }
 
 func (q *Queries) UpdateTrack(ctx context.Context, arg UpdateTrackParams) (Track, error) {
 	row := q.db.QueryRow(ctx, updateTrack,
-		arg.ID,
 		arg.Title,
 		arg.Description,
 		arg.Bpm,
 		arg.GraphData,
-		arg.UserID,
+		arg.ID,
+		arg.ExpectedVersion,
 	)
 	var i Track
 	err := row.Scan(
@@ -284,25 +894,32 @@ func (q *Queries) UpdateTrack(ctx context.Context, arg UpdateTrackParams) (Track
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const updateTrackGraph = `-- name: UpdateTrackGraph :one
 UPDATE tracks
-SET graph_data = $2, updated_at = NOW()
-WHERE id = $1 AND user_id = $3
-RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at
+SET graph_data = $1, version = version + 1, updated_at = NOW()
+WHERE id = $2 AND deleted_at IS NULL
+  AND ($3::int IS NULL OR version = $3::int)
+RETURNING id, user_id, title, description, is_public, bpm, graph_data, created_at, updated_at, cover_s3_key, version, share_slug, published_at, forked_from, deleted_at
 `
 
 type UpdateTrackGraphParams struct {
-	ID        uuid.UUID   `json:"id"`
-	GraphData []byte      `json:"graph_data"`
-	UserID    pgtype.UUID `json:"user_id"`
+	GraphData       []byte      `json:"graph_data"`
+	ID              uuid.UUID   `json:"id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
 }
 
 func (q *Queries) UpdateTrackGraph(ctx context.Context, arg UpdateTrackGraphParams) (Track, error) {
-	row := q.db.QueryRow(ctx, updateTrackGraph, arg.ID, arg.GraphData, arg.UserID)
+	row := q.db.QueryRow(ctx, updateTrackGraph, arg.GraphData, arg.ID, arg.ExpectedVersion)
 	var i Track
 	err := row.Scan(
 		&i.ID,
@@ -314,6 +931,12 @@ func (q *Queries) UpdateTrackGraph(ctx context.Context, arg UpdateTrackGraphPara
 		&i.GraphData,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CoverS3Key,
+		&i.Version,
+		&i.ShareSlug,
+		&i.PublishedAt,
+		&i.ForkedFrom,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -12,13 +12,35 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const chargeUserStorage = `-- name: ChargeUserStorage :execrows
+UPDATE users
+SET storage_used = COALESCE(storage_used, 0) + $1::bigint, updated_at = NOW()
+WHERE id = $2
+  AND COALESCE(storage_used, 0) + $1::bigint <= COALESCE(storage_limit, 0)
+`
+
+type ChargeUserStorageParams struct {
+	Amount int64     `json:"amount"`
+	ID     uuid.UUID `json:"id"`
+}
+
+// Adds amount to the user's storage unless that would take them over their
+// limit, in which case no row is updated.
+func (q *Queries) ChargeUserStorage(ctx context.Context, arg ChargeUserStorageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, chargeUserStorage, arg.Amount, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
   email, display_name, avatar_url, oauth_provider, oauth_id
 ) VALUES (
   $1, $2, $3, $4, $5
 )
-RETURNING id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at
+RETURNING id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at, is_admin
 `
 
 type CreateUserParams struct {
@@ -49,6 +71,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.StorageLimit,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
@@ -64,7 +87,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at FROM users
+SELECT id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at, is_admin FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -82,12 +105,13 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.StorageLimit,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at FROM users
+SELECT id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at, is_admin FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -105,12 +129,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.StorageLimit,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
 const getUserByOAuth = `-- name: GetUserByOAuth :one
-SELECT id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at FROM users
+SELECT id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at, is_admin FROM users
 WHERE oauth_provider = $1 AND oauth_id = $2
 LIMIT 1
 `
@@ -134,15 +159,32 @@ func (q *Queries) GetUserByOAuth(ctx context.Context, arg GetUserByOAuthParams)
 		&i.StorageLimit,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
+const releaseUserStorage = `-- name: ReleaseUserStorage :exec
+UPDATE users
+SET storage_used = GREATEST(COALESCE(storage_used, 0) - $1::bigint, 0), updated_at = NOW()
+WHERE id = $2
+`
+
+type ReleaseUserStorageParams struct {
+	Amount int64     `json:"amount"`
+	ID     uuid.UUID `json:"id"`
+}
+
+func (q *Queries) ReleaseUserStorage(ctx context.Context, arg ReleaseUserStorageParams) error {
+	_, err := q.db.Exec(ctx, releaseUserStorage, arg.Amount, arg.ID)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET display_name = $2, avatar_url = $3, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at
+RETURNING id, email, display_name, avatar_url, oauth_provider, oauth_id, storage_used, storage_limit, created_at, updated_at, is_admin
 `
 
 type UpdateUserParams struct {
@@ -165,6 +207,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.StorageLimit,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsAdmin,
 	)
 	return i, err
 }
@@ -0,0 +1,139 @@
+package access
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var rank = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+var (
+	ErrNotFound  = errors.New("track not found")
+	ErrForbidden = errors.New("insufficient permissions for this track")
+)
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := rank[r]
+	return ok
+}
+
+// Assignable reports whether r can be granted to a member. Ownership follows
+// tracks.user_id and is never stored as a membership.
+func (r Role) Assignable() bool {
+	return r == RoleEditor || r == RoleViewer
+}
+
+// Allows reports whether r grants at least the permissions of min.
+func (r Role) Allows(min Role) bool {
+	return rank[r] >= rank[min]
+}
+
+// queries are the lookups Authorizer needs, as provided by *sqlc.Queries.
+type queries interface {
+	GetTrackAccess(ctx context.Context, arg sqlc.GetTrackAccessParams) (sqlc.GetTrackAccessRow, error)
+	GetTrack(ctx context.Context, id uuid.UUID) (sqlc.Track, error)
+	ListSampleTrackIDs(ctx context.Context, sampleID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type Authorizer struct {
+	db queries
+}
+
+func NewAuthorizer(db *sqlc.Queries) *Authorizer {
+	return &Authorizer{db: db}
+}
+
+// Track loads a track together with the user's role on it and checks that the
+// role is at least min. Users with no role at all get ErrNotFound rather than
+// ErrForbidden, so that private tracks are indistinguishable from missing ones.
+func (a *Authorizer) Track(ctx context.Context, trackID, userID uuid.UUID, min Role) (sqlc.Track, Role, error) {
+	row, err := a.db.GetTrackAccess(ctx, sqlc.GetTrackAccessParams{
+		TrackID: trackID,
+		UserID:  userID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sqlc.Track{}, "", ErrNotFound
+	}
+	if err != nil {
+		return sqlc.Track{}, "", err
+	}
+
+	role := Role(row.MemberRole)
+	if row.Track.UserID.Valid && row.Track.UserID.Bytes == userID {
+		role = RoleOwner
+	}
+	if !role.Valid() {
+		return sqlc.Track{}, "", ErrNotFound
+	}
+	if !role.Allows(min) {
+		return row.Track, role, ErrForbidden
+	}
+	return row.Track, role, nil
+}
+
+// ReadableTrack loads a track the user may read: one that is public, or one
+// they have any role on.
+func (a *Authorizer) ReadableTrack(ctx context.Context, trackID, userID uuid.UUID) (sqlc.Track, error) {
+	track, _, err := a.Track(ctx, trackID, userID, RoleViewer)
+	if errors.Is(err, ErrNotFound) {
+		track, err = a.db.GetTrack(ctx, trackID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !track.IsPublic.Bool) {
+			return sqlc.Track{}, ErrNotFound
+		}
+	}
+	return track, err
+}
+
+// Upload checks access to a file attached to a track. Uploaders keep full
+// control of their own files; anyone else needs at least min on the track.
+func (a *Authorizer) Upload(ctx context.Context, uploaderID, trackID pgtype.UUID, userID uuid.UUID, min Role) error {
+	if uploaderID.Valid && uploaderID.Bytes == userID {
+		return nil
+	}
+	if !trackID.Valid {
+		return ErrNotFound
+	}
+	_, _, err := a.Track(ctx, trackID.Bytes, userID, min)
+	return err
+}
+
+// Sample checks access to a sample. Samples uploaded to a track follow
+// Upload. Library samples belong to their uploader alone; anyone else may
+// only read one, through a track it is attached to.
+func (a *Authorizer) Sample(ctx context.Context, sample sqlc.Sample, userID uuid.UUID, min Role) error {
+	if sample.TrackID.Valid || (sample.UserID.Valid && sample.UserID.Bytes == userID) {
+		return a.Upload(ctx, sample.UserID, sample.TrackID, userID, min)
+	}
+	if min != RoleViewer {
+		return ErrNotFound
+	}
+
+	trackIDs, err := a.db.ListSampleTrackIDs(ctx, sample.ID)
+	if err != nil {
+		return err
+	}
+	for _, trackID := range trackIDs {
+		if _, _, err := a.Track(ctx, trackID, userID, RoleViewer); err == nil {
+			return nil
+		}
+	}
+	return ErrNotFound
+}
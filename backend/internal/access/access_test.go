@@ -0,0 +1,112 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+// fakeQueries serves tracks with their owners and member roles, and the
+// tracks each library sample is attached to.
+type fakeQueries struct {
+	owners   map[uuid.UUID]uuid.UUID
+	members  map[uuid.UUID]map[uuid.UUID]Role
+	attached map[uuid.UUID][]uuid.UUID
+}
+
+func (f *fakeQueries) GetTrackAccess(ctx context.Context, arg sqlc.GetTrackAccessParams) (sqlc.GetTrackAccessRow, error) {
+	owner, ok := f.owners[arg.TrackID]
+	if !ok {
+		return sqlc.GetTrackAccessRow{}, pgx.ErrNoRows
+	}
+	return sqlc.GetTrackAccessRow{
+		Track:      sqlc.Track{ID: arg.TrackID, UserID: pgtype.UUID{Bytes: owner, Valid: true}},
+		MemberRole: string(f.members[arg.TrackID][arg.UserID]),
+	}, nil
+}
+
+func (f *fakeQueries) GetTrack(ctx context.Context, id uuid.UUID) (sqlc.Track, error) {
+	owner, ok := f.owners[id]
+	if !ok {
+		return sqlc.Track{}, pgx.ErrNoRows
+	}
+	return sqlc.Track{ID: id, UserID: pgtype.UUID{Bytes: owner, Valid: true}}, nil
+}
+
+func (f *fakeQueries) ListSampleTrackIDs(ctx context.Context, sampleID uuid.UUID) ([]uuid.UUID, error) {
+	return f.attached[sampleID], nil
+}
+
+func TestSampleLibraryAccess(t *testing.T) {
+	var (
+		owner   = uuid.New()
+		viewer  = uuid.New()
+		editor  = uuid.New()
+		other   = uuid.New()
+		track   = uuid.New()
+		private = uuid.New()
+	)
+	library := sqlc.Sample{ID: uuid.New(), UserID: pgtype.UUID{Bytes: owner, Valid: true}}
+	unattached := sqlc.Sample{ID: uuid.New(), UserID: pgtype.UUID{Bytes: owner, Valid: true}}
+	authorizer := &Authorizer{db: &fakeQueries{
+		owners: map[uuid.UUID]uuid.UUID{track: owner, private: other},
+		members: map[uuid.UUID]map[uuid.UUID]Role{
+			track: {viewer: RoleViewer, editor: RoleEditor},
+		},
+		attached: map[uuid.UUID][]uuid.UUID{library.ID: {private, track}},
+	}}
+
+	tests := []struct {
+		name   string
+		sample sqlc.Sample
+		user   uuid.UUID
+		min    Role
+		want   error
+	}{
+		{"owner edits", library, owner, RoleOwner, nil},
+		{"owner reads an unattached sample", unattached, owner, RoleViewer, nil},
+		{"viewer of an attached track reads", library, viewer, RoleViewer, nil},
+		{"viewer of an attached track cannot edit", library, viewer, RoleEditor, ErrNotFound},
+		{"editor of an attached track cannot edit", library, editor, RoleEditor, ErrNotFound},
+		{"owner of another attached track reads", library, other, RoleViewer, nil},
+		{"stranger", library, uuid.New(), RoleViewer, ErrNotFound},
+		{"viewer of no attached track", unattached, viewer, RoleViewer, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.Sample(context.Background(), tt.sample, tt.user, tt.min)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Sample = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackSampleAccess(t *testing.T) {
+	owner, viewer, uploader := uuid.New(), uuid.New(), uuid.New()
+	track := uuid.New()
+	authorizer := &Authorizer{db: &fakeQueries{
+		owners:  map[uuid.UUID]uuid.UUID{track: owner},
+		members: map[uuid.UUID]map[uuid.UUID]Role{track: {viewer: RoleViewer, uploader: RoleEditor}},
+	}}
+	sample := sqlc.Sample{
+		ID:      uuid.New(),
+		UserID:  pgtype.UUID{Bytes: uploader, Valid: true},
+		TrackID: pgtype.UUID{Bytes: track, Valid: true},
+	}
+
+	if err := authorizer.Sample(context.Background(), sample, viewer, RoleViewer); err != nil {
+		t.Errorf("viewer reading: %v", err)
+	}
+	if err := authorizer.Sample(context.Background(), sample, viewer, RoleEditor); !errors.Is(err, ErrForbidden) {
+		t.Errorf("viewer editing: %v, want %v", err, ErrForbidden)
+	}
+	if err := authorizer.Sample(context.Background(), sample, uploader, RoleOwner); err != nil {
+		t.Errorf("uploader: %v", err)
+	}
+}
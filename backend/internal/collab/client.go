@@ -0,0 +1,162 @@
+package collab
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 1 << 20
+	sendBuffer     = 64
+)
+
+const (
+	MsgSnapshot = "snapshot"
+	MsgOps      = "ops"
+	MsgSelect   = "select"
+	MsgPresence = "presence"
+	MsgReject   = "reject"
+	MsgSaved    = "saved"
+	MsgError    = "error"
+)
+
+// inbound is what editors send. Ops carry an id chosen by the client so it
+// can match the broadcast (or rejection) back to its optimistic edit.
+type inbound struct {
+	Type   string     `json:"type"`
+	ID     string     `json:"id,omitempty"`
+	Ops    []graph.Op `json:"ops,omitempty"`
+	NodeID *string    `json:"node_id,omitempty"`
+}
+
+type outbound struct {
+	Type     string       `json:"type"`
+	Seq      int64        `json:"seq"`
+	ID       string       `json:"id,omitempty"`
+	ClientID string       `json:"client_id,omitempty"`
+	UserID   string       `json:"user_id,omitempty"`
+	Ops      []graph.Op   `json:"ops,omitempty"`
+	Graph    *graph.Graph `json:"graph,omitempty"`
+	Presence []Presence   `json:"presence,omitempty"`
+	Version  int32        `json:"version,omitempty"`
+	Op       *int         `json:"op,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+type Presence struct {
+	ClientID string  `json:"client_id"`
+	UserID   string  `json:"user_id"`
+	Name     string  `json:"name"`
+	ReadOnly bool    `json:"read_only"`
+	Selected *string `json:"selected_node_id"`
+}
+
+type client struct {
+	id       string
+	userID   uuid.UUID
+	name     string
+	readOnly bool
+	selected *string
+	conn     *websocket.Conn
+	send     chan []byte
+}
+
+func newClient(conn *websocket.Conn, userID uuid.UUID, name string, readOnly bool) *client {
+	return &client{
+		id:       uuid.NewString(),
+		userID:   userID,
+		name:     name,
+		readOnly: readOnly,
+		conn:     conn,
+		send:     make(chan []byte, sendBuffer),
+	}
+}
+
+func (c *client) presence() Presence {
+	return Presence{
+		ClientID: c.id,
+		UserID:   c.userID.String(),
+		Name:     c.name,
+		ReadOnly: c.readOnly,
+		Selected: c.selected,
+	}
+}
+
+// readPump forwards messages to the room until the connection drops. It runs
+// on the handler goroutine, which must stay alive for the connection's life.
+func (c *client) readPump(r *room) {
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Collab client %s disconnected: %v\n", c.id, err)
+			}
+			return
+		}
+
+		var msg inbound
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.enqueue(outbound{Type: MsgError, Error: "invalid message"})
+			continue
+		}
+		r.events <- event{kind: eventMessage, client: c, inbound: msg}
+	}
+}
+
+// writePump owns all writes to the connection. The room closes send when the
+// client leaves, which ends the pump.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// enqueue queues a message without blocking. A client that cannot keep up is
+// disconnected rather than allowed to stall the room.
+func (c *client) enqueue(msg outbound) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Warning: failed to encode collab message: %v\n", err)
+		return true
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	default:
+		_ = c.conn.Close()
+		return false
+	}
+}
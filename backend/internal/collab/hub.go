@@ -0,0 +1,155 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+// queries are the lookups Hub and its rooms need, as provided by
+// *sqlc.Queries.
+type queries interface {
+	GetTrack(ctx context.Context, id uuid.UUID) (sqlc.Track, error)
+	GetUser(ctx context.Context, id uuid.UUID) (sqlc.User, error)
+}
+
+// Hub keeps one room per track with connected editors. Rooms are created on
+// the first join and saved and dropped when the last editor leaves.
+type Hub struct {
+	db   queries
+	pool *pgxpool.Pool
+
+	mu    sync.Mutex
+	rooms map[uuid.UUID]*room
+	refs  map[*room]int
+}
+
+func NewHub(db *sqlc.Queries, pool *pgxpool.Pool) *Hub {
+	return &Hub{
+		db:    db,
+		pool:  pool,
+		rooms: make(map[uuid.UUID]*room),
+		refs:  make(map[*room]int),
+	}
+}
+
+// Serve joins conn to the track's room and blocks until the editor
+// disconnects. The caller is responsible for checking access to the track;
+// readOnly clients receive every update but cannot send ops.
+func (h *Hub) Serve(conn *websocket.Conn, trackID, userID uuid.UUID, readOnly bool) {
+	ctx := context.Background()
+
+	r, err := h.acquire(ctx, trackID)
+	if err != nil {
+		data, _ := json.Marshal(outbound{Type: MsgError, Error: "failed to open track"})
+		_ = conn.WriteMessage(websocket.TextMessage, data)
+		return
+	}
+
+	name := ""
+	if user, err := h.db.GetUser(ctx, userID); err == nil {
+		name = user.DisplayName.String
+	}
+
+	c := newClient(conn, userID, name, readOnly)
+	done := make(chan struct{})
+	go func() {
+		c.writePump()
+		close(done)
+	}()
+
+	r.events <- event{kind: eventJoin, client: c}
+	c.readPump(r)
+	r.events <- event{kind: eventLeave, client: c}
+
+	// The connection is recycled once the handler returns, so wait for the
+	// writer to drain before letting go of it.
+	<-done
+}
+
+// Disconnect closes a user's connections to the track's live session, if one
+// is open. Call it after their access to the track changes, so their editors
+// reconnect with the new role instead of keeping the one they joined with.
+func (h *Hub) Disconnect(trackID, userID uuid.UUID) {
+	h.mu.Lock()
+	r, ok := h.rooms[trackID]
+	h.mu.Unlock()
+	if ok {
+		r.events <- event{kind: eventDisconnect, userID: userID}
+	}
+}
+
+// acquire returns the track's room, opening it if needed, and takes a
+// reference on it. The track is loaded without holding mu so one slow query
+// does not stall every other join and leave; if two editors open the same
+// track at once, the first room registered wins and the other load is
+// discarded.
+func (h *Hub) acquire(ctx context.Context, trackID uuid.UUID) (*room, error) {
+	if r := h.ref(trackID); r != nil {
+		return r, nil
+	}
+
+	track, err := h.db.GetTrack(ctx, trackID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := graph.Parse(track.GraphData)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[trackID]
+	if !ok {
+		r = newRoom(h, track, g)
+		h.rooms[trackID] = r
+		go r.run()
+	}
+	h.refs[r]++
+	return r, nil
+}
+
+// ref takes a reference on the track's room if one is open.
+func (h *Hub) ref(trackID uuid.UUID) *room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[trackID]
+	if !ok {
+		return nil
+	}
+	h.refs[r]++
+	return r
+}
+
+// release drops a reference held by a departed client and reports whether it
+// was the last one.
+func (h *Hub) release(r *room) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.refs[r]--
+	return h.refs[r] == 0
+}
+
+// close removes an empty room, unless an editor joined while it was saving,
+// in which case the room keeps running.
+func (h *Hub) close(r *room) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.refs[r] > 0 {
+		return false
+	}
+	delete(h.rooms, r.trackID)
+	delete(h.refs, r)
+	return true
+}
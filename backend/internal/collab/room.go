@@ -0,0 +1,349 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+const (
+	persistInterval = 5 * time.Second
+	persistTimeout  = 10 * time.Second
+	revisionLabel   = "Live session"
+)
+
+// event is a join, a message or a leave of one client. They share a channel
+// so the room sees each client's events in the order they happened.
+type event struct {
+	kind    eventKind
+	client  *client
+	inbound inbound
+	userID  uuid.UUID
+}
+
+type eventKind int
+
+const (
+	eventJoin eventKind = iota
+	eventMessage
+	eventLeave
+	eventDisconnect
+)
+
+// room serializes every edit to one track through a single goroutine. The
+// order in which ops reach run is the order all editors apply them in, and
+// each accepted batch gets the next seq so clients can detect gaps.
+type room struct {
+	hub     *Hub
+	trackID uuid.UUID
+
+	graph   *graph.Graph
+	version int32
+	seq     int64
+
+	// pending holds ops accepted since the last save. If the track was saved
+	// through the REST API in the meantime, they are replayed on top of it.
+	pending    []graph.Op
+	lastEditor uuid.UUID
+
+	clients map[*client]bool
+	events  chan event
+}
+
+func newRoom(hub *Hub, track sqlc.Track, g *graph.Graph) *room {
+	return &room{
+		hub:     hub,
+		trackID: track.ID,
+		graph:   g,
+		version: track.Version,
+		clients: make(map[*client]bool),
+		events:  make(chan event, 256),
+	}
+}
+
+func (r *room) run() {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-r.events:
+			switch ev.kind {
+			case eventJoin:
+				r.join(ev.client)
+			case eventMessage:
+				r.handle(ev.client, ev.inbound)
+			case eventLeave:
+				if r.leave(ev.client) {
+					return
+				}
+			case eventDisconnect:
+				r.disconnect(ev.userID)
+			}
+
+		case <-ticker.C:
+			if len(r.pending) == 0 {
+				r.refresh()
+			} else {
+				r.persist()
+			}
+		}
+	}
+}
+
+// join sends the newcomer a snapshot. The room may have sat idle while the
+// track was saved elsewhere, so it first checks for a newer stored version.
+func (r *room) join(c *client) {
+	r.refresh()
+	r.clients[c] = true
+	c.enqueue(r.snapshot(c))
+	r.broadcastPresence()
+}
+
+// leave drops a departing client and reports whether the room closed because
+// it was the last one.
+func (r *room) leave(c *client) bool {
+	delete(r.clients, c)
+	close(c.send)
+	if r.hub.release(r) {
+		r.persist()
+		if r.hub.close(r) {
+			return true
+		}
+	}
+	r.broadcastPresence()
+	return false
+}
+
+// disconnect closes a user's connections after their access to the track
+// changed. Their editors reconnect and are let in with the new role, if any.
+func (r *room) disconnect(userID uuid.UUID) {
+	for c := range r.clients {
+		if c.userID == userID {
+			c.enqueue(outbound{Type: MsgError, Seq: r.seq, Error: "your access to this track changed"})
+			_ = c.conn.Close()
+		}
+	}
+}
+
+func (r *room) handle(c *client, msg inbound) {
+	switch msg.Type {
+	case MsgOps:
+		r.applyOps(c, msg)
+	case MsgSelect:
+		c.selected = msg.NodeID
+		r.broadcastPresence()
+	default:
+		c.enqueue(outbound{Type: MsgError, ID: msg.ID, Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// applyOps applies a batch atomically. A batch that no longer fits the graph,
+// typically because another editor removed a node first, is rejected and the
+// sender gets a fresh snapshot to rebase its local state on.
+func (r *room) applyOps(c *client, msg inbound) {
+	if len(msg.Ops) == 0 {
+		return
+	}
+	if c.readOnly {
+		c.enqueue(outbound{Type: MsgReject, Seq: r.seq, ID: msg.ID, Error: "viewers cannot edit this track"})
+		return
+	}
+
+	next, err := r.graph.Clone()
+	if err != nil {
+		log.Printf("Warning: failed to copy collab graph for track %s: %v\n", r.trackID, err)
+		c.enqueue(outbound{Type: MsgReject, Seq: r.seq, ID: msg.ID, Error: "failed to apply ops"})
+		return
+	}
+	if err := next.Apply(msg.Ops); err != nil {
+		reject := outbound{Type: MsgReject, Seq: r.seq, ID: msg.ID, Error: err.Error()}
+		var opErr *graph.OpError
+		if errors.As(err, &opErr) {
+			reject.Op = &opErr.Index
+			reject.Error = opErr.Message
+		}
+		c.enqueue(reject)
+		c.enqueue(r.snapshot(c))
+		return
+	}
+	if err := graph.Validate(next); err != nil {
+		c.enqueue(outbound{Type: MsgReject, Seq: r.seq, ID: msg.ID, Error: err.Error()})
+		c.enqueue(r.snapshot(c))
+		return
+	}
+
+	r.graph = next
+	r.seq++
+	r.pending = append(r.pending, msg.Ops...)
+	r.lastEditor = c.userID
+
+	r.broadcast(outbound{
+		Type:     MsgOps,
+		Seq:      r.seq,
+		ID:       msg.ID,
+		ClientID: c.id,
+		UserID:   c.userID.String(),
+		Ops:      msg.Ops,
+	})
+}
+
+// persist writes the live graph through UpdateTrackGraph, conditioned on the
+// version the room last saw. If someone saved the track outside the session
+// since then, the stored graph becomes the new base and pending ops are
+// replayed on it; ops that no longer apply are dropped and every editor is
+// resynced with a snapshot.
+func (r *room) persist() {
+	if len(r.pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancel()
+
+	track, err := r.save(ctx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if err = r.rebase(ctx); err == nil {
+			track, err = r.save(ctx)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: failed to persist collab session for track %s: %v\n", r.trackID, err)
+		return
+	}
+
+	r.version = track.Version
+	r.pending = nil
+	r.broadcast(outbound{Type: MsgSaved, Seq: r.seq, Version: r.version})
+}
+
+func (r *room) save(ctx context.Context) (sqlc.Track, error) {
+	data, err := json.Marshal(r.graph)
+	if err != nil {
+		return sqlc.Track{}, err
+	}
+
+	var track sqlc.Track
+	err = database.WithTx(ctx, r.hub.pool, func(q *sqlc.Queries) error {
+		track, err = q.UpdateTrackGraph(ctx, sqlc.UpdateTrackGraphParams{
+			ID:              r.trackID,
+			GraphData:       data,
+			ExpectedVersion: pgtype.Int4{Int32: r.version, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return database.RecordRevision(ctx, q, track, r.lastEditor, revisionLabel)
+	})
+	return track, err
+}
+
+// refresh reloads the track if it was saved outside the session, by a REST
+// update, a revision restore or a migration, since the room last saw it.
+func (r *room) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancel()
+
+	track, err := r.hub.db.GetTrack(ctx, r.trackID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.closeDeleted()
+		return
+	}
+	if err == nil && track.Version != r.version {
+		err = r.reload(track)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to refresh collab session for track %s: %v\n", r.trackID, err)
+	}
+}
+
+func (r *room) rebase(ctx context.Context) error {
+	track, err := r.hub.db.GetTrack(ctx, r.trackID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.closeDeleted()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return r.reload(track)
+}
+
+// closeDeleted ends the session of a track that was deleted or trashed under
+// it; there is nothing left to save into.
+func (r *room) closeDeleted() {
+	r.pending = nil
+	for c := range r.clients {
+		c.enqueue(outbound{Type: MsgError, Seq: r.seq, Error: "track was deleted"})
+		_ = c.conn.Close()
+	}
+}
+
+// reload makes the stored track the room's base, replays pending ops on it
+// and resyncs every editor with a snapshot.
+func (r *room) reload(track sqlc.Track) error {
+	base, err := graph.Parse(track.GraphData)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range r.pending {
+		next, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if err := next.Apply([]graph.Op{op}); err != nil {
+			continue
+		}
+		if graph.Validate(next) == nil {
+			base = next
+		}
+	}
+
+	r.graph = base
+	r.version = track.Version
+	r.seq++
+	for c := range r.clients {
+		c.enqueue(r.snapshot(c))
+	}
+	return nil
+}
+
+func (r *room) snapshot(c *client) outbound {
+	return outbound{
+		Type:     MsgSnapshot,
+		Seq:      r.seq,
+		ClientID: c.id,
+		Graph:    r.graph,
+		Presence: r.presence(),
+		Version:  r.version,
+	}
+}
+
+func (r *room) presence() []Presence {
+	list := make([]Presence, 0, len(r.clients))
+	for c := range r.clients {
+		list = append(list, c.presence())
+	}
+	return list
+}
+
+func (r *room) broadcastPresence() {
+	r.broadcast(outbound{Type: MsgPresence, Seq: r.seq, Presence: r.presence()})
+}
+
+func (r *room) broadcast(msg outbound) {
+	for c := range r.clients {
+		c.enqueue(msg)
+	}
+}
@@ -0,0 +1,289 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+// fakeQueries serves one stored track, which tests update to simulate saves
+// made outside the session.
+type fakeQueries struct {
+	track sqlc.Track
+}
+
+func (f *fakeQueries) GetTrack(ctx context.Context, id uuid.UUID) (sqlc.Track, error) {
+	if id != f.track.ID {
+		return sqlc.Track{}, pgx.ErrNoRows
+	}
+	return f.track, nil
+}
+
+func (f *fakeQueries) GetUser(ctx context.Context, id uuid.UUID) (sqlc.User, error) {
+	return sqlc.User{}, pgx.ErrNoRows
+}
+
+func testRoom(t *testing.T) (*Hub, *room) {
+	t.Helper()
+	g := &graph.Graph{Nodes: []graph.Node{
+		{ID: "osc", Type: "oscillator", Params: map[string]interface{}{"frequency": 440.0}},
+	}}
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	track := sqlc.Track{ID: uuid.New(), Version: 1, GraphData: data}
+	hub := &Hub{
+		db:    &fakeQueries{track: track},
+		rooms: make(map[uuid.UUID]*room),
+		refs:  make(map[*room]int),
+	}
+	return hub, newRoom(hub, track, g)
+}
+
+func testClient(readOnly bool) *client {
+	return newClient(nil, uuid.New(), "editor", readOnly)
+}
+
+// recv returns the next message queued for c.
+func recv(t *testing.T, c *client) outbound {
+	t.Helper()
+	select {
+	case data, ok := <-c.send:
+		if !ok {
+			t.Fatal("send channel closed")
+		}
+		var msg outbound
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+	return outbound{}
+}
+
+// drain discards everything queued for c so far.
+func drain(c *client) {
+	for {
+		select {
+		case <-c.send:
+		default:
+			return
+		}
+	}
+}
+
+func setFrequency(value float64) []graph.Op {
+	return []graph.Op{{Op: graph.OpSetParam, ID: "osc", Key: "frequency", Value: value}}
+}
+
+func TestRoomBroadcastsAcceptedOps(t *testing.T) {
+	_, r := testRoom(t)
+	a, b := testClient(false), testClient(false)
+	r.join(a)
+	r.join(b)
+	drain(a)
+	drain(b)
+
+	r.applyOps(a, inbound{Type: MsgOps, ID: "1", Ops: setFrequency(220)})
+
+	for _, c := range []*client{a, b} {
+		msg := recv(t, c)
+		if msg.Type != MsgOps || msg.Seq != 1 || msg.ID != "1" || msg.ClientID != a.id {
+			t.Errorf("got %+v", msg)
+		}
+	}
+	if got := r.graph.Nodes[0].Params["frequency"]; got != 220.0 {
+		t.Errorf("frequency = %v, want 220", got)
+	}
+	if len(r.pending) != 1 || r.lastEditor != a.userID {
+		t.Errorf("pending %v by %s", r.pending, r.lastEditor)
+	}
+}
+
+func TestRoomRejectsViewerOps(t *testing.T) {
+	_, r := testRoom(t)
+	viewer := testClient(true)
+	r.join(viewer)
+	drain(viewer)
+
+	r.applyOps(viewer, inbound{Type: MsgOps, ID: "1", Ops: setFrequency(220)})
+
+	if msg := recv(t, viewer); msg.Type != MsgReject || msg.ID != "1" {
+		t.Errorf("got %+v, want a rejection", msg)
+	}
+	if r.seq != 0 || len(r.pending) != 0 {
+		t.Errorf("viewer ops were applied")
+	}
+}
+
+func TestRoomRejectsStaleOpsWithSnapshot(t *testing.T) {
+	_, r := testRoom(t)
+	c := testClient(false)
+	r.join(c)
+	drain(c)
+
+	ops := append(setFrequency(220), graph.Op{Op: graph.OpRemoveNode, ID: "gone"})
+	r.applyOps(c, inbound{Type: MsgOps, ID: "1", Ops: ops})
+
+	reject := recv(t, c)
+	if reject.Type != MsgReject || reject.Op == nil || *reject.Op != 1 {
+		t.Errorf("got %+v, want a rejection of op 1", reject)
+	}
+	if msg := recv(t, c); msg.Type != MsgSnapshot {
+		t.Errorf("got %s, want a snapshot", msg.Type)
+	}
+	// The batch is atomic, so the valid first op was not kept either.
+	if got := r.graph.Nodes[0].Params["frequency"]; got != 440.0 {
+		t.Errorf("frequency = %v, want 440", got)
+	}
+}
+
+// A room that sat idle while the track was saved through the REST API must not
+// hand newcomers its old graph; pending ops are replayed on the stored one.
+func TestRoomJoinReloadsNewerTrack(t *testing.T) {
+	hub, r := testRoom(t)
+	a := testClient(false)
+	r.join(a)
+	r.applyOps(a, inbound{Type: MsgOps, ID: "1", Ops: setFrequency(220)})
+	drain(a)
+
+	stored := &graph.Graph{Nodes: []graph.Node{
+		{ID: "osc", Type: "oscillator", Params: map[string]interface{}{"frequency": 330.0}},
+		{ID: "osc2", Type: "oscillator", Params: map[string]interface{}{"frequency": 110.0}},
+	}}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := hub.db.(*fakeQueries)
+	db.track.GraphData = data
+	db.track.Version = 2
+
+	b := testClient(false)
+	r.join(b)
+
+	for _, c := range []*client{a, b} {
+		msg := recv(t, c)
+		if msg.Type != MsgSnapshot || msg.Version != 2 || msg.Graph == nil || len(msg.Graph.Nodes) != 2 {
+			t.Fatalf("got %+v, want a snapshot of version 2", msg)
+		}
+		if got := msg.Graph.Nodes[0].Params["frequency"]; got != 220.0 {
+			t.Errorf("frequency = %v, want the pending 220", got)
+		}
+	}
+	if len(r.pending) != 1 {
+		t.Errorf("pending = %v, want the op kept for the next save", r.pending)
+	}
+}
+
+func TestRoomRefreshKeepsCurrentTrack(t *testing.T) {
+	_, r := testRoom(t)
+	c := testClient(false)
+	r.join(c)
+	drain(c)
+
+	r.refresh()
+
+	select {
+	case data := <-c.send:
+		t.Errorf("got %s, want nothing", data)
+	default:
+	}
+	if r.seq != 0 {
+		t.Errorf("seq = %d, want 0", r.seq)
+	}
+}
+
+// A client that disconnects straight away sends its join, messages and leave
+// back to back; the room must see them in that order.
+func TestRoomHandlesEventsInOrder(t *testing.T) {
+	hub, r := testRoom(t)
+	hub.rooms[r.trackID] = r
+	hub.refs[r] = 1
+	done := make(chan struct{})
+	go func() {
+		r.run()
+		close(done)
+	}()
+
+	c := testClient(false)
+	r.events <- event{kind: eventJoin, client: c}
+	r.events <- event{kind: eventMessage, client: c, inbound: inbound{Type: MsgSelect}}
+	r.events <- event{kind: eventLeave, client: c}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("room did not close after its last client left")
+	}
+
+	var types []string
+	for data := range c.send {
+		var msg outbound
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, msg.Type)
+	}
+	if len(types) == 0 || types[0] != MsgSnapshot {
+		t.Errorf("got %v, want a snapshot first", types)
+	}
+	if _, ok := hub.rooms[r.trackID]; ok {
+		t.Error("closed room is still registered")
+	}
+}
+
+func TestHubRefReusesOpenRoom(t *testing.T) {
+	hub, r := testRoom(t)
+	if hub.ref(r.trackID) != nil {
+		t.Fatal("ref opened a room")
+	}
+
+	hub.rooms[r.trackID] = r
+	if got := hub.ref(r.trackID); got != r {
+		t.Fatal("ref did not return the open room")
+	}
+	if got := hub.ref(r.trackID); got != r || hub.refs[r] != 2 {
+		t.Fatalf("refs = %d, want 2", hub.refs[r])
+	}
+
+	if hub.release(r) {
+		t.Error("release reported last with one reference left")
+	}
+	if !hub.release(r) {
+		t.Error("release did not report the last reference")
+	}
+	if !hub.close(r) {
+		t.Error("close kept an unreferenced room")
+	}
+	if hub.ref(r.trackID) != nil {
+		t.Error("closed room is still registered")
+	}
+}
+
+func TestHubCloseKeepsRejoinedRoom(t *testing.T) {
+	hub, r := testRoom(t)
+	hub.rooms[r.trackID] = r
+	hub.ref(r.trackID)
+
+	if !hub.release(r) {
+		t.Fatal("release did not report the last reference")
+	}
+	// An editor joins while the room is saving.
+	hub.ref(r.trackID)
+	if hub.close(r) {
+		t.Fatal("close dropped a room with an editor in it")
+	}
+	if hub.rooms[r.trackID] != r {
+		t.Error("room was unregistered")
+	}
+}
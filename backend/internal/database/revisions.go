@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+// RevisionRetention is how many revisions are kept per track. Older ones are
+// deleted as new ones are recorded.
+const RevisionRetention = 200
+
+// RecordRevision snapshots the track's current graph into its history. Nothing
+// is recorded when the graph is unchanged since the latest revision.
+func RecordRevision(ctx context.Context, q *sqlc.Queries, track sqlc.Track, authorID uuid.UUID, label string) error {
+	rows, err := q.CreateTrackRevision(ctx, sqlc.CreateTrackRevisionParams{
+		TrackID:   track.ID,
+		AuthorID:  pgtype.UUID{Bytes: authorID, Valid: true},
+		Label:     pgtype.Text{String: label, Valid: label != ""},
+		GraphData: track.GraphData,
+	})
+	if err != nil || rows == 0 {
+		return err
+	}
+	return q.PruneTrackRevisions(ctx, sqlc.PruneTrackRevisionsParams{
+		TrackID: track.ID,
+		Keep:    RevisionRetention,
+	})
+}
@@ -0,0 +1,25 @@
+// Package database holds helpers shared by everything that talks to the
+// database through the generated sqlc queries.
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+// WithTx runs fn against queries bound to a new transaction and commits only
+// if fn succeeds.
+func WithTx(ctx context.Context, pool *pgxpool.Pool, fn func(q *sqlc.Queries) error) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(sqlc.New(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
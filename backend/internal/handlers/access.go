@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/theosov/hexa/internal/access"
+)
+
+// accessFailure maps a failed access.Authorizer check to an HTTP error.
+func accessFailure(err error) *fiber.Error {
+	switch {
+	case errors.Is(err, access.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "track not found")
+	case errors.Is(err, access.ErrForbidden):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	default:
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to fetch track")
+	}
+}
+
+func accessError(c *fiber.Ctx, err error) error {
+	return sendFailure(c, accessFailure(err))
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+type UnusedFile struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+type TrackAnalysisResponse struct {
+	*graph.Analysis
+	UnusedSamples  []UnusedFile `json:"unused_samples"`
+	UnusedImpulses []UnusedFile `json:"unused_impulses"`
+}
+
+// AnalyzeTrack reports on a track's signal flow (see graph.Analyze) and lists
+// the samples and impulses uploaded to it that neither the graph nor any of
+// its scenes refer to.
+func (h *TracksHandler) AnalyzeTrack(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	track, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	g, err := graph.Parse(track.GraphData)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "track has invalid graph data",
+		})
+	}
+
+	pgTrackID := uuidToPgtype(track.ID)
+	scenes, err := h.db.ListScenesByTrack(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch scenes",
+		})
+	}
+	samples, err := h.db.ListTrackSamples(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch samples",
+		})
+	}
+	impulses, err := h.db.ListTrackImpulses(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch impulses",
+		})
+	}
+
+	used := g.FileIDs()
+	for _, scene := range scenes {
+		var state SceneState
+		if err := json.Unmarshal(scene.StateData, &state); err != nil {
+			continue
+		}
+		for _, params := range state.NodeParams {
+			graph.CollectFileIDs(params, used)
+		}
+	}
+
+	response := TrackAnalysisResponse{
+		Analysis:       graph.Analyze(g),
+		UnusedSamples:  []UnusedFile{},
+		UnusedImpulses: []UnusedFile{},
+	}
+	for _, sample := range samples {
+		if !used[sample.ID.String()] {
+			response.UnusedSamples = append(response.UnusedSamples, UnusedFile{
+				ID:       sample.ID.String(),
+				Filename: sample.Filename,
+				Size:     sample.FileSize,
+			})
+		}
+	}
+	for _, impulse := range impulses {
+		if !used[impulse.ID.String()] {
+			response.UnusedImpulses = append(response.UnusedImpulses, UnusedFile{
+				ID:       impulse.ID.String(),
+				Filename: impulse.Filename,
+				Size:     impulse.FileSize,
+			})
+		}
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/upload"
+)
+
+// audioColumns holds probed metadata in the nullable columns shared by
+// samples, impulses and template files.
+type audioColumns struct {
+	Duration   pgtype.Float8
+	SampleRate pgtype.Int4
+	Channels   pgtype.Int4
+	BitDepth   pgtype.Int4
+	Codec      pgtype.Text
+}
+
+func newAudioColumns(info *audio.Info) audioColumns {
+	return audioColumns{
+		Duration:   pgtype.Float8{Float64: info.Duration, Valid: true},
+		SampleRate: pgtype.Int4{Int32: int32(info.SampleRate), Valid: true},
+		Channels:   pgtype.Int4{Int32: int32(info.Channels), Valid: true},
+		BitDepth:   pgtype.Int4{Int32: int32(info.BitDepth), Valid: info.BitDepth > 0},
+		Codec:      pgtype.Text{String: info.Codec, Valid: true},
+	}
+}
+
+// audioInfo returns the stored metadata for a response, or nil for files
+// uploaded before metadata was recorded.
+func audioInfo(duration pgtype.Float8, sampleRate, channels, bitDepth pgtype.Int4, codec pgtype.Text) *audio.Info {
+	if !duration.Valid {
+		return nil
+	}
+	return &audio.Info{
+		Duration:   duration.Float64,
+		SampleRate: int(sampleRate.Int32),
+		Channels:   int(channels.Int32),
+		BitDepth:   int(bitDepth.Int32),
+		Codec:      codec.String,
+	}
+}
+
+func sampleAudio(s sqlc.Sample) *audio.Info {
+	return audioInfo(s.Duration, s.SampleRate, s.Channels, s.BitDepth, s.Codec)
+}
+
+func impulseAudio(i sqlc.ReverbImpulse) *audio.Info {
+	return audioInfo(i.Duration, i.SampleRate, i.Channels, i.BitDepth, i.Codec)
+}
+
+// uploadFailure maps a failed upload.Policy check to an HTTP error.
+func uploadFailure(err error) *fiber.Error {
+	var rejection *upload.Rejection
+	if errors.As(err, &rejection) {
+		if rejection.Err != nil {
+			log.Printf("Warning: rejected upload: %v\n", rejection.Err)
+		}
+		return fiber.NewError(fiber.StatusBadRequest, rejection.Reason)
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, "failed to read audio file")
+}
@@ -258,6 +258,7 @@ func (h *AuthHandler) GetCurrentUser(c *fiber.Ctx) error {
 		"avatar_url":    user.AvatarUrl,
 		"storage_used":  user.StorageUsed,
 		"storage_limit": user.StorageLimit,
+		"is_admin":      user.IsAdmin,
 	})
 }
 
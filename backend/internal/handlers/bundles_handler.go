@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/bundle"
+	"github.com/theosov/hexa/pkg/graph"
+	"github.com/theosov/hexa/pkg/storage"
+	"github.com/theosov/hexa/pkg/upload"
+)
+
+const (
+	// BundleMaxSize is the largest bundle accepted for import, and with it
+	// the largest request body the server accepts.
+	BundleMaxSize = 256 * 1024 * 1024
+
+	bundleStreamTimeout = 10 * time.Minute
+)
+
+type BundlesHandler struct {
+	db      *sqlc.Queries
+	pool    *pgxpool.Pool
+	storage *storage.MinIOClient
+	access  *access.Authorizer
+}
+
+func NewBundlesHandler(db *sqlc.Queries, pool *pgxpool.Pool, storage *storage.MinIOClient) *BundlesHandler {
+	return &BundlesHandler{
+		db:      db,
+		pool:    pool,
+		storage: storage,
+		access:  access.NewAuthorizer(db),
+	}
+}
+
+func bundleFilename(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == ' ' {
+			return r
+		}
+		return -1
+	}, title)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "track"
+	}
+	return name + bundle.Extension
+}
+
+// ExportBundle streams a .hexa archive of a track the user can view: the
+// track, its scenes and every sample and impulse uploaded to it.
+func (h *BundlesHandler) ExportBundle(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	track, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	pgTrackID := uuidToPgtype(track.ID)
+	samples, err := h.db.ListTrackSamples(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch samples",
+		})
+	}
+	impulses, err := h.db.ListTrackImpulses(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch impulses",
+		})
+	}
+	scenes, err := h.db.ListScenesByTrack(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch scenes",
+		})
+	}
+
+	summary := trackSummary(track)
+	c.Set(fiber.HeaderContentType, bundle.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, bundleFilename(track.Title)))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), bundleStreamTimeout)
+		defer cancel()
+
+		bw := bundle.NewWriter(w, bundle.Track{
+			Title:       summary.Title,
+			Description: summary.Description,
+			BPM:         summary.BPM,
+			Graph:       track.GraphData,
+		})
+		for _, scene := range scenes {
+			bw.AddScene(bundle.Scene{
+				Name:     scene.Name,
+				Position: scene.Position.Int32,
+				State:    scene.StateData,
+			})
+		}
+
+		addFile := func(file bundle.File, s3Key string) error {
+			obj, err := h.storage.GetFile(ctx, s3Key)
+			if err != nil {
+				return err
+			}
+			defer obj.Close()
+			return bw.AddFile(file, obj)
+		}
+		for _, sample := range samples {
+			if err := addFile(bundle.File{
+				ID:       sample.ID.String(),
+				Kind:     bundle.KindSample,
+				Filename: sample.Filename,
+				MimeType: sample.MimeType.String,
+			}, sample.S3Key); err != nil {
+				// Headers are already sent; a truncated archive fails to
+				// open, which is the best signal left to the client.
+				log.Printf("Warning: failed to bundle sample %s of track %s: %v\n", sample.ID, track.ID, err)
+				return
+			}
+		}
+		for _, impulse := range impulses {
+			if err := addFile(bundle.File{
+				ID:       impulse.ID.String(),
+				Kind:     bundle.KindImpulse,
+				Filename: impulse.Filename,
+				MimeType: impulse.MimeType.String,
+			}, impulse.S3Key); err != nil {
+				log.Printf("Warning: failed to bundle impulse %s of track %s: %v\n", impulse.ID, track.ID, err)
+				return
+			}
+		}
+
+		if err := bw.Close(); err != nil {
+			log.Printf("Warning: failed to finish bundle of track %s: %v\n", track.ID, err)
+			return
+		}
+		_ = w.Flush()
+	})
+
+	return nil
+}
+
+// ImportBundle recreates a track from an uploaded .hexa archive under the
+// caller's account. Every file gets a new id and the graph and scenes are
+// rewritten to match; the files count towards the caller's storage. Files
+// must decode as audio, as they would when uploaded directly.
+func (h *BundlesHandler) ImportBundle(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	fileHeader, err := c.FormFile("bundle")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "bundle is required",
+		})
+	}
+	if fileHeader.Size > BundleMaxSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("bundle too large (max %dMB)", BundleMaxSize/1024/1024),
+		})
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to open bundle",
+		})
+	}
+	defer src.Close()
+
+	br, err := bundle.Open(src, fileHeader.Size)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	manifest := br.Manifest
+
+	if _, err := graph.ValidateJSON(manifest.Track.Graph); err != nil {
+		return graphValidationError(c, err)
+	}
+
+	var totalSize int64
+	for _, file := range manifest.Files {
+		totalSize += file.Size
+	}
+
+	user, err := h.db.GetUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check storage",
+		})
+	}
+	if user.StorageUsed.Int64+totalSize > user.StorageLimit.Int64 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "storage limit exceeded",
+		})
+	}
+
+	// The manifest sizes only gate the import; files are recorded and
+	// charged with the bytes actually stored.
+	uploaded := make(map[string]copiedFile, len(manifest.Files))
+	files := make([]trackFile, 0, len(manifest.Files))
+	cleanup := func() {
+		for _, file := range uploaded {
+			if err := h.storage.DeleteFile(c.Context(), file.s3Key); err != nil {
+				log.Printf("Warning: failed to delete imported file %s: %v\n", file.s3Key, err)
+			}
+		}
+	}
+	for _, file := range manifest.Files {
+		// Files are read three times, to verify their checksum, to check them
+		// like any other upload and to store them; entries are not
+		// compressed, so this is cheap.
+		if err := br.Verify(file); err != nil {
+			cleanup()
+			if errors.Is(err, bundle.ErrChecksum) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("%s does not match its checksum", file.Filename),
+				})
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		rc, err := br.Open(file)
+		if err != nil {
+			cleanup()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		policy := upload.Samples
+		if file.Kind == bundle.KindImpulse {
+			policy = upload.Impulses
+		}
+		result, err := policy.Check(c.Context(), rc, file.Size)
+		rc.Close()
+		if err != nil {
+			cleanup()
+			if errors.Is(err, bundle.ErrChecksum) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("%s does not match its checksum", file.Filename),
+				})
+			}
+			failure := uploadFailure(err)
+			return c.Status(failure.Code).JSON(fiber.Map{
+				"error": fmt.Sprintf("%s: %s", file.Filename, failure.Message),
+			})
+		}
+
+		rc, err = br.Open(file)
+		if err != nil {
+			cleanup()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		imported := copiedFile{
+			id:    uuid.New(),
+			s3Key: fmt.Sprintf("%ss/%s/%s%s", file.Kind, userID.String(), uuid.New().String(), result.Format.Extension),
+		}
+		counted := &countingReader{r: rc}
+		err = h.storage.UploadFile(c.Context(), imported.s3Key, counted, file.Size, result.Format.MimeType)
+		rc.Close()
+		imported.size = counted.n
+		if errors.Is(err, bundle.ErrChecksum) {
+			cleanup()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("%s does not match its checksum", file.Filename),
+			})
+		}
+		if err != nil {
+			cleanup()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to upload file",
+			})
+		}
+		if url, err := h.storage.GetPresignedURL(c.Context(), imported.s3Key, 1*time.Hour); err == nil {
+			imported.url = url.String()
+		}
+		uploaded[file.ID] = imported
+		files = append(files, trackFile{
+			ref:      file.ID,
+			kind:     file.Kind,
+			filename: file.Filename,
+			size:     imported.size,
+			mimeType: pgtype.Text{String: result.Format.MimeType, Valid: true},
+			audio:    newAudioColumns(result.Info),
+		})
+	}
+
+	remap := func(id string) (string, string, bool) {
+		file, ok := uploaded[id]
+		return file.id.String(), file.url, ok
+	}
+
+	g, err := graph.Parse(manifest.Track.Graph)
+	if err != nil {
+		cleanup()
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "invalid graph data",
+		})
+	}
+	g.RemapFiles(remap)
+	graphJSON, err := json.Marshal(g)
+	if err != nil {
+		cleanup()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encode graph data",
+		})
+	}
+
+	title := c.FormValue("title", manifest.Track.Title)
+	bpm := manifest.Track.BPM
+	if bpm == 0 {
+		bpm = 120
+	}
+
+	var track sqlc.Track
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		track, err = q.CreateTrack(c.Context(), sqlc.CreateTrackParams{
+			UserID: uuidToPgtype(userID),
+			Title:  title,
+			Description: pgtype.Text{
+				String: manifest.Track.Description,
+				Valid:  manifest.Track.Description != "",
+			},
+			Bpm:       pgtype.Int4{Int32: bpm, Valid: true},
+			GraphData: graphJSON,
+		})
+		if err != nil {
+			return err
+		}
+		newTrackID := uuidToPgtype(track.ID)
+
+		if err := createTrackFiles(c.Context(), q, userID, track.ID, files, uploaded); err != nil {
+			return err
+		}
+
+		for _, scene := range manifest.Scenes {
+			state := []byte(scene.State)
+			if len(state) == 0 {
+				state = []byte("{}")
+			}
+			if _, err := q.CreateScene(c.Context(), sqlc.CreateSceneParams{
+				ID:        uuid.New(),
+				TrackID:   newTrackID,
+				Name:      scene.Name,
+				StateData: remapSceneState(state, remap),
+				Position:  pgtype.Int4{Int32: scene.Position, Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := database.RecordRevision(c.Context(), q, track, userID, "Imported from bundle"); err != nil {
+			return err
+		}
+		return chargeStorage(c.Context(), q, userID, uploaded)
+	})
+	if err != nil {
+		cleanup()
+		if errors.Is(err, errStorageLimit) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "storage limit exceeded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to import bundle",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+	response.Role = string(access.RoleOwner)
+
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/collab"
+)
+
+type CollabHandler struct {
+	db     *sqlc.Queries
+	hub    *collab.Hub
+	access *access.Authorizer
+}
+
+func NewCollabHandler(db *sqlc.Queries, hub *collab.Hub) *CollabHandler {
+	return &CollabHandler{
+		db:     db,
+		hub:    hub,
+		access: access.NewAuthorizer(db),
+	}
+}
+
+// Upgrade checks access before the connection is upgraded, so that a missing
+// track is still reported as a regular HTTP error.
+func (h *CollabHandler) Upgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "websocket upgrade required",
+		})
+	}
+
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	_, role, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	c.Locals("trackID", trackID)
+	c.Locals("readOnly", !role.Allows(access.RoleEditor))
+	return c.Next()
+}
+
+func (h *CollabHandler) Session() fiber.Handler {
+	return websocket.New(func(conn *websocket.Conn) {
+		trackID := conn.Locals("trackID").(uuid.UUID)
+		userID := conn.Locals("userID").(uuid.UUID)
+		readOnly := conn.Locals("readOnly").(bool)
+		h.hub.Serve(conn, trackID, userID, readOnly)
+	})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/bundle"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+// errStorageLimit is returned from a transaction when charging for new files
+// would take the user over their storage limit.
+var errStorageLimit = errors.New("storage limit exceeded")
+
+// trackFile is an uploaded sample or impulse to be recreated for a new track
+// or template: where its data is stored and the metadata of its row. ref is
+// the id the source graph and scenes refer to it by.
+type trackFile struct {
+	ref      string
+	kind     string
+	s3Key    string
+	filename string
+	size     int64
+	mimeType pgtype.Text
+	audio    audioColumns
+}
+
+func sampleFile(s sqlc.Sample) trackFile {
+	return trackFile{
+		ref:      s.ID.String(),
+		kind:     bundle.KindSample,
+		s3Key:    s.S3Key,
+		filename: s.Filename,
+		size:     s.FileSize,
+		mimeType: s.MimeType,
+		audio:    audioColumns{s.Duration, s.SampleRate, s.Channels, s.BitDepth, s.Codec},
+	}
+}
+
+func impulseFile(i sqlc.ReverbImpulse) trackFile {
+	return trackFile{
+		ref:      i.ID.String(),
+		kind:     bundle.KindImpulse,
+		s3Key:    i.S3Key,
+		filename: i.Filename,
+		size:     i.FileSize,
+		mimeType: i.MimeType,
+		audio:    audioColumns{i.Duration, i.SampleRate, i.Channels, i.BitDepth, i.Codec},
+	}
+}
+
+func templateFile(f sqlc.TemplateFile) trackFile {
+	return trackFile{
+		ref:      f.ID.String(),
+		kind:     f.Kind,
+		s3Key:    f.S3Key,
+		filename: f.Filename,
+		size:     f.FileSize,
+		mimeType: f.MimeType,
+		audio:    audioColumns{f.Duration, f.SampleRate, f.Channels, f.BitDepth, f.Codec},
+	}
+}
+
+// copiedFile is the new copy of a trackFile, owned by the user it was made
+// for.
+type copiedFile struct {
+	id    uuid.UUID
+	s3Key string
+	url   string
+	size  int64
+}
+
+// copyStoredFiles copies files under prefix/userID, keyed by their ref.
+// prefix returns the key prefix for a file kind. Copies made before a
+// failure are removed again.
+func copyStoredFiles(ctx context.Context, store *storage.MinIOClient, userID uuid.UUID, files []trackFile, prefix func(kind string) string) (map[string]copiedFile, error) {
+	copies := make(map[string]copiedFile, len(files))
+	for _, file := range files {
+		dst := copiedFile{
+			id:    uuid.New(),
+			s3Key: fmt.Sprintf("%s/%s/%s%s", prefix(file.kind), userID.String(), uuid.New().String(), filepath.Ext(file.s3Key)),
+			size:  file.size,
+		}
+		if err := store.CopyFile(ctx, file.s3Key, dst.s3Key); err != nil {
+			deleteCopies(ctx, store, copies)
+			return nil, err
+		}
+		if url, err := store.GetPresignedURL(ctx, dst.s3Key, 1*time.Hour); err == nil {
+			dst.url = url.String()
+		}
+		copies[file.ref] = dst
+	}
+	return copies, nil
+}
+
+func deleteCopies(ctx context.Context, store *storage.MinIOClient, copies map[string]copiedFile) {
+	for _, file := range copies {
+		if err := store.DeleteFile(ctx, file.s3Key); err != nil {
+			log.Printf("Warning: failed to delete copied file: %v\n", err)
+		}
+	}
+}
+
+// createTrackFiles records the copies of files as samples and impulses of
+// trackID owned by userID.
+func createTrackFiles(ctx context.Context, q *sqlc.Queries, userID, trackID uuid.UUID, files []trackFile, copies map[string]copiedFile) error {
+	for _, file := range files {
+		dst := copies[file.ref]
+		var err error
+		switch file.kind {
+		case bundle.KindSample:
+			_, err = q.CopySample(ctx, sqlc.CopySampleParams{
+				ID:         dst.id,
+				UserID:     uuidToPgtype(userID),
+				TrackID:    uuidToPgtype(trackID),
+				Filename:   file.filename,
+				FileSize:   dst.size,
+				S3Key:      dst.s3Key,
+				MimeType:   file.mimeType,
+				Duration:   file.audio.Duration,
+				SampleRate: file.audio.SampleRate,
+				Channels:   file.audio.Channels,
+				BitDepth:   file.audio.BitDepth,
+				Codec:      file.audio.Codec,
+			})
+		case bundle.KindImpulse:
+			_, err = q.CopyImpulse(ctx, sqlc.CopyImpulseParams{
+				ID:         dst.id,
+				UserID:     uuidToPgtype(userID),
+				TrackID:    uuidToPgtype(trackID),
+				Filename:   file.filename,
+				FileSize:   dst.size,
+				S3Key:      dst.s3Key,
+				MimeType:   file.mimeType,
+				Duration:   file.audio.Duration,
+				SampleRate: file.audio.SampleRate,
+				Channels:   file.audio.Channels,
+				BitDepth:   file.audio.BitDepth,
+				Codec:      file.audio.Codec,
+			})
+		default:
+			err = fmt.Errorf("unknown file kind %q", file.kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chargeStorage adds the size of copies to the user's storage. The limit is
+// checked by the same statement, so concurrent imports and forks cannot
+// together overrun it the way a read-then-write would; callers check it
+// up front as well to fail before copying anything.
+func chargeStorage(ctx context.Context, q *sqlc.Queries, userID uuid.UUID, copies map[string]copiedFile) error {
+	var total int64
+	for _, file := range copies {
+		total += file.size
+	}
+	return chargeUpload(ctx, q, userID, total)
+}
+
+// chargeUpload adds size to the user's storage, or returns errStorageLimit
+// if that would take them over their limit.
+func chargeUpload(ctx context.Context, q *sqlc.Queries, userID uuid.UUID, size int64) error {
+	rows, err := q.ChargeUserStorage(ctx, sqlc.ChargeUserStorageParams{
+		ID:     userID,
+		Amount: size,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errStorageLimit
+	}
+	return nil
+}
+
+// releaseUpload credits size back to the uploader of a removed file.
+func releaseUpload(ctx context.Context, q *sqlc.Queries, uploaderID pgtype.UUID, size int64) {
+	if !uploaderID.Valid {
+		return
+	}
+	if err := q.ReleaseUserStorage(ctx, sqlc.ReleaseUserStorageParams{
+		ID:     uploaderID.Bytes,
+		Amount: size,
+	}); err != nil {
+		log.Printf("Warning: failed to release %d bytes of storage for user %s: %v\n", size, uuid.UUID(uploaderID.Bytes), err)
+	}
+}
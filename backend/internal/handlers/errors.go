@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendFailure responds with the status and message of a *fiber.Error returned
+// by one of the handler helpers, as the JSON error body every endpoint uses.
+// Any other error becomes a 500.
+func sendFailure(c *fiber.Ctx, err error) error {
+	failure := fiber.ErrInternalServerError
+	errors.As(err, &failure)
+	return c.Status(failure.Code).JSON(fiber.Map{
+		"error": failure.Message,
+	})
+}
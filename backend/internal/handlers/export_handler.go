@@ -1,21 +1,406 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/jobs"
+	"github.com/theosov/hexa/pkg/export"
+	"github.com/theosov/hexa/pkg/storage"
 )
 
-type ExportHandler struct{}
+type ExportHandler struct {
+	db      *sqlc.Queries
+	storage *storage.MinIOClient
+	worker  *jobs.ExportWorker
+	access  *access.Authorizer
+}
+
+func NewExportHandler(db *sqlc.Queries, storage *storage.MinIOClient, worker *jobs.ExportWorker) *ExportHandler {
+	return &ExportHandler{
+		db:      db,
+		storage: storage,
+		worker:  worker,
+		access:  access.NewAuthorizer(db),
+	}
+}
+
+const (
+	ExportMaxFileSize  = 200 * 1024 * 1024
+	ExportMaxDuration  = 600
+	exportPollInterval = 500 * time.Millisecond
+	// The server's WriteTimeout also bounds streamed responses, so the event
+	// stream is closed before it and EventSource reconnects on its own.
+	exportStreamWindow = 8 * time.Second
+)
+
+type ExportJobResponse struct {
+	ID          string          `json:"id"`
+	TrackID     *string         `json:"track_id"`
+	Status      string          `json:"status"`
+	Progress    float64         `json:"progress"`
+	Filename    string          `json:"filename"`
+	Error       *string         `json:"error,omitempty"`
+	DownloadURL *string         `json:"download_url,omitempty"`
+	Loudness    json.RawMessage `json:"loudness,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+	StartedAt   *string         `json:"started_at,omitempty"`
+	FinishedAt  *string         `json:"finished_at,omitempty"`
+}
+
+func formatOptionalTime(ts pgtype.Timestamp) *string {
+	if !ts.Valid {
+		return nil
+	}
+	formatted := ts.Time.Format(time.RFC3339)
+	return &formatted
+}
+
+func (h *ExportHandler) jobToResponse(ctx context.Context, job sqlc.ExportJob) ExportJobResponse {
+	resp := ExportJobResponse{
+		ID:         job.ID.String(),
+		Status:     job.Status,
+		Progress:   job.Progress,
+		Filename:   job.Filename,
+		CreatedAt:  job.CreatedAt.Time.Format(time.RFC3339),
+		StartedAt:  formatOptionalTime(job.StartedAt),
+		FinishedAt: formatOptionalTime(job.FinishedAt),
+	}
+
+	if job.TrackID.Valid {
+		trackID := uuid.UUID(job.TrackID.Bytes).String()
+		resp.TrackID = &trackID
+	}
+	if job.Error.Valid {
+		resp.Error = &job.Error.String
+	}
+	if len(job.LoudnessReport) > 0 {
+		resp.Loudness = job.LoudnessReport
+	}
+	if job.Status == jobs.StatusCompleted && job.OutputS3Key.Valid {
+		if url, err := h.storage.GetPresignedDownloadURL(ctx, job.OutputS3Key.String, job.Filename, 1*time.Hour); err == nil {
+			downloadURL := url.String()
+			resp.DownloadURL = &downloadURL
+		}
+	}
+
+	return resp
+}
+
+func parseExportSettings(c *fiber.Ctx) (export.Settings, error) {
+	settings := export.Settings{
+		Format: c.FormValue("format"),
+		Mode:   c.FormValue("mode"),
+	}
+
+	ints := []struct {
+		field string
+		dst   *int
+	}{
+		{"sample_rate", &settings.SampleRate},
+		{"bit_depth", &settings.BitDepth},
+		{"bitrate", &settings.Bitrate},
+	}
+	for _, f := range ints {
+		raw := c.FormValue(f.field)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return settings, &export.FieldError{Field: f.field, Message: "must be an integer"}
+		}
+		*f.dst = value
+	}
+
+	if raw := c.FormValue("quality"); raw != "" {
+		quality, err := strconv.Atoi(raw)
+		if err != nil {
+			return settings, &export.FieldError{Field: "quality", Message: "must be an integer"}
+		}
+		settings.Quality = &quality
+	}
+
+	return settings, nil
+}
+
+func parseLoudness(c *fiber.Ctx) (export.Loudness, error) {
+	var loudness export.Loudness
+
+	floats := []struct {
+		field string
+		dst   **float64
+	}{
+		{"loudness_target", &loudness.Target},
+		{"true_peak", &loudness.TruePeak},
+	}
+	for _, f := range floats {
+		raw := c.FormValue(f.field)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return loudness, &export.FieldError{Field: f.field, Message: "must be a number"}
+		}
+		*f.dst = &value
+	}
+
+	if raw := c.FormValue("measure_only"); raw != "" {
+		measureOnly, err := strconv.ParseBool(raw)
+		if err != nil {
+			return loudness, &export.FieldError{Field: "measure_only", Message: "must be a boolean"}
+		}
+		loudness.MeasureOnly = measureOnly
+	}
+
+	return export.ResolveLoudness(loudness)
+}
+
+func exportSettingsError(c *fiber.Ctx, err error) error {
+	var fieldErr *export.FieldError
+	if errors.As(err, &fieldErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fieldErr.Message,
+			"field": fieldErr.Field,
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "invalid export settings",
+	})
+}
 
-func NewExportHandler() *ExportHandler {
-	return &ExportHandler{}
+func exportFilename(requested string, profile export.Profile) string {
+	name := filepath.Base(requested)
+	if requested == "" || name == "." || name == "/" {
+		name = "track"
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + profile.Extension
+}
+
+func (h *ExportHandler) CreateExport(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	settings, err := parseExportSettings(c)
+	if err != nil {
+		return exportSettingsError(c, err)
+	}
+
+	profile, settings, err := export.Resolve(settings)
+	if err != nil {
+		return exportSettingsError(c, err)
+	}
+
+	loudness, err := parseLoudness(c)
+	if err != nil {
+		return exportSettingsError(c, err)
+	}
+
+	opts := jobs.ExportOptions{Settings: settings, Loudness: loudness}
+	if raw := c.FormValue("duration"); raw != "" {
+		duration, err := strconv.ParseFloat(raw, 64)
+		if err != nil || duration <= 0 || duration > ExportMaxDuration {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("duration must be between 0 and %d seconds", ExportMaxDuration),
+			})
+		}
+		opts.Duration = duration
+	}
+
+	params := sqlc.CreateExportJobParams{
+		UserID:   userID,
+		Filename: exportFilename(c.FormValue("filename"), profile),
+	}
+
+	if trackIDStr := c.FormValue("track_id"); trackIDStr != "" {
+		trackID, err := uuid.Parse(trackIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid track_id",
+			})
+		}
+		if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer); err != nil {
+			return accessError(c, err)
+		}
+		params.TrackID = uuidToPgtype(trackID)
+	}
+
+	if file, err := c.FormFile("audio"); err == nil {
+		if file.Size > ExportMaxFileSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("file too large (max %dMB)", ExportMaxFileSize/1024/1024),
+			})
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to open file",
+			})
+		}
+		defer src.Close()
+
+		ext := filepath.Ext(file.Filename)
+		if ext == "" {
+			ext = ".webm"
+		}
+		inputKey := fmt.Sprintf("exports/%s/inputs/%s%s", userID.String(), uuid.New().String(), ext)
+		if err := h.storage.UploadFile(c.Context(), inputKey, src, file.Size, file.Header.Get("Content-Type")); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to upload file",
+			})
+		}
+		params.InputS3Key = pgtype.Text{String: inputKey, Valid: true}
+	}
+
+	if !params.TrackID.Valid && !params.InputS3Key.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "track_id or audio file is required",
+		})
+	}
+
+	optionsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encode export options",
+		})
+	}
+	params.Options = optionsJSON
+
+	job, err := h.db.CreateExportJob(c.Context(), params)
+	if err != nil {
+		if params.InputS3Key.Valid {
+			_ = h.storage.DeleteFile(c.Context(), params.InputS3Key.String)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create export job",
+		})
+	}
+
+	h.worker.Notify()
+
+	return c.Status(fiber.StatusAccepted).JSON(h.jobToResponse(c.Context(), job))
+}
+
+func (h *ExportHandler) ListFormats(c *fiber.Ctx) error {
+	return c.JSON(export.Profiles())
+}
+
+func (h *ExportHandler) GetExport(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	jobID, err := uuid.Parse(c.Params("jobId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid job id",
+		})
+	}
+
+	job, err := h.db.GetUserExportJob(c.Context(), sqlc.GetUserExportJobParams{
+		ID:     jobID,
+		UserID: userID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "export job not found",
+		})
+	}
+
+	return c.JSON(h.jobToResponse(c.Context(), job))
+}
+
+func (h *ExportHandler) ExportEvents(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	jobID, err := uuid.Parse(c.Params("jobId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid job id",
+		})
+	}
+
+	params := sqlc.GetUserExportJobParams{ID: jobID, UserID: userID}
+	if _, err := h.db.GetUserExportJob(c.Context(), params); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "export job not found",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), exportStreamWindow)
+		defer cancel()
+
+		fmt.Fprintf(w, "retry: %d\n\n", exportPollInterval.Milliseconds())
+
+		var last ExportJobResponse
+		ticker := time.NewTicker(exportPollInterval)
+		defer ticker.Stop()
+
+		for {
+			job, err := h.db.GetUserExportJob(ctx, params)
+			if err != nil {
+				return
+			}
+
+			resp := h.jobToResponse(ctx, job)
+			if resp.Status != last.Status || resp.Progress != last.Progress {
+				last = resp
+				data, _ := json.Marshal(resp)
+				fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+
+			if job.Status == jobs.StatusCompleted || job.Status == jobs.StatusFailed {
+				fmt.Fprint(w, "event: done\ndata: {}\n\n")
+				_ = w.Flush()
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+
+	return nil
 }
 
 func (h *ExportHandler) ExportMP3(c *fiber.Ctx) error {
+	bitrate, err := strconv.Atoi(c.FormValue("bitrate", "192"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bitrate must be an integer")
+	}
+
+	profile, settings, err := export.Resolve(export.Settings{
+		Format:  "mp3",
+		Mode:    export.ModeCBR,
+		Bitrate: bitrate,
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
 	fileHeader, err := c.FormFile("audio")
 	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "audio file missing")
@@ -45,18 +430,14 @@ func (h *ExportHandler) ExportMP3(c *fiber.Ctx) error {
 	tmpMp3.Close()
 	defer os.Remove(tmpMp3.Name())
 
-	bitrate := c.FormValue("bitrate", "192")
-	cmd := exec.Command("ffmpeg",
-		"-y",
-		"-i", tmpWebm.Name(),
-		"-vn",
-		"-c:a", "libmp3lame",
-		"-b:a", fmt.Sprintf("%sk", bitrate),
-		tmpMp3.Name(),
-	)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Printf("ffmpeg error: %s\n", string(output))
-		return fiber.NewError(fiber.StatusInternalServerError, "encoding failed: "+string(output))
+	if err := export.Encode(c.Context(), export.EncodeOptions{
+		Input:    tmpWebm.Name(),
+		Output:   tmpMp3.Name(),
+		Profile:  profile,
+		Settings: settings,
+	}); err != nil {
+		log.Printf("Warning: failed to encode mp3 export for user %s: %v\n", c.Locals("userID"), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "encoding failed")
 	}
 
 	mp3Data, err := os.ReadFile(tmpMp3.Name())
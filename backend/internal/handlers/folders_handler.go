@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+const folderNameMaxLength = 100
+
+type FoldersHandler struct {
+	db *sqlc.Queries
+}
+
+func NewFoldersHandler(db *sqlc.Queries) *FoldersHandler {
+	return &FoldersHandler{
+		db: db,
+	}
+}
+
+type FolderRequest struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+}
+
+type FolderResponse struct {
+	ID         string  `json:"id"`
+	ParentID   *string `json:"parent_id"`
+	Name       string  `json:"name"`
+	TrackCount int64   `json:"track_count"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+func folderToResponse(folder sqlc.Folder, trackCount int64) FolderResponse {
+	response := FolderResponse{
+		ID:         folder.ID.String(),
+		Name:       folder.Name,
+		TrackCount: trackCount,
+		CreatedAt:  folder.CreatedAt.Time.Format(time.RFC3339),
+		UpdatedAt:  folder.UpdatedAt.Time.Format(time.RFC3339),
+	}
+	if folder.ParentID.Valid {
+		parentID := uuid.UUID(folder.ParentID.Bytes).String()
+		response.ParentID = &parentID
+	}
+	return response
+}
+
+// ListFolders returns all of the user's folders as a flat list; clients build
+// the tree from parent_id.
+func (h *FoldersHandler) ListFolders(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	rows, err := h.db.ListUserFolders(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch folders",
+		})
+	}
+
+	response := make([]FolderResponse, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, folderToResponse(sqlc.Folder{
+			ID:        row.ID,
+			UserID:    row.UserID,
+			ParentID:  row.ParentID,
+			Name:      row.Name,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+		}, row.TrackCount))
+	}
+
+	return c.JSON(response)
+}
+
+func (h *FoldersHandler) CreateFolder(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	var req FolderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.Name == "" || len(req.Name) > folderNameMaxLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name must be between 1 and 100 characters",
+		})
+	}
+
+	parentID, err := h.parent(c, userID, req.ParentID)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	folder, err := h.db.CreateFolder(c.Context(), sqlc.CreateFolderParams{
+		UserID:   userID,
+		ParentID: parentID,
+		Name:     req.Name,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create folder",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(folderToResponse(folder, 0))
+}
+
+// UpdateFolder renames a folder and moves it under parent_id, or to the top
+// level when parent_id is null. A folder cannot be moved into itself or one
+// of its descendants.
+func (h *FoldersHandler) UpdateFolder(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	folderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid folder id",
+		})
+	}
+
+	var req FolderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.Name == "" || len(req.Name) > folderNameMaxLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name must be between 1 and 100 characters",
+		})
+	}
+
+	if _, err := h.db.GetUserFolder(c.Context(), sqlc.GetUserFolderParams{
+		ID:     folderID,
+		UserID: userID,
+	}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "folder not found",
+		})
+	}
+
+	parentID, err := h.parent(c, userID, req.ParentID)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+	if parentID.Valid {
+		cycle, err := h.db.IsFolderInSubtree(c.Context(), sqlc.IsFolderInSubtreeParams{
+			Root:      folderID,
+			Candidate: parentID.Bytes,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to move folder",
+			})
+		}
+		if cycle {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "folder cannot be moved into itself",
+			})
+		}
+	}
+
+	folder, err := h.db.UpdateFolder(c.Context(), sqlc.UpdateFolderParams{
+		ID:       folderID,
+		UserID:   userID,
+		Name:     req.Name,
+		ParentID: parentID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update folder",
+		})
+	}
+
+	return c.JSON(folderToResponse(folder, 0))
+}
+
+// DeleteFolder removes a folder and its subfolders. Tracks inside them are not
+// deleted; they move back to the top level.
+func (h *FoldersHandler) DeleteFolder(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	folderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid folder id",
+		})
+	}
+
+	if _, err := h.db.GetUserFolder(c.Context(), sqlc.GetUserFolderParams{
+		ID:     folderID,
+		UserID: userID,
+	}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "folder not found",
+		})
+	}
+
+	if err := h.db.DeleteFolder(c.Context(), sqlc.DeleteFolderParams{
+		ID:     folderID,
+		UserID: userID,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete folder",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// parent resolves an optional parent folder id, which must belong to the user.
+func (h *FoldersHandler) parent(c *fiber.Ctx, userID uuid.UUID, raw *string) (pgtype.UUID, error) {
+	if raw == nil || *raw == "" {
+		return pgtype.UUID{}, nil
+	}
+	parentID, err := uuid.Parse(*raw)
+	if err != nil {
+		return pgtype.UUID{}, fiber.NewError(fiber.StatusBadRequest, "invalid parent_id")
+	}
+	if _, err := h.db.GetUserFolder(c.Context(), sqlc.GetUserFolderParams{
+		ID:     parentID,
+		UserID: userID,
+	}); err != nil {
+		return pgtype.UUID{}, fiber.NewError(fiber.StatusNotFound, "parent folder not found")
+	}
+	return uuidToPgtype(parentID), nil
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/graph"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+const forkTitleSuffix = " (fork)"
+
+type ForksHandler struct {
+	db      *sqlc.Queries
+	pool    *pgxpool.Pool
+	storage *storage.MinIOClient
+	access  *access.Authorizer
+}
+
+func NewForksHandler(db *sqlc.Queries, pool *pgxpool.Pool, storage *storage.MinIOClient) *ForksHandler {
+	return &ForksHandler{
+		db:      db,
+		pool:    pool,
+		storage: storage,
+		access:  access.NewAuthorizer(db),
+	}
+}
+
+type ForkTrackRequest struct {
+	Title string `json:"title,omitempty"`
+}
+
+type LineageEntry struct {
+	ID         string `json:"id,omitempty"`
+	Title      string `json:"title,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	ShareSlug  string `json:"share_slug,omitempty"`
+	Visible    bool   `json:"visible"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+// remapSceneState rewrites file references in a scene's node parameters.
+// State that does not decode is returned unchanged.
+func remapSceneState(data []byte, remap func(id string) (string, string, bool)) []byte {
+	var state SceneState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return data
+	}
+	for _, params := range state.NodeParams {
+		graph.RemapFileParams(params, remap)
+	}
+	remapped, err := json.Marshal(state)
+	if err != nil {
+		return data
+	}
+	return remapped
+}
+
+// ForkTrack copies a track the user can read, along with its scenes, samples
+// and impulses, into the user's account. Files are copied in storage rather
+// than shared, so the fork is unaffected if the original is deleted, and
+// their size is charged to the user forking. The user's own library samples
+// are attached to the fork instead.
+func (h *ForksHandler) ForkTrack(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	var req ForkTrackRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	source, err := h.access.ReadableTrack(c.Context(), trackID, userID)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	title := req.Title
+	if title == "" {
+		title = source.Title + forkTitleSuffix
+	}
+
+	sourceID := uuidToPgtype(source.ID)
+	trackSamples, err := h.db.ListTrackSamples(c.Context(), sourceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch samples",
+		})
+	}
+	samples, library := splitForkSamples(trackSamples, userID)
+	impulses, err := h.db.ListTrackImpulses(c.Context(), sourceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch impulses",
+		})
+	}
+	scenes, err := h.db.ListScenesByTrack(c.Context(), sourceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch scenes",
+		})
+	}
+
+	var totalSize int64
+	files := make([]trackFile, 0, len(samples)+len(impulses))
+	for _, sample := range samples {
+		files = append(files, sampleFile(sample))
+	}
+	for _, impulse := range impulses {
+		files = append(files, impulseFile(impulse))
+	}
+	for _, file := range files {
+		totalSize += file.size
+	}
+
+	user, err := h.db.GetUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check storage",
+		})
+	}
+	if user.StorageUsed.Int64+totalSize > user.StorageLimit.Int64 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "storage limit exceeded",
+		})
+	}
+
+	copies, err := copyStoredFiles(c.Context(), h.storage, userID, files, func(kind string) string {
+		return kind + "s"
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to copy files",
+		})
+	}
+	cleanup := func() {
+		deleteCopies(c.Context(), h.storage, copies)
+	}
+
+	remap := func(id string) (string, string, bool) {
+		file, ok := copies[id]
+		return file.id.String(), file.url, ok
+	}
+
+	g, err := graph.Parse(source.GraphData)
+	if err != nil {
+		cleanup()
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "source track has invalid graph data",
+		})
+	}
+	g.RemapFiles(remap)
+	graphJSON, err := json.Marshal(g)
+	if err != nil {
+		cleanup()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encode graph data",
+		})
+	}
+
+	var track sqlc.Track
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		track, err = q.CreateForkedTrack(c.Context(), sqlc.CreateForkedTrackParams{
+			UserID:      uuidToPgtype(userID),
+			Title:       title,
+			Description: source.Description,
+			Bpm:         source.Bpm,
+			GraphData:   graphJSON,
+			ForkedFrom:  sourceID,
+		})
+		if err != nil {
+			return err
+		}
+		newTrackID := uuidToPgtype(track.ID)
+
+		if err := createTrackFiles(c.Context(), q, userID, track.ID, files, copies); err != nil {
+			return err
+		}
+		for _, sample := range library {
+			if err := q.AttachTrackSample(c.Context(), sqlc.AttachTrackSampleParams{
+				TrackID:  track.ID,
+				SampleID: sample.ID,
+			}); err != nil {
+				return err
+			}
+		}
+
+		for _, scene := range scenes {
+			if _, err := q.CreateScene(c.Context(), sqlc.CreateSceneParams{
+				ID:        uuid.New(),
+				TrackID:   newTrackID,
+				Name:      scene.Name,
+				StateData: remapSceneState(scene.StateData, remap),
+				Position:  scene.Position,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := database.RecordRevision(c.Context(), q, track, userID, "Forked from "+source.Title); err != nil {
+			return err
+		}
+		return chargeStorage(c.Context(), q, userID, copies)
+	})
+	if err != nil {
+		cleanup()
+		if errors.Is(err, errStorageLimit) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "storage limit exceeded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fork track",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+	response.Role = string(access.RoleOwner)
+
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// Lineage returns the chain of tracks this one was forked from, nearest first,
+// and its direct forks. Ancestors the user cannot see keep their place in the
+// chain but are returned without details.
+func (h *ForksHandler) Lineage(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	track, err := h.access.ReadableTrack(c.Context(), trackID, userID)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	ancestors, err := h.db.ListTrackAncestors(c.Context(), sqlc.ListTrackAncestorsParams{
+		TrackID: track.ID,
+		UserID:  userID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch lineage",
+		})
+	}
+	forks, err := h.db.ListTrackForks(c.Context(), sqlc.ListTrackForksParams{
+		TrackID: uuidToPgtype(track.ID),
+		UserID:  userID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch forks",
+		})
+	}
+
+	ancestorList := make([]LineageEntry, 0, len(ancestors))
+	for _, row := range ancestors {
+		if !row.Visible {
+			ancestorList = append(ancestorList, LineageEntry{Visible: false})
+			continue
+		}
+		ancestorList = append(ancestorList, LineageEntry{
+			ID:         row.ID.String(),
+			Title:      row.Title,
+			AuthorName: row.AuthorName.String,
+			ShareSlug:  row.ShareSlug,
+			Visible:    true,
+			CreatedAt:  row.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	forkList := make([]LineageEntry, 0, len(forks))
+	for _, row := range forks {
+		entry := LineageEntry{
+			ID:         row.ID.String(),
+			Title:      row.Title,
+			AuthorName: row.AuthorName.String,
+			Visible:    true,
+			CreatedAt:  row.CreatedAt.Time.Format(time.RFC3339),
+		}
+		if row.IsPublic.Bool {
+			entry.ShareSlug = row.ShareSlug.String
+		}
+		forkList = append(forkList, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"ancestors": ancestorList,
+		"forks":     forkList,
+	})
+}
+
+// splitForkSamples separates the samples of a track forked by userID into
+// those to copy and the forker's own library samples, which are attached to
+// the fork as they are instead of being copied and charged again.
+func splitForkSamples(samples []sqlc.Sample, userID uuid.UUID) (copied, library []sqlc.Sample) {
+	for _, sample := range samples {
+		if !sample.TrackID.Valid && sample.UserID.Valid && sample.UserID.Bytes == userID {
+			library = append(library, sample)
+		} else {
+			copied = append(copied, sample)
+		}
+	}
+	return copied, library
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+func TestSplitForkSamples(t *testing.T) {
+	forker, author := uuid.New(), uuid.New()
+	track := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	uploadedByForker := sqlc.Sample{ID: uuid.New(), UserID: uuidToPgtype(forker), TrackID: track}
+	uploadedByAuthor := sqlc.Sample{ID: uuid.New(), UserID: uuidToPgtype(author), TrackID: track}
+	forkerLibrary := sqlc.Sample{ID: uuid.New(), UserID: uuidToPgtype(forker)}
+	authorLibrary := sqlc.Sample{ID: uuid.New(), UserID: uuidToPgtype(author)}
+
+	copied, library := splitForkSamples([]sqlc.Sample{
+		uploadedByForker, forkerLibrary, uploadedByAuthor, authorLibrary,
+	}, forker)
+
+	if got := sampleIDs(library); len(got) != 1 || got[0] != forkerLibrary.ID {
+		t.Errorf("library = %v, want only the forker's library sample", got)
+	}
+	want := []uuid.UUID{uploadedByForker.ID, uploadedByAuthor.ID, authorLibrary.ID}
+	got := sampleIDs(copied)
+	if len(got) != len(want) {
+		t.Fatalf("copied = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("copied = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func sampleIDs(samples []sqlc.Sample) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(samples))
+	for _, s := range samples {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
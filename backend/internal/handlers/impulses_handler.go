@@ -1,35 +1,36 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"path/filepath"
-	"strings"
+	"io"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/jobs"
 	"github.com/theosov/hexa/pkg/storage"
+	"github.com/theosov/hexa/pkg/upload"
 )
 
 type ImpulsesHandler struct {
 	db      *sqlc.Queries
 	storage *storage.MinIOClient
+	access  *access.Authorizer
 }
 
 func NewImpulsesHandler(db *sqlc.Queries, storage *storage.MinIOClient) *ImpulsesHandler {
 	return &ImpulsesHandler{
 		db:      db,
 		storage: storage,
+		access:  access.NewAuthorizer(db),
 	}
 }
 
-const (
-	ImpulseMaxFileSize  = 20 * 1024 * 1024
-	ImpulseAllowedTypes = "audio/wav,audio/x-wav,audio/ogg,audio/webm,audio/flac,audio/mpeg"
-)
-
 func (h *ImpulsesHandler) UploadImpulse(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 
@@ -47,6 +48,10 @@ func (h *ImpulsesHandler) UploadImpulse(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor); err != nil {
+		return accessError(c, err)
+	}
+
 	file, err := c.FormFile("file")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -54,16 +59,9 @@ func (h *ImpulsesHandler) UploadImpulse(c *fiber.Ctx) error {
 		})
 	}
 
-	if file.Size > ImpulseMaxFileSize {
+	if file.Size > upload.Impulses.MaxSize() {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("file too large (max %dMB)", ImpulseMaxFileSize/1024/1024),
-		})
-	}
-
-	contentType := file.Header.Get("Content-Type")
-	if contentType == "" || !strings.Contains(ImpulseAllowedTypes, contentType) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid file type (allowed: wav, ogg, webm, flac, mp3)",
+			"error": fmt.Sprintf("file too large (max %dMB)", upload.Impulses.MaxSize()/1024/1024),
 		})
 	}
 
@@ -80,9 +78,6 @@ func (h *ImpulsesHandler) UploadImpulse(c *fiber.Ctx) error {
 		})
 	}
 
-	ext := filepath.Ext(file.Filename)
-	s3Key := fmt.Sprintf("impulses/%s/%s%s", userID.String(), uuid.New().String(), ext)
-
 	src, err := file.Open()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -91,32 +86,66 @@ func (h *ImpulsesHandler) UploadImpulse(c *fiber.Ctx) error {
 	}
 	defer src.Close()
 
+	checked, err := upload.Impulses.Check(c.Context(), src, file.Size)
+	if err != nil {
+		failure := uploadFailure(err)
+		return c.Status(failure.Code).JSON(fiber.Map{
+			"error": failure.Message,
+		})
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to open file",
+		})
+	}
+	meta := newAudioColumns(checked.Info)
+	contentType := checked.Format.MimeType
+	s3Key := fmt.Sprintf("impulses/%s/%s%s", userID.String(), uuid.New().String(), checked.Format.Extension)
+
+	// Storage is charged before the file is stored, so concurrent uploads
+	// cannot together take the user over their limit.
+	if err := chargeUpload(c.Context(), h.db, userID, file.Size); err != nil {
+		if errors.Is(err, errStorageLimit) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "storage limit exceeded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update storage",
+		})
+	}
+	uploader := uuidToPgtype(userID)
+
 	if err := h.storage.UploadFile(c.Context(), s3Key, src, file.Size, contentType); err != nil {
+		releaseUpload(c.Context(), h.db, uploader, file.Size)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to upload file",
 		})
 	}
 
 	impulse, err := h.db.CreateImpulse(c.Context(), sqlc.CreateImpulseParams{
-		UserID:   uuidToPgtype(userID),
-		TrackID:  uuidToPgtype(trackID),
-		Filename: file.Filename,
-		FileSize: file.Size,
-		S3Key:    s3Key,
-		MimeType: pgtype.Text{String: contentType, Valid: true},
+		UserID:     uuidToPgtype(userID),
+		TrackID:    uuidToPgtype(trackID),
+		Filename:   file.Filename,
+		FileSize:   file.Size,
+		S3Key:      s3Key,
+		MimeType:   pgtype.Text{String: contentType, Valid: true},
+		Duration:   meta.Duration,
+		SampleRate: meta.SampleRate,
+		Channels:   meta.Channels,
+		BitDepth:   meta.BitDepth,
+		Codec:      meta.Codec,
 	})
 	if err != nil {
 		_ = h.storage.DeleteFile(c.Context(), s3Key)
+		releaseUpload(c.Context(), h.db, uploader, file.Size)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to save impulse",
 		})
 	}
 
-	if err := h.db.UpdateUserStorage(c.Context(), sqlc.UpdateUserStorageParams{
-		ID:          userID,
-		StorageUsed: pgtype.Int8{Int64: user.StorageUsed.Int64 + file.Size},
-	}); err != nil {
-		fmt.Printf("Warning: failed to update storage: %v\n", err)
+	if _, err := src.Seek(0, io.SeekStart); err == nil {
+		h.storeImpulsePeaks(c.Context(), impulse, src)
 	}
 
 	url, _ := h.storage.GetPresignedURL(c.Context(), s3Key, 1*time.Hour)
@@ -126,6 +155,7 @@ func (h *ImpulsesHandler) UploadImpulse(c *fiber.Ctx) error {
 		"filename":   impulse.Filename,
 		"size":       impulse.FileSize,
 		"url":        url.String(),
+		"audio":      impulseAudio(impulse),
 		"created_at": impulse.CreatedAt,
 	})
 }
@@ -140,15 +170,20 @@ func (h *ImpulsesHandler) GetImpulse(c *fiber.Ctx) error {
 		})
 	}
 
-	impulse, err := h.db.GetUserImpulse(c.Context(), sqlc.GetUserImpulseParams{
-		ID:     impulseID,
-		UserID: uuidToPgtype(userID),
-	})
+	impulse, err := h.db.GetImpulse(c.Context(), impulseID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "impulse not found",
 		})
 	}
+	if err := h.access.Upload(c.Context(), impulse.UserID, impulse.TrackID, userID, access.RoleViewer); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "impulse not found",
+			})
+		}
+		return accessError(c, err)
+	}
 
 	url, err := h.storage.GetPresignedURL(c.Context(), impulse.S3Key, 1*time.Hour)
 	if err != nil {
@@ -162,6 +197,7 @@ func (h *ImpulsesHandler) GetImpulse(c *fiber.Ctx) error {
 		"filename": impulse.Filename,
 		"size":     impulse.FileSize,
 		"url":      url.String(),
+		"audio":    impulseAudio(impulse),
 	})
 }
 
@@ -175,40 +211,36 @@ func (h *ImpulsesHandler) DeleteImpulse(c *fiber.Ctx) error {
 		})
 	}
 
-	impulse, err := h.db.GetUserImpulse(c.Context(), sqlc.GetUserImpulseParams{
-		ID:     impulseID,
-		UserID: uuidToPgtype(userID),
-	})
+	impulse, err := h.db.GetImpulse(c.Context(), impulseID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "impulse not found",
 		})
 	}
+	if err := h.access.Upload(c.Context(), impulse.UserID, impulse.TrackID, userID, access.RoleEditor); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "impulse not found",
+			})
+		}
+		return accessError(c, err)
+	}
 
-	if err := h.storage.DeleteFile(c.Context(), impulse.S3Key); err != nil {
-		fmt.Printf("Warning: failed to delete impulse from storage: %v\n", err)
+	for _, key := range jobs.ImpulseObjectKeys(impulse) {
+		if err := h.storage.DeleteFile(c.Context(), key); err != nil {
+			log.Printf("Warning: failed to delete impulse from storage: %v\n", err)
+		}
 	}
 
-	if err := h.db.DeleteImpulse(c.Context(), sqlc.DeleteImpulseParams{
-		ID:     impulseID,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
+	if err := h.db.DeleteImpulse(c.Context(), impulseID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to delete impulse",
 		})
 	}
 
-	user, err := h.db.GetUser(c.Context(), userID)
-	if err == nil {
-		newStorage := user.StorageUsed.Int64 - impulse.FileSize
-		if newStorage < 0 {
-			newStorage = 0
-		}
-		_ = h.db.UpdateUserStorage(c.Context(), sqlc.UpdateUserStorageParams{
-			ID:          userID,
-			StorageUsed: pgtype.Int8{Int64: newStorage},
-		})
-	}
+	// Storage is credited back to the uploader, who may not be the one
+	// deleting the file.
+	releaseUpload(c.Context(), h.db, impulse.UserID, impulse.FileSize)
 
 	return c.JSON(fiber.Map{
 		"message": "impulse deleted",
@@ -216,6 +248,7 @@ func (h *ImpulsesHandler) DeleteImpulse(c *fiber.Ctx) error {
 }
 
 func (h *ImpulsesHandler) ListTrackImpulses(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
 	trackID, err := uuid.Parse(c.Params("trackId"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -223,6 +256,10 @@ func (h *ImpulsesHandler) ListTrackImpulses(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer); err != nil {
+		return accessError(c, err)
+	}
+
 	impulses, err := h.db.ListTrackImpulses(c.Context(), uuidToPgtype(trackID))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -238,6 +275,7 @@ func (h *ImpulsesHandler) ListTrackImpulses(c *fiber.Ctx) error {
 			"filename": impulse.Filename,
 			"size":     impulse.FileSize,
 			"url":      url.String(),
+			"audio":    impulseAudio(impulse),
 		})
 	}
 
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// FormOverhead allows for the multipart framing and text fields sent along
+// with an uploaded file.
+const FormOverhead = 1 << 20
+
+// RouteLimit lets one route accept a larger request body than the server
+// default and, with Timeout, spend longer reading the request and writing
+// the response. Path is the full route path and may contain :params. A zero
+// MaxBody keeps the default limit.
+type RouteLimit struct {
+	Method  string
+	Path    string
+	MaxBody int64
+	Timeout time.Duration
+}
+
+// Limits enforces per-route body limits. The server streams request bodies
+// (fiber.Config.StreamRequestBody), so only the first BodyLimit bytes of a
+// request are held in memory and multipart files are spooled to disk as the
+// handler reads them; Handler rejects oversized bodies from their
+// Content-Length before that happens.
+type Limits struct {
+	defaultBody int64
+	routes      []RouteLimit
+}
+
+func NewLimits(defaultBody int64, routes ...RouteLimit) *Limits {
+	return &Limits{defaultBody: defaultBody, routes: routes}
+}
+
+func (l *Limits) match(method, path string) (RouteLimit, bool) {
+	for _, route := range l.routes {
+		if route.Method == method && matchPath(route.Path, path) {
+			return route, true
+		}
+	}
+	return RouteLimit{}, false
+}
+
+// matchPath reports whether path matches a route pattern, where a :param
+// segment matches any single segment.
+func matchPath(pattern, path string) bool {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], ":") && want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HeaderReceived extends the read and write deadlines of routes that have a
+// Timeout. It is installed as the fasthttp server's HeaderReceived hook,
+// which runs before the body is read.
+func (l *Limits) HeaderReceived(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	path, _, _ := strings.Cut(string(header.RequestURI()), "?")
+	route, ok := l.match(string(header.Method()), path)
+	if !ok || route.Timeout <= 0 {
+		return fasthttp.RequestConfig{}
+	}
+	return fasthttp.RequestConfig{
+		ReadTimeout:  route.Timeout,
+		WriteTimeout: route.Timeout,
+	}
+}
+
+// Handler rejects request bodies larger than the route allows.
+func (l *Limits) Handler(c *fiber.Ctx) error {
+	limit := l.defaultBody
+	if route, ok := l.match(c.Method(), c.Path()); ok && route.MaxBody > 0 {
+		limit = route.MaxBody
+	}
+
+	switch length := c.Request().Header.ContentLength(); {
+	case length == -1:
+		// Chunked bodies have no declared size to check up front.
+		return c.Status(fiber.StatusLengthRequired).JSON(fiber.Map{
+			"error": "request body must have a Content-Length",
+		})
+	case int64(length) > limit:
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("request body too large (max %dMB)", limit/1024/1024),
+		})
+	}
+	return c.Next()
+}
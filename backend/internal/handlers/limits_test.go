@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/api/export", "/api/export", true},
+		{"/api/export", "/api/export/", true},
+		{"/api/export", "/api/export/formats", false},
+		{"/api/tracks/:id/bundle", "/api/tracks/123/bundle", true},
+		{"/api/tracks/:id/bundle", "/api/tracks/123/scenes", false},
+		{"/api/tracks/import", "/api/tracks/123", false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLimitsHandler(t *testing.T) {
+	limits := NewLimits(10,
+		RouteLimit{Method: fiber.MethodPost, Path: "/big", MaxBody: 100},
+		RouteLimit{Method: fiber.MethodPost, Path: "/slow", Timeout: time.Minute},
+	)
+	app := fiber.New()
+	app.Use(limits.Handler)
+	app.Post("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/small", 10, fiber.StatusOK},
+		{"/small", 11, fiber.StatusRequestEntityTooLarge},
+		{"/big", 100, fiber.StatusOK},
+		{"/big", 101, fiber.StatusRequestEntityTooLarge},
+		{"/slow", 10, fiber.StatusOK},
+		{"/slow", 11, fiber.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(fiber.MethodPost, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("POST %s with %d bytes: got %d, want %d", tt.path, tt.size, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestLimitsHandlerAllowsBodilessGet(t *testing.T) {
+	limits := NewLimits(10, RouteLimit{Method: fiber.MethodGet, Path: "/download", Timeout: time.Minute})
+	app := fiber.New()
+	app.Use(limits.Handler)
+	app.Get("/download", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/download", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("got %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestLimitsHeaderReceived(t *testing.T) {
+	limits := NewLimits(10, RouteLimit{Method: fiber.MethodGet, Path: "/tracks/:id/bundle", Timeout: time.Minute})
+
+	var header fasthttp.RequestHeader
+	header.SetMethod(fiber.MethodGet)
+	header.SetRequestURI("/tracks/123/bundle?download=1")
+	if got := limits.HeaderReceived(&header); got.ReadTimeout != time.Minute || got.WriteTimeout != time.Minute {
+		t.Errorf("got %+v, want one minute timeouts", got)
+	}
+
+	header.SetRequestURI("/tracks/123")
+	if got := limits.HeaderReceived(&header); got != (fasthttp.RequestConfig{}) {
+		t.Errorf("got %+v for an unlisted route", got)
+	}
+}
@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/collab"
+	"github.com/theosov/hexa/internal/database"
+)
+
+const (
+	inviteDefaultTTL = 7 * 24 * time.Hour
+	inviteMaxDays    = 30
+)
+
+type MembersHandler struct {
+	db          *sqlc.Queries
+	pool        *pgxpool.Pool
+	access      *access.Authorizer
+	hub         *collab.Hub
+	frontendURL string
+}
+
+func NewMembersHandler(db *sqlc.Queries, pool *pgxpool.Pool, hub *collab.Hub, frontendURL string) *MembersHandler {
+	return &MembersHandler{
+		db:          db,
+		pool:        pool,
+		access:      access.NewAuthorizer(db),
+		hub:         hub,
+		frontendURL: frontendURL,
+	}
+}
+
+type MemberResponse struct {
+	UserID      string `json:"user_id"`
+	Role        string `json:"role"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type InviteResponse struct {
+	ID         string  `json:"id"`
+	TrackID    string  `json:"track_id"`
+	TrackTitle string  `json:"track_title,omitempty"`
+	Role       string  `json:"role"`
+	Email      *string `json:"email"`
+	Token      string  `json:"token"`
+	URL        string  `json:"url"`
+	ExpiresAt  string  `json:"expires_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+type CreateInviteRequest struct {
+	Email         string `json:"email,omitempty"`
+	Role          string `json:"role"`
+	ExpiresInDays int    `json:"expires_in_days,omitempty"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+func generateInviteToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (h *MembersHandler) inviteToResponse(invite sqlc.TrackInvite) InviteResponse {
+	var email *string
+	if invite.Email.Valid {
+		email = &invite.Email.String
+	}
+
+	return InviteResponse{
+		ID:        invite.ID.String(),
+		TrackID:   invite.TrackID.String(),
+		Role:      invite.Role,
+		Email:     email,
+		Token:     invite.Token,
+		URL:       h.frontendURL + "/invites/" + invite.Token,
+		ExpiresAt: invite.ExpiresAt.Time.Format(time.RFC3339),
+		CreatedAt: invite.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
+
+func (h *MembersHandler) track(c *fiber.Ctx, min access.Role) (sqlc.Track, error) {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return sqlc.Track{}, fiber.NewError(fiber.StatusBadRequest, "invalid track id")
+	}
+
+	track, _, err := h.access.Track(c.Context(), trackID, userID, min)
+	if err != nil {
+		return sqlc.Track{}, accessFailure(err)
+	}
+	return track, nil
+}
+
+// ListMembers returns everyone with access to the track, starting with the
+// owner.
+func (h *MembersHandler) ListMembers(c *fiber.Ctx) error {
+	track, err := h.track(c, access.RoleViewer)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	response := make([]MemberResponse, 0)
+	if owner, err := h.db.GetUser(c.Context(), track.UserID.Bytes); err == nil {
+		response = append(response, MemberResponse{
+			UserID:      owner.ID.String(),
+			Role:        string(access.RoleOwner),
+			Email:       owner.Email,
+			DisplayName: owner.DisplayName.String,
+			AvatarURL:   owner.AvatarUrl.String,
+			CreatedAt:   track.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	members, err := h.db.ListTrackMembers(c.Context(), track.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch members",
+		})
+	}
+	for _, member := range members {
+		response = append(response, MemberResponse{
+			UserID:      member.UserID.String(),
+			Role:        member.Role,
+			Email:       member.Email,
+			DisplayName: member.DisplayName.String,
+			AvatarURL:   member.AvatarUrl.String,
+			CreatedAt:   member.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(response)
+}
+
+func (h *MembersHandler) UpdateMember(c *fiber.Ctx) error {
+	track, err := h.track(c, access.RoleOwner)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	memberID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	var req UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if !access.Role(req.Role).Assignable() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be editor or viewer",
+		})
+	}
+
+	member, err := h.db.UpdateTrackMemberRole(c.Context(), sqlc.UpdateTrackMemberRoleParams{
+		TrackID: track.ID,
+		UserID:  memberID,
+		Role:    req.Role,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "member not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update member",
+		})
+	}
+	h.hub.Disconnect(track.ID, memberID)
+
+	return c.JSON(fiber.Map{
+		"user_id": member.UserID,
+		"role":    member.Role,
+	})
+}
+
+// RemoveMember revokes a member's access. Owners can remove anyone; members
+// can remove themselves to leave a track.
+func (h *MembersHandler) RemoveMember(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	memberID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	min := access.RoleOwner
+	if memberID == userID {
+		min = access.RoleViewer
+	}
+	track, err := h.track(c, min)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	if track.UserID.Bytes == memberID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "the owner cannot be removed from a track",
+		})
+	}
+
+	if err := h.db.RemoveTrackMember(c.Context(), sqlc.RemoveTrackMemberParams{
+		TrackID: track.ID,
+		UserID:  memberID,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to remove member",
+		})
+	}
+	h.hub.Disconnect(track.ID, memberID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateInvite creates an invite for an email address, or a shareable link
+// when no email is given.
+func (h *MembersHandler) CreateInvite(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	track, err := h.track(c, access.RoleOwner)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	var req CreateInviteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if !access.Role(req.Role).Assignable() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be editor or viewer",
+		})
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > inviteMaxDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_in_days must be between 1 and 30",
+		})
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email != "" && !strings.Contains(email, "@") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid email",
+		})
+	}
+
+	ttl := inviteDefaultTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	token, err := generateInviteToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to generate invite",
+		})
+	}
+
+	invite, err := h.db.CreateTrackInvite(c.Context(), sqlc.CreateTrackInviteParams{
+		TrackID:   track.ID,
+		Role:      req.Role,
+		Email:     pgtype.Text{String: email, Valid: email != ""},
+		Token:     token,
+		CreatedBy: uuidToPgtype(userID),
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().Add(ttl), Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create invite",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(h.inviteToResponse(invite))
+}
+
+func (h *MembersHandler) ListInvites(c *fiber.Ctx) error {
+	track, err := h.track(c, access.RoleOwner)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	invites, err := h.db.ListTrackInvites(c.Context(), track.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch invites",
+		})
+	}
+
+	response := make([]InviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		response = append(response, h.inviteToResponse(invite))
+	}
+
+	return c.JSON(response)
+}
+
+func (h *MembersHandler) RevokeInvite(c *fiber.Ctx) error {
+	track, err := h.track(c, access.RoleOwner)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	inviteID, err := uuid.Parse(c.Params("inviteId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid invite id",
+		})
+	}
+
+	if err := h.db.DeleteTrackInvite(c.Context(), sqlc.DeleteTrackInviteParams{
+		ID:      inviteID,
+		TrackID: track.ID,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to revoke invite",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListMyInvites returns pending invites addressed to the current user's email.
+func (h *MembersHandler) ListMyInvites(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	user, err := h.db.GetUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+
+	rows, err := h.db.ListPendingInvitesByEmail(c.Context(), user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch invites",
+		})
+	}
+
+	response := make([]InviteResponse, 0, len(rows))
+	for _, row := range rows {
+		invite := h.inviteToResponse(sqlc.TrackInvite{
+			ID:        row.ID,
+			TrackID:   row.TrackID,
+			Role:      row.Role,
+			Email:     row.Email,
+			Token:     row.Token,
+			ExpiresAt: row.ExpiresAt,
+			CreatedAt: row.CreatedAt,
+		})
+		invite.TrackTitle = row.TrackTitle
+		response = append(response, invite)
+	}
+
+	return c.JSON(response)
+}
+
+// AcceptInvite adds the current user to the invite's track. Email invites are
+// single-use and bound to that address; link invites can be used by anyone
+// until they expire or are revoked. Accepting never lowers an existing role.
+func (h *MembersHandler) AcceptInvite(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	invite, err := h.db.GetTrackInviteByToken(c.Context(), c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "invite not found",
+		})
+	}
+	if invite.AcceptedAt.Valid || time.Now().After(invite.ExpiresAt.Time) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "invite is no longer valid",
+		})
+	}
+
+	if invite.Email.Valid {
+		user, err := h.db.GetUser(c.Context(), userID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+		if !strings.EqualFold(user.Email, invite.Email.String) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "invite was sent to a different email address",
+			})
+		}
+	}
+
+	role := access.Role(invite.Role)
+	_, current, err := h.access.Track(c.Context(), invite.TrackID, userID, access.RoleViewer)
+	if err != nil && !errors.Is(err, access.ErrNotFound) {
+		return accessError(c, err)
+	}
+	keep := err == nil && current.Allows(role)
+	if keep {
+		role = current
+	}
+
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		if !keep {
+			if _, err := q.UpsertTrackMember(c.Context(), sqlc.UpsertTrackMemberParams{
+				TrackID:   invite.TrackID,
+				UserID:    userID,
+				Role:      invite.Role,
+				InvitedBy: invite.CreatedBy,
+			}); err != nil {
+				return err
+			}
+		}
+		if invite.Email.Valid {
+			return q.MarkTrackInviteAccepted(c.Context(), sqlc.MarkTrackInviteAcceptedParams{
+				ID:         invite.ID,
+				AcceptedBy: uuidToPgtype(userID),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to accept invite",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"track_id": invite.TrackID,
+		"role":     role,
+	})
+}
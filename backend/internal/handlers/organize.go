@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/database"
+)
+
+const organizeMaxTracks = 200
+
+// OrganizeTracksRequest applies one folder move and any number of tag changes
+// to a set of tracks. FolderID is left unchanged when omitted; an empty string
+// moves the tracks back to the top level.
+type OrganizeTracksRequest struct {
+	TrackIDs   []string `json:"track_ids"`
+	FolderID   *string  `json:"folder_id,omitempty"`
+	AddTags    []string `json:"add_tags,omitempty"`
+	RemoveTags []string `json:"remove_tags,omitempty"`
+}
+
+func parseIDs(raw []string, kind string) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]bool, len(raw))
+	ids := make([]uuid.UUID, 0, len(raw))
+	for _, s := range raw {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s id %q", kind, s)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// OrganizeTracks files tracks into one of the user's folders and adds or
+// removes the user's tags on them. Folders and tags are personal, so any
+// track the user can see may be organized, including ones shared with them.
+func (h *TracksHandler) OrganizeTracks(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	var req OrganizeTracksRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	trackIDs, err := parseIDs(req.TrackIDs, "track")
+	if err == nil && (len(trackIDs) == 0 || len(trackIDs) > organizeMaxTracks) {
+		err = fmt.Errorf("track_ids must list between 1 and %d tracks", organizeMaxTracks)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	addTags, err := parseIDs(req.AddTags, "tag")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	removeTags, err := parseIDs(req.RemoveTags, "tag")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var folderID *uuid.UUID
+	if req.FolderID != nil && *req.FolderID != "" {
+		id, err := uuid.Parse(*req.FolderID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid folder id",
+			})
+		}
+		if _, err := h.db.GetUserFolder(c.Context(), sqlc.GetUserFolderParams{
+			ID:     id,
+			UserID: userID,
+		}); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "folder not found",
+			})
+		}
+		folderID = &id
+	}
+
+	for _, tagID := range append(addTags, removeTags...) {
+		if _, err := h.db.GetUserTag(c.Context(), sqlc.GetUserTagParams{
+			ID:     tagID,
+			UserID: userID,
+		}); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "tag not found",
+			})
+		}
+	}
+
+	for _, trackID := range trackIDs {
+		if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer); err != nil {
+			return accessError(c, err)
+		}
+	}
+
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		if folderID != nil {
+			if err := q.MoveTracksToFolder(c.Context(), sqlc.MoveTracksToFolderParams{
+				UserID:   userID,
+				FolderID: *folderID,
+				TrackIds: trackIDs,
+			}); err != nil {
+				return err
+			}
+		} else if req.FolderID != nil {
+			if err := q.RemoveTracksFromFolders(c.Context(), sqlc.RemoveTracksFromFoldersParams{
+				UserID:   userID,
+				TrackIds: trackIDs,
+			}); err != nil {
+				return err
+			}
+		}
+
+		for _, tagID := range addTags {
+			if err := q.TagTracks(c.Context(), sqlc.TagTracksParams{
+				TagID:    tagID,
+				TrackIds: trackIDs,
+			}); err != nil {
+				return err
+			}
+		}
+		for _, tagID := range removeTags {
+			if err := q.UntagTracks(c.Context(), sqlc.UntagTracksParams{
+				TagID:    tagID,
+				TrackIds: trackIDs,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to organize tracks",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"updated": len(trackIDs),
+	})
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/jobs"
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/storage"
+	"golang.org/x/sync/singleflight"
+)
+
+// Peaks computed on demand decode the whole file, so requests for the same
+// file share one computation and only maxPeakDecodes run at a time.
+const maxPeakDecodes = 2
+
+var (
+	peakComputations singleflight.Group
+	peakDecodes      = make(chan struct{}, maxPeakDecodes)
+)
+
+// loadOrComputePeaks returns the peaks stored under stored, or computes them
+// from the audio at source for files that have none yet (uploaded before
+// peaks existed, or copied into a fork or template). New peaks are stored
+// under key and recorded with save.
+func loadOrComputePeaks(ctx context.Context, store *storage.MinIOClient, stored pgtype.Text, source, key string, save func(context.Context, pgtype.Text) (int64, error)) (*audio.Peaks, error) {
+	if stored.Valid {
+		return jobs.LoadPeaks(ctx, store, stored.String)
+	}
+
+	// The computation outlives the request that started it when others are
+	// waiting on it; ComputePeaks bounds it with its own timeout.
+	result := peakComputations.DoChan(key, func() (interface{}, error) {
+		return computePeaks(context.WithoutCancel(ctx), store, source, key, save)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*audio.Peaks), nil
+	}
+}
+
+func computePeaks(ctx context.Context, store *storage.MinIOClient, source, key string, save func(context.Context, pgtype.Text) (int64, error)) (*audio.Peaks, error) {
+	peakDecodes <- struct{}{}
+	defer func() { <-peakDecodes }()
+
+	obj, err := store.GetFile(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch audio: %w", err)
+	}
+	defer obj.Close()
+
+	peaks, err := audio.ComputePeaksReader(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := jobs.StorePeaks(ctx, store, key, peaks); err != nil {
+		return nil, err
+	}
+	rows, err := save(ctx, pgtype.Text{String: key, Valid: true})
+	if err != nil {
+		// The stored peaks are left for the next request to overwrite.
+		log.Printf("Warning: failed to save peaks: %v\n", err)
+	} else if rows == 0 {
+		// The file was deleted in the meantime; the peaks are still good
+		// for this response.
+		if err := store.DeleteFile(ctx, key); err != nil {
+			log.Printf("Warning: failed to delete peaks: %v\n", err)
+		}
+	}
+	return peaks, nil
+}
+
+// sendPeaks responds with the level of peaks selected by the zoom query
+// parameter, 0 (the finest) by default.
+func sendPeaks(c *fiber.Ctx, peaks *audio.Peaks) error {
+	zoom := 0
+	if raw := c.Query("zoom"); raw != "" {
+		var err error
+		if zoom, err = strconv.Atoi(raw); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "zoom must be an integer",
+			})
+		}
+	}
+
+	waveform, ok := peaks.Zoom(zoom)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("zoom must be between 0 and %d", len(peaks.Levels)-1),
+		})
+	}
+	return c.JSON(waveform)
+}
+
+// GetSamplePeaks returns waveform peaks of a sample. They describe the
+// playback rendition once it exists, and the original before that.
+func (h *SamplesHandler) GetSamplePeaks(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	sampleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid sample id",
+		})
+	}
+
+	sample, err := h.db.GetSample(c.Context(), sampleID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "sample not found",
+		})
+	}
+	if err := h.access.Sample(c.Context(), sample, userID, access.RoleViewer); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "sample not found",
+			})
+		}
+		return accessError(c, err)
+	}
+
+	source := sample.S3Key
+	if sample.PlaybackS3Key.Valid {
+		source = sample.PlaybackS3Key.String
+	}
+	peaks, err := loadOrComputePeaks(c.Context(), h.storage, sample.PeaksS3Key, source, jobs.SamplePeaksKey(sample.ID),
+		func(ctx context.Context, key pgtype.Text) (int64, error) {
+			return h.db.SetSamplePeaks(ctx, sqlc.SetSamplePeaksParams{ID: sample.ID, PeaksS3Key: key})
+		})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to load peaks",
+		})
+	}
+
+	return sendPeaks(c, peaks)
+}
+
+// storeImpulsePeaks computes the peaks of a newly uploaded impulse. Impulses
+// are short enough to do this during the upload; on failure the peaks
+// endpoint computes them on demand instead.
+func (h *ImpulsesHandler) storeImpulsePeaks(ctx context.Context, impulse sqlc.ReverbImpulse, r io.Reader) {
+	peaks, err := audio.ComputePeaksReader(ctx, r)
+	if err != nil {
+		log.Printf("Warning: failed to compute impulse peaks: %v\n", err)
+		return
+	}
+	key := jobs.ImpulsePeaksKey(impulse.ID)
+	if err := jobs.StorePeaks(ctx, h.storage, key, peaks); err != nil {
+		log.Printf("Warning: failed to store impulse peaks: %v\n", err)
+		return
+	}
+	if _, err := h.db.SetImpulsePeaks(ctx, sqlc.SetImpulsePeaksParams{
+		ID:         impulse.ID,
+		PeaksS3Key: pgtype.Text{String: key, Valid: true},
+	}); err != nil {
+		log.Printf("Warning: failed to save impulse peaks: %v\n", err)
+		_ = h.storage.DeleteFile(ctx, key)
+	}
+}
+
+func (h *ImpulsesHandler) GetImpulsePeaks(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	impulseID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid impulse id",
+		})
+	}
+
+	impulse, err := h.db.GetImpulse(c.Context(), impulseID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "impulse not found",
+		})
+	}
+	if err := h.access.Upload(c.Context(), impulse.UserID, impulse.TrackID, userID, access.RoleViewer); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "impulse not found",
+			})
+		}
+		return accessError(c, err)
+	}
+
+	peaks, err := loadOrComputePeaks(c.Context(), h.storage, impulse.PeaksS3Key, impulse.S3Key, jobs.ImpulsePeaksKey(impulse.ID),
+		func(ctx context.Context, key pgtype.Text) (int64, error) {
+			return h.db.SetImpulsePeaks(ctx, sqlc.SetImpulsePeaksParams{ID: impulse.ID, PeaksS3Key: key})
+		})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to load peaks",
+		})
+	}
+
+	return sendPeaks(c, peaks)
+}
+
+// GetExportPeaks returns waveform peaks of a finished export's output.
+func (h *ExportHandler) GetExportPeaks(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	jobID, err := uuid.Parse(c.Params("jobId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid job id",
+		})
+	}
+
+	job, err := h.db.GetUserExportJob(c.Context(), sqlc.GetUserExportJobParams{
+		ID:     jobID,
+		UserID: userID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "export job not found",
+		})
+	}
+	if !job.PeaksS3Key.Valid {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "export has no peaks",
+		})
+	}
+
+	peaks, err := jobs.LoadPeaks(c.Context(), h.storage, job.PeaksS3Key.String)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to load peaks",
+		})
+	}
+
+	return sendPeaks(c, peaks)
+}
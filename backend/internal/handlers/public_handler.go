@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+// publicURLExpiry keeps links handed to anonymous visitors short-lived; the
+// page is expected to be re-fetched rather than the URLs shared.
+const publicURLExpiry = 15 * time.Minute
+
+var publicSorts = map[string]bool{
+	"published": true,
+	"updated":   true,
+	"created":   true,
+	"title":     true,
+}
+
+type PublicHandler struct {
+	db      *sqlc.Queries
+	storage *storage.MinIOClient
+}
+
+func NewPublicHandler(db *sqlc.Queries, storage *storage.MinIOClient) *PublicHandler {
+	return &PublicHandler{
+		db:      db,
+		storage: storage,
+	}
+}
+
+type PublicAuthor struct {
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+type PublicTrackSummary struct {
+	Slug        string       `json:"slug"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	BPM         int32        `json:"bpm"`
+	CoverURL    string       `json:"cover_url,omitempty"`
+	Author      PublicAuthor `json:"author"`
+	PublishedAt string       `json:"published_at"`
+	UpdatedAt   string       `json:"updated_at"`
+}
+
+type PublicFile struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+}
+
+type PublicTrackResponse struct {
+	PublicTrackSummary
+	GraphData map[string]interface{} `json:"graph_data"`
+	Samples   []PublicFile           `json:"samples"`
+	Impulses  []PublicFile           `json:"impulses"`
+}
+
+func (h *PublicHandler) summary(c *fiber.Ctx, track sqlc.Track, authorName, authorAvatar pgtype.Text) PublicTrackSummary {
+	base := trackSummary(track)
+	summary := PublicTrackSummary{
+		Slug:        track.ShareSlug.String,
+		Title:       base.Title,
+		Description: base.Description,
+		BPM:         base.BPM,
+		Author: PublicAuthor{
+			Name:      authorName.String,
+			AvatarURL: authorAvatar.String,
+		},
+		PublishedAt: track.PublishedAt.Time.Format(time.RFC3339),
+		UpdatedAt:   base.UpdatedAt,
+	}
+	if track.CoverS3Key.Valid {
+		if url, err := h.storage.GetPresignedURL(c.Context(), track.CoverS3Key.String, publicURLExpiry); err == nil {
+			summary.CoverURL = url.String()
+		}
+	}
+	return summary
+}
+
+// ListPublicTracks pages through published tracks, newest first unless
+// another sort is requested. See parseTrackSearch for the supported filters.
+func (h *PublicHandler) ListPublicTracks(c *fiber.Ctx) error {
+	search, err := parseTrackSearch(c, publicSorts, "published")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	rows, err := h.db.SearchPublicTracks(c.Context(), search.publicParams())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch tracks",
+		})
+	}
+
+	var nextCursor *string
+	if len(rows) > search.Limit {
+		rows = rows[:search.Limit]
+		last := rows[len(rows)-1]
+		cursor := search.nextCursor(last.Track, last.Rank)
+		nextCursor = &cursor
+	}
+
+	tracks := make([]PublicTrackSummary, 0, len(rows))
+	for _, row := range rows {
+		tracks = append(tracks, h.summary(c, row.Track, row.AuthorName, row.AuthorAvatarUrl))
+	}
+
+	return c.JSON(fiber.Map{
+		"tracks":      tracks,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetPublicTrack returns a published track by its share slug, with its
+// samples and impulses behind short-lived presigned URLs.
+func (h *PublicHandler) GetPublicTrack(c *fiber.Ctx) error {
+	row, err := h.db.GetPublicTrackBySlug(c.Context(), pgtype.Text{String: c.Params("slug"), Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "track not found",
+		})
+	}
+
+	full, err := trackToResponse(row.Track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+
+	trackID := uuidToPgtype(row.Track.ID)
+	samples, err := h.db.ListTrackSamples(c.Context(), trackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch samples",
+		})
+	}
+	impulses, err := h.db.ListTrackImpulses(c.Context(), trackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch impulses",
+		})
+	}
+
+	response := PublicTrackResponse{
+		PublicTrackSummary: h.summary(c, row.Track, row.AuthorName, row.AuthorAvatarUrl),
+		GraphData:          full.GraphData,
+		Samples:            make([]PublicFile, 0, len(samples)),
+		Impulses:           make([]PublicFile, 0, len(impulses)),
+	}
+	for _, sample := range samples {
+		url, err := h.storage.GetPresignedURL(c.Context(), sample.S3Key, publicURLExpiry)
+		if err != nil {
+			continue
+		}
+		response.Samples = append(response.Samples, PublicFile{
+			ID:       sample.ID.String(),
+			Filename: sample.Filename,
+			Size:     sample.FileSize,
+			URL:      url.String(),
+		})
+	}
+	for _, impulse := range impulses {
+		url, err := h.storage.GetPresignedURL(c.Context(), impulse.S3Key, publicURLExpiry)
+		if err != nil {
+			continue
+		}
+		response.Impulses = append(response.Impulses, PublicFile{
+			ID:       impulse.ID.String(),
+			Filename: impulse.Filename,
+			Size:     impulse.FileSize,
+			URL:      url.String(),
+		})
+	}
+
+	return c.JSON(response)
+}
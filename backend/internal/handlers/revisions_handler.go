@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+const (
+	revisionsDefaultLimit = 50
+	revisionsMaxLimit     = 200
+
+	// revisionCurrent can be passed instead of a revision id to diff against
+	// the track's live graph.
+	revisionCurrent = "current"
+)
+
+type RevisionsHandler struct {
+	db     *sqlc.Queries
+	pool   *pgxpool.Pool
+	access *access.Authorizer
+}
+
+func NewRevisionsHandler(db *sqlc.Queries, pool *pgxpool.Pool) *RevisionsHandler {
+	return &RevisionsHandler{
+		db:     db,
+		pool:   pool,
+		access: access.NewAuthorizer(db),
+	}
+}
+
+type RevisionResponse struct {
+	ID         string                 `json:"id"`
+	TrackID    string                 `json:"track_id"`
+	AuthorID   *string                `json:"author_id"`
+	AuthorName string                 `json:"author_name,omitempty"`
+	Label      string                 `json:"label,omitempty"`
+	GraphData  map[string]interface{} `json:"graph_data,omitempty"`
+	CreatedAt  string                 `json:"created_at"`
+}
+
+type RestoreRevisionRequest struct {
+	Label string `json:"label,omitempty"`
+}
+
+func (h *RevisionsHandler) track(c *fiber.Ctx, min access.Role) (sqlc.Track, access.Role, error) {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return sqlc.Track{}, "", fiber.NewError(fiber.StatusBadRequest, "invalid track id")
+	}
+
+	track, role, err := h.access.Track(c.Context(), trackID, userID, min)
+	if err != nil {
+		return sqlc.Track{}, "", accessFailure(err)
+	}
+	return track, role, nil
+}
+
+func (h *RevisionsHandler) ListRevisions(c *fiber.Ctx) error {
+	track, _, err := h.track(c, access.RoleViewer)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	limit := c.QueryInt("limit", revisionsDefaultLimit)
+	if limit < 1 || limit > revisionsMaxLimit {
+		limit = revisionsDefaultLimit
+	}
+	offset := min(max(c.QueryInt("offset", 0), 0), math.MaxInt32)
+
+	rows, err := h.db.ListTrackRevisions(c.Context(), sqlc.ListTrackRevisionsParams{
+		TrackID: track.ID,
+		Limit:   int32(limit),
+		Offset:  int32(offset),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch revisions",
+		})
+	}
+
+	response := make([]RevisionResponse, 0, len(rows))
+	for _, row := range rows {
+		rev := RevisionResponse{
+			ID:         row.ID.String(),
+			TrackID:    row.TrackID.String(),
+			AuthorName: row.AuthorName.String,
+			Label:      row.Label.String,
+			CreatedAt:  row.CreatedAt.Time.Format(time.RFC3339),
+		}
+		if row.AuthorID.Valid {
+			authorID := uuid.UUID(row.AuthorID.Bytes).String()
+			rev.AuthorID = &authorID
+		}
+		response = append(response, rev)
+	}
+
+	return c.JSON(response)
+}
+
+func (h *RevisionsHandler) GetRevision(c *fiber.Ctx) error {
+	track, _, err := h.track(c, access.RoleViewer)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	revision, err := h.revision(c.Context(), track.ID, c.Params("revisionId"))
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	response, err := revisionToResponse(revision)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize revision",
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// RestoreRevision writes the revision's graph back to the track. The restore
+// itself becomes a new revision, so it can be undone like any other edit.
+func (h *RevisionsHandler) RestoreRevision(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid If-Match header",
+		})
+	}
+
+	track, role, err := h.track(c, access.RoleEditor)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	revision, err := h.revision(c.Context(), track.ID, c.Params("revisionId"))
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	var req RestoreRevisionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+	label := req.Label
+	if label == "" {
+		label = fmt.Sprintf("Restored from %s", revision.CreatedAt.Time.Format("2006-01-02 15:04"))
+	}
+
+	// Revisions are validated like any other graph written to the track, and
+	// those older than the current graph format are upgraded on the way back.
+	graphJSON, err := normalizeGraph(revision.GraphData)
+	if err != nil {
+		return graphValidationError(c, err)
+	}
+
+	trackID := track.ID
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		track, err = q.UpdateTrackGraph(c.Context(), sqlc.UpdateTrackGraphParams{
+			ID:              trackID,
+			GraphData:       graphJSON,
+			ExpectedVersion: expectedVersion,
+		})
+		if err != nil {
+			return err
+		}
+		return database.RecordRevision(c.Context(), q, track, userID, label)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return trackConflict(c, h.db, trackID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to restore revision",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+	response.Role = string(role)
+
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
+	return c.JSON(response)
+}
+
+// DiffRevisions compares two revisions of a track, given as ?from=&to=. Either
+// side may be "current" to compare against the live graph.
+func (h *RevisionsHandler) DiffRevisions(c *fiber.Ctx) error {
+	track, _, err := h.track(c, access.RoleViewer)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	from, to := c.Query("from"), c.Query("to", revisionCurrent)
+	if from == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from is required",
+		})
+	}
+
+	load := func(id string) (*graph.Graph, error) {
+		data := track.GraphData
+		if id != revisionCurrent {
+			revision, err := h.revision(c.Context(), track.ID, id)
+			if err != nil {
+				return nil, err
+			}
+			data = revision.GraphData
+		}
+
+		g, err := graph.Parse(data)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusUnprocessableEntity, "revision has invalid graph data")
+		}
+		return g, nil
+	}
+
+	a, err := load(from)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+	b, err := load(to)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"from": from,
+		"to":   to,
+		"diff": graph.Compare(a, b),
+	})
+}
+
+func (h *RevisionsHandler) revision(ctx context.Context, trackID uuid.UUID, rawID string) (sqlc.TrackRevision, error) {
+	revisionID, err := uuid.Parse(rawID)
+	if err != nil {
+		return sqlc.TrackRevision{}, fiber.NewError(fiber.StatusBadRequest, "invalid revision id")
+	}
+
+	revision, err := h.db.GetTrackRevision(ctx, sqlc.GetTrackRevisionParams{
+		ID:      revisionID,
+		TrackID: trackID,
+	})
+	if err != nil {
+		return sqlc.TrackRevision{}, fiber.NewError(fiber.StatusNotFound, "revision not found")
+	}
+	return revision, nil
+}
+
+func revisionToResponse(revision sqlc.TrackRevision) (*RevisionResponse, error) {
+	graphData, err := decodeGraph(revision.GraphData)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &RevisionResponse{
+		ID:        revision.ID.String(),
+		TrackID:   revision.TrackID.String(),
+		Label:     revision.Label.String,
+		GraphData: graphData,
+		CreatedAt: revision.CreatedAt.Time.Format(time.RFC3339),
+	}
+	if revision.AuthorID.Valid {
+		authorID := uuid.UUID(revision.AuthorID.Bytes).String()
+		response.AuthorID = &authorID
+	}
+	return response, nil
+}
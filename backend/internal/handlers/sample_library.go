@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+)
+
+const (
+	libraryDefaultLimit = 50
+	libraryMaxLimit     = 100
+)
+
+// likeEscaper escapes the wildcards of ILIKE so a search matches them
+// literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListLibrarySamples lists the caller's library samples, newest first.
+//
+//	q               case-insensitive filename substring
+//	limit, offset
+func (h *SamplesHandler) ListLibrarySamples(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	limit := c.QueryInt("limit", libraryDefaultLimit)
+	if limit < 1 || limit > libraryMaxLimit {
+		limit = libraryDefaultLimit
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	offset = min(offset, math.MaxInt32)
+
+	var filename pgtype.Text
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filename = pgtype.Text{String: "%" + likeEscaper.Replace(q) + "%", Valid: true}
+	}
+
+	samples, err := h.db.ListUserSamples(c.Context(), sqlc.ListUserSamplesParams{
+		UserID:    uuidToPgtype(userID),
+		Filename:  filename,
+		RowLimit:  int32(limit),
+		RowOffset: int32(offset),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch samples",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(samples))
+	for _, sample := range samples {
+		response, err := h.sampleResponse(c, sample)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to generate download url",
+			})
+		}
+		result = append(result, response)
+	}
+
+	return c.JSON(result)
+}
+
+// AttachSample makes one of the caller's library samples available on a
+// track they can edit. The sample is not copied, so it counts towards the
+// caller's storage only once however many tracks use it.
+func (h *SamplesHandler) AttachSample(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("trackId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+	sampleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid sample id",
+		})
+	}
+
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor); err != nil {
+		return accessError(c, err)
+	}
+
+	sample, err := h.db.GetUserSample(c.Context(), sqlc.GetUserSampleParams{
+		ID:     sampleID,
+		UserID: uuidToPgtype(userID),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "sample not found",
+		})
+	}
+	if sample.TrackID.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "only library samples can be attached to tracks",
+		})
+	}
+
+	if err := h.db.AttachTrackSample(c.Context(), sqlc.AttachTrackSampleParams{
+		TrackID:  trackID,
+		SampleID: sample.ID,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to attach sample",
+		})
+	}
+
+	response, err := h.sampleResponse(c, sample)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to generate download url",
+		})
+	}
+	return c.JSON(response)
+}
+
+// DetachSample removes a library sample from a track. The sample itself
+// stays in its owner's library.
+func (h *SamplesHandler) DetachSample(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("trackId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+	sampleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid sample id",
+		})
+	}
+
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor); err != nil {
+		return accessError(c, err)
+	}
+
+	rows, err := h.db.DetachTrackSample(c.Context(), sqlc.DetachTrackSampleParams{
+		TrackID:  trackID,
+		SampleID: sampleID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to detach sample",
+		})
+	}
+	if rows == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "sample is not attached to this track",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "sample detached",
+	})
+}
@@ -1,50 +1,92 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"path/filepath"
-	"strings"
+	"io"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/jobs"
 	"github.com/theosov/hexa/pkg/storage"
+	"github.com/theosov/hexa/pkg/upload"
 )
 
 type SamplesHandler struct {
-	db      *sqlc.Queries
-	storage *storage.MinIOClient
+	db         *sqlc.Queries
+	storage    *storage.MinIOClient
+	access     *access.Authorizer
+	transcoder *jobs.TranscodeWorker
 }
 
-func NewSamplesHandler(db *sqlc.Queries, storage *storage.MinIOClient) *SamplesHandler {
+func NewSamplesHandler(db *sqlc.Queries, storage *storage.MinIOClient, transcoder *jobs.TranscodeWorker) *SamplesHandler {
 	return &SamplesHandler{
-		db:      db,
-		storage: storage,
+		db:         db,
+		storage:    storage,
+		access:     access.NewAuthorizer(db),
+		transcoder: transcoder,
 	}
 }
 
-const (
-	MaxFileSize  = 10 * 1024 * 1024
-	AllowedTypes = "audio/mpeg,audio/wav,audio/ogg,audio/webm"
-)
+// renditions returns URLs for the transcoded versions of a sample that have
+// been produced so far, keyed by rendition.
+func (h *SamplesHandler) renditions(c *fiber.Ctx, sample sqlc.Sample) fiber.Map {
+	result := fiber.Map{}
+	for name, key := range map[string]pgtype.Text{
+		"playback": sample.PlaybackS3Key,
+		"preview":  sample.PreviewS3Key,
+	} {
+		if !key.Valid {
+			continue
+		}
+		if url, err := h.storage.GetPresignedURL(c.Context(), key.String, 1*time.Hour); err == nil {
+			result[name] = url.String()
+		}
+	}
+	return result
+}
+
+// sampleResponse describes a sample with a download URL for its original
+// file. It fails only when that URL cannot be signed.
+func (h *SamplesHandler) sampleResponse(c *fiber.Ctx, sample sqlc.Sample) (fiber.Map, error) {
+	url, err := h.storage.GetPresignedURL(c.Context(), sample.S3Key, 1*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"id":         sample.ID,
+		"filename":   sample.Filename,
+		"size":       sample.FileSize,
+		"url":        url.String(),
+		"library":    !sample.TrackID.Valid,
+		"audio":      sampleAudio(sample),
+		"transcode":  sample.TranscodeStatus,
+		"renditions": h.renditions(c, sample),
+	}, nil
+}
 
+// UploadSample stores a sample on the track given by track_id, or in the
+// user's library when track_id is omitted.
 func (h *SamplesHandler) UploadSample(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 
-	trackIDStr := c.FormValue("track_id")
-	if trackIDStr == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "track_id is required",
-		})
-	}
-
-	trackID, err := uuid.Parse(trackIDStr)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid track_id",
-		})
+	var trackID pgtype.UUID
+	if trackIDStr := c.FormValue("track_id"); trackIDStr != "" {
+		id, err := uuid.Parse(trackIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid track_id",
+			})
+		}
+		if _, _, err := h.access.Track(c.Context(), id, userID, access.RoleEditor); err != nil {
+			return accessError(c, err)
+		}
+		trackID = uuidToPgtype(id)
 	}
 
 	file, err := c.FormFile("file")
@@ -54,16 +96,9 @@ func (h *SamplesHandler) UploadSample(c *fiber.Ctx) error {
 		})
 	}
 
-	if file.Size > MaxFileSize {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("file too large (max %dMB)", MaxFileSize/1024/1024),
-		})
-	}
-
-	contentType := file.Header.Get("Content-Type")
-	if !strings.Contains(AllowedTypes, contentType) {
+	if file.Size > upload.Samples.MaxSize() {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid file type (allowed: mp3, wav, ogg, webm)",
+			"error": fmt.Sprintf("file too large (max %dMB)", upload.Samples.MaxSize()/1024/1024),
 		})
 	}
 
@@ -80,9 +115,6 @@ func (h *SamplesHandler) UploadSample(c *fiber.Ctx) error {
 		})
 	}
 
-	ext := filepath.Ext(file.Filename)
-	s3Key := fmt.Sprintf("samples/%s/%s%s", userID.String(), uuid.New().String(), ext)
-
 	src, err := file.Open()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -91,43 +123,74 @@ func (h *SamplesHandler) UploadSample(c *fiber.Ctx) error {
 	}
 	defer src.Close()
 
+	checked, err := upload.Samples.Check(c.Context(), src, file.Size)
+	if err != nil {
+		failure := uploadFailure(err)
+		return c.Status(failure.Code).JSON(fiber.Map{
+			"error": failure.Message,
+		})
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to open file",
+		})
+	}
+	meta := newAudioColumns(checked.Info)
+	contentType := checked.Format.MimeType
+	s3Key := fmt.Sprintf("samples/%s/%s%s", userID.String(), uuid.New().String(), checked.Format.Extension)
+
+	// Storage is charged before the file is stored, so concurrent uploads
+	// cannot together take the user over their limit.
+	if err := chargeUpload(c.Context(), h.db, userID, file.Size); err != nil {
+		if errors.Is(err, errStorageLimit) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "storage limit exceeded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update storage",
+		})
+	}
+	uploader := uuidToPgtype(userID)
+
 	if err := h.storage.UploadFile(c.Context(), s3Key, src, file.Size, contentType); err != nil {
+		releaseUpload(c.Context(), h.db, uploader, file.Size)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to upload file",
 		})
 	}
 
 	sample, err := h.db.CreateSample(c.Context(), sqlc.CreateSampleParams{
-		UserID:   uuidToPgtype(userID),
-		TrackID:  uuidToPgtype(trackID),
-		Filename: file.Filename,
-		FileSize: file.Size,
-		S3Key:    s3Key,
-		MimeType: pgtype.Text{String: contentType, Valid: true},
+		UserID:     uuidToPgtype(userID),
+		TrackID:    trackID,
+		Filename:   file.Filename,
+		FileSize:   file.Size,
+		S3Key:      s3Key,
+		MimeType:   pgtype.Text{String: contentType, Valid: true},
+		Duration:   meta.Duration,
+		SampleRate: meta.SampleRate,
+		Channels:   meta.Channels,
+		BitDepth:   meta.BitDepth,
+		Codec:      meta.Codec,
 	})
 	if err != nil {
 		_ = h.storage.DeleteFile(c.Context(), s3Key)
+		releaseUpload(c.Context(), h.db, uploader, file.Size)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to save sample",
 		})
 	}
 
-	if err := h.db.UpdateUserStorage(c.Context(), sqlc.UpdateUserStorageParams{
-		ID:          userID,
-		StorageUsed: pgtype.Int8{Int64: user.StorageUsed.Int64 + file.Size},
-	}); err != nil {
-		fmt.Printf("Warning: failed to update storage: %v\n", err)
-	}
+	h.transcoder.Notify()
 
-	url, _ := h.storage.GetPresignedURL(c.Context(), s3Key, 1*time.Hour)
-
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"id":         sample.ID,
-		"filename":   sample.Filename,
-		"size":       sample.FileSize,
-		"url":        url.String(),
-		"created_at": sample.CreatedAt,
-	})
+	response, err := h.sampleResponse(c, sample)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to generate download url",
+		})
+	}
+	response["created_at"] = sample.CreatedAt
+	return c.Status(fiber.StatusCreated).JSON(response)
 }
 
 func (h *SamplesHandler) GetSample(c *fiber.Ctx) error {
@@ -139,29 +202,28 @@ func (h *SamplesHandler) GetSample(c *fiber.Ctx) error {
 		})
 	}
 
-	sample, err := h.db.GetUserSample(c.Context(), sqlc.GetUserSampleParams{
-		ID:     sampleID,
-		UserID: uuidToPgtype(userID),
-	})
+	sample, err := h.db.GetSample(c.Context(), sampleID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "sample not found",
 		})
 	}
+	if err := h.access.Sample(c.Context(), sample, userID, access.RoleViewer); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "sample not found",
+			})
+		}
+		return accessError(c, err)
+	}
 
-	url, err := h.storage.GetPresignedURL(c.Context(), sample.S3Key, 1*time.Hour)
+	response, err := h.sampleResponse(c, sample)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to generate download url",
 		})
 	}
-
-	return c.JSON(fiber.Map{
-		"id":       sample.ID,
-		"filename": sample.Filename,
-		"size":     sample.FileSize,
-		"url":      url.String(),
-	})
+	return c.JSON(response)
 }
 
 func (h *SamplesHandler) DeleteSample(c *fiber.Ctx) error {
@@ -173,40 +235,36 @@ func (h *SamplesHandler) DeleteSample(c *fiber.Ctx) error {
 		})
 	}
 
-	sample, err := h.db.GetUserSample(c.Context(), sqlc.GetUserSampleParams{
-		ID:     sampleID,
-		UserID: uuidToPgtype(userID),
-	})
+	sample, err := h.db.GetSample(c.Context(), sampleID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "sample not found",
 		})
 	}
+	if err := h.access.Sample(c.Context(), sample, userID, access.RoleEditor); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "sample not found",
+			})
+		}
+		return accessError(c, err)
+	}
 
-	if err := h.storage.DeleteFile(c.Context(), sample.S3Key); err != nil {
-		fmt.Printf("Warning: failed to delete from storage: %v\n", err)
+	for _, key := range jobs.SampleObjectKeys(sample) {
+		if err := h.storage.DeleteFile(c.Context(), key); err != nil {
+			log.Printf("Warning: failed to delete from storage: %v\n", err)
+		}
 	}
 
-	if err := h.db.DeleteSample(c.Context(), sqlc.DeleteSampleParams{
-		ID:     sampleID,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
+	if err := h.db.DeleteSample(c.Context(), sampleID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to delete sample",
 		})
 	}
 
-	user, err := h.db.GetUser(c.Context(), userID)
-	if err == nil {
-		newStorage := user.StorageUsed.Int64 - sample.FileSize
-		if newStorage < 0 {
-			newStorage = 0
-		}
-		_ = h.db.UpdateUserStorage(c.Context(), sqlc.UpdateUserStorageParams{
-			ID:          userID,
-			StorageUsed: pgtype.Int8{Int64: newStorage},
-		})
-	}
+	// Storage is credited back to the uploader, who may not be the one
+	// deleting the file.
+	releaseUpload(c.Context(), h.db, sample.UserID, sample.FileSize)
 
 	return c.JSON(fiber.Map{
 		"message": "sample deleted",
@@ -214,6 +272,7 @@ func (h *SamplesHandler) DeleteSample(c *fiber.Ctx) error {
 }
 
 func (h *SamplesHandler) ListTrackSamples(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
 	trackID, err := uuid.Parse(c.Params("trackId"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -221,6 +280,10 @@ func (h *SamplesHandler) ListTrackSamples(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer); err != nil {
+		return accessError(c, err)
+	}
+
 	samples, err := h.db.ListTrackSamples(c.Context(), uuidToPgtype(trackID))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -230,13 +293,13 @@ func (h *SamplesHandler) ListTrackSamples(c *fiber.Ctx) error {
 
 	result := make([]fiber.Map, 0, len(samples))
 	for _, sample := range samples {
-		url, _ := h.storage.GetPresignedURL(c.Context(), sample.S3Key, 1*time.Hour)
-		result = append(result, fiber.Map{
-			"id":       sample.ID,
-			"filename": sample.Filename,
-			"size":     sample.FileSize,
-			"url":      url.String(),
-		})
+		response, err := h.sampleResponse(c, sample)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to generate download url",
+			})
+		}
+		result = append(result, response)
 	}
 
 	return c.JSON(result)
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
 )
 
 type SceneState struct {
@@ -21,6 +24,7 @@ type SceneResponse struct {
 	Name      string     `json:"name"`
 	StateData SceneState `json:"state_data"`
 	Position  int32      `json:"position"`
+	Version   int32      `json:"version"`
 	CreatedAt string     `json:"created_at"`
 }
 
@@ -37,11 +41,27 @@ type UpdateSceneRequest struct {
 }
 
 type ScenesHandler struct {
-	db *sqlc.Queries
+	db     *sqlc.Queries
+	access *access.Authorizer
 }
 
 func NewScenesHandler(db *sqlc.Queries) *ScenesHandler {
-	return &ScenesHandler{db: db}
+	return &ScenesHandler{
+		db:     db,
+		access: access.NewAuthorizer(db),
+	}
+}
+
+// authorizeScene checks the user's role on the track a scene belongs to. A
+// scene on a track the user cannot see is reported as missing.
+func (h *ScenesHandler) authorizeScene(c *fiber.Ctx, trackID pgtype.UUID, userID uuid.UUID, min access.Role) error {
+	if _, _, err := h.access.Track(c.Context(), trackID.Bytes, userID, min); err != nil {
+		if errors.Is(err, access.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "scene not found")
+		}
+		return accessFailure(err)
+	}
+	return nil
 }
 
 func (h *ScenesHandler) ListScenes(c *fiber.Ctx) error {
@@ -52,11 +72,8 @@ func (h *ScenesHandler) ListScenes(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid track id")
 	}
 
-	if _, err := h.db.GetUserTrack(c.Context(), sqlc.GetUserTrackParams{
-		ID:     trackID,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
-		return fiber.NewError(fiber.StatusNotFound, "track not found")
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer); err != nil {
+		return accessFailure(err)
 	}
 
 	rows, err := h.db.ListScenesByTrack(c.Context(), uuidToPgtype(trackID))
@@ -78,6 +95,7 @@ func (h *ScenesHandler) ListScenes(c *fiber.Ctx) error {
 			Name:      row.Name,
 			StateData: state,
 			Position:  row.Position.Int32,
+			Version:   row.Version,
 			CreatedAt: row.CreatedAt.Time.Format(time.RFC3339),
 		})
 	}
@@ -85,6 +103,32 @@ func (h *ScenesHandler) ListScenes(c *fiber.Ctx) error {
 	return c.JSON(resp)
 }
 
+func (h *ScenesHandler) GetScene(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	sceneID, err := uuid.Parse(c.Params("sceneId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid scene id")
+	}
+
+	row, err := h.db.GetScene(c.Context(), sceneID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "scene not found")
+	}
+
+	if err := h.authorizeScene(c, row.TrackID, userID, access.RoleViewer); err != nil {
+		return err
+	}
+
+	resp, err := sceneToResponse(row)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to decode scene state")
+	}
+
+	c.Set(fiber.HeaderETag, versionETag(row.Version))
+	return c.JSON(resp)
+}
+
 func (h *ScenesHandler) CreateScene(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 
@@ -93,11 +137,8 @@ func (h *ScenesHandler) CreateScene(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid track id")
 	}
 
-	if _, err := h.db.GetUserTrack(c.Context(), sqlc.GetUserTrackParams{
-		ID:     trackID,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
-		return fiber.NewError(fiber.StatusNotFound, "track not found")
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor); err != nil {
+		return accessFailure(err)
 	}
 
 	var req CreateSceneRequest
@@ -139,6 +180,7 @@ func (h *ScenesHandler) CreateScene(c *fiber.Ctx) error {
 		Name:      row.Name,
 		Position:  row.Position.Int32,
 		StateData: req.StateData,
+		Version:   row.Version,
 		CreatedAt: row.CreatedAt.Time.Format(time.RFC3339),
 	})
 }
@@ -156,11 +198,13 @@ func (h *ScenesHandler) UpdateScene(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "scene not found")
 	}
 
-	if _, err := h.db.GetUserTrack(c.Context(), sqlc.GetUserTrackParams{
-		ID:     sceneRow.TrackID.Bytes,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
-		return fiber.NewError(fiber.StatusForbidden, "access denied")
+	if err := h.authorizeScene(c, sceneRow.TrackID, userID, access.RoleEditor); err != nil {
+		return err
+	}
+
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid If-Match header")
 	}
 
 	var req UpdateSceneRequest
@@ -184,25 +228,70 @@ func (h *ScenesHandler) UpdateScene(c *fiber.Ctx) error {
 	}
 
 	row, err := h.db.UpdateScene(c.Context(), sqlc.UpdateSceneParams{
-		ID:        sceneID,
-		Name:      name,
-		StateData: stateJSON,
-		Position:  pgtype.Int4{Int32: position, Valid: true},
+		ID:              sceneID,
+		Name:            name,
+		StateData:       stateJSON,
+		Position:        pgtype.Int4{Int32: position, Valid: true},
+		ExpectedVersion: expectedVersion,
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return h.updateConflict(c, sceneID)
+	}
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "failed to update scene")
 	}
 
+	c.Set(fiber.HeaderETag, versionETag(row.Version))
 	return c.JSON(SceneResponse{
 		ID:        row.ID,
 		TrackID:   row.TrackID.Bytes,
 		Name:      row.Name,
 		Position:  row.Position.Int32,
 		StateData: req.StateData,
+		Version:   row.Version,
 		CreatedAt: row.CreatedAt.Time.Format(time.RFC3339),
 	})
 }
 
+// updateConflict returns the scene's current state with a 409 so the client
+// can merge its edit, or a 404 if the scene was deleted in the meantime.
+func (h *ScenesHandler) updateConflict(c *fiber.Ctx, sceneID uuid.UUID) error {
+	row, err := h.db.GetScene(c.Context(), sceneID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "scene not found")
+	}
+
+	resp, err := sceneToResponse(row)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to decode scene state")
+	}
+
+	c.Set(fiber.HeaderETag, versionETag(row.Version))
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":   "scene was modified by another client",
+		"current": resp,
+	})
+}
+
+func sceneToResponse(row sqlc.GetSceneRow) (SceneResponse, error) {
+	var state SceneState
+	if len(row.StateData) > 0 {
+		if err := json.Unmarshal(row.StateData, &state); err != nil {
+			return SceneResponse{}, err
+		}
+	}
+
+	return SceneResponse{
+		ID:        row.ID,
+		TrackID:   row.TrackID.Bytes,
+		Name:      row.Name,
+		StateData: state,
+		Position:  row.Position.Int32,
+		Version:   row.Version,
+		CreatedAt: row.CreatedAt.Time.Format(time.RFC3339),
+	}, nil
+}
+
 func (h *ScenesHandler) DeleteScene(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 
@@ -216,11 +305,8 @@ func (h *ScenesHandler) DeleteScene(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusNotFound, "scene not found")
 	}
 
-	if _, err := h.db.GetUserTrack(c.Context(), sqlc.GetUserTrackParams{
-		ID:     sceneRow.TrackID.Bytes,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
-		return fiber.NewError(fiber.StatusForbidden, "access denied")
+	if err := h.authorizeScene(c, sceneRow.TrackID, userID, access.RoleEditor); err != nil {
+		return err
 	}
 
 	if err := h.db.DeleteScene(c.Context(), sceneID); err != nil {
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+const (
+	searchDefaultLimit = 50
+	searchMaxLimit     = 100
+
+	sortRelevance = "relevance"
+
+	// folderNone selects tracks the user has not filed into a folder.
+	folderNone = "none"
+)
+
+// trackCursor marks the last row of a page. Which of Time, Title and Rank is
+// set depends on the sort it was issued for, and a cursor is only accepted
+// with that same sort.
+type trackCursor struct {
+	Sort  string     `json:"s"`
+	ID    uuid.UUID  `json:"id"`
+	Time  *time.Time `json:"t,omitempty"`
+	Title *string    `json:"n,omitempty"`
+	Rank  *float64   `json:"r,omitempty"`
+}
+
+type trackSearch struct {
+	Query         string
+	Sort          string
+	Limit         int
+	BPMMin        pgtype.Int4
+	BPMMax        pgtype.Int4
+	CreatedAfter  pgtype.Timestamp
+	CreatedBefore pgtype.Timestamp
+	UpdatedAfter  pgtype.Timestamp
+	UpdatedBefore pgtype.Timestamp
+	BlockTypes    []string
+	FolderID      pgtype.UUID
+	Unfiled       bool
+	TagIDs        []uuid.UUID
+	Cursor        *trackCursor
+}
+
+// parseTrackSearch reads the query string shared by the track list endpoints:
+//
+//	q                               full-text search over title and description
+//	sort                            one of sorts, or relevance when q is set
+//	bpm_min, bpm_max                inclusive BPM range
+//	block                           comma-separated block types that must all be present
+//	created_after, created_before   RFC 3339 timestamps or YYYY-MM-DD dates
+//	updated_after, updated_before
+//	folder                          folder id, or "none" for tracks outside any folder
+//	tag                             comma-separated tag ids that must all be applied
+//	limit, cursor
+//
+// folder and tag refer to the caller's own folders and tags, so they only
+// narrow the user's track list.
+func parseTrackSearch(c *fiber.Ctx, sorts map[string]bool, defaultSort string) (trackSearch, error) {
+	search := trackSearch{
+		Query:      strings.TrimSpace(c.Query("q")),
+		Sort:       c.Query("sort"),
+		BlockTypes: []string{},
+		TagIDs:     []uuid.UUID{},
+	}
+
+	if search.Sort == "" {
+		search.Sort = defaultSort
+		if search.Query != "" {
+			search.Sort = sortRelevance
+		}
+	}
+	if search.Sort == sortRelevance {
+		if search.Query == "" {
+			return search, fmt.Errorf("sort=relevance requires q")
+		}
+	} else if !sorts[search.Sort] {
+		return search, fmt.Errorf("unsupported sort %q", search.Sort)
+	}
+
+	search.Limit = c.QueryInt("limit", searchDefaultLimit)
+	if search.Limit < 1 || search.Limit > searchMaxLimit {
+		search.Limit = searchDefaultLimit
+	}
+
+	var err error
+	if search.BPMMin, err = queryInt4(c, "bpm_min"); err != nil {
+		return search, err
+	}
+	if search.BPMMax, err = queryInt4(c, "bpm_max"); err != nil {
+		return search, err
+	}
+	if search.CreatedAfter, err = queryTimestamp(c, "created_after"); err != nil {
+		return search, err
+	}
+	if search.CreatedBefore, err = queryTimestamp(c, "created_before"); err != nil {
+		return search, err
+	}
+	if search.UpdatedAfter, err = queryTimestamp(c, "updated_after"); err != nil {
+		return search, err
+	}
+	if search.UpdatedBefore, err = queryTimestamp(c, "updated_before"); err != nil {
+		return search, err
+	}
+
+	if raw := c.Query("block"); raw != "" {
+		for _, blockType := range strings.Split(raw, ",") {
+			blockType = strings.TrimSpace(blockType)
+			if _, ok := graph.Blocks[blockType]; !ok {
+				return search, fmt.Errorf("unknown block type %q", blockType)
+			}
+			search.BlockTypes = append(search.BlockTypes, blockType)
+		}
+	}
+
+	if raw := c.Query("folder"); raw == folderNone {
+		search.Unfiled = true
+	} else if raw != "" {
+		folderID, err := uuid.Parse(raw)
+		if err != nil {
+			return search, fmt.Errorf("invalid folder id")
+		}
+		search.FolderID = uuidToPgtype(folderID)
+	}
+
+	if raw := c.Query("tag"); raw != "" {
+		for _, rawID := range strings.Split(raw, ",") {
+			tagID, err := uuid.Parse(strings.TrimSpace(rawID))
+			if err != nil {
+				return search, fmt.Errorf("invalid tag id %q", rawID)
+			}
+			search.TagIDs = append(search.TagIDs, tagID)
+		}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		data, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil {
+			return search, fmt.Errorf("invalid cursor")
+		}
+		var cursor trackCursor
+		if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != search.Sort {
+			return search, fmt.Errorf("invalid cursor")
+		}
+		search.Cursor = &cursor
+	}
+
+	return search, nil
+}
+
+func queryInt4(c *fiber.Ctx, key string) (pgtype.Int4, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return pgtype.Int4{}, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 32)
+	if err != nil {
+		return pgtype.Int4{}, fmt.Errorf("%s must be an integer", key)
+	}
+	return pgtype.Int4{Int32: int32(value), Valid: true}, nil
+}
+
+func queryTimestamp(c *fiber.Ctx, key string) (pgtype.Timestamp, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return pgtype.Timestamp{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return pgtype.Timestamp{Time: t.UTC(), Valid: true}, nil
+		}
+	}
+	return pgtype.Timestamp{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", key)
+}
+
+// cursorArgs returns the keyset columns for the query; all are null on the
+// first page.
+func (s trackSearch) cursorArgs() (id pgtype.UUID, title pgtype.Text, rank pgtype.Float8, at pgtype.Timestamp) {
+	if s.Cursor == nil {
+		return
+	}
+	id = uuidToPgtype(s.Cursor.ID)
+	if s.Cursor.Title != nil {
+		title = pgtype.Text{String: *s.Cursor.Title, Valid: true}
+	}
+	if s.Cursor.Rank != nil {
+		rank = pgtype.Float8{Float64: *s.Cursor.Rank, Valid: true}
+	}
+	if s.Cursor.Time != nil {
+		at = pgtype.Timestamp{Time: *s.Cursor.Time, Valid: true}
+	}
+	return
+}
+
+func (s trackSearch) accessibleParams(userID uuid.UUID) sqlc.SearchAccessibleTracksParams {
+	id, title, rank, at := s.cursorArgs()
+	return sqlc.SearchAccessibleTracksParams{
+		UserID:        userID,
+		Query:         s.Query,
+		Sort:          s.Sort,
+		BpmMin:        s.BPMMin,
+		BpmMax:        s.BPMMax,
+		CreatedAfter:  s.CreatedAfter,
+		CreatedBefore: s.CreatedBefore,
+		UpdatedAfter:  s.UpdatedAfter,
+		UpdatedBefore: s.UpdatedBefore,
+		BlockTypes:    s.BlockTypes,
+		FolderID:      s.FolderID,
+		Unfiled:       s.Unfiled,
+		TagIds:        s.TagIDs,
+		CursorID:      id,
+		CursorTitle:   title,
+		CursorRank:    rank,
+		CursorTime:    at,
+		// One extra row tells whether there is a next page.
+		RowLimit: int32(s.Limit + 1),
+	}
+}
+
+func (s trackSearch) publicParams() sqlc.SearchPublicTracksParams {
+	id, title, rank, at := s.cursorArgs()
+	return sqlc.SearchPublicTracksParams{
+		Query:         s.Query,
+		Sort:          s.Sort,
+		BpmMin:        s.BPMMin,
+		BpmMax:        s.BPMMax,
+		CreatedAfter:  s.CreatedAfter,
+		CreatedBefore: s.CreatedBefore,
+		UpdatedAfter:  s.UpdatedAfter,
+		UpdatedBefore: s.UpdatedBefore,
+		BlockTypes:    s.BlockTypes,
+		CursorID:      id,
+		CursorTitle:   title,
+		CursorRank:    rank,
+		CursorTime:    at,
+		RowLimit:      int32(s.Limit + 1),
+	}
+}
+
+// nextCursor encodes the position after track, the last row of a page.
+func (s trackSearch) nextCursor(track sqlc.Track, rank float64) string {
+	cursor := trackCursor{Sort: s.Sort, ID: track.ID}
+	switch s.Sort {
+	case "title":
+		cursor.Title = &track.Title
+	case sortRelevance:
+		cursor.Rank = &rank
+	case "created":
+		cursor.Time = &track.CreatedAt.Time
+	case "published":
+		cursor.Time = &track.PublishedAt.Time
+	default:
+		cursor.Time = &track.UpdatedAt.Time
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+const tagNameMaxLength = 50
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type TagsHandler struct {
+	db *sqlc.Queries
+}
+
+func NewTagsHandler(db *sqlc.Queries) *TagsHandler {
+	return &TagsHandler{
+		db: db,
+	}
+}
+
+type TagRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+type TagResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Color      string `json:"color,omitempty"`
+	TrackCount int64  `json:"track_count"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// TrackTag is the short form of a tag embedded in track listings.
+type TrackTag struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+func tagToResponse(tag sqlc.Tag, trackCount int64) TagResponse {
+	return TagResponse{
+		ID:         tag.ID.String(),
+		Name:       tag.Name,
+		Color:      tag.Color.String,
+		TrackCount: trackCount,
+		CreatedAt:  tag.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
+
+func validateTag(req TagRequest) (pgtype.Text, error) {
+	if req.Name == "" || len(req.Name) > tagNameMaxLength {
+		return pgtype.Text{}, errors.New("name must be between 1 and 50 characters")
+	}
+	if req.Color == "" {
+		return pgtype.Text{}, nil
+	}
+	if !tagColorPattern.MatchString(req.Color) {
+		return pgtype.Text{}, errors.New("color must be a hex value like #ff8800")
+	}
+	return pgtype.Text{String: req.Color, Valid: true}, nil
+}
+
+func (h *TagsHandler) ListTags(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	rows, err := h.db.ListUserTags(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch tags",
+		})
+	}
+
+	response := make([]TagResponse, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, tagToResponse(sqlc.Tag{
+			ID:        row.ID,
+			UserID:    row.UserID,
+			Name:      row.Name,
+			Color:     row.Color,
+			CreatedAt: row.CreatedAt,
+		}, row.TrackCount))
+	}
+
+	return c.JSON(response)
+}
+
+func (h *TagsHandler) CreateTag(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	var req TagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	color, err := validateTag(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tag, err := h.db.CreateTag(c.Context(), sqlc.CreateTagParams{
+		UserID: userID,
+		Name:   req.Name,
+		Color:  color,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "a tag with this name already exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create tag",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(tagToResponse(tag, 0))
+}
+
+func (h *TagsHandler) UpdateTag(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	tagID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid tag id",
+		})
+	}
+
+	var req TagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	color, err := validateTag(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if _, err := h.db.GetUserTag(c.Context(), sqlc.GetUserTagParams{
+		ID:     tagID,
+		UserID: userID,
+	}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tag not found",
+		})
+	}
+
+	tag, err := h.db.UpdateTag(c.Context(), sqlc.UpdateTagParams{
+		ID:     tagID,
+		UserID: userID,
+		Name:   req.Name,
+		Color:  color,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "a tag with this name already exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update tag",
+		})
+	}
+
+	return c.JSON(tagToResponse(tag, 0))
+}
+
+func (h *TagsHandler) DeleteTag(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	tagID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid tag id",
+		})
+	}
+
+	if _, err := h.db.GetUserTag(c.Context(), sqlc.GetUserTagParams{
+		ID:     tagID,
+		UserID: userID,
+	}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tag not found",
+		})
+	}
+
+	if err := h.db.DeleteTag(c.Context(), sqlc.DeleteTagParams{
+		ID:     tagID,
+		UserID: userID,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete tag",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,606 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/graph"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+var templateScopes = map[string]bool{
+	"all":     true,
+	"curated": true,
+	"mine":    true,
+}
+
+type TemplatesHandler struct {
+	db      *sqlc.Queries
+	pool    *pgxpool.Pool
+	storage *storage.MinIOClient
+	access  *access.Authorizer
+}
+
+func NewTemplatesHandler(db *sqlc.Queries, pool *pgxpool.Pool, storage *storage.MinIOClient) *TemplatesHandler {
+	return &TemplatesHandler{
+		db:      db,
+		pool:    pool,
+		storage: storage,
+		access:  access.NewAuthorizer(db),
+	}
+}
+
+type CreateTemplateRequest struct {
+	TrackID      string `json:"track_id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Curated      bool   `json:"curated"`
+	IncludeFiles *bool  `json:"include_files,omitempty"`
+}
+
+// TemplateScene is a default scene stored with a template.
+type TemplateScene struct {
+	Name     string          `json:"name"`
+	Position int32           `json:"position"`
+	State    json.RawMessage `json:"state"`
+}
+
+type TemplateFileResponse struct {
+	ID       string      `json:"id"`
+	Kind     string      `json:"kind"`
+	Filename string      `json:"filename"`
+	Size     int64       `json:"size"`
+	Audio    *audio.Info `json:"audio"`
+}
+
+type TemplateResponse struct {
+	ID          string                 `json:"id"`
+	UserID      string                 `json:"user_id"`
+	Curated     bool                   `json:"curated"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	BPM         int32                  `json:"bpm"`
+	AuthorName  string                 `json:"author_name,omitempty"`
+	SceneCount  int                    `json:"scene_count"`
+	FileCount   int                    `json:"file_count"`
+	GraphData   map[string]interface{} `json:"graph_data,omitempty"`
+	Scenes      []TemplateScene        `json:"scenes,omitempty"`
+	Files       []TemplateFileResponse `json:"files,omitempty"`
+	CreatedAt   string                 `json:"created_at"`
+	UpdatedAt   string                 `json:"updated_at"`
+}
+
+// visibleTemplate loads a template the user may use: a curated one or one of
+// their own.
+func (h *TemplatesHandler) visibleTemplate(c *fiber.Ctx, userID uuid.UUID) (sqlc.TrackTemplate, error) {
+	templateID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return sqlc.TrackTemplate{}, fiber.NewError(fiber.StatusBadRequest, "invalid template id")
+	}
+	template, err := h.db.GetTemplate(c.Context(), templateID)
+	if err != nil || (!template.Curated && template.UserID != userID) {
+		return sqlc.TrackTemplate{}, fiber.NewError(fiber.StatusNotFound, "template not found")
+	}
+	return template, nil
+}
+
+// ListTemplates returns curated templates followed by the user's own. scope
+// narrows the list to "curated" or "mine".
+func (h *TemplatesHandler) ListTemplates(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	scope := c.Query("scope", "all")
+	if !templateScopes[scope] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("unsupported scope %q", scope),
+		})
+	}
+
+	rows, err := h.db.ListTemplates(c.Context(), sqlc.ListTemplatesParams{
+		UserID: userID,
+		Scope:  scope,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch templates",
+		})
+	}
+
+	response := make([]TemplateResponse, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, TemplateResponse{
+			ID:          row.ID.String(),
+			UserID:      row.UserID.String(),
+			Curated:     row.Curated,
+			Name:        row.Name,
+			Description: row.Description.String,
+			BPM:         row.Bpm,
+			AuthorName:  row.AuthorName.String,
+			SceneCount:  int(row.SceneCount),
+			FileCount:   int(row.FileCount),
+			CreatedAt:   row.CreatedAt.Time.Format(time.RFC3339),
+			UpdatedAt:   row.UpdatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(response)
+}
+
+func (h *TemplatesHandler) GetTemplate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	template, err := h.visibleTemplate(c, userID)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	files, err := h.db.ListTemplateFiles(c.Context(), template.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch template files",
+		})
+	}
+
+	response, err := templateToResponse(template, files)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize template",
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// CreateTemplate saves a track the user can view as a template: its graph,
+// BPM and scenes, and unless include_files is false its samples and impulses.
+// Bundled files are copied and charged to the user. Only admins may save
+// curated templates.
+func (h *TemplatesHandler) CreateTemplate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	var req CreateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	trackID, err := uuid.Parse(req.TrackID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track_id",
+		})
+	}
+
+	user, err := h.db.GetUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch user",
+		})
+	}
+	if req.Curated && !user.IsAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only admins can curate templates",
+		})
+	}
+
+	track, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = track.Title
+	}
+	description := req.Description
+	if description == "" {
+		description = track.Description.String
+	}
+	bpm := track.Bpm.Int32
+	if !track.Bpm.Valid {
+		bpm = 120
+	}
+
+	pgTrackID := uuidToPgtype(track.ID)
+	var files []trackFile
+	if req.IncludeFiles == nil || *req.IncludeFiles {
+		samples, err := h.db.ListTrackSamples(c.Context(), pgTrackID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to fetch samples",
+			})
+		}
+		impulses, err := h.db.ListTrackImpulses(c.Context(), pgTrackID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to fetch impulses",
+			})
+		}
+		for _, sample := range samples {
+			files = append(files, sampleFile(sample))
+		}
+		for _, impulse := range impulses {
+			files = append(files, impulseFile(impulse))
+		}
+	}
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.size
+	}
+
+	if user.StorageUsed.Int64+totalSize > user.StorageLimit.Int64 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "storage limit exceeded",
+		})
+	}
+
+	scenes, err := h.db.ListScenesByTrack(c.Context(), pgTrackID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch scenes",
+		})
+	}
+
+	copies, err := copyStoredFiles(c.Context(), h.storage, userID, files, func(string) string {
+		return "templates"
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to copy files",
+		})
+	}
+
+	// Templates keep no URLs, since presigned ones expire; tracks created
+	// from them get fresh ones. References to files left out are cleared.
+	remap := func(id string) (string, string, bool) {
+		if file, ok := copies[id]; ok {
+			return file.id.String(), "", true
+		}
+		return "", "", true
+	}
+
+	g, err := graph.Parse(track.GraphData)
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "track has invalid graph data",
+		})
+	}
+	g.RemapFiles(remap)
+	graphJSON, err := json.Marshal(g)
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encode graph data",
+		})
+	}
+
+	templateScenes := make([]TemplateScene, 0, len(scenes))
+	for _, scene := range scenes {
+		templateScenes = append(templateScenes, TemplateScene{
+			Name:     scene.Name,
+			Position: scene.Position.Int32,
+			State:    remapSceneState(scene.StateData, remap),
+		})
+	}
+	scenesJSON, err := json.Marshal(templateScenes)
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encode scenes",
+		})
+	}
+
+	var template sqlc.TrackTemplate
+	var created []sqlc.TemplateFile
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		template, err = q.CreateTemplate(c.Context(), sqlc.CreateTemplateParams{
+			UserID:      userID,
+			Curated:     req.Curated,
+			Name:        name,
+			Description: pgtype.Text{String: description, Valid: description != ""},
+			Bpm:         bpm,
+			GraphData:   graphJSON,
+			Scenes:      scenesJSON,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			dst := copies[file.ref]
+			row, err := q.CreateTemplateFile(c.Context(), sqlc.CreateTemplateFileParams{
+				ID:         dst.id,
+				TemplateID: template.ID,
+				Kind:       file.kind,
+				Filename:   file.filename,
+				FileSize:   dst.size,
+				S3Key:      dst.s3Key,
+				MimeType:   file.mimeType,
+				Duration:   file.audio.Duration,
+				SampleRate: file.audio.SampleRate,
+				Channels:   file.audio.Channels,
+				BitDepth:   file.audio.BitDepth,
+				Codec:      file.audio.Codec,
+			})
+			if err != nil {
+				return err
+			}
+			created = append(created, row)
+		}
+
+		return chargeStorage(c.Context(), q, userID, copies)
+	})
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		if errors.Is(err, errStorageLimit) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "storage limit exceeded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create template",
+		})
+	}
+
+	response, err := templateToResponse(template, created)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize template",
+		})
+	}
+	response.AuthorName = user.DisplayName.String
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// DeleteTemplate removes a template and its files. Users can delete their own
+// templates; curated ones can also be deleted by any admin.
+func (h *TemplatesHandler) DeleteTemplate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	template, err := h.visibleTemplate(c, userID)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	if template.UserID != userID {
+		user, err := h.db.GetUser(c.Context(), userID)
+		if err != nil || !user.IsAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "only admins can delete curated templates",
+			})
+		}
+	}
+
+	files, err := h.db.ListTemplateFiles(c.Context(), template.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch template files",
+		})
+	}
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.FileSize
+	}
+
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		if err := q.DeleteTemplate(c.Context(), template.ID); err != nil {
+			return err
+		}
+		return q.ReleaseUserStorage(c.Context(), sqlc.ReleaseUserStorageParams{
+			ID:     template.UserID,
+			Amount: totalSize,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete template",
+		})
+	}
+
+	for _, file := range files {
+		if err := h.storage.DeleteFile(c.Context(), file.S3Key); err != nil {
+			log.Printf("Warning: failed to delete from storage: %v\n", err)
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func templateToResponse(template sqlc.TrackTemplate, files []sqlc.TemplateFile) (*TemplateResponse, error) {
+	graphData, err := decodeGraph(template.GraphData)
+	if err != nil {
+		return nil, err
+	}
+	var scenes []TemplateScene
+	if err := json.Unmarshal(template.Scenes, &scenes); err != nil {
+		return nil, err
+	}
+
+	response := &TemplateResponse{
+		ID:          template.ID.String(),
+		UserID:      template.UserID.String(),
+		Curated:     template.Curated,
+		Name:        template.Name,
+		Description: template.Description.String,
+		BPM:         template.Bpm,
+		SceneCount:  len(scenes),
+		FileCount:   len(files),
+		GraphData:   graphData,
+		Scenes:      scenes,
+		Files:       make([]TemplateFileResponse, 0, len(files)),
+		CreatedAt:   template.CreatedAt.Time.Format(time.RFC3339),
+		UpdatedAt:   template.UpdatedAt.Time.Format(time.RFC3339),
+	}
+	for _, file := range files {
+		response.Files = append(response.Files, TemplateFileResponse{
+			ID:       file.ID.String(),
+			Kind:     file.Kind,
+			Filename: file.Filename,
+			Size:     file.FileSize,
+			Audio:    audioInfo(file.Duration, file.SampleRate, file.Channels, file.BitDepth, file.Codec),
+		})
+	}
+	return response, nil
+}
+
+// createFromTemplate backs CreateTrack when a template_id is given. Fields
+// set in the request override the template's; its graph is always used.
+func (h *TracksHandler) createFromTemplate(c *fiber.Ctx, userID uuid.UUID, req CreateTrackRequest) error {
+	templateID, err := uuid.Parse(req.TemplateID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid template_id",
+		})
+	}
+	template, err := h.db.GetTemplate(c.Context(), templateID)
+	if err != nil || (!template.Curated && template.UserID != userID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "template not found",
+		})
+	}
+
+	files, err := h.db.ListTemplateFiles(c.Context(), template.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch template files",
+		})
+	}
+	var scenes []TemplateScene
+	if err := json.Unmarshal(template.Scenes, &scenes); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "template has invalid scenes",
+		})
+	}
+
+	var totalSize int64
+	stored := make([]trackFile, 0, len(files))
+	for _, file := range files {
+		stored = append(stored, templateFile(file))
+		totalSize += file.FileSize
+	}
+
+	user, err := h.db.GetUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check storage",
+		})
+	}
+	if user.StorageUsed.Int64+totalSize > user.StorageLimit.Int64 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "storage limit exceeded",
+		})
+	}
+
+	copies, err := copyStoredFiles(c.Context(), h.storage, userID, stored, func(kind string) string {
+		return kind + "s"
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to copy template files",
+		})
+	}
+	remap := func(id string) (string, string, bool) {
+		file, ok := copies[id]
+		return file.id.String(), file.url, ok
+	}
+
+	g, err := graph.Parse(template.GraphData)
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "template has invalid graph data",
+		})
+	}
+	g.RemapFiles(remap)
+	graphJSON, err := json.Marshal(g)
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encode graph data",
+		})
+	}
+
+	title := req.Title
+	if title == "" {
+		title = template.Name
+	}
+	description := req.Description
+	if description == "" {
+		description = template.Description.String
+	}
+	bpm := req.BPM
+	if bpm == 0 {
+		bpm = template.Bpm
+	}
+
+	var track sqlc.Track
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		track, err = q.CreateTrack(c.Context(), sqlc.CreateTrackParams{
+			UserID:      uuidToPgtype(userID),
+			Title:       title,
+			Description: pgtype.Text{String: description, Valid: description != ""},
+			Bpm:         pgtype.Int4{Int32: bpm, Valid: true},
+			GraphData:   graphJSON,
+		})
+		if err != nil {
+			return err
+		}
+		newTrackID := uuidToPgtype(track.ID)
+
+		if err := createTrackFiles(c.Context(), q, userID, track.ID, stored, copies); err != nil {
+			return err
+		}
+
+		for _, scene := range scenes {
+			state := []byte(scene.State)
+			if len(state) == 0 {
+				state = []byte("{}")
+			}
+			if _, err := q.CreateScene(c.Context(), sqlc.CreateSceneParams{
+				ID:        uuid.New(),
+				TrackID:   newTrackID,
+				Name:      scene.Name,
+				StateData: remapSceneState(state, remap),
+				Position:  pgtype.Int4{Int32: scene.Position, Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := database.RecordRevision(c.Context(), q, track, userID, "Created from template "+template.Name); err != nil {
+			return err
+		}
+		return chargeStorage(c.Context(), q, userID, copies)
+	})
+	if err != nil {
+		deleteCopies(c.Context(), h.storage, copies)
+		if errors.Is(err, errStorageLimit) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "storage limit exceeded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create track",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
@@ -1,16 +1,34 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/graph"
+	"github.com/theosov/hexa/pkg/storage"
 )
 
 type TracksHandler struct {
-	db *sqlc.Queries
+	db      *sqlc.Queries
+	pool    *pgxpool.Pool
+	storage *storage.MinIOClient
+	access  *access.Authorizer
 }
 
 func uuidToPgtype(id uuid.UUID) pgtype.UUID {
@@ -20,8 +38,45 @@ func uuidToPgtype(id uuid.UUID) pgtype.UUID {
 	}
 }
 
-func NewTracksHandler(db *sqlc.Queries) *TracksHandler {
-	return &TracksHandler{db: db}
+func NewTracksHandler(db *sqlc.Queries, pool *pgxpool.Pool, storage *storage.MinIOClient) *TracksHandler {
+	return &TracksHandler{
+		db:      db,
+		pool:    pool,
+		storage: storage,
+		access:  access.NewAuthorizer(db),
+	}
+}
+
+const CoverMaxFileSize = 5 * 1024 * 1024
+
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+const (
+	uniqueViolation   = "23505"
+	shareSlugLength   = 10
+	shareSlugAttempts = 3
+	// 32 lowercase letters and digits without the easily confused ones, so
+	// slugs survive being read out or typed and bytes map onto it evenly.
+	shareSlugAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+)
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func generateShareSlug() (string, error) {
+	b := make([]byte, shareSlugLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = shareSlugAlphabet[int(b[i])%len(shareSlugAlphabet)]
+	}
+	return string(b), nil
 }
 
 type CreateTrackRequest struct {
@@ -29,13 +84,15 @@ type CreateTrackRequest struct {
 	Description string      `json:"description"`
 	BPM         int32       `json:"bpm"`
 	GraphData   interface{} `json:"graph_data"`
+	TemplateID  string      `json:"template_id,omitempty"`
 }
 
 type UpdateTrackRequest struct {
-	Title       string      `json:"title"`
-	Description string      `json:"description"`
-	BPM         int32       `json:"bpm"`
-	GraphData   interface{} `json:"graph_data"`
+	Title         string      `json:"title"`
+	Description   string      `json:"description"`
+	BPM           int32       `json:"bpm"`
+	GraphData     interface{} `json:"graph_data"`
+	RevisionLabel string      `json:"revision_label,omitempty"`
 }
 
 type TrackResponse struct {
@@ -44,18 +101,48 @@ type TrackResponse struct {
 	Title       string                 `json:"title"`
 	Description string                 `json:"description"`
 	IsPublic    bool                   `json:"is_public"`
+	ShareSlug   string                 `json:"share_slug,omitempty"`
+	ForkedFrom  *string                `json:"forked_from"`
 	BPM         int32                  `json:"bpm"`
 	GraphData   map[string]interface{} `json:"graph_data"`
+	GraphError  string                 `json:"graph_error,omitempty"`
+	CoverURL    string                 `json:"cover_url,omitempty"`
+	Role        string                 `json:"role,omitempty"`
+	FolderID    *string                `json:"folder_id,omitempty"`
+	Tags        []TrackTag             `json:"tags,omitempty"`
+	Version     int32                  `json:"version"`
 	CreatedAt   string                 `json:"created_at"`
 	UpdatedAt   string                 `json:"updated_at"`
 }
 
-func trackToResponse(track sqlc.Track) (*TrackResponse, error) {
+// decodeGraph upgrades stored graph data to the current format version and
+// decodes it for a response. Stored rows are left as they are; the
+// migrate-graphs command rewrites them in bulk.
+func decodeGraph(data []byte) (map[string]interface{}, error) {
+	data, _, err := graph.Migrate(data)
+	if err != nil {
+		return nil, err
+	}
 	var graphData map[string]interface{}
-	if err := json.Unmarshal(track.GraphData, &graphData); err != nil {
+	if err := json.Unmarshal(data, &graphData); err != nil {
 		return nil, err
 	}
+	return graphData, nil
+}
+
+func trackToResponse(track sqlc.Track) (*TrackResponse, error) {
+	graphData, err := decodeGraph(track.GraphData)
+	if err != nil {
+		return nil, err
+	}
+
+	response := trackSummary(track)
+	response.GraphData = graphData
+	return response, nil
+}
 
+// trackSummary builds the response for everything but graph_data.
+func trackSummary(track sqlc.Track) *TrackResponse {
 	description := ""
 	if track.Description.Valid {
 		description = track.Description.String
@@ -66,39 +153,127 @@ func trackToResponse(track sqlc.Track) (*TrackResponse, error) {
 		bpm = track.Bpm.Int32
 	}
 
+	var forkedFrom *string
+	if track.ForkedFrom.Valid {
+		id := uuid.UUID(track.ForkedFrom.Bytes).String()
+		forkedFrom = &id
+	}
+
 	return &TrackResponse{
 		ID:          track.ID.String(),
 		UserID:      track.UserID.String(),
 		Title:       track.Title,
 		Description: description,
 		IsPublic:    track.IsPublic.Bool,
+		ShareSlug:   track.ShareSlug.String,
+		ForkedFrom:  forkedFrom,
 		BPM:         bpm,
-		GraphData:   graphData,
+		Version:     track.Version,
 		CreatedAt:   track.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:   track.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
-	}, nil
+	}
+}
+
+// normalizeGraph validates graph data and returns it as it is stored:
+// upgraded to the current format version.
+func normalizeGraph(data []byte) ([]byte, error) {
+	g, err := graph.ValidateJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(g)
 }
 
+func graphValidationError(c *fiber.Ctx, err error) error {
+	var validationErr *graph.ValidationError
+	if errors.As(err, &validationErr) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":  "invalid graph data",
+			"errors": validationErr.Errors,
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "invalid graph data",
+	})
+}
+
+var trackListSorts = map[string]bool{
+	"updated": true,
+	"created": true,
+	"title":   true,
+}
+
+// ListTracks pages through the tracks the user owns or collaborates on. See
+// parseTrackSearch for the supported filters.
 func (h *TracksHandler) ListTracks(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 
-	tracks, err := h.db.ListUserTracks(c.Context(), uuidToPgtype(userID))
+	search, err := parseTrackSearch(c, trackListSorts, "updated")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	rows, err := h.db.SearchAccessibleTracks(c.Context(), search.accessibleParams(userID))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to fetch tracks",
 		})
 	}
 
-	response := make([]TrackResponse, 0, len(tracks))
-	for _, track := range tracks {
-		tr, err := trackToResponse(track)
+	var nextCursor *string
+	if len(rows) > search.Limit {
+		rows = rows[:search.Limit]
+		last := rows[len(rows)-1]
+		cursor := search.nextCursor(last.Track, last.Rank)
+		nextCursor = &cursor
+	}
+
+	trackIDs := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		trackIDs = append(trackIDs, row.Track.ID)
+	}
+	tagRows, err := h.db.ListTagsForTracks(c.Context(), sqlc.ListTagsForTracksParams{
+		UserID:   userID,
+		TrackIds: trackIDs,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch tags",
+		})
+	}
+	tags := make(map[uuid.UUID][]TrackTag)
+	for _, row := range tagRows {
+		tags[row.TrackID] = append(tags[row.TrackID], TrackTag{
+			ID:    row.ID.String(),
+			Name:  row.Name,
+			Color: row.Color.String,
+		})
+	}
+
+	tracks := make([]TrackResponse, 0, len(rows))
+	for _, row := range rows {
+		tr, err := trackToResponse(row.Track)
 		if err != nil {
-			continue
+			// Keep the track listed so it can still be renamed, restored
+			// from history or deleted.
+			tr = trackSummary(row.Track)
+			tr.GraphError = "stored graph_data could not be decoded"
+		}
+		tr.Role = row.Role
+		if row.FolderID.Valid {
+			folderID := uuid.UUID(row.FolderID.Bytes).String()
+			tr.FolderID = &folderID
 		}
-		response = append(response, *tr)
+		tr.Tags = tags[row.Track.ID]
+		tracks = append(tracks, *tr)
 	}
 
-	return c.JSON(response)
+	return c.JSON(fiber.Map{
+		"tracks":      tracks,
+		"next_cursor": nextCursor,
+	})
 }
 
 func (h *TracksHandler) GetTrack(c *fiber.Ctx) error {
@@ -110,14 +285,9 @@ func (h *TracksHandler) GetTrack(c *fiber.Ctx) error {
 		})
 	}
 
-	track, err := h.db.GetUserTrack(c.Context(), sqlc.GetUserTrackParams{
-		ID:     trackID,
-		UserID: uuidToPgtype(userID),
-	})
+	track, role, err := h.access.Track(c.Context(), trackID, userID, access.RoleViewer)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "track not found",
-		})
+		return accessError(c, err)
 	}
 
 	response, err := trackToResponse(track)
@@ -126,10 +296,51 @@ func (h *TracksHandler) GetTrack(c *fiber.Ctx) error {
 			"error": "failed to serialize track",
 		})
 	}
+	response.Role = string(role)
+
+	if track.CoverS3Key.Valid {
+		if url, err := h.storage.GetPresignedURL(c.Context(), track.CoverS3Key.String, 1*time.Hour); err == nil {
+			response.CoverURL = url.String()
+		}
+	}
 
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
 	return c.JSON(response)
 }
 
+// ValidateGraph checks graph_data against the block schema without saving it.
+func (h *TracksHandler) ValidateGraph(c *fiber.Ctx) error {
+	var req struct {
+		GraphData interface{} `json:"graph_data"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	graphJSON, err := json.Marshal(req.GraphData)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid graph data",
+		})
+	}
+
+	errs := []graph.FieldError{}
+	if _, err := graph.ValidateJSON(graphJSON); err != nil {
+		var validationErr *graph.ValidationError
+		if !errors.As(err, &validationErr) {
+			return graphValidationError(c, err)
+		}
+		errs = validationErr.Errors
+	}
+
+	return c.JSON(fiber.Map{
+		"valid":  len(errs) == 0,
+		"errors": errs,
+	})
+}
+
 func (h *TracksHandler) CreateTrack(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 
@@ -140,30 +351,45 @@ func (h *TracksHandler) CreateTrack(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.TemplateID != "" {
+		return h.createFromTemplate(c, userID, req)
+	}
+
 	graphJSON, err := json.Marshal(req.GraphData)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "invalid graph data",
 		})
 	}
+	graphJSON, err = normalizeGraph(graphJSON)
+	if err != nil {
+		return graphValidationError(c, err)
+	}
 
 	bpm := req.BPM
 	if bpm == 0 {
 		bpm = 120
 	}
 
-	track, err := h.db.CreateTrack(c.Context(), sqlc.CreateTrackParams{
-		UserID: uuidToPgtype(userID),
-		Title:  req.Title,
-		Description: pgtype.Text{
-			String: req.Description,
-			Valid:  req.Description != "",
-		},
-		Bpm: pgtype.Int4{
-			Int32: bpm,
-			Valid: true,
-		},
-		GraphData: graphJSON,
+	var track sqlc.Track
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		track, err = q.CreateTrack(c.Context(), sqlc.CreateTrackParams{
+			UserID: uuidToPgtype(userID),
+			Title:  req.Title,
+			Description: pgtype.Text{
+				String: req.Description,
+				Valid:  req.Description != "",
+			},
+			Bpm: pgtype.Int4{
+				Int32: bpm,
+				Valid: true,
+			},
+			GraphData: graphJSON,
+		})
+		if err != nil {
+			return err
+		}
+		return database.RecordRevision(c.Context(), q, track, userID, "Created")
 	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -190,6 +416,17 @@ func (h *TracksHandler) UpdateTrack(c *fiber.Ctx) error {
 		})
 	}
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid If-Match header",
+		})
+	}
+
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor); err != nil {
+		return accessError(c, err)
+	}
+
 	var req UpdateTrackRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -203,18 +440,32 @@ func (h *TracksHandler) UpdateTrack(c *fiber.Ctx) error {
 			"error": "invalid graph data",
 		})
 	}
+	graphJSON, err = normalizeGraph(graphJSON)
+	if err != nil {
+		return graphValidationError(c, err)
+	}
 
-	track, err := h.db.UpdateTrack(c.Context(), sqlc.UpdateTrackParams{
-		ID:    trackID,
-		Title: req.Title,
-		Description: pgtype.Text{
-			String: req.Description,
-			Valid:  req.Description != "",
-		},
-		Bpm:       pgtype.Int4{Int32: req.BPM, Valid: true},
-		GraphData: graphJSON,
-		UserID:    uuidToPgtype(userID),
+	var track sqlc.Track
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		track, err = q.UpdateTrack(c.Context(), sqlc.UpdateTrackParams{
+			ID:    trackID,
+			Title: req.Title,
+			Description: pgtype.Text{
+				String: req.Description,
+				Valid:  req.Description != "",
+			},
+			Bpm:             pgtype.Int4{Int32: req.BPM, Valid: true},
+			GraphData:       graphJSON,
+			ExpectedVersion: expectedVersion,
+		})
+		if err != nil {
+			return err
+		}
+		return database.RecordRevision(c.Context(), q, track, userID, req.RevisionLabel)
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return h.updateConflict(c, trackID)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to update track",
@@ -228,6 +479,7 @@ func (h *TracksHandler) UpdateTrack(c *fiber.Ctx) error {
 		})
 	}
 
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
 	return c.JSON(response)
 }
 
@@ -240,14 +492,35 @@ func (h *TracksHandler) UpdateTrackGraph(c *fiber.Ctx) error {
 		})
 	}
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid If-Match header",
+		})
+	}
+
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor); err != nil {
+		return accessError(c, err)
+	}
+
+	// The body carries either a full graph_data replacement or a list of ops
+	// applied to the stored graph, which is what the studio sends for
+	// individual edits.
 	var req struct {
-		GraphData interface{} `json:"graph_data"`
+		GraphData     interface{} `json:"graph_data"`
+		Ops           []graph.Op  `json:"ops"`
+		RevisionLabel string      `json:"revision_label,omitempty"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "invalid request body",
 		})
 	}
+	if req.Ops != nil && req.GraphData != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "send either graph_data or ops, not both",
+		})
+	}
 
 	graphJSON, err := json.Marshal(req.GraphData)
 	if err != nil {
@@ -255,12 +528,46 @@ func (h *TracksHandler) UpdateTrackGraph(c *fiber.Ctx) error {
 			"error": "invalid graph data",
 		})
 	}
+	if req.Ops == nil {
+		graphJSON, err = normalizeGraph(graphJSON)
+		if err != nil {
+			return graphValidationError(c, err)
+		}
+	}
+
+	var track sqlc.Track
+	err = database.WithTx(c.Context(), h.pool, func(q *sqlc.Queries) error {
+		if req.Ops != nil {
+			graphJSON, err = applyGraphOps(c.Context(), q, trackID, expectedVersion, req.Ops)
+			if err != nil {
+				return err
+			}
+		}
 
-	track, err := h.db.UpdateTrackGraph(c.Context(), sqlc.UpdateTrackGraphParams{
-		ID:        trackID,
-		GraphData: graphJSON,
-		UserID:    uuidToPgtype(userID),
+		track, err = q.UpdateTrackGraph(c.Context(), sqlc.UpdateTrackGraphParams{
+			ID:              trackID,
+			GraphData:       graphJSON,
+			ExpectedVersion: expectedVersion,
+		})
+		if err != nil {
+			return err
+		}
+		return database.RecordRevision(c.Context(), q, track, userID, req.RevisionLabel)
 	})
+	var opErr *graph.OpError
+	if errors.As(err, &opErr) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": opErr.Message,
+			"op":    opErr.Index,
+		})
+	}
+	var validationErr *graph.ValidationError
+	if errors.As(err, &validationErr) {
+		return graphValidationError(c, err)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return h.updateConflict(c, trackID)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to update track graph",
@@ -274,9 +581,69 @@ func (h *TracksHandler) UpdateTrackGraph(c *fiber.Ctx) error {
 		})
 	}
 
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
 	return c.JSON(response)
 }
 
+// applyGraphOps locks the track row and applies ops to its stored graph. A
+// version mismatch is reported as pgx.ErrNoRows, the same as a failed
+// conditional UPDATE, before the ops are validated, so the client sees a
+// conflict rather than an error about a graph it has not seen yet.
+func applyGraphOps(ctx context.Context, q *sqlc.Queries, trackID uuid.UUID, expectedVersion pgtype.Int4, ops []graph.Op) ([]byte, error) {
+	current, err := q.GetTrackForUpdate(ctx, trackID)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion.Valid && current.Version != expectedVersion.Int32 {
+		return nil, pgx.ErrNoRows
+	}
+
+	g, err := graph.Parse(current.GraphData)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Apply(ops); err != nil {
+		return nil, err
+	}
+	if err := graph.Validate(g); err != nil {
+		return nil, err
+	}
+	return json.Marshal(g)
+}
+
+// updateConflict explains why a conditional update matched no row: either the
+// track is gone, or its version moved on and the client gets the current
+// state back to merge against.
+func (h *TracksHandler) updateConflict(c *fiber.Ctx, trackID uuid.UUID) error {
+	return trackConflict(c, h.db, trackID)
+}
+
+// trackConflict answers a write whose If-Match version is stale with the
+// track as it is now.
+func trackConflict(c *fiber.Ctx, db *sqlc.Queries, trackID uuid.UUID) error {
+	track, err := db.GetTrack(c.Context(), trackID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "track not found",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":   "track was modified by another client",
+		"current": response,
+	})
+}
+
+// DeleteTrack moves a track to the trash. It disappears from every listing
+// and from collaborators, but can be restored until it is purged.
 func (h *TracksHandler) DeleteTrack(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uuid.UUID)
 	trackID, err := uuid.Parse(c.Params("id"))
@@ -286,16 +653,199 @@ func (h *TracksHandler) DeleteTrack(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.db.DeleteTrack(c.Context(), sqlc.DeleteTrackParams{
-		ID:     trackID,
-		UserID: uuidToPgtype(userID),
-	}); err != nil {
+	if _, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleOwner); err != nil {
+		return accessError(c, err)
+	}
+
+	if _, err := h.db.TrashTrack(c.Context(), trackID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to delete track",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"message": "track deleted",
+		"message": "track moved to trash",
+	})
+}
+
+// SetVisibility publishes or unpublishes a track. Publishing for the first
+// time assigns the share slug used by the public endpoints.
+func (h *TracksHandler) SetVisibility(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	var req struct {
+		IsPublic *bool `json:"is_public"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.IsPublic == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "is_public is required",
+		})
+	}
+
+	current, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleOwner)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	params := sqlc.SetTrackPublicParams{
+		ID:       trackID,
+		IsPublic: pgtype.Bool{Bool: *req.IsPublic, Valid: true},
+	}
+
+	var track sqlc.Track
+	for attempt := 0; ; attempt++ {
+		if *req.IsPublic && !current.ShareSlug.Valid {
+			slug, err := generateShareSlug()
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "failed to generate share link",
+				})
+			}
+			params.ShareSlug = pgtype.Text{String: slug, Valid: true}
+		}
+
+		track, err = h.db.SetTrackPublic(c.Context(), params)
+		if isUniqueViolation(err) && attempt < shareSlugAttempts {
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update visibility",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to serialize track",
+		})
+	}
+
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
+	return c.JSON(response)
+}
+
+func (h *TracksHandler) UploadCover(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	track, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "file is required",
+		})
+	}
+
+	if file.Size > CoverMaxFileSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("file too large (max %dMB)", CoverMaxFileSize/1024/1024),
+		})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to open file",
+		})
+	}
+	defer src.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := coverExtensions[contentType]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid file type (allowed: jpeg, png)",
+		})
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to read file",
+		})
+	}
+
+	s3Key := fmt.Sprintf("covers/%s/%s%s", userID.String(), uuid.New().String(), ext)
+	if err := h.storage.UploadFile(c.Context(), s3Key, src, file.Size, contentType); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to upload file",
+		})
+	}
+
+	if _, err := h.db.SetTrackCover(c.Context(), sqlc.SetTrackCoverParams{
+		ID:         trackID,
+		CoverS3Key: pgtype.Text{String: s3Key, Valid: true},
+	}); err != nil {
+		_ = h.storage.DeleteFile(c.Context(), s3Key)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save cover",
+		})
+	}
+
+	if track.CoverS3Key.Valid {
+		if err := h.storage.DeleteFile(c.Context(), track.CoverS3Key.String); err != nil {
+			log.Printf("Warning: failed to delete old cover: %v\n", err)
+		}
+	}
+
+	url, _ := h.storage.GetPresignedURL(c.Context(), s3Key, 1*time.Hour)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"cover_url": url.String(),
+	})
+}
+
+func (h *TracksHandler) DeleteCover(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid track id",
+		})
+	}
+
+	track, _, err := h.access.Track(c.Context(), trackID, userID, access.RoleEditor)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	if !track.CoverS3Key.Valid {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "track has no cover",
+		})
+	}
+
+	if _, err := h.db.SetTrackCover(c.Context(), sqlc.SetTrackCoverParams{
+		ID: trackID,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to remove cover",
+		})
+	}
+
+	if err := h.storage.DeleteFile(c.Context(), track.CoverS3Key.String); err != nil {
+		log.Printf("Warning: failed to delete cover from storage: %v\n", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "cover deleted",
 	})
 }
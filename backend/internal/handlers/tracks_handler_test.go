@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+func TestNormalizeGraphStoresCurrentVersion(t *testing.T) {
+	old := []byte(`{"nodes": [
+		{"id": "osc", "type": "oscillator", "params": {"frequency": "440"}},
+		{"id": "out", "type": "master", "params": {}}
+	], "connections": [{"id": "c1", "from": "osc", "to": "out"}]}`)
+
+	data, err := normalizeGraph(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored graph.Graph
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != graph.CurrentVersion {
+		t.Errorf("version = %d, want %d", stored.Version, graph.CurrentVersion)
+	}
+	if got := stored.Nodes[0].Params["frequency"]; got != 440.0 {
+		t.Errorf("frequency = %#v, want 440", got)
+	}
+}
+
+func TestNormalizeGraphRejectsInvalid(t *testing.T) {
+	if _, err := normalizeGraph([]byte(`[]`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/access"
+	"github.com/theosov/hexa/internal/jobs"
+)
+
+type TrashHandler struct {
+	db    *sqlc.Queries
+	trash *jobs.TrashCollector
+}
+
+func NewTrashHandler(db *sqlc.Queries, trash *jobs.TrashCollector) *TrashHandler {
+	return &TrashHandler{
+		db:    db,
+		trash: trash,
+	}
+}
+
+type TrashedTrackResponse struct {
+	TrackResponse
+	DeletedAt string `json:"deleted_at"`
+	PurgeAt   string `json:"purge_at"`
+}
+
+func (h *TrashHandler) trashedToResponse(track sqlc.Track) TrashedTrackResponse {
+	return TrashedTrackResponse{
+		TrackResponse: *trackSummary(track),
+		DeletedAt:     track.DeletedAt.Time.Format(time.RFC3339),
+		PurgeAt:       track.DeletedAt.Time.Add(h.trash.Retention()).Format(time.RFC3339),
+	}
+}
+
+// trashed loads one of the user's own trashed tracks. Only owners can delete
+// tracks, so the trash never holds anyone else's.
+func (h *TrashHandler) trashed(c *fiber.Ctx) (sqlc.Track, error) {
+	userID := c.Locals("userID").(uuid.UUID)
+	trackID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return sqlc.Track{}, fiber.NewError(fiber.StatusBadRequest, "invalid track id")
+	}
+
+	track, err := h.db.GetTrashedTrack(c.Context(), sqlc.GetTrashedTrackParams{
+		ID:     trackID,
+		UserID: uuidToPgtype(userID),
+	})
+	if err != nil {
+		return sqlc.Track{}, fiber.NewError(fiber.StatusNotFound, "track not found in trash")
+	}
+	return track, nil
+}
+
+func (h *TrashHandler) ListTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	tracks, err := h.db.ListTrashedTracks(c.Context(), uuidToPgtype(userID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch trash",
+		})
+	}
+
+	response := make([]TrashedTrackResponse, 0, len(tracks))
+	for _, track := range tracks {
+		response = append(response, h.trashedToResponse(track))
+	}
+
+	return c.JSON(response)
+}
+
+func (h *TrashHandler) RestoreTrack(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+	track, err := h.trashed(c)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	track, err = h.db.RestoreTrack(c.Context(), sqlc.RestoreTrackParams{
+		ID:     track.ID,
+		UserID: uuidToPgtype(userID),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to restore track",
+		})
+	}
+
+	response, err := trackToResponse(track)
+	if err != nil {
+		response = trackSummary(track)
+		response.GraphError = "stored graph_data could not be decoded"
+	}
+	response.Role = string(access.RoleOwner)
+
+	c.Set(fiber.HeaderETag, versionETag(track.Version))
+	return c.JSON(response)
+}
+
+// PurgeTrack permanently deletes a trashed track and its files.
+func (h *TrashHandler) PurgeTrack(c *fiber.Ctx) error {
+	track, err := h.trashed(c)
+	if err != nil {
+		return sendFailure(c, err)
+	}
+
+	if err := h.trash.Purge(c.Context(), track); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to purge track",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// EmptyTrash permanently deletes every track in the user's trash.
+func (h *TrashHandler) EmptyTrash(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	tracks, err := h.db.ListTrashedTracks(c.Context(), uuidToPgtype(userID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch trash",
+		})
+	}
+
+	for _, track := range tracks {
+		if err := h.trash.Purge(c.Context(), track); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to empty trash",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"purged": len(tracks),
+	})
+}
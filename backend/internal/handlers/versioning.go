@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func versionETag(version int32) string {
+	return `"` + strconv.Itoa(int(version)) + `"`
+}
+
+// ifMatchVersion reads the version a client expects to overwrite from the
+// If-Match header. A missing header or "*" yields a null version, which the
+// update queries treat as an unconditional write. ok is false when the header
+// is present but is not one of our version tags.
+func ifMatchVersion(c *fiber.Ctx) (version pgtype.Int4, ok bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return pgtype.Int4{}, true
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return pgtype.Int4{}, false
+	}
+	parsed, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 32)
+	if err != nil {
+		return pgtype.Int4{}, false
+	}
+	return pgtype.Int4{Int32: int32(parsed), Valid: true}, true
+}
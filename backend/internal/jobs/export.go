@@ -0,0 +1,383 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/export"
+	"github.com/theosov/hexa/pkg/graph"
+	"github.com/theosov/hexa/pkg/render"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+
+	pollInterval     = 5 * time.Second
+	staleAfter       = 10 * time.Minute
+	progressStep     = 0.01
+	progressInterval = 500 * time.Millisecond
+)
+
+type ExportOptions struct {
+	export.Settings
+	export.Loudness
+	Duration float64 `json:"duration,omitempty"`
+}
+
+type ExportWorker struct {
+	db          *sqlc.Queries
+	storage     *storage.MinIOClient
+	concurrency int
+	wake        chan struct{}
+}
+
+func NewExportWorker(db *sqlc.Queries, storage *storage.MinIOClient, concurrency int) *ExportWorker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &ExportWorker{
+		db:          db,
+		storage:     storage,
+		concurrency: concurrency,
+		wake:        make(chan struct{}, concurrency),
+	}
+}
+
+// Start requeues jobs left running by a crashed instance and launches the
+// worker pool. Jobs are claimed with SKIP LOCKED, so several server instances
+// can share the same queue.
+func (w *ExportWorker) Start(ctx context.Context) {
+	staleBefore := pgtype.Timestamp{Time: time.Now().Add(-staleAfter), Valid: true}
+	if err := w.db.RequeueStaleExportJobs(ctx, staleBefore); err != nil {
+		log.Printf("Warning: failed to requeue stale export jobs: %v\n", err)
+	}
+
+	for i := 0; i < w.concurrency; i++ {
+		go w.loop(ctx)
+	}
+}
+
+func (w *ExportWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// failureMessage is what users are shown for a failed export or transcode.
+// err itself may carry ffmpeg output and server paths, so it only goes to the
+// log; users get its kind, or fallback.
+func failureMessage(err error, fallback string) string {
+	for _, known := range []error{export.ErrEncoding, export.ErrMeasurement, export.ErrSilentInput, audio.ErrUndecodable} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	return fallback
+}
+
+func (w *ExportWorker) loop(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := w.db.ClaimExportJob(ctx)
+		if err == nil {
+			if err := w.run(ctx, job); err != nil {
+				log.Printf("Export job %s failed: %v\n", job.ID, err)
+				_ = w.db.FailExportJob(ctx, sqlc.FailExportJobParams{
+					ID:    job.ID,
+					Error: pgtype.Text{String: failureMessage(err, "export failed"), Valid: true},
+				})
+			}
+			continue
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Warning: failed to claim export job: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ExportWorker) run(ctx context.Context, job sqlc.ExportJob) error {
+	var opts ExportOptions
+	if err := json.Unmarshal(job.Options, &opts); err != nil {
+		return fmt.Errorf("invalid job options: %w", err)
+	}
+
+	profile, settings, err := export.Resolve(opts.Settings)
+	if err != nil {
+		return fmt.Errorf("invalid export settings: %w", err)
+	}
+
+	loudness, err := export.ResolveLoudness(opts.Loudness)
+	if err != nil {
+		return fmt.Errorf("invalid loudness settings: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "export-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := w.progressReporter(ctx, job)
+
+	var (
+		track    sqlc.Track
+		metadata *export.Metadata
+		cover    string
+	)
+	if job.TrackID.Valid {
+		track, err = w.db.GetTrack(ctx, job.TrackID.Bytes)
+		if err != nil {
+			return fmt.Errorf("track not found: %w", err)
+		}
+
+		metadata = w.trackMetadata(ctx, track)
+
+		if track.CoverS3Key.Valid && profile.Artwork {
+			cover = filepath.Join(dir, "cover"+filepath.Ext(track.CoverS3Key.String))
+			if err := download(ctx, w.storage, track.CoverS3Key.String, cover); err != nil {
+				log.Printf("Warning: skipping cover art for export %s: %v\n", job.ID, err)
+				cover = ""
+			}
+		}
+	}
+
+	var (
+		inputPath string
+		duration  time.Duration
+		encodeAt  float64
+	)
+
+	switch {
+	case job.InputS3Key.Valid:
+		inputPath = filepath.Join(dir, "input"+filepath.Ext(job.InputS3Key.String))
+		if err := download(ctx, w.storage, job.InputS3Key.String, inputPath); err != nil {
+			return err
+		}
+		info, err := audio.Probe(ctx, inputPath)
+		if err != nil {
+			return err
+		}
+		duration = time.Duration(info.Duration * float64(time.Second))
+	case job.TrackID.Valid:
+		inputPath = filepath.Join(dir, "render.wav")
+		duration, err = w.renderTrack(ctx, track, opts, inputPath, func(f float64) {
+			report(f / 2)
+		})
+		if err != nil {
+			return err
+		}
+		encodeAt = 0.5
+	default:
+		return errors.New("job has no input")
+	}
+
+	var loudnessReport *export.LoudnessReport
+	if loudness.Enabled() {
+		measured, err := export.Measure(ctx, inputPath, loudness)
+		if err != nil {
+			return err
+		}
+		loudnessReport = &export.LoudnessReport{
+			Target:   *loudness.Target,
+			TruePeak: *loudness.TruePeak,
+			Input:    *measured,
+		}
+	}
+
+	outputPath := filepath.Join(dir, "output"+profile.Extension)
+	encodeOpts := export.EncodeOptions{
+		Input:    inputPath,
+		Output:   outputPath,
+		Profile:  profile,
+		Settings: settings,
+		Metadata: metadata,
+		Cover:    cover,
+		Loudness: loudness,
+		Duration: duration,
+		Progress: func(f float64) {
+			report(encodeAt + f*(1-encodeAt))
+		},
+	}
+	if loudnessReport != nil {
+		encodeOpts.Measured = &loudnessReport.Input
+	}
+	if err := export.Encode(ctx, encodeOpts); err != nil {
+		return err
+	}
+
+	var reportJSON []byte
+	if loudnessReport != nil {
+		if !loudness.MeasureOnly {
+			if measured, err := export.Measure(ctx, outputPath, loudness); err == nil {
+				loudnessReport.Output = measured
+			} else {
+				log.Printf("Warning: failed to measure export %s output loudness: %v\n", job.ID, err)
+			}
+		}
+		if reportJSON, err = json.Marshal(loudnessReport); err != nil {
+			return fmt.Errorf("cannot encode loudness report: %w", err)
+		}
+	}
+
+	outputKey := fmt.Sprintf("exports/%s/%s%s", job.UserID.String(), job.ID.String(), profile.Extension)
+	if err := upload(ctx, w.storage, outputPath, outputKey, profile.ContentType); err != nil {
+		return err
+	}
+
+	var peaksKey pgtype.Text
+	if peaks, err := audio.ComputePeaks(ctx, outputPath); err != nil {
+		log.Printf("Warning: failed to compute peaks of export %s: %v\n", job.ID, err)
+	} else {
+		key := fmt.Sprintf("exports/%s/%s.peaks.json", job.UserID.String(), job.ID.String())
+		if err := StorePeaks(ctx, w.storage, key, peaks); err != nil {
+			log.Printf("Warning: failed to store peaks of export %s: %v\n", job.ID, err)
+		} else {
+			peaksKey = pgtype.Text{String: key, Valid: true}
+		}
+	}
+
+	if job.InputS3Key.Valid {
+		if err := w.storage.DeleteFile(ctx, job.InputS3Key.String); err != nil {
+			log.Printf("Warning: failed to delete input of export %s: %v\n", job.ID, err)
+		}
+	}
+
+	return w.db.CompleteExportJob(ctx, sqlc.CompleteExportJobParams{
+		ID:             job.ID,
+		OutputS3Key:    pgtype.Text{String: outputKey, Valid: true},
+		LoudnessReport: reportJSON,
+		PeaksS3Key:     peaksKey,
+	})
+}
+
+func (w *ExportWorker) trackMetadata(ctx context.Context, track sqlc.Track) *export.Metadata {
+	metadata := &export.Metadata{
+		Title:   track.Title,
+		Comment: track.Description.String,
+		BPM:     int(track.Bpm.Int32),
+	}
+
+	if track.UserID.Valid {
+		if owner, err := w.db.GetUser(ctx, track.UserID.Bytes); err == nil {
+			metadata.Artist = owner.DisplayName.String
+		}
+	}
+
+	return metadata
+}
+
+func (w *ExportWorker) renderTrack(ctx context.Context, track sqlc.Track, opts ExportOptions, path string, progress func(float64)) (time.Duration, error) {
+	g, err := graph.Parse(track.GraphData)
+	if err != nil {
+		return 0, err
+	}
+
+	buf, err := render.Render(ctx, g, render.Options{
+		Duration: time.Duration(opts.Duration * float64(time.Second)),
+		BPM:      int(track.Bpm.Int32),
+		Progress: progress,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("render failed: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create render file: %w", err)
+	}
+	defer f.Close()
+
+	if err := render.WriteWAV(f, buf); err != nil {
+		return 0, fmt.Errorf("cannot write render file: %w", err)
+	}
+	return buf.Duration(), nil
+}
+
+func download(ctx context.Context, store *storage.MinIOClient, key, path string) error {
+	obj, err := store.GetFile(ctx, key)
+	if err != nil {
+		return fmt.Errorf("cannot fetch input: %w", err)
+	}
+	defer obj.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create input file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, obj); err != nil {
+		return fmt.Errorf("cannot download input: %w", err)
+	}
+	return nil
+}
+
+func upload(ctx context.Context, store *storage.MinIOClient, path, key, contentType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open output: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat output: %w", err)
+	}
+
+	if err := store.UploadFile(ctx, key, f, info.Size(), contentType); err != nil {
+		return fmt.Errorf("cannot upload output: %w", err)
+	}
+	return nil
+}
+
+// progressReporter throttles progress writes so a long encode does not turn
+// into a stream of UPDATEs.
+func (w *ExportWorker) progressReporter(ctx context.Context, job sqlc.ExportJob) func(float64) {
+	var (
+		mu       sync.Mutex
+		last     float64
+		lastSent time.Time
+	)
+	return func(fraction float64) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fraction-last < progressStep || time.Since(lastSent) < progressInterval {
+			return
+		}
+		last, lastSent = fraction, time.Now()
+
+		if err := w.db.UpdateExportJobProgress(ctx, sqlc.UpdateExportJobProgressParams{
+			ID:       job.ID,
+			Progress: fraction,
+		}); err != nil {
+			log.Printf("Warning: failed to update progress of export %s: %v\n", job.ID, err)
+		}
+	}
+}
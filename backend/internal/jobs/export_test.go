@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/export"
+)
+
+func TestFailureMessageHidesDetails(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: exit status 1: /tmp/export-123/input.wav: Invalid data", export.ErrEncoding), "encoding failed"},
+		{fmt.Errorf("%w: exit status 1: Conversion failed!", export.ErrMeasurement), "loudness measurement failed"},
+		{export.ErrSilentInput, "cannot measure loudness of silent audio"},
+		{fmt.Errorf("%w: moov atom not found", audio.ErrUndecodable), "file could not be decoded as audio"},
+		{fmt.Errorf("cannot download input: %w", errors.New("dial tcp 10.0.0.5:9000: refused")), "export failed"},
+	}
+	for _, tt := range tests {
+		if got := failureMessage(tt.err, "export failed"); got != tt.want {
+			t.Errorf("failureMessage(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+func SamplePeaksKey(id uuid.UUID) string {
+	return fmt.Sprintf("samples/renditions/%s/peaks.json", id.String())
+}
+
+func ImpulsePeaksKey(id uuid.UUID) string {
+	return fmt.Sprintf("impulses/peaks/%s.json", id.String())
+}
+
+// StorePeaks uploads peaks as JSON under key.
+func StorePeaks(ctx context.Context, store *storage.MinIOClient, key string, peaks *audio.Peaks) error {
+	data, err := json.Marshal(peaks)
+	if err != nil {
+		return fmt.Errorf("cannot encode peaks: %w", err)
+	}
+	if err := store.UploadFile(ctx, key, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return fmt.Errorf("cannot upload peaks: %w", err)
+	}
+	return nil
+}
+
+// LoadPeaks fetches peaks stored by StorePeaks.
+func LoadPeaks(ctx context.Context, store *storage.MinIOClient, key string) (*audio.Peaks, error) {
+	obj, err := store.GetFile(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch peaks: %w", err)
+	}
+	defer obj.Close()
+
+	var peaks audio.Peaks
+	if err := json.NewDecoder(obj).Decode(&peaks); err != nil {
+		return nil, fmt.Errorf("cannot decode peaks: %w", err)
+	}
+	return &peaks, nil
+}
+
+// SampleObjectKeys lists every stored object of a sample: the original and
+// whichever renditions and peaks exist.
+func SampleObjectKeys(sample sqlc.Sample) []string {
+	return objectKeys(sample.S3Key, sample.PlaybackS3Key, sample.PreviewS3Key, sample.PeaksS3Key)
+}
+
+// ImpulseObjectKeys lists every stored object of an impulse.
+func ImpulseObjectKeys(impulse sqlc.ReverbImpulse) []string {
+	return objectKeys(impulse.S3Key, impulse.PeaksS3Key)
+}
+
+func objectKeys(original string, derived ...pgtype.Text) []string {
+	keys := []string{original}
+	for _, key := range derived {
+		if key.Valid {
+			keys = append(keys, key.String)
+		}
+	}
+	return keys
+}
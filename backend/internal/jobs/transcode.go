@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/pkg/audio"
+	"github.com/theosov/hexa/pkg/export"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+// Renditions every sample is transcoded to: a canonical WAV the studio can
+// decode without resampling and a small Opus file for previews.
+var (
+	PlaybackSettings = export.Settings{Format: "wav", SampleRate: 48000, BitDepth: 32}
+	PreviewSettings  = export.Settings{Format: "opus", SampleRate: 48000, Mode: export.ModeVBR, Bitrate: 96}
+)
+
+// TranscodeWorker produces the playback and preview renditions of samples.
+// Renditions are generated by the server and do not count towards the
+// uploader's storage.
+type TranscodeWorker struct {
+	db          *sqlc.Queries
+	storage     *storage.MinIOClient
+	concurrency int
+	wake        chan struct{}
+}
+
+func NewTranscodeWorker(db *sqlc.Queries, storage *storage.MinIOClient, concurrency int) *TranscodeWorker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &TranscodeWorker{
+		db:          db,
+		storage:     storage,
+		concurrency: concurrency,
+		wake:        make(chan struct{}, concurrency),
+	}
+}
+
+// Start requeues samples left running by a crashed instance and launches the
+// worker pool. Samples are claimed with SKIP LOCKED, like export jobs.
+func (w *TranscodeWorker) Start(ctx context.Context) {
+	staleBefore := pgtype.Timestamp{Time: time.Now().Add(-staleAfter), Valid: true}
+	if err := w.db.RequeueStaleSampleTranscodes(ctx, staleBefore); err != nil {
+		log.Printf("Warning: failed to requeue stale transcodes: %v\n", err)
+	}
+
+	for i := 0; i < w.concurrency; i++ {
+		go w.loop(ctx)
+	}
+}
+
+func (w *TranscodeWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *TranscodeWorker) loop(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		sample, err := w.db.ClaimSampleTranscode(ctx)
+		if err == nil {
+			if err := w.run(ctx, sample); err != nil {
+				log.Printf("Transcode of sample %s failed: %v\n", sample.ID, err)
+				_ = w.db.FailSampleTranscode(ctx, sqlc.FailSampleTranscodeParams{
+					ID:             sample.ID,
+					TranscodeError: pgtype.Text{String: failureMessage(err, "transcode failed"), Valid: true},
+				})
+			}
+			continue
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Warning: failed to claim transcode: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *TranscodeWorker) run(ctx context.Context, sample sqlc.Sample) error {
+	dir, err := os.MkdirTemp("", "transcode-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input"+filepath.Ext(sample.S3Key))
+	if err := download(ctx, w.storage, sample.S3Key, input); err != nil {
+		return err
+	}
+
+	var keys []string
+	encode := func(name string, settings export.Settings) (string, string, error) {
+		profile, settings, err := export.Resolve(settings)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid %s settings: %w", name, err)
+		}
+		output := filepath.Join(dir, name+profile.Extension)
+		if err := export.Encode(ctx, export.EncodeOptions{
+			Input:    input,
+			Output:   output,
+			Profile:  profile,
+			Settings: settings,
+		}); err != nil {
+			return "", "", err
+		}
+
+		key := fmt.Sprintf("samples/renditions/%s/%s%s", sample.ID.String(), name, profile.Extension)
+		if err := upload(ctx, w.storage, output, key, profile.ContentType); err != nil {
+			return "", "", err
+		}
+		keys = append(keys, key)
+		return output, key, nil
+	}
+	cleanup := func() {
+		for _, key := range keys {
+			if err := w.storage.DeleteFile(ctx, key); err != nil {
+				log.Printf("Warning: failed to delete rendition %s of sample %s: %v\n", key, sample.ID, err)
+			}
+		}
+	}
+
+	playbackPath, playback, err := encode("playback", PlaybackSettings)
+	if err != nil {
+		cleanup()
+		return err
+	}
+	_, preview, err := encode("preview", PreviewSettings)
+	if err != nil {
+		cleanup()
+		return err
+	}
+
+	// Peaks are taken from the playback rendition, which is already at
+	// audio.PeaksSampleRate. A sample without them still plays, and the peaks
+	// endpoint generates them on demand.
+	var peaksKey pgtype.Text
+	if peaks, err := audio.ComputePeaks(ctx, playbackPath); err != nil {
+		log.Printf("Warning: failed to compute peaks of sample %s: %v\n", sample.ID, err)
+	} else if err := StorePeaks(ctx, w.storage, SamplePeaksKey(sample.ID), peaks); err != nil {
+		log.Printf("Warning: failed to store peaks of sample %s: %v\n", sample.ID, err)
+	} else {
+		peaksKey = pgtype.Text{String: SamplePeaksKey(sample.ID), Valid: true}
+	}
+
+	rows, err := w.db.CompleteSampleTranscode(ctx, sqlc.CompleteSampleTranscodeParams{
+		ID:            sample.ID,
+		PlaybackS3Key: pgtype.Text{String: playback, Valid: true},
+		PreviewS3Key:  pgtype.Text{String: preview, Valid: true},
+		PeaksS3Key:    peaksKey,
+	})
+	if err != nil {
+		cleanup()
+		return err
+	}
+	if rows == 0 {
+		// The sample was deleted while it was being transcoded. Peaks are
+		// only removed here: the peaks endpoint may have stored the same
+		// key for a sample that still exists.
+		if peaksKey.Valid {
+			keys = append(keys, peaksKey.String)
+		}
+		cleanup()
+	}
+	return nil
+}
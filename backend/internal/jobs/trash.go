@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/theosov/hexa/db/sqlc"
+	"github.com/theosov/hexa/internal/database"
+	"github.com/theosov/hexa/pkg/storage"
+)
+
+const (
+	trashSweepInterval = 1 * time.Hour
+	trashSweepBatch    = 50
+)
+
+// TrashCollector permanently removes trashed tracks, either on request or
+// once they have been in the trash longer than the retention period.
+type TrashCollector struct {
+	db        *sqlc.Queries
+	pool      *pgxpool.Pool
+	storage   *storage.MinIOClient
+	retention time.Duration
+}
+
+func NewTrashCollector(db *sqlc.Queries, pool *pgxpool.Pool, storage *storage.MinIOClient, retention time.Duration) *TrashCollector {
+	return &TrashCollector{
+		db:        db,
+		pool:      pool,
+		storage:   storage,
+		retention: retention,
+	}
+}
+
+// Retention is how long a track stays in the trash before it is purged.
+func (t *TrashCollector) Retention() time.Duration {
+	return t.retention
+}
+
+// Start sweeps expired tracks now and then every trashSweepInterval. Purges
+// only delete rows that are still trashed, so several server instances can
+// sweep at once.
+func (t *TrashCollector) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(trashSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			t.sweep(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (t *TrashCollector) sweep(ctx context.Context) {
+	before := pgtype.Timestamp{Time: time.Now().Add(-t.retention), Valid: true}
+	for {
+		tracks, err := t.db.ListExpiredTrashedTracks(ctx, sqlc.ListExpiredTrashedTracksParams{
+			DeletedAt: before,
+			Limit:     trashSweepBatch,
+		})
+		if err != nil {
+			log.Printf("Warning: failed to list expired trash: %v\n", err)
+			return
+		}
+
+		for _, track := range tracks {
+			if err := t.Purge(ctx, track); err != nil {
+				log.Printf("Warning: failed to purge track %s: %v\n", track.ID, err)
+				return
+			}
+		}
+		if len(tracks) < trashSweepBatch {
+			return
+		}
+	}
+}
+
+// Purge deletes a trashed track with its scenes, revisions, samples and
+// impulses, credits the files' sizes back to their uploaders and removes the
+// objects from storage. Library samples attached to the track are only
+// detached. A track that is no longer in the trash is left alone.
+func (t *TrashCollector) Purge(ctx context.Context, track sqlc.Track) error {
+	trackID := pgtype.UUID{Bytes: track.ID, Valid: true}
+	samples, err := t.db.ListTrackUploadedSamples(ctx, trackID)
+	if err != nil {
+		return fmt.Errorf("cannot list samples: %w", err)
+	}
+	impulses, err := t.db.ListTrackImpulses(ctx, trackID)
+	if err != nil {
+		return fmt.Errorf("cannot list impulses: %w", err)
+	}
+
+	released, keys := purgedFiles(track, samples, impulses)
+
+	purged := false
+	err = database.WithTx(ctx, t.pool, func(q *sqlc.Queries) error {
+		rows, err := q.PurgeTrack(ctx, track.ID)
+		if err != nil || rows == 0 {
+			return err
+		}
+		purged = true
+
+		for userID, amount := range released {
+			if err := q.ReleaseUserStorage(ctx, sqlc.ReleaseUserStorageParams{
+				ID:     userID,
+				Amount: amount,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !purged {
+		return err
+	}
+
+	// Objects go only once the rows are gone, so a failure here leaves
+	// orphaned objects rather than rows pointing at missing files.
+	for _, key := range keys {
+		if err := t.storage.DeleteFile(ctx, key); err != nil {
+			log.Printf("Warning: failed to delete %s of purged track %s: %v\n", key, track.ID, err)
+		}
+	}
+	return nil
+}
+
+// purgedFiles returns the storage to credit back to each uploader and the
+// objects to delete when track is purged with its samples and impulses.
+// Library samples are skipped: they belong to their owner's library, and
+// purging only detaches them.
+func purgedFiles(track sqlc.Track, samples []sqlc.Sample, impulses []sqlc.ReverbImpulse) (map[uuid.UUID]int64, []string) {
+	released := make(map[uuid.UUID]int64)
+	keys := make([]string, 0, len(samples)+len(impulses)+1)
+	for _, sample := range samples {
+		if !sample.TrackID.Valid || sample.TrackID.Bytes != track.ID {
+			continue
+		}
+		if sample.UserID.Valid {
+			released[sample.UserID.Bytes] += sample.FileSize
+		}
+		keys = append(keys, SampleObjectKeys(sample)...)
+	}
+	for _, impulse := range impulses {
+		if impulse.UserID.Valid {
+			released[impulse.UserID.Bytes] += impulse.FileSize
+		}
+		keys = append(keys, ImpulseObjectKeys(impulse)...)
+	}
+	if track.CoverS3Key.Valid {
+		keys = append(keys, track.CoverS3Key.String)
+	}
+	return released, keys
+}
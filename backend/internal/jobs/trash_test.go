@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/theosov/hexa/db/sqlc"
+)
+
+func TestPurgedFilesKeepsLibrarySamples(t *testing.T) {
+	owner, collaborator := uuid.New(), uuid.New()
+	track := sqlc.Track{
+		ID:         uuid.New(),
+		CoverS3Key: pgtype.Text{String: "covers/track.png", Valid: true},
+	}
+	onTrack := pgtype.UUID{Bytes: track.ID, Valid: true}
+
+	samples := []sqlc.Sample{
+		{
+			UserID:        pgtype.UUID{Bytes: owner, Valid: true},
+			TrackID:       onTrack,
+			FileSize:      100,
+			S3Key:         "samples/kick.wav",
+			PlaybackS3Key: pgtype.Text{String: "samples/renditions/kick.wav", Valid: true},
+		},
+		{
+			UserID:   pgtype.UUID{Bytes: collaborator, Valid: true},
+			TrackID:  onTrack,
+			FileSize: 20,
+			S3Key:    "samples/snare.wav",
+		},
+		// A library sample attached to the track.
+		{
+			UserID:   pgtype.UUID{Bytes: owner, Valid: true},
+			FileSize: 1000,
+			S3Key:    "samples/library.wav",
+		},
+	}
+	impulses := []sqlc.ReverbImpulse{{
+		UserID:   pgtype.UUID{Bytes: owner, Valid: true},
+		FileSize: 5,
+		S3Key:    "impulses/hall.wav",
+	}}
+
+	released, keys := purgedFiles(track, samples, impulses)
+
+	wantReleased := map[uuid.UUID]int64{owner: 105, collaborator: 20}
+	if !reflect.DeepEqual(released, wantReleased) {
+		t.Errorf("released = %v, want %v", released, wantReleased)
+	}
+	wantKeys := []string{
+		"samples/kick.wav",
+		"samples/renditions/kick.wav",
+		"samples/snare.wav",
+		"impulses/hall.wav",
+		"covers/track.png",
+	}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys = %v, want %v", keys, wantKeys)
+	}
+}
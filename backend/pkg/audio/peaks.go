@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+const (
+	// PeaksSampleRate is the rate audio is resampled to before computing
+	// peaks, the same as the sample playback rendition, so clients can map
+	// buckets to time without knowing the source rate.
+	PeaksSampleRate = 48000
+
+	// peaksSamplesPerPixel is the bucket size of the finest level; each
+	// further level doubles it.
+	peaksSamplesPerPixel = 256
+	peaksLevels          = 8
+)
+
+// Peaks is the waveform overview of a file at several zoom levels, from
+// finest (level 0) to coarsest. Channels are mixed down to mono.
+type Peaks struct {
+	Levels []PeakLevel `json:"levels"`
+}
+
+// PeakLevel holds a min and max value per bucket of SamplesPerPixel samples,
+// interleaved and scaled to 8 bits.
+type PeakLevel struct {
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Data            []int8 `json:"data"`
+}
+
+// Waveform is one level of Peaks in the JSON layout audiowaveform uses.
+type Waveform struct {
+	Version         int    `json:"version"`
+	Channels        int    `json:"channels"`
+	SampleRate      int    `json:"sample_rate"`
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Bits            int    `json:"bits"`
+	Length          int    `json:"length"`
+	Data            []int8 `json:"data"`
+}
+
+// Zoom returns the waveform at the given level, 0 being the finest.
+func (p *Peaks) Zoom(level int) (*Waveform, bool) {
+	if level < 0 || level >= len(p.Levels) {
+		return nil, false
+	}
+	l := p.Levels[level]
+	return &Waveform{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      PeaksSampleRate,
+		SamplesPerPixel: l.SamplesPerPixel,
+		Bits:            8,
+		Length:          len(l.Data) / 2,
+		Data:            l.Data,
+	}, true
+}
+
+// ComputePeaks decodes the file at path and computes its peaks.
+func ComputePeaks(ctx context.Context, path string) (*Peaks, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
+		"-i", path,
+		"-map", "0:a:0",
+		"-ac", "1",
+		"-ar", strconv.Itoa(PeaksSampleRate),
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"pipe:1",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach ffmpeg output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	finest, err := bucketPeaks(bufio.NewReader(stdout))
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("failed to read decoded audio: %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, runError(ctx, "ffmpeg", err, stderr.String())
+	}
+	if len(finest) == 0 {
+		return nil, fmt.Errorf("%w: no audio data", ErrUndecodable)
+	}
+
+	peaks := &Peaks{Levels: []PeakLevel{{SamplesPerPixel: peaksSamplesPerPixel, Data: finest}}}
+	for len(peaks.Levels) < peaksLevels {
+		prev := peaks.Levels[len(peaks.Levels)-1]
+		if len(prev.Data) <= 2 {
+			break
+		}
+		peaks.Levels = append(peaks.Levels, PeakLevel{
+			SamplesPerPixel: prev.SamplesPerPixel * 2,
+			Data:            mergePeaks(prev.Data),
+		})
+	}
+	return peaks, nil
+}
+
+// ComputePeaksReader computes the peaks of the contents of r, which is
+// copied to a temporary file first like in ProbeReader.
+func ComputePeaksReader(ctx context.Context, r io.Reader) (*Peaks, error) {
+	tmp, err := os.CreateTemp("", "hexa-peaks-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return ComputePeaks(ctx, tmp.Name())
+}
+
+// bucketPeaks reads 16-bit little-endian mono PCM and returns the min and max
+// of every peaksSamplesPerPixel samples.
+func bucketPeaks(r io.Reader) ([]int8, error) {
+	var (
+		data   []int8
+		buf    [2]byte
+		lo, hi int16
+		n      int
+	)
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		v := int16(binary.LittleEndian.Uint16(buf[:]))
+		if n == 0 || v < lo {
+			lo = v
+		}
+		if n == 0 || v > hi {
+			hi = v
+		}
+		n++
+		if n == peaksSamplesPerPixel {
+			data = append(data, scalePeak(lo), scalePeak(hi))
+			n = 0
+		}
+	}
+	if n > 0 {
+		data = append(data, scalePeak(lo), scalePeak(hi))
+	}
+	return data, nil
+}
+
+func scalePeak(v int16) int8 {
+	return int8(v >> 8)
+}
+
+// mergePeaks halves the resolution of interleaved min/max data.
+func mergePeaks(data []int8) []int8 {
+	merged := make([]int8, 0, (len(data)/2+1)/2*2)
+	for i := 0; i < len(data); i += 4 {
+		lo, hi := data[i], data[i+1]
+		if i+3 < len(data) {
+			lo = min(lo, data[i+2])
+			hi = max(hi, data[i+3])
+		}
+		merged = append(merged, lo, hi)
+	}
+	return merged
+}
@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// pcm encodes samples as 16-bit little-endian PCM.
+func pcm(samples ...int16) []byte {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		_ = binary.Write(&buf, binary.LittleEndian, s)
+	}
+	return buf.Bytes()
+}
+
+// repeat returns n copies of v.
+func repeat(v int16, n int) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = v
+	}
+	return out
+}
+
+func TestBucketPeaks(t *testing.T) {
+	full := append(repeat(0, peaksSamplesPerPixel-2), -32768, 32767)
+	tests := []struct {
+		name string
+		data []byte
+		want []int8
+	}{
+		{"empty", nil, nil},
+		{"one full bucket", pcm(full...), []int8{-128, 127}},
+		{"single sample", pcm(1024), []int8{4, 4}},
+		{
+			"partial last bucket",
+			pcm(append(full, -512, 256)...),
+			[]int8{-128, 127, -2, 1},
+		},
+		{
+			"buckets do not share extremes",
+			pcm(append(repeat(-8192, peaksSamplesPerPixel), repeat(4096, peaksSamplesPerPixel)...)...),
+			[]int8{-32, -32, 16, 16},
+		},
+		{"trailing odd byte is ignored", append(pcm(2560), 0x7f), []int8{10, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bucketPeaks(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bucketPeaks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePeaks(t *testing.T) {
+	tests := []struct {
+		name string
+		data []int8
+		want []int8
+	}{
+		{"empty", []int8{}, []int8{}},
+		{"single bucket is kept", []int8{-3, 5}, []int8{-3, 5}},
+		{"pair", []int8{-3, 5, -7, 2}, []int8{-7, 5}},
+		{"odd bucket count keeps the last", []int8{-1, 1, -2, 2, -9, 9}, []int8{-2, 2, -9, 9}},
+		{"even bucket count", []int8{0, 1, -4, 0, 3, 3, -1, 8}, []int8{-4, 1, -1, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePeaks(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePeaks(%v) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoom(t *testing.T) {
+	peaks := &Peaks{Levels: []PeakLevel{
+		{SamplesPerPixel: 256, Data: []int8{-1, 1, -2, 2, -3, 3}},
+		{SamplesPerPixel: 512, Data: []int8{-2, 2, -3, 3}},
+	}}
+
+	for _, level := range []int{-1, 2, 100} {
+		if _, ok := peaks.Zoom(level); ok {
+			t.Errorf("Zoom(%d) succeeded, want out of range", level)
+		}
+	}
+
+	w, ok := peaks.Zoom(1)
+	if !ok {
+		t.Fatal("Zoom(1) failed")
+	}
+	want := &Waveform{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      PeaksSampleRate,
+		SamplesPerPixel: 512,
+		Bits:            8,
+		Length:          2,
+		Data:            []int8{-2, 2, -3, 3},
+	}
+	if !reflect.DeepEqual(w, want) {
+		t.Errorf("Zoom(1) = %+v, want %+v", w, want)
+	}
+
+	if _, ok := (&Peaks{}).Zoom(0); ok {
+		t.Error("Zoom(0) of empty peaks succeeded")
+	}
+}
@@ -0,0 +1,179 @@
+// Package audio inspects uploaded audio files using ffprobe and ffmpeg.
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeTimeout bounds probing and decoding a single file.
+const probeTimeout = 60 * time.Second
+
+// ErrUndecodable is returned for files ffmpeg cannot decode as audio.
+var ErrUndecodable = errors.New("file could not be decoded as audio")
+
+// Info describes the first audio stream of a file. BitDepth is zero for
+// lossy codecs, which have none.
+type Info struct {
+	Duration   float64 `json:"duration"`
+	SampleRate int     `json:"sample_rate"`
+	Channels   int     `json:"channels"`
+	BitDepth   int     `json:"bit_depth,omitempty"`
+	Codec      string  `json:"codec"`
+}
+
+type probeOutput struct {
+	Streams []struct {
+		CodecName        string `json:"codec_name"`
+		SampleRate       string `json:"sample_rate"`
+		Channels         int    `json:"channels"`
+		BitsPerSample    int    `json:"bits_per_sample"`
+		BitsPerRawSample string `json:"bits_per_raw_sample"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe reads the stream parameters of the file at path and then decodes it
+// in full, so truncated or corrupt files are rejected with ErrUndecodable.
+// The duration is taken from the decode, since recordings such as
+// MediaRecorder's WebM often carry none in their headers.
+func Probe(ctx context.Context, path string) (*Info, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,sample_rate,channels,bits_per_sample,bits_per_raw_sample:format=duration",
+		"-of", "json",
+		path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, runError(ctx, "ffprobe", err, stderr.String())
+	}
+
+	var probe probeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return nil, fmt.Errorf("%w: no audio stream", ErrUndecodable)
+	}
+	stream := probe.Streams[0]
+
+	info := &Info{
+		Channels: stream.Channels,
+		BitDepth: stream.BitsPerSample,
+		Codec:    stream.CodecName,
+	}
+	info.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+	if info.BitDepth == 0 {
+		info.BitDepth, _ = strconv.Atoi(stream.BitsPerRawSample)
+	}
+
+	decoded, err := decode(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	info.Duration = decoded.Seconds()
+	if info.Duration <= 0 {
+		info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	}
+	if info.Duration <= 0 || info.SampleRate <= 0 || info.Channels <= 0 {
+		return nil, fmt.Errorf("%w: no audio data", ErrUndecodable)
+	}
+	return info, nil
+}
+
+// ProbeReader probes the contents of r. ffprobe needs to seek in some
+// containers, so r is copied to a temporary file first.
+func ProbeReader(ctx context.Context, r io.Reader) (*Info, error) {
+	tmp, err := os.CreateTemp("", "hexa-probe-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return Probe(ctx, tmp.Name())
+}
+
+// decode runs the first audio stream through ffmpeg, discarding the output,
+// and returns how much audio it decoded.
+func decode(ctx context.Context, path string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
+		"-xerror",
+		"-nostats",
+		"-progress", "pipe:1",
+		"-i", path,
+		"-map", "0:a:0",
+		"-f", "null",
+		"-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach ffmpeg output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	var decoded time.Duration
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" {
+			continue
+		}
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us > 0 {
+			decoded = time.Duration(us) * time.Microsecond
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return 0, runError(ctx, "ffmpeg", err, stderr.String())
+	}
+	return decoded, nil
+}
+
+// runError reports a tool that ran and rejected the file as ErrUndecodable,
+// and anything else (a missing binary, a timeout) as a plain failure.
+func runError(ctx context.Context, tool string, err error, stderr string) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s failed: %w", tool, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg := strings.TrimSpace(stderr)
+		if i := strings.LastIndex(msg, "\n"); i >= 0 {
+			msg = msg[i+1:]
+		}
+		return fmt.Errorf("%w: %s", ErrUndecodable, msg)
+	}
+	return fmt.Errorf("%s failed: %w", tool, err)
+}
@@ -9,6 +9,15 @@ import (
 func AuthMiddleware(jwtManager *JWTManager) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
+
+		// Browsers cannot set headers on a WebSocket handshake, so the token
+		// may be passed as a query parameter for upgrades only.
+		if authHeader == "" && strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") {
+			if token := c.Query("access_token"); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
+
 		if authHeader == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "missing authorization header",
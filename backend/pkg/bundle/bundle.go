@@ -0,0 +1,293 @@
+// Package bundle reads and writes .hexa archives: a zip holding a track, its
+// scenes and its uploaded files, described by a manifest with checksums.
+package bundle
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"time"
+)
+
+const (
+	Format       = "hexa-bundle"
+	Version      = 1
+	Extension    = ".hexa"
+	ContentType  = "application/zip"
+	ManifestName = "manifest.json"
+
+	KindSample  = "sample"
+	KindImpulse = "impulse"
+
+	// MaxManifestSize bounds the manifest, which is decoded in memory.
+	MaxManifestSize = 16 << 20
+)
+
+var (
+	ErrNoManifest  = errors.New("bundle has no manifest")
+	ErrUnsupported = errors.New("unsupported bundle format or version")
+	ErrChecksum    = errors.New("bundle file does not match its checksum")
+)
+
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Track     Track     `json:"track"`
+	Scenes    []Scene   `json:"scenes"`
+	Files     []File    `json:"files"`
+}
+
+type Track struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	BPM         int32           `json:"bpm"`
+	Graph       json.RawMessage `json:"graph"`
+}
+
+type Scene struct {
+	Name     string          `json:"name"`
+	Position int32           `json:"position"`
+	State    json.RawMessage `json:"state"`
+}
+
+// File is an uploaded sample or impulse. ID is the id the graph and scenes
+// refer to it by; importers assign new ids and rewrite those references.
+type File struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Path     string `json:"path"`
+}
+
+// Writer streams a bundle. Files are written as they are added and the
+// manifest, which needs their checksums, is written last by Close.
+type Writer struct {
+	zw       *zip.Writer
+	manifest Manifest
+}
+
+func NewWriter(w io.Writer, track Track) *Writer {
+	return &Writer{
+		zw: zip.NewWriter(w),
+		manifest: Manifest{
+			Format:  Format,
+			Version: Version,
+			Track:   track,
+			Scenes:  []Scene{},
+			Files:   []File{},
+		},
+	}
+}
+
+func (w *Writer) AddScene(scene Scene) {
+	w.manifest.Scenes = append(w.manifest.Scenes, scene)
+}
+
+// AddFile copies r into the archive and records it in the manifest. Size and
+// SHA256 are filled in from the data actually written.
+func (w *Writer) AddFile(file File, r io.Reader) error {
+	if file.Kind != KindSample && file.Kind != KindImpulse {
+		return fmt.Errorf("unknown file kind %q", file.Kind)
+	}
+	file.Path = fmt.Sprintf("files/%ss/%s%s", file.Kind, file.ID, path.Ext(file.Filename))
+
+	// Audio is already compressed, so deflating it only costs time.
+	dst, err := w.zw.CreateHeader(&zip.FileHeader{
+		Name:     file.Path,
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, h), r)
+	if err != nil {
+		return err
+	}
+	file.Size = size
+	file.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	w.manifest.Files = append(w.manifest.Files, file)
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.manifest.CreatedAt = time.Now().UTC()
+
+	dst, err := w.zw.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(w.manifest); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+type Reader struct {
+	Manifest Manifest
+	files    map[string]*zip.File
+}
+
+// Open reads and checks the manifest of the bundle in r. File contents are
+// only verified as they are read through Reader.Open.
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	entry, ok := entries[ManifestName]
+	if !ok {
+		return nil, ErrNoManifest
+	}
+	if entry.UncompressedSize64 > MaxManifestSize {
+		return nil, fmt.Errorf("invalid manifest: larger than %dMB", MaxManifestSize>>20)
+	}
+	src, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	defer src.Close()
+
+	var manifest Manifest
+	// The declared size is not trusted, so the read is bounded as well.
+	if err := json.NewDecoder(io.LimitReader(src, MaxManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Format != Format || manifest.Version != Version {
+		return nil, ErrUnsupported
+	}
+	if len(manifest.Track.Graph) == 0 || string(manifest.Track.Graph) == "null" {
+		return nil, errors.New("invalid manifest: track has no graph")
+	}
+
+	reader := &Reader{
+		Manifest: manifest,
+		files:    make(map[string]*zip.File, len(manifest.Files)),
+	}
+	for _, file := range manifest.Files {
+		if file.Kind != KindSample && file.Kind != KindImpulse {
+			return nil, fmt.Errorf("invalid manifest: unknown file kind %q", file.Kind)
+		}
+		if file.Size < 0 {
+			return nil, fmt.Errorf("invalid manifest: negative size for %q", file.Path)
+		}
+		if _, dup := reader.files[file.ID]; dup {
+			return nil, fmt.Errorf("invalid manifest: duplicate file id %q", file.ID)
+		}
+		f, ok := entries[file.Path]
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest: missing file %q", file.Path)
+		}
+		if f.UncompressedSize64 != uint64(file.Size) {
+			return nil, fmt.Errorf("invalid manifest: size mismatch for %q", file.Path)
+		}
+		reader.files[file.ID] = f
+	}
+
+	return reader, nil
+}
+
+// Open returns the contents of file, which are exactly file.Size bytes. The
+// returned reader fails with ErrChecksum along with the last byte if the data
+// does not match the manifest, so callers that stop reading once they have
+// the declared size still see the error.
+func (r *Reader) Open(file File) (io.ReadCloser, error) {
+	f, ok := r.files[file.ID]
+	if !ok {
+		return nil, fmt.Errorf("file %q is not in the bundle", file.ID)
+	}
+	src, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &checkedReader{
+		src:       src,
+		remaining: file.Size,
+		hash:      sha256.New(),
+		expect:    file.SHA256,
+	}, nil
+}
+
+// Verify reads file in full and checks it against the manifest. Consumers
+// that read exactly file.Size bytes with io.ReadFull semantics drop an error
+// returned along with the last byte, so they should verify first.
+func (r *Reader) Verify(file File) error {
+	rc, err := r.Open(file)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+type checkedReader struct {
+	src       io.ReadCloser
+	remaining int64
+	hash      hash.Hash
+	expect    string
+	err       error
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		c.err = c.verify()
+		return 0, c.err
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.src.Read(p)
+	c.hash.Write(p[:n])
+	c.remaining -= int64(n)
+
+	switch {
+	case c.remaining == 0:
+		if c.err = c.verify(); c.err != nil {
+			return n, c.err
+		}
+		return n, nil
+	case errors.Is(err, io.EOF):
+		c.err = io.ErrUnexpectedEOF
+		return n, c.err
+	}
+	return n, err
+}
+
+// verify checks the data read so far against the manifest checksum, and
+// returns io.EOF if it matches.
+func (c *checkedReader) verify() error {
+	if hex.EncodeToString(c.hash.Sum(nil)) != c.expect {
+		return ErrChecksum
+	}
+	return io.EOF
+}
+
+func (c *checkedReader) Close() error {
+	return c.src.Close()
+}
@@ -0,0 +1,186 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func writeBundle(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Track{Title: "Demo", Graph: json.RawMessage(`{"nodes":[],"connections":[]}`)})
+	if err := w.AddFile(File{ID: "s1", Kind: KindSample, Filename: "kick.wav"}, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rawBundle builds an archive from a manifest and file entries as given,
+// without the checks Writer applies.
+func rawBundle(t *testing.T, manifest Manifest, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, data)
+	}
+	w, err := zw.Create(ManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(w).Encode(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func open(t *testing.T, data []byte) (*Reader, error) {
+	t.Helper()
+	return Open(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestRoundTrip(t *testing.T) {
+	r, err := open(t, writeBundle(t, "RIFF audio"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Manifest.Files) != 1 || r.Manifest.Files[0].Size != 10 {
+		t.Fatalf("files = %+v", r.Manifest.Files)
+	}
+
+	rc, err := r.Open(r.Manifest.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil || string(data) != "RIFF audio" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	file := File{ID: "s1", Kind: KindSample, Filename: "kick.wav", Size: 4, SHA256: "00", Path: "files/samples/s1.wav"}
+	data := rawBundle(t, Manifest{
+		Format:  Format,
+		Version: Version,
+		Track:   Track{Graph: json.RawMessage(`{}`)},
+		Files:   []File{file},
+	}, map[string]string{file.Path: "RIFF"})
+
+	r, err := open(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("read to EOF", func(t *testing.T) {
+		rc, _ := r.Open(file)
+		defer rc.Close()
+		if _, err := io.ReadAll(rc); !errors.Is(err, ErrChecksum) {
+			t.Errorf("got %v, want ErrChecksum", err)
+		}
+	})
+	// Readers that stop after Size bytes never ask for EOF.
+	t.Run("read exactly Size bytes", func(t *testing.T) {
+		rc, _ := r.Open(file)
+		defer rc.Close()
+		if n, err := rc.Read(make([]byte, file.Size)); n != int(file.Size) || !errors.Is(err, ErrChecksum) {
+			t.Errorf("got %d, %v, want %d, ErrChecksum", n, err, file.Size)
+		}
+	})
+	t.Run("verify", func(t *testing.T) {
+		if err := r.Verify(file); !errors.Is(err, ErrChecksum) {
+			t.Errorf("got %v, want ErrChecksum", err)
+		}
+	})
+}
+
+func TestOpenRejectsBadManifests(t *testing.T) {
+	graph := Track{Graph: json.RawMessage(`{}`)}
+	tests := []struct {
+		name     string
+		manifest Manifest
+		files    map[string]string
+	}{
+		{"wrong version", Manifest{Format: Format, Version: Version + 1, Track: graph}, nil},
+		{"no graph", Manifest{Format: Format, Version: Version}, nil},
+		{
+			"negative size",
+			Manifest{Format: Format, Version: Version, Track: graph, Files: []File{
+				{ID: "s1", Kind: KindSample, Size: -1, Path: "a.wav"},
+			}},
+			map[string]string{"a.wav": "RIFF"},
+		},
+		{
+			"size mismatch",
+			Manifest{Format: Format, Version: Version, Track: graph, Files: []File{
+				{ID: "s1", Kind: KindSample, Size: 3, Path: "a.wav"},
+			}},
+			map[string]string{"a.wav": "RIFF"},
+		},
+		{
+			"missing file",
+			Manifest{Format: Format, Version: Version, Track: graph, Files: []File{
+				{ID: "s1", Kind: KindSample, Size: 4, Path: "a.wav"},
+			}},
+			nil,
+		},
+		{
+			"unknown kind",
+			Manifest{Format: Format, Version: Version, Track: graph, Files: []File{
+				{ID: "s1", Kind: "video", Size: 4, Path: "a.wav"},
+			}},
+			map[string]string{"a.wav": "RIFF"},
+		},
+		{
+			"duplicate id",
+			Manifest{Format: Format, Version: Version, Track: graph, Files: []File{
+				{ID: "s1", Kind: KindSample, Size: 4, Path: "a.wav"},
+				{ID: "s1", Kind: KindSample, Size: 4, Path: "b.wav"},
+			}},
+			map[string]string{"a.wav": "RIFF", "b.wav": "RIFF"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := open(t, rawBundle(t, tt.manifest, tt.files)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestOpenRejectsOversizedManifest(t *testing.T) {
+	manifest := Manifest{
+		Format:  Format,
+		Version: Version,
+		Track:   Track{Title: strings.Repeat("x", MaxManifestSize), Graph: json.RawMessage(`{}`)},
+	}
+	if _, err := open(t, rawBundle(t, manifest, nil)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestOpenRequiresManifest(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Close()
+	if _, err := open(t, buf.Bytes()); !errors.Is(err, ErrNoManifest) {
+		t.Fatalf("got %v, want ErrNoManifest", err)
+	}
+}
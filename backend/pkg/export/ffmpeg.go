@@ -0,0 +1,107 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrEncoding wraps a failed encode. The wrapping error carries ffmpeg's
+// output, which is meant for logs rather than users.
+var ErrEncoding = errors.New("encoding failed")
+
+type ProgressFunc func(fraction float64)
+
+type EncodeOptions struct {
+	Input    string
+	Output   string
+	Profile  Profile
+	Settings Settings
+	Metadata *Metadata
+	Cover    string
+	Loudness Loudness
+	Measured *LoudnessMeasurement
+	Duration time.Duration
+	Progress ProgressFunc
+}
+
+// Encode runs ffmpeg with the profile's codec arguments and reports progress
+// against the expected duration using ffmpeg's -progress output.
+func Encode(ctx context.Context, opts EncodeOptions) error {
+	args := []string{"-y", "-nostats", "-progress", "pipe:1", "-i", opts.Input}
+
+	if opts.Cover != "" && opts.Profile.Artwork {
+		args = append(args,
+			"-i", opts.Cover,
+			"-map", "0:a",
+			"-map", "1:v",
+			"-c:v", "copy",
+			"-disposition:v", "attached_pic",
+		)
+	} else {
+		args = append(args, "-vn")
+	}
+
+	if opts.Measured != nil && !opts.Loudness.MeasureOnly {
+		args = append(args, "-af", opts.Loudness.filter(opts.Measured))
+	}
+
+	args = append(args, opts.Profile.Args(opts.Settings)...)
+	if opts.Metadata != nil {
+		args = append(args, opts.Metadata.args(opts.Profile)...)
+	}
+	args = append(args, opts.Output)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to attach ffmpeg output: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || opts.Progress == nil || opts.Duration <= 0 {
+			continue
+		}
+		switch key {
+		case "out_time_us":
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			opts.Progress(min(1, float64(us)/float64(opts.Duration.Microseconds())))
+		case "progress":
+			if value == "end" {
+				opts.Progress(1)
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %v: %s", ErrEncoding, err, lastLines(stderr.String(), 5))
+	}
+	return nil
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
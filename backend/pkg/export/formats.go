@@ -0,0 +1,246 @@
+package export
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+const (
+	ModeCBR = "cbr"
+	ModeVBR = "vbr"
+)
+
+type Settings struct {
+	Format     string `json:"format"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	BitDepth   int    `json:"bit_depth,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Bitrate    int    `json:"bitrate,omitempty"`
+	Quality    *int   `json:"quality,omitempty"`
+}
+
+type Profile struct {
+	Format      string   `json:"format"`
+	Codec       string   `json:"codec"`
+	Extension   string   `json:"extension"`
+	ContentType string   `json:"content_type"`
+	Lossless    bool     `json:"lossless"`
+	SampleRates []int    `json:"sample_rates"`
+	BitDepths   []int    `json:"bit_depths,omitempty"`
+	Modes       []string `json:"modes,omitempty"`
+	MinBitrate  int      `json:"min_bitrate,omitempty"`
+	MaxBitrate  int      `json:"max_bitrate,omitempty"`
+	MinQuality  int      `json:"min_quality,omitempty"`
+	MaxQuality  int      `json:"max_quality,omitempty"`
+	// DefaultQuality applies when VBR is requested without a quality. It is
+	// kept out of Defaults, whose mode may be one that takes no quality.
+	DefaultQuality int      `json:"default_quality,omitempty"`
+	Artwork        bool     `json:"artwork"`
+	Defaults       Settings `json:"defaults"`
+
+	bpmTag    string
+	codecArgs func(s Settings) []string
+}
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+var losslessRates = []int{44100, 48000, 88200, 96000}
+
+var profiles = []Profile{
+	{
+		Format:      "wav",
+		Codec:       "pcm",
+		Extension:   ".wav",
+		ContentType: "audio/wav",
+		Lossless:    true,
+		SampleRates: losslessRates,
+		BitDepths:   []int{16, 24, 32},
+		Defaults:    Settings{Format: "wav", SampleRate: 48000, BitDepth: 24},
+		codecArgs: func(s Settings) []string {
+			codec := map[int]string{16: "pcm_s16le", 24: "pcm_s24le", 32: "pcm_f32le"}[s.BitDepth]
+			return []string{"-c:a", codec}
+		},
+	},
+	{
+		Format:      "flac",
+		Codec:       "flac",
+		Extension:   ".flac",
+		ContentType: "audio/flac",
+		Lossless:    true,
+		SampleRates: losslessRates,
+		BitDepths:   []int{16, 24},
+		Artwork:     true,
+		Defaults:    Settings{Format: "flac", SampleRate: 48000, BitDepth: 24},
+		bpmTag:      "BPM",
+		codecArgs: func(s Settings) []string {
+			if s.BitDepth == 16 {
+				return []string{"-c:a", "flac", "-sample_fmt", "s16"}
+			}
+			return []string{"-c:a", "flac", "-sample_fmt", "s32", "-bits_per_raw_sample", "24"}
+		},
+	},
+	{
+		Format:      "opus",
+		Codec:       "libopus",
+		Extension:   ".opus",
+		ContentType: "audio/ogg",
+		SampleRates: []int{48000},
+		Modes:       []string{ModeVBR, ModeCBR},
+		MinBitrate:  32,
+		MaxBitrate:  256,
+		Defaults:    Settings{Format: "opus", SampleRate: 48000, Mode: ModeVBR, Bitrate: 128},
+		bpmTag:      "BPM",
+		codecArgs: func(s Settings) []string {
+			vbr := "on"
+			if s.Mode == ModeCBR {
+				vbr = "off"
+			}
+			return []string{"-c:a", "libopus", "-b:a", fmt.Sprintf("%dk", s.Bitrate), "-vbr", vbr}
+		},
+	},
+	{
+		Format:      "aac",
+		Codec:       "aac",
+		Extension:   ".m4a",
+		ContentType: "audio/mp4",
+		SampleRates: []int{44100, 48000},
+		Modes:       []string{ModeCBR},
+		MinBitrate:  64,
+		MaxBitrate:  320,
+		Artwork:     true,
+		Defaults:    Settings{Format: "aac", SampleRate: 48000, Mode: ModeCBR, Bitrate: 256},
+		codecArgs: func(s Settings) []string {
+			return []string{"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", s.Bitrate), "-movflags", "+faststart"}
+		},
+	},
+	{
+		Format:         "mp3",
+		Codec:          "libmp3lame",
+		Extension:      ".mp3",
+		ContentType:    "audio/mpeg",
+		SampleRates:    []int{32000, 44100, 48000},
+		Modes:          []string{ModeCBR, ModeVBR},
+		MinBitrate:     32,
+		MaxBitrate:     320,
+		MinQuality:     0,
+		MaxQuality:     9,
+		DefaultQuality: 2,
+		Artwork:        true,
+		Defaults:       Settings{Format: "mp3", SampleRate: 44100, Mode: ModeCBR, Bitrate: 192},
+		bpmTag:         "TBPM",
+		codecArgs: func(s Settings) []string {
+			if s.Mode == ModeVBR {
+				return []string{"-c:a", "libmp3lame", "-q:a", strconv.Itoa(*s.Quality)}
+			}
+			return []string{"-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", s.Bitrate)}
+		},
+	},
+}
+
+const DefaultFormat = "mp3"
+
+func Profiles() []Profile {
+	return profiles
+}
+
+func Lookup(format string) (Profile, bool) {
+	for _, p := range profiles {
+		if p.Format == format {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// usesQuality reports whether the profile's VBR mode is driven by a quality
+// scale rather than a target bitrate (libmp3lame -q:a vs libopus -vbr on).
+func (p Profile) usesQuality(mode string) bool {
+	return mode == ModeVBR && p.MaxQuality > 0
+}
+
+// Resolve validates the requested settings against the format registry and
+// fills unset fields with the profile defaults.
+func Resolve(s Settings) (Profile, Settings, error) {
+	if s.Format == "" {
+		s.Format = DefaultFormat
+	}
+
+	p, ok := Lookup(s.Format)
+	if !ok {
+		return Profile{}, s, &FieldError{Field: "format", Message: fmt.Sprintf("unsupported format %q", s.Format)}
+	}
+
+	if s.SampleRate == 0 {
+		s.SampleRate = p.Defaults.SampleRate
+	}
+	if !slices.Contains(p.SampleRates, s.SampleRate) {
+		return p, s, &FieldError{Field: "sample_rate", Message: fmt.Sprintf("%s supports sample rates %v", p.Format, p.SampleRates)}
+	}
+
+	if p.Lossless {
+		if s.BitDepth == 0 {
+			s.BitDepth = p.Defaults.BitDepth
+		}
+		if !slices.Contains(p.BitDepths, s.BitDepth) {
+			return p, s, &FieldError{Field: "bit_depth", Message: fmt.Sprintf("%s supports bit depths %v", p.Format, p.BitDepths)}
+		}
+		if s.Mode != "" || s.Bitrate != 0 || s.Quality != nil {
+			return p, s, &FieldError{Field: "mode", Message: "lossless formats take no bitrate or quality settings"}
+		}
+		return p, s, nil
+	}
+
+	if s.BitDepth != 0 {
+		return p, s, &FieldError{Field: "bit_depth", Message: "bit depth only applies to lossless formats"}
+	}
+
+	if s.Mode == "" {
+		s.Mode = p.Defaults.Mode
+	}
+	if !slices.Contains(p.Modes, s.Mode) {
+		return p, s, &FieldError{Field: "mode", Message: fmt.Sprintf("%s supports modes %v", p.Format, p.Modes)}
+	}
+
+	if p.usesQuality(s.Mode) {
+		if s.Bitrate != 0 {
+			return p, s, &FieldError{Field: "bitrate", Message: "bitrate is not used in vbr mode, set quality instead"}
+		}
+		if s.Quality == nil {
+			s.Quality = intPtr(p.DefaultQuality)
+		}
+		if *s.Quality < p.MinQuality || *s.Quality > p.MaxQuality {
+			return p, s, &FieldError{Field: "quality", Message: fmt.Sprintf("quality must be between %d and %d", p.MinQuality, p.MaxQuality)}
+		}
+		return p, s, nil
+	}
+
+	if s.Quality != nil {
+		return p, s, &FieldError{Field: "quality", Message: fmt.Sprintf("quality is not used by %s %s", p.Format, s.Mode)}
+	}
+	if s.Bitrate == 0 {
+		s.Bitrate = p.Defaults.Bitrate
+	}
+	if s.Bitrate < p.MinBitrate || s.Bitrate > p.MaxBitrate {
+		return p, s, &FieldError{Field: "bitrate", Message: fmt.Sprintf("bitrate must be between %d and %d kbps", p.MinBitrate, p.MaxBitrate)}
+	}
+	return p, s, nil
+}
+
+// Args returns the ffmpeg output arguments for settings already passed
+// through Resolve.
+func (p Profile) Args(s Settings) []string {
+	args := []string{"-ar", strconv.Itoa(s.SampleRate)}
+	return append(args, p.codecArgs(s)...)
+}
@@ -0,0 +1,93 @@
+package export
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProfileDefaultsResolve(t *testing.T) {
+	for _, p := range Profiles() {
+		if _, _, err := Resolve(p.Defaults); err != nil {
+			t.Errorf("%s defaults: %v", p.Format, err)
+		}
+	}
+}
+
+func TestResolveVBRDefaultQuality(t *testing.T) {
+	_, s, err := Resolve(Settings{Format: "mp3", Mode: ModeVBR})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Quality == nil || *s.Quality != 2 {
+		t.Fatalf("quality = %v, want 2", s.Quality)
+	}
+}
+
+func TestResolveRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		field    string
+	}{
+		{"unknown format", Settings{Format: "wma"}, "format"},
+		{"sample rate not offered", Settings{Format: "wav", SampleRate: 22050}, "sample_rate"},
+		{"opus only runs at 48k", Settings{Format: "opus", SampleRate: 44100}, "sample_rate"},
+		{"bit depth not offered", Settings{Format: "flac", BitDepth: 32}, "bit_depth"},
+		{"bitrate on lossless", Settings{Format: "wav", Bitrate: 320}, "mode"},
+		{"mode on lossless", Settings{Format: "flac", Mode: ModeCBR}, "mode"},
+		{"quality on lossless", Settings{Format: "wav", Quality: intPtr(2)}, "mode"},
+		{"bit depth on lossy", Settings{Format: "mp3", BitDepth: 16}, "bit_depth"},
+		{"unknown mode", Settings{Format: "mp3", Mode: "abr"}, "mode"},
+		{"vbr not offered", Settings{Format: "aac", Mode: ModeVBR}, "mode"},
+		{"bitrate below range", Settings{Format: "mp3", Bitrate: 16}, "bitrate"},
+		{"bitrate above range", Settings{Format: "aac", Bitrate: 512}, "bitrate"},
+		{"bitrate with quality vbr", Settings{Format: "mp3", Mode: ModeVBR, Bitrate: 192}, "bitrate"},
+		{"quality below range", Settings{Format: "mp3", Mode: ModeVBR, Quality: intPtr(-1)}, "quality"},
+		{"quality above range", Settings{Format: "mp3", Mode: ModeVBR, Quality: intPtr(10)}, "quality"},
+		{"quality with cbr", Settings{Format: "mp3", Mode: ModeCBR, Quality: intPtr(2)}, "quality"},
+		{"quality with bitrate vbr", Settings{Format: "opus", Mode: ModeVBR, Quality: intPtr(5)}, "quality"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Resolve(tt.settings)
+			fieldErr, ok := err.(*FieldError)
+			if !ok {
+				t.Fatalf("Resolve error = %v, want a FieldError", err)
+			}
+			if fieldErr.Field != tt.field {
+				t.Errorf("field = %q, want %q (%v)", fieldErr.Field, tt.field, err)
+			}
+		})
+	}
+}
+
+func TestProfileArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		want     []string
+	}{
+		{"default format", Settings{}, []string{"-ar", "44100", "-c:a", "libmp3lame", "-b:a", "192k"}},
+		{"wav 16", Settings{Format: "wav", BitDepth: 16}, []string{"-ar", "48000", "-c:a", "pcm_s16le"}},
+		{"wav 24", Settings{Format: "wav", SampleRate: 96000}, []string{"-ar", "96000", "-c:a", "pcm_s24le"}},
+		{"wav 32", Settings{Format: "wav", BitDepth: 32}, []string{"-ar", "48000", "-c:a", "pcm_f32le"}},
+		{"flac 16", Settings{Format: "flac", BitDepth: 16}, []string{"-ar", "48000", "-c:a", "flac", "-sample_fmt", "s16"}},
+		{"flac 24", Settings{Format: "flac"}, []string{"-ar", "48000", "-c:a", "flac", "-sample_fmt", "s32", "-bits_per_raw_sample", "24"}},
+		{"opus vbr", Settings{Format: "opus"}, []string{"-ar", "48000", "-c:a", "libopus", "-b:a", "128k", "-vbr", "on"}},
+		{"opus cbr", Settings{Format: "opus", Mode: ModeCBR, Bitrate: 64}, []string{"-ar", "48000", "-c:a", "libopus", "-b:a", "64k", "-vbr", "off"}},
+		{"aac", Settings{Format: "aac", SampleRate: 44100}, []string{"-ar", "44100", "-c:a", "aac", "-b:a", "256k", "-movflags", "+faststart"}},
+		{"mp3 vbr", Settings{Format: "mp3", Mode: ModeVBR, Quality: intPtr(0)}, []string{"-ar", "44100", "-c:a", "libmp3lame", "-q:a", "0"}},
+		{"mp3 cbr", Settings{Format: "mp3", Bitrate: 320, SampleRate: 48000}, []string{"-ar", "48000", "-c:a", "libmp3lame", "-b:a", "320k"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, s, err := Resolve(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Args(s); !slices.Equal(got, tt.want) {
+				t.Errorf("Args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
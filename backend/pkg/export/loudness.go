@@ -0,0 +1,169 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLoudnessTarget = -14.0
+	DefaultTruePeak       = -1.0
+
+	MinLoudnessTarget = -70.0
+	MaxLoudnessTarget = -5.0
+	MinTruePeak       = -9.0
+	MaxTruePeak       = 0.0
+
+	// loudnormLRA is the loudness range loudnorm may keep. It is set to the
+	// filter's maximum so that linear mode is never downgraded to dynamic
+	// compression because the source has a wide range.
+	loudnormLRA = 50.0
+)
+
+var (
+	ErrSilentInput = errors.New("cannot measure loudness of silent audio")
+
+	// ErrMeasurement wraps a failed loudness pass. The wrapping error carries
+	// ffmpeg's output, which is meant for logs rather than users.
+	ErrMeasurement = errors.New("loudness measurement failed")
+)
+
+type Loudness struct {
+	Target      *float64 `json:"loudness_target,omitempty"`
+	TruePeak    *float64 `json:"true_peak,omitempty"`
+	MeasureOnly bool     `json:"measure_only,omitempty"`
+}
+
+// Enabled reports whether the export should run through the loudness pass.
+func (l Loudness) Enabled() bool {
+	return l.Target != nil || l.TruePeak != nil || l.MeasureOnly
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// ResolveLoudness validates the loudness options and fills unset targets
+// with the streaming defaults (-14 LUFS, -1 dBTP).
+func ResolveLoudness(l Loudness) (Loudness, error) {
+	if !l.Enabled() {
+		return l, nil
+	}
+
+	if l.Target == nil {
+		l.Target = floatPtr(DefaultLoudnessTarget)
+	}
+	if *l.Target < MinLoudnessTarget || *l.Target > MaxLoudnessTarget {
+		return l, &FieldError{Field: "loudness_target", Message: fmt.Sprintf("loudness target must be between %g and %g LUFS", MinLoudnessTarget, MaxLoudnessTarget)}
+	}
+
+	if l.TruePeak == nil {
+		l.TruePeak = floatPtr(DefaultTruePeak)
+	}
+	if *l.TruePeak < MinTruePeak || *l.TruePeak > MaxTruePeak {
+		return l, &FieldError{Field: "true_peak", Message: fmt.Sprintf("true peak must be between %g and %g dBTP", MinTruePeak, MaxTruePeak)}
+	}
+
+	return l, nil
+}
+
+// LoudnessMeasurement is an EBU R128 measurement as reported by loudnorm.
+type LoudnessMeasurement struct {
+	Integrated   float64 `json:"integrated"`
+	LRA          float64 `json:"lra"`
+	TruePeak     float64 `json:"true_peak"`
+	Threshold    float64 `json:"threshold"`
+	TargetOffset float64 `json:"target_offset"`
+}
+
+type LoudnessReport struct {
+	Target   float64              `json:"target"`
+	TruePeak float64              `json:"true_peak_ceiling"`
+	Input    LoudnessMeasurement  `json:"input"`
+	Output   *LoudnessMeasurement `json:"output,omitempty"`
+}
+
+// Measure runs the first loudnorm pass over the input and returns its
+// measurement against the given targets.
+func Measure(ctx context.Context, path string, l Loudness) (*LoudnessMeasurement, error) {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:print_format=json", *l.Target, *l.TruePeak, loudnormLRA)
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-nostats", "-hide_banner",
+		"-i", path,
+		"-vn",
+		"-af", filter,
+		"-f", "null", "-",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %v: %s", ErrMeasurement, err, lastLines(stderr.String(), 5))
+	}
+
+	return parseLoudnorm(stderr.String())
+}
+
+// parseLoudnorm extracts the JSON block loudnorm prints at the end of its
+// log output. Values are quoted strings and may be "-inf" for silence.
+func parseLoudnorm(output string) (*LoudnessMeasurement, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("loudness measurement missing from ffmpeg output")
+	}
+
+	var raw struct {
+		InputI       string `json:"input_i"`
+		InputLRA     string `json:"input_lra"`
+		InputTP      string `json:"input_tp"`
+		InputThresh  string `json:"input_thresh"`
+		TargetOffset string `json:"target_offset"`
+	}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse loudness measurement: %w", err)
+	}
+
+	var m LoudnessMeasurement
+	fields := []struct {
+		raw string
+		dst *float64
+	}{
+		{raw.InputI, &m.Integrated},
+		{raw.InputLRA, &m.LRA},
+		{raw.InputTP, &m.TruePeak},
+		{raw.InputThresh, &m.Threshold},
+		{raw.TargetOffset, &m.TargetOffset},
+	}
+	for _, f := range fields {
+		value, err := strconv.ParseFloat(strings.TrimSpace(f.raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse loudness value %q: %w", f.raw, err)
+		}
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return nil, ErrSilentInput
+		}
+		*f.dst = value
+	}
+
+	return &m, nil
+}
+
+// filter builds the second loudnorm pass from a first-pass measurement. With
+// the measured values loudnorm applies a single linear gain, and only switches
+// to dynamic mode with its true-peak limiter when that gain would push peaks
+// past the ceiling.
+func (l Loudness) filter(m *LoudnessMeasurement) string {
+	return fmt.Sprintf(
+		"loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%g:measured_LRA=%g:measured_TP=%g:measured_thresh=%g:offset=%g:linear=true",
+		*l.Target, *l.TruePeak, loudnormLRA,
+		m.Integrated, m.LRA, m.TruePeak, m.Threshold, m.TargetOffset,
+	)
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"errors"
+	"testing"
+)
+
+// loudnormOutput is the stderr of a first loudnorm pass, as printed by
+// ffmpeg with -nostats -hide_banner.
+const loudnormOutput = `Input #0, wav, from '/tmp/export-1234/render.wav':
+  Duration: 00:03:12.00, bitrate: 2304 kb/s
+  Stream #0:0: Audio: pcm_s24le ([1][0][0][0] / 0x0001), 48000 Hz, 2 channels, s32 (24 bit), 2304 kb/s
+Stream mapping:
+  Stream #0:0 -> #0:0 (pcm_s24le (native) -> pcm_s16le (native))
+Output #0, null, to 'pipe:':
+  Metadata:
+    encoder         : Lavf60.16.100
+  Stream #0:0: Audio: pcm_s16le, 192000 Hz, 2 channels, s16, 6144 kb/s
+[Parsed_loudnorm_0 @ 0x5581c0d2a2c0] 
+{
+	"input_i" : "-23.54",
+	"input_tp" : "-6.63",
+	"input_lra" : "5.60",
+	"input_thresh" : "-33.93",
+	"output_i" : "-14.30",
+	"output_tp" : "-1.00",
+	"output_lra" : "4.20",
+	"output_thresh" : "-24.60",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.30"
+}
+[out#0/null @ 0x5581c0d1f4c0] video:0kB audio:72000kB subtitle:0kB other streams:0kB global headers:0kB muxing overhead: unknown
+`
+
+func TestParseLoudnorm(t *testing.T) {
+	m, err := parseLoudnorm(loudnormOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LoudnessMeasurement{Integrated: -23.54, LRA: 5.6, TruePeak: -6.63, Threshold: -33.93, TargetOffset: 0.3}
+	if *m != want {
+		t.Errorf("measurement = %+v, want %+v", *m, want)
+	}
+}
+
+func TestParseLoudnormSilence(t *testing.T) {
+	output := `[Parsed_loudnorm_0 @ 0x55d5c3e0] 
+{
+	"input_i" : "-inf",
+	"input_tp" : "-inf",
+	"input_lra" : "0.00",
+	"input_thresh" : "-inf",
+	"output_i" : "-inf",
+	"output_tp" : "-inf",
+	"output_lra" : "0.00",
+	"output_thresh" : "-inf",
+	"normalization_type" : "dynamic",
+	"target_offset" : "inf"
+}
+`
+	if _, err := parseLoudnorm(output); !errors.Is(err, ErrSilentInput) {
+		t.Fatalf("error = %v, want %v", err, ErrSilentInput)
+	}
+}
+
+func TestParseLoudnormRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"no json block", "Input #0, wav, from 'in.wav':\n  Duration: 00:00:01.00\nConversion failed!\n"},
+		{"empty", ""},
+		{"unterminated block", "[Parsed_loudnorm_0 @ 0x1] \n{\n\t\"input_i\" : \"-23.54\",\n"},
+		{"missing field", "[Parsed_loudnorm_0 @ 0x1] \n{\n\t\"input_i\" : \"-23.54\",\n\t\"input_tp\" : \"-6.63\"\n}\n"},
+		{"not a number", "{\"input_i\": \"loud\", \"input_tp\": \"-1\", \"input_lra\": \"1\", \"input_thresh\": \"-30\", \"target_offset\": \"0\"}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := parseLoudnorm(tt.output); err == nil {
+				t.Fatalf("parsed %+v, want an error", m)
+			} else if errors.Is(err, ErrSilentInput) {
+				t.Fatalf("error = %v, want a parse failure", err)
+			}
+		})
+	}
+}
+
+func TestResolveLoudness(t *testing.T) {
+	l, err := ResolveLoudness(Loudness{MeasureOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *l.Target != DefaultLoudnessTarget || *l.TruePeak != DefaultTruePeak {
+		t.Errorf("targets = %g, %g; want defaults", *l.Target, *l.TruePeak)
+	}
+
+	if l, err := ResolveLoudness(Loudness{}); err != nil || l.Target != nil {
+		t.Errorf("disabled loudness = %+v, %v; want it left alone", l, err)
+	}
+
+	for _, bad := range []Loudness{
+		{Target: floatPtr(-80)},
+		{Target: floatPtr(0)},
+		{TruePeak: floatPtr(MaxTruePeak + 1)},
+		{TruePeak: floatPtr(MinTruePeak - 1)},
+	} {
+		if _, err := ResolveLoudness(bad); err == nil {
+			t.Errorf("ResolveLoudness(%+v) succeeded", bad)
+		}
+	}
+}
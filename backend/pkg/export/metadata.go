@@ -0,0 +1,34 @@
+package export
+
+import "strconv"
+
+type Metadata struct {
+	Title   string
+	Artist  string
+	Comment string
+	BPM     int
+}
+
+// args maps the metadata onto ffmpeg's generic keys, which the muxers write as
+// ID3v2 frames, Vorbis comments, MP4 atoms or RIFF INFO chunks. BPM has no
+// generic key, so it is only written where the container defines a tag for it.
+func (m Metadata) args(p Profile) []string {
+	var args []string
+	add := func(key, value string) {
+		if value != "" {
+			args = append(args, "-metadata", key+"="+value)
+		}
+	}
+
+	add("title", m.Title)
+	add("artist", m.Artist)
+	add("comment", m.Comment)
+	if p.bpmTag != "" && m.BPM > 0 {
+		add(p.bpmTag, strconv.Itoa(m.BPM))
+	}
+	if p.Format == "mp3" {
+		args = append(args, "-id3v2_version", "3")
+	}
+
+	return args
+}
@@ -0,0 +1,226 @@
+package graph
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// Reasons a node is reported as unreachable.
+const (
+	ReasonDisconnected = "disconnected"
+	ReasonNoPathMaster = "no_path_to_master"
+)
+
+type UnreachableNode struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Cycle is a group of nodes that feed back into each other. ThroughDelay is
+// true when every loop in the group passes through a delay block; Web Audio
+// mutes loops that do not.
+type Cycle struct {
+	Nodes        []string `json:"nodes"`
+	ThroughDelay bool     `json:"through_delay"`
+}
+
+type NodeCost struct {
+	ID   string  `json:"id"`
+	Type string  `json:"type"`
+	Cost float64 `json:"cost"`
+}
+
+// CostReport estimates processing load in units of one oscillator. Wasted
+// is the part spent on nodes whose output never reaches a master.
+type CostReport struct {
+	Total  float64    `json:"total"`
+	Wasted float64    `json:"wasted"`
+	Nodes  []NodeCost `json:"nodes"`
+}
+
+type Analysis struct {
+	HasMaster   bool              `json:"has_master"`
+	Unreachable []UnreachableNode `json:"unreachable"`
+	Cycles      []Cycle           `json:"cycles"`
+	Cost        CostReport        `json:"cost"`
+}
+
+// blockCosts are rough per-block costs relative to an oscillator, based on
+// the Web Audio nodes each block builds. Blocks whose cost depends on their
+// params are handled in nodeCost.
+var blockCosts = map[string]float64{
+	"oscillator": 1,
+	"sampler":    1.5,
+	"filter":     2,
+	"delay":      2.5,
+	"lfo":        0.5,
+	"sequencer":  0.25,
+	"master":     1.5,
+}
+
+const (
+	// reverbCostPerSecond is the convolution cost per second of impulse
+	// response; generated impulses last `decay` seconds.
+	reverbCostPerSecond = 4
+	mixerChannelCost    = 0.5
+	unknownBlockCost    = 1
+)
+
+func nodeCost(n *Node) float64 {
+	switch n.Type {
+	case "reverb":
+		return reverbCostPerSecond * math.Max(n.Float("decay", 3), 0.1)
+	case "mixer":
+		return mixerChannelCost * float64(mixerChannels(n))
+	}
+	if cost, ok := blockCosts[n.Type]; ok {
+		return cost
+	}
+	return unknownBlockCost
+}
+
+// Analyze reports on the signal flow of g: nodes whose output never reaches
+// a master block, feedback loops and an estimate of the processing cost.
+// Audio, modulation and trigger connections all count as signal flow.
+// Connections to nodes that do not exist are ignored.
+func Analyze(g *Graph) *Analysis {
+	a := &Analysis{
+		Unreachable: []UnreachableNode{},
+		Cycles:      []Cycle{},
+		Cost:        CostReport{Nodes: make([]NodeCost, 0, len(g.Nodes))},
+	}
+
+	nodes := make(map[string]*Node, len(g.Nodes))
+	for i := range g.Nodes {
+		nodes[g.Nodes[i].ID] = &g.Nodes[i]
+	}
+	edges := make(map[string][]string, len(g.Nodes))
+	reverse := make(map[string][]string, len(g.Nodes))
+	connected := make(map[string]bool, len(g.Nodes))
+	for _, conn := range g.Connections {
+		if nodes[conn.From] == nil || nodes[conn.To] == nil {
+			continue
+		}
+		edges[conn.From] = append(edges[conn.From], conn.To)
+		reverse[conn.To] = append(reverse[conn.To], conn.From)
+		connected[conn.From] = true
+		connected[conn.To] = true
+	}
+
+	// Walk backwards from every master to find the nodes that feed one.
+	reaches := make(map[string]bool, len(g.Nodes))
+	var queue []string
+	for _, n := range g.Nodes {
+		if n.Type == "master" {
+			a.HasMaster = true
+			reaches[n.ID] = true
+			queue = append(queue, n.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, from := range reverse[id] {
+			if !reaches[from] {
+				reaches[from] = true
+				queue = append(queue, from)
+			}
+		}
+	}
+
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		cost := nodeCost(n)
+		a.Cost.Total += cost
+		a.Cost.Nodes = append(a.Cost.Nodes, NodeCost{ID: n.ID, Type: n.Type, Cost: cost})
+
+		if reaches[n.ID] {
+			continue
+		}
+		a.Cost.Wasted += cost
+		reason := ReasonNoPathMaster
+		if !connected[n.ID] {
+			reason = ReasonDisconnected
+		}
+		a.Unreachable = append(a.Unreachable, UnreachableNode{ID: n.ID, Type: n.Type, Reason: reason})
+	}
+
+	for _, component := range components(g, edges, nil) {
+		inLoop := func(id string) bool { return slices.Contains(component, id) }
+		undelayed := components(g, edges, func(id string) bool {
+			return inLoop(id) && nodes[id].Type != "delay"
+		})
+		a.Cycles = append(a.Cycles, Cycle{
+			Nodes:        component,
+			ThroughDelay: len(undelayed) == 0,
+		})
+	}
+
+	return a
+}
+
+// components returns the strongly connected components of the graph that
+// contain a loop, restricted to the nodes keep accepts (all when nil). Node
+// ids within a component are sorted.
+func components(g *Graph, edges map[string][]string, keep func(id string) bool) [][]string {
+	index := make(map[string]int, len(g.Nodes))
+	low := make(map[string]int, len(g.Nodes))
+	onStack := make(map[string]bool, len(g.Nodes))
+	var stack []string
+	var result [][]string
+	next := 0
+
+	include := func(id string) bool { return keep == nil || keep(id) }
+
+	var visit func(id string)
+	visit = func(id string) {
+		index[id] = next
+		low[id] = next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		selfLoop := false
+		for _, to := range edges[id] {
+			if !include(to) {
+				continue
+			}
+			if to == id {
+				selfLoop = true
+			}
+			if _, seen := index[to]; !seen {
+				visit(to)
+				low[id] = min(low[id], low[to])
+			} else if onStack[to] {
+				low[id] = min(low[id], index[to])
+			}
+		}
+
+		if low[id] != index[id] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == id {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			sort.Strings(component)
+			result = append(result, component)
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if _, seen := index[n.ID]; !seen && include(n.ID) {
+			visit(n.ID)
+		}
+	}
+	return result
+}
@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// patch builds a graph from "id:type" nodes and "from>to" connections.
+func patch(nodes []string, conns ...string) *Graph {
+	g := &Graph{}
+	for _, spec := range nodes {
+		id, kind, _ := strings.Cut(spec, ":")
+		g.Nodes = append(g.Nodes, Node{ID: id, Type: kind, Params: map[string]interface{}{}})
+	}
+	for _, spec := range conns {
+		from, to, _ := strings.Cut(spec, ">")
+		g.Connections = append(g.Connections, Connection{ID: spec, From: from, To: to})
+	}
+	return g
+}
+
+func TestAnalyzeUnreachable(t *testing.T) {
+	tests := []struct {
+		name      string
+		graph     *Graph
+		hasMaster bool
+		want      []UnreachableNode
+	}{
+		{
+			"everything reaches the master",
+			patch([]string{"o:oscillator", "f:filter", "m:master"}, "o>f", "f>m"),
+			true,
+			[]UnreachableNode{},
+		},
+		{
+			"no master",
+			patch([]string{"o:oscillator", "f:filter", "l:lfo"}, "o>f"),
+			false,
+			[]UnreachableNode{
+				{ID: "o", Type: "oscillator", Reason: ReasonNoPathMaster},
+				{ID: "f", Type: "filter", Reason: ReasonNoPathMaster},
+				{ID: "l", Type: "lfo", Reason: ReasonDisconnected},
+			},
+		},
+		{
+			"disconnected parts",
+			patch([]string{"o:oscillator", "m:master", "o2:oscillator", "f2:filter", "x:delay"}, "o>m", "o2>f2"),
+			true,
+			[]UnreachableNode{
+				{ID: "o2", Type: "oscillator", Reason: ReasonNoPathMaster},
+				{ID: "f2", Type: "filter", Reason: ReasonNoPathMaster},
+				{ID: "x", Type: "delay", Reason: ReasonDisconnected},
+			},
+		},
+		{
+			"modulation reaches through its target",
+			patch([]string{"l:lfo", "o:oscillator", "m:master"}, "l>o", "o>m"),
+			true,
+			[]UnreachableNode{},
+		},
+		{
+			"connections to missing nodes are ignored",
+			patch([]string{"o:oscillator", "m:master"}, "o>gone", "gone>m"),
+			true,
+			[]UnreachableNode{{ID: "o", Type: "oscillator", Reason: ReasonDisconnected}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Analyze(tt.graph)
+			if a.HasMaster != tt.hasMaster {
+				t.Errorf("HasMaster = %v, want %v", a.HasMaster, tt.hasMaster)
+			}
+			if !reflect.DeepEqual(a.Unreachable, tt.want) {
+				t.Errorf("Unreachable = %+v\nwant %+v", a.Unreachable, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph *Graph
+		want  []Cycle
+	}{
+		{
+			"no loops",
+			patch([]string{"o:oscillator", "f:filter", "m:master"}, "o>f", "f>m"),
+			[]Cycle{},
+		},
+		{
+			"self-loop without a delay",
+			patch([]string{"f:filter", "m:master"}, "f>f", "f>m"),
+			[]Cycle{{Nodes: []string{"f"}, ThroughDelay: false}},
+		},
+		{
+			"self-loop on a delay",
+			patch([]string{"d:delay", "m:master"}, "d>d", "d>m"),
+			[]Cycle{{Nodes: []string{"d"}, ThroughDelay: true}},
+		},
+		{
+			"loop broken by a delay",
+			patch([]string{"f:filter", "d:delay", "m:master"}, "f>d", "d>f", "d>m"),
+			[]Cycle{{Nodes: []string{"d", "f"}, ThroughDelay: true}},
+		},
+		{
+			"loop without a delay",
+			patch([]string{"f:filter", "r:reverb", "m:master"}, "f>r", "r>f", "r>m"),
+			[]Cycle{{Nodes: []string{"f", "r"}, ThroughDelay: false}},
+		},
+		{
+			// f>d>f is delayed but f>g>f is not, so the group is not.
+			"one of two loops skips the delay",
+			patch([]string{"f:filter", "d:delay", "g:filter", "m:master"}, "f>d", "d>f", "f>g", "g>f", "f>m"),
+			[]Cycle{{Nodes: []string{"d", "f", "g"}, ThroughDelay: false}},
+		},
+		{
+			"a self-loop inside a delayed loop",
+			patch([]string{"f:filter", "d:delay", "m:master"}, "f>d", "d>f", "f>f", "d>m"),
+			[]Cycle{{Nodes: []string{"d", "f"}, ThroughDelay: false}},
+		},
+		{
+			"separate loops are reported separately",
+			patch([]string{"a:filter", "b:delay", "c:filter", "e:filter", "m:master"}, "a>b", "b>a", "c>e", "e>c", "b>m"),
+			[]Cycle{
+				{Nodes: []string{"a", "b"}, ThroughDelay: true},
+				{Nodes: []string{"c", "e"}, ThroughDelay: false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Analyze(tt.graph).Cycles
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Cycles = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentsKeep(t *testing.T) {
+	g := patch([]string{"a:filter", "b:delay", "c:filter"}, "a>b", "b>c", "c>a")
+	edges := map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}}
+
+	if got := components(g, edges, nil); !reflect.DeepEqual(got, [][]string{{"a", "b", "c"}}) {
+		t.Errorf("got %v", got)
+	}
+	// Leaving out any node of a simple loop breaks it.
+	if got := components(g, edges, func(id string) bool { return id != "b" }); len(got) != 0 {
+		t.Errorf("got %v, want no components", got)
+	}
+}
+
+func TestAnalyzeCost(t *testing.T) {
+	g := patch([]string{"o:oscillator", "r:reverb", "x:mixer", "m:master", "l:lfo"}, "o>r", "r>x", "x>m")
+	g.Nodes[1].Params["decay"] = 2.0
+	g.Nodes[2].Params["channels"] = 6.0
+
+	a := Analyze(g)
+	// oscillator 1, reverb 4*2, mixer 0.5*6, master 1.5, unreachable lfo 0.5
+	if a.Cost.Total != 14 {
+		t.Errorf("Total = %v, want 14", a.Cost.Total)
+	}
+	if a.Cost.Wasted != 0.5 {
+		t.Errorf("Wasted = %v, want 0.5", a.Cost.Wasted)
+	}
+	if len(a.Cost.Nodes) != len(g.Nodes) {
+		t.Errorf("%d node costs, want %d", len(a.Cost.Nodes), len(g.Nodes))
+	}
+}
@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"reflect"
+	"sort"
+)
+
+type ParamChange struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type NodeChange struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	OldType string        `json:"old_type,omitempty"`
+	Params  []ParamChange `json:"params,omitempty"`
+	Moved   bool          `json:"moved,omitempty"`
+}
+
+type ConnectionChange struct {
+	ID   string     `json:"id"`
+	From Connection `json:"from"`
+	To   Connection `json:"to"`
+}
+
+type Diff struct {
+	NodesAdded         []Node             `json:"nodes_added"`
+	NodesRemoved       []Node             `json:"nodes_removed"`
+	NodesChanged       []NodeChange       `json:"nodes_changed"`
+	ConnectionsAdded   []Connection       `json:"connections_added"`
+	ConnectionsRemoved []Connection       `json:"connections_removed"`
+	ConnectionsRewired []ConnectionChange `json:"connections_rewired"`
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.NodesAdded) == 0 && len(d.NodesRemoved) == 0 && len(d.NodesChanged) == 0 &&
+		len(d.ConnectionsAdded) == 0 && len(d.ConnectionsRemoved) == 0 && len(d.ConnectionsRewired) == 0
+}
+
+// Compare returns the structural changes needed to turn a into b. Nodes and
+// connections are matched by ID; a connection that keeps its ID but changes
+// endpoints or port is reported as rewired rather than removed and added.
+func Compare(a, b *Graph) *Diff {
+	d := &Diff{
+		NodesAdded:         []Node{},
+		NodesRemoved:       []Node{},
+		NodesChanged:       []NodeChange{},
+		ConnectionsAdded:   []Connection{},
+		ConnectionsRemoved: []Connection{},
+		ConnectionsRewired: []ConnectionChange{},
+	}
+
+	oldNodes := make(map[string]Node, len(a.Nodes))
+	for _, n := range a.Nodes {
+		oldNodes[n.ID] = n
+	}
+	newNodes := make(map[string]bool, len(b.Nodes))
+
+	for _, n := range b.Nodes {
+		newNodes[n.ID] = true
+		old, ok := oldNodes[n.ID]
+		if !ok {
+			d.NodesAdded = append(d.NodesAdded, n)
+			continue
+		}
+
+		change := NodeChange{
+			ID:     n.ID,
+			Type:   n.Type,
+			Params: compareParams(old.Params, n.Params),
+			Moved:  old.Position != n.Position,
+		}
+		if old.Type != n.Type {
+			change.OldType = old.Type
+		}
+		if len(change.Params) > 0 || change.Moved || change.OldType != "" {
+			d.NodesChanged = append(d.NodesChanged, change)
+		}
+	}
+	for _, n := range a.Nodes {
+		if !newNodes[n.ID] {
+			d.NodesRemoved = append(d.NodesRemoved, n)
+		}
+	}
+
+	oldConns := make(map[string]Connection, len(a.Connections))
+	for _, c := range a.Connections {
+		oldConns[c.ID] = c
+	}
+	newConns := make(map[string]bool, len(b.Connections))
+
+	for _, c := range b.Connections {
+		newConns[c.ID] = true
+		old, ok := oldConns[c.ID]
+		if !ok {
+			d.ConnectionsAdded = append(d.ConnectionsAdded, c)
+			continue
+		}
+		if !sameWiring(old, c) {
+			d.ConnectionsRewired = append(d.ConnectionsRewired, ConnectionChange{ID: c.ID, From: old, To: c})
+		}
+	}
+	for _, c := range a.Connections {
+		if !newConns[c.ID] {
+			d.ConnectionsRemoved = append(d.ConnectionsRemoved, c)
+		}
+	}
+
+	return d
+}
+
+func compareParams(a, b map[string]interface{}) []ParamChange {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []ParamChange
+	for _, k := range sorted {
+		from, to := a[k], b[k]
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, ParamChange{Key: k, From: from, To: to})
+		}
+	}
+	return changes
+}
+
+func sameWiring(a, b Connection) bool {
+	if a.From != b.From || a.To != b.To {
+		return false
+	}
+	if (a.ToPortIndex == nil) != (b.ToPortIndex == nil) {
+		return false
+	}
+	return a.ToPortIndex == nil || *a.ToPortIndex == *b.ToPortIndex
+}
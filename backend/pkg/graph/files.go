@@ -0,0 +1,51 @@
+package graph
+
+// fileParams pairs node params that hold the id of an uploaded file with the
+// param holding its URL.
+var fileParams = []struct{ id, url string }{
+	{"sampleId", "sampleUrl"},
+	{"impulseId", "impulseUrl"},
+}
+
+// RemapFiles points file references at other files, typically copies made
+// for a forked track. remap returns the new id and URL for an old id, or
+// false to leave the reference untouched.
+func (g *Graph) RemapFiles(remap func(id string) (newID, url string, ok bool)) {
+	for i := range g.Nodes {
+		RemapFileParams(g.Nodes[i].Params, remap)
+	}
+}
+
+// RemapFileParams applies remap to a single node's params, for places such as
+// scene snapshots that store params outside a Graph.
+func RemapFileParams(params map[string]interface{}, remap func(id string) (newID, url string, ok bool)) {
+	for _, p := range fileParams {
+		id, ok := params[p.id].(string)
+		if !ok || id == "" {
+			continue
+		}
+		if newID, url, ok := remap(id); ok {
+			params[p.id] = newID
+			params[p.url] = url
+		}
+	}
+}
+
+// FileIDs returns the ids of every uploaded file the graph refers to.
+func (g *Graph) FileIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for i := range g.Nodes {
+		CollectFileIDs(g.Nodes[i].Params, ids)
+	}
+	return ids
+}
+
+// CollectFileIDs adds the file ids referenced by a single node's params to
+// ids, for params stored outside a Graph such as scene snapshots.
+func CollectFileIDs(params map[string]interface{}, ids map[string]bool) {
+	for _, p := range fileParams {
+		if id, ok := params[p.id].(string); ok && id != "" {
+			ids[id] = true
+		}
+	}
+}
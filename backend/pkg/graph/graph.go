@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type Node struct {
+	ID       string                 `json:"id"`
+	Type     string                 `json:"type"`
+	Position Position               `json:"position"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+type Connection struct {
+	ID          string `json:"id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	ToPortIndex *int   `json:"to_port_index,omitempty"`
+}
+
+type Graph struct {
+	Version     int          `json:"version"`
+	Nodes       []Node       `json:"nodes"`
+	Connections []Connection `json:"connections"`
+}
+
+// Parse decodes graph data, upgrading it to CurrentVersion first.
+func Parse(data []byte) (*Graph, error) {
+	data, _, err := Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var g Graph
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse graph data: %w", err)
+	}
+	if g.Nodes == nil {
+		g.Nodes = []Node{}
+	}
+	if g.Connections == nil {
+		g.Connections = []Connection{}
+	}
+	for i := range g.Nodes {
+		if g.Nodes[i].Params == nil {
+			g.Nodes[i].Params = map[string]interface{}{}
+		}
+	}
+	return &g, nil
+}
+
+func (g *Graph) Node(id string) (*Node, bool) {
+	for i := range g.Nodes {
+		if g.Nodes[i].ID == id {
+			return &g.Nodes[i], true
+		}
+	}
+	return nil, false
+}
+
+func (g *Graph) Inputs(nodeID string) []Connection {
+	var result []Connection
+	for _, conn := range g.Connections {
+		if conn.To == nodeID {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
+
+func (g *Graph) Outputs(nodeID string) []Connection {
+	var result []Connection
+	for _, conn := range g.Connections {
+		if conn.From == nodeID {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
+
+func (n *Node) Float(key string, fallback float64) float64 {
+	switch v := n.Params[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+func (n *Node) String(key string, fallback string) string {
+	if v, ok := n.Params[key].(string); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (n *Node) Bool(key string, fallback bool) bool {
+	switch v := n.Params[key].(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	}
+	return fallback
+}
+
+// Clone returns a deep copy of the graph, including nested param values.
+// Params holding values JSON cannot encode make it fail.
+func (g *Graph) Clone() (*Graph, error) {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return nil, fmt.Errorf("graph: cannot clone: %w", err)
+	}
+	clone, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("graph: cannot clone: %w", err)
+	}
+	return clone, nil
+}
@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCloneIsDeep(t *testing.T) {
+	g := &Graph{Nodes: []Node{
+		{ID: "seq", Type: "sequencer", Params: map[string]interface{}{"steps": []interface{}{1.0, 0.0}}},
+	}}
+	clone, err := g.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(clone.Nodes, g.Nodes) {
+		t.Fatalf("got %+v, want %+v", clone.Nodes, g.Nodes)
+	}
+
+	clone.Nodes[0].Params["steps"].([]interface{})[0] = 0.0
+	if g.Nodes[0].Params["steps"].([]interface{})[0] != 1.0 {
+		t.Error("editing the clone changed the original")
+	}
+}
+
+func TestCloneRejectsUnencodableParams(t *testing.T) {
+	g := &Graph{Nodes: []Node{
+		{ID: "osc", Type: "oscillator", Params: map[string]interface{}{"frequency": math.NaN()}},
+	}}
+	if _, err := g.Clone(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,204 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Migration upgrades a graph document from version From to From+1. Apply
+// works on the decoded JSON so that steps do not depend on the current Go
+// types, and must leave a document that is already in the new shape alone:
+// clients that predate versioning send current graphs without a version.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]interface{}) error
+}
+
+// CurrentVersion is the graph format version written by this server. It
+// must equal len(Migrations).
+const CurrentVersion = 2
+
+// Migrations is the registry of format upgrades, in order. Adding a step
+// means appending it here and bumping CurrentVersion.
+var Migrations = []Migration{
+	{From: 0, Description: "store numeric params as numbers", Apply: migrateNumericParams},
+	{From: 1, Description: "fill in sequencer step fields", Apply: migrateSequencerSteps},
+}
+
+// Migrate upgrades a stored graph to CurrentVersion. Graphs without a
+// version are version 0. The result is data itself when nothing had to
+// change, and changed reports whether it was rewritten.
+func Migrate(data []byte) (result []byte, changed bool, err error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false, fmt.Errorf("failed to parse graph data: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+
+	version, err := docVersion(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	if version == CurrentVersion {
+		return data, false, nil
+	}
+	if version > CurrentVersion {
+		return nil, false, fmt.Errorf("graph version %d is newer than supported version %d", version, CurrentVersion)
+	}
+
+	for _, m := range Migrations[version:] {
+		if err := m.Apply(doc); err != nil {
+			return nil, false, fmt.Errorf("graph migration from version %d (%s): %w", m.From, m.Description, err)
+		}
+	}
+	doc["version"] = CurrentVersion
+
+	result, err = json.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+// MigrateSceneState upgrades the node params a scene snapshot stores under
+// "nodeParams", keyed by node id, to the current format. Scene state carries
+// no version of its own, so every step runs; steps leave params already in
+// their shape alone. Node types come from g, the graph of the scene's track,
+// and params of nodes g does not have are left as they are. Other fields of
+// the state are kept.
+func MigrateSceneState(data []byte, g *Graph) (result []byte, changed bool, err error) {
+	var state map[string]interface{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, false, fmt.Errorf("failed to parse scene state: %w", err)
+	}
+	nodeParams, _ := state["nodeParams"].(map[string]interface{})
+	if len(nodeParams) == 0 {
+		return data, false, nil
+	}
+
+	before, err := json.Marshal(nodeParams)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The steps work on graph documents, so the params are wrapped in one.
+	// They are updated in place.
+	nodes := make([]interface{}, 0, len(nodeParams))
+	for id, params := range nodeParams {
+		node, ok := g.Node(id)
+		if !ok {
+			continue
+		}
+		nodes = append(nodes, map[string]interface{}{"id": id, "type": node.Type, "params": params})
+	}
+	doc := map[string]interface{}{"nodes": nodes}
+	for _, m := range Migrations {
+		if err := m.Apply(doc); err != nil {
+			return nil, false, fmt.Errorf("scene state migration from version %d (%s): %w", m.From, m.Description, err)
+		}
+	}
+
+	after, err := json.Marshal(nodeParams)
+	if err != nil {
+		return nil, false, err
+	}
+	if string(before) == string(after) {
+		return data, false, nil
+	}
+	result, err = json.Marshal(state)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+func docVersion(doc map[string]interface{}) (int, error) {
+	raw, ok := doc["version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	v, ok := raw.(float64)
+	if !ok || v < 0 || v != float64(int(v)) {
+		return 0, fmt.Errorf("invalid graph version %v", raw)
+	}
+	return int(v), nil
+}
+
+// docNodes returns the node objects of a graph document, skipping anything
+// malformed; validation reports those separately.
+func docNodes(doc map[string]interface{}) []map[string]interface{} {
+	list, _ := doc["nodes"].([]interface{})
+	nodes := make([]map[string]interface{}, 0, len(list))
+	for _, raw := range list {
+		if node, ok := raw.(map[string]interface{}); ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// migrateNumericParams converts number and integer params that older studio
+// builds saved as strings, such as "440", to numbers. Strings that do not
+// parse are left for validation to reject.
+func migrateNumericParams(doc map[string]interface{}) error {
+	for _, node := range docNodes(doc) {
+		nodeType, _ := node["type"].(string)
+		spec, ok := Blocks[nodeType]
+		if !ok {
+			continue
+		}
+		params, _ := node["params"].(map[string]interface{})
+		for key, value := range params {
+			p, ok := spec.param(key)
+			if !ok || (p.Kind != KindNumber && p.Kind != KindInteger) {
+				continue
+			}
+			if s, isString := value.(string); isString {
+				if f, ok := toFloat(s); ok {
+					params[key] = f
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// migrateSequencerSteps gives every sequencer step the fields the studio
+// has always defaulted on load: active false, velocity and probability 1.
+// Probability was added after the first release and numeric strings are
+// converted as above.
+func migrateSequencerSteps(doc map[string]interface{}) error {
+	for _, node := range docNodes(doc) {
+		if node["type"] != "sequencer" {
+			continue
+		}
+		params, _ := node["params"].(map[string]interface{})
+		steps, _ := params["steps"].([]interface{})
+		for _, raw := range steps {
+			step, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch active := step["active"].(type) {
+			case nil:
+				step["active"] = false
+			case float64:
+				step["active"] = active != 0
+			}
+			for _, key := range []string{"velocity", "probability"} {
+				switch value := step[key].(type) {
+				case nil:
+					step[key] = 1.0
+				case string:
+					if f, ok := toFloat(value); ok {
+						step[key] = f
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
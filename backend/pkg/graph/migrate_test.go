@@ -0,0 +1,212 @@
+package graph
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		t.Fatalf("bad fixture: %v", err)
+	}
+	return doc
+}
+
+// applyStep runs the single migration starting at from on doc.
+func applyStep(t *testing.T, from int, doc map[string]interface{}) {
+	t.Helper()
+	if err := Migrations[from].Apply(doc); err != nil {
+		t.Fatalf("migration from %d: %v", from, err)
+	}
+}
+
+func TestRegistryIsContiguous(t *testing.T) {
+	if len(Migrations) != CurrentVersion {
+		t.Fatalf("CurrentVersion is %d but %d migrations are registered", CurrentVersion, len(Migrations))
+	}
+	for i, m := range Migrations {
+		if m.From != i {
+			t.Errorf("migration %d has From %d", i, m.From)
+		}
+		if m.Apply == nil || m.Description == "" {
+			t.Errorf("migration %d is missing Apply or Description", i)
+		}
+	}
+}
+
+func TestMigrateNumericParams(t *testing.T) {
+	doc := decode(t, `{"nodes": [
+		{"id": "o", "type": "oscillator", "params": {"frequency": "440", "detune": " -12.5 ", "type": "sine"}},
+		{"id": "s", "type": "sequencer", "params": {"stepsPerBar": "16", "bpm": "fast"}},
+		{"id": "m", "type": "mixer", "params": {"gain_0": "0.5", "label": "7"}},
+		{"id": "x", "type": "unknown", "params": {"frequency": "440"}}
+	], "connections": []}`)
+	applyStep(t, 0, doc)
+
+	want := decode(t, `{"nodes": [
+		{"id": "o", "type": "oscillator", "params": {"frequency": 440, "detune": -12.5, "type": "sine"}},
+		{"id": "s", "type": "sequencer", "params": {"stepsPerBar": 16, "bpm": "fast"}},
+		{"id": "m", "type": "mixer", "params": {"gain_0": 0.5, "label": "7"}},
+		{"id": "x", "type": "unknown", "params": {"frequency": "440"}}
+	], "connections": []}`)
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("got %v\nwant %v", doc, want)
+	}
+}
+
+func TestMigrateSequencerSteps(t *testing.T) {
+	doc := decode(t, `{"nodes": [
+		{"id": "s", "type": "sequencer", "params": {"steps": [
+			{"active": true, "velocity": 0.8},
+			{},
+			{"active": 1, "velocity": "0.5", "probability": "0.25"},
+			{"active": false, "velocity": 0, "probability": 0},
+			"junk"
+		]}},
+		{"id": "o", "type": "oscillator", "params": {"steps": [{}]}}
+	], "connections": []}`)
+	applyStep(t, 1, doc)
+
+	want := decode(t, `{"nodes": [
+		{"id": "s", "type": "sequencer", "params": {"steps": [
+			{"active": true, "velocity": 0.8, "probability": 1},
+			{"active": false, "velocity": 1, "probability": 1},
+			{"active": true, "velocity": 0.5, "probability": 0.25},
+			{"active": false, "velocity": 0, "probability": 0},
+			"junk"
+		]}},
+		{"id": "o", "type": "oscillator", "params": {"steps": [{}]}}
+	], "connections": []}`)
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("got %v\nwant %v", doc, want)
+	}
+}
+
+// Clients that predate versioning send graphs in the current shape with no
+// version, so every step has to leave an already migrated graph unchanged.
+func TestMigrationsAreIdempotent(t *testing.T) {
+	const current = `{"nodes": [
+		{"id": "o", "type": "oscillator", "params": {"frequency": 440, "type": "sine"}},
+		{"id": "s", "type": "sequencer", "params": {"bpm": 120, "steps": [{"active": true, "velocity": 1, "probability": 0.5}]}}
+	], "connections": []}`
+
+	for i := range Migrations {
+		doc := decode(t, current)
+		applyStep(t, i, doc)
+		if !reflect.DeepEqual(doc, decode(t, current)) {
+			t.Errorf("migration from %d changed a current graph: %v", i, doc)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	data, changed, err := Migrate([]byte(`{"nodes": [{"id": "o", "type": "oscillator", "params": {"frequency": "220"}}], "connections": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("expected an unversioned graph to change")
+	}
+	g, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Version != CurrentVersion {
+		t.Errorf("version = %d, want %d", g.Version, CurrentVersion)
+	}
+	if f, ok := g.Nodes[0].Params["frequency"].(float64); !ok || f != 220 {
+		t.Errorf("frequency = %#v, want 220", g.Nodes[0].Params["frequency"])
+	}
+
+	again, changed, err := Migrate(data)
+	if err != nil || changed || string(again) != string(data) {
+		t.Errorf("migrating a current graph: changed=%v err=%v", changed, err)
+	}
+}
+
+func TestMigrateRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"newer version":   `{"version": 99, "nodes": [], "connections": []}`,
+		"invalid version": `{"version": "2", "nodes": [], "connections": []}`,
+		"not json":        `{"nodes": [`,
+	} {
+		if _, _, err := Migrate([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseMigratesOldGraphs(t *testing.T) {
+	g, err := ValidateJSON([]byte(`{"nodes": [
+		{"id": "s", "type": "sequencer", "params": {"bpm": "128", "steps": [{"active": true, "velocity": "1"}]}}
+	], "connections": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := g.Nodes[0].Params["steps"].([]interface{})
+	step := steps[0].(map[string]interface{})
+	if g.Nodes[0].Params["bpm"] != 128.0 || step["velocity"] != 1.0 || step["probability"] != 1.0 {
+		t.Errorf("graph not migrated: %v", g.Nodes[0].Params)
+	}
+}
+
+func TestMigrateSceneState(t *testing.T) {
+	g, err := Parse([]byte(`{"version": 2, "nodes": [
+		{"id": "o", "type": "oscillator", "params": {"frequency": 440}},
+		{"id": "s", "type": "sequencer", "params": {}}
+	], "connections": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, changed, err := MigrateSceneState([]byte(`{
+		"nodeParams": {
+			"o": {"frequency": "220", "type": "saw"},
+			"s": {"steps": [{"active": 1}, {"active": true, "velocity": "0.5", "probability": 0.25}]},
+			"gone": {"frequency": "110"}
+		},
+		"mutedNodeIds": ["s"]
+	}`), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("expected the state to change")
+	}
+
+	want := decode(t, `{
+		"nodeParams": {
+			"o": {"frequency": 220, "type": "saw"},
+			"s": {"steps": [
+				{"active": true, "velocity": 1, "probability": 1},
+				{"active": true, "velocity": 0.5, "probability": 0.25}
+			]},
+			"gone": {"frequency": "110"}
+		},
+		"mutedNodeIds": ["s"]
+	}`)
+	if got := decode(t, string(data)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	again, changed, err := MigrateSceneState(data, g)
+	if err != nil || changed || string(again) != string(data) {
+		t.Errorf("second migration changed = %v, err = %v; want it left alone", changed, err)
+	}
+}
+
+func TestMigrateSceneStateWithoutParams(t *testing.T) {
+	g := &Graph{}
+	for _, state := range []string{`{}`, `{"nodeParams": {}, "mutedNodeIds": []}`, `{"nodeParams": null}`} {
+		data, changed, err := MigrateSceneState([]byte(state), g)
+		if err != nil || changed || string(data) != state {
+			t.Errorf("%s: got %s, %v, %v", state, data, changed, err)
+		}
+	}
+	if _, _, err := MigrateSceneState([]byte(`[`), g); err == nil {
+		t.Error("expected an error for invalid state")
+	}
+}
@@ -0,0 +1,156 @@
+package graph
+
+import "fmt"
+
+const (
+	OpAddNode    = "add_node"
+	OpRemoveNode = "remove_node"
+	OpMoveNode   = "move_node"
+	OpSetParam   = "set_param"
+	OpConnect    = "connect"
+	OpDisconnect = "disconnect"
+)
+
+// Op is a single edit to a graph. Which fields are used depends on Op:
+//
+//	add_node     Node
+//	remove_node  ID
+//	move_node    ID, Position
+//	set_param    ID, Key, Value (a null Value removes the param)
+//	connect      Connection
+//	disconnect   ID (the connection id)
+type Op struct {
+	Op         string      `json:"op"`
+	ID         string      `json:"id,omitempty"`
+	Node       *Node       `json:"node,omitempty"`
+	Position   *Position   `json:"position,omitempty"`
+	Key        string      `json:"key,omitempty"`
+	Value      interface{} `json:"value,omitempty"`
+	Connection *Connection `json:"connection,omitempty"`
+}
+
+type OpError struct {
+	Index   int
+	Message string
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("op %d: %s", e.Index, e.Message)
+}
+
+// Apply runs ops in order against g. It stops at the first invalid op and
+// leaves g partially modified, so callers that need all-or-nothing semantics
+// should apply to a copy or discard g on error.
+func (g *Graph) Apply(ops []Op) error {
+	for i, op := range ops {
+		if err := g.apply(op); err != nil {
+			return &OpError{Index: i, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+func (g *Graph) apply(op Op) error {
+	switch op.Op {
+	case OpAddNode:
+		if op.Node == nil || op.Node.ID == "" || op.Node.Type == "" {
+			return fmt.Errorf("add_node requires a node with id and type")
+		}
+		if _, exists := g.Node(op.Node.ID); exists {
+			return fmt.Errorf("node %q already exists", op.Node.ID)
+		}
+		node := *op.Node
+		if node.Params == nil {
+			node.Params = map[string]interface{}{}
+		}
+		g.Nodes = append(g.Nodes, node)
+
+	case OpRemoveNode:
+		index := g.nodeIndex(op.ID)
+		if index < 0 {
+			return fmt.Errorf("node %q does not exist", op.ID)
+		}
+		g.Nodes = append(g.Nodes[:index], g.Nodes[index+1:]...)
+
+		kept := g.Connections[:0]
+		for _, conn := range g.Connections {
+			if conn.From != op.ID && conn.To != op.ID {
+				kept = append(kept, conn)
+			}
+		}
+		g.Connections = kept
+
+	case OpMoveNode:
+		node, ok := g.Node(op.ID)
+		if !ok {
+			return fmt.Errorf("node %q does not exist", op.ID)
+		}
+		if op.Position == nil {
+			return fmt.Errorf("move_node requires a position")
+		}
+		node.Position = *op.Position
+
+	case OpSetParam:
+		node, ok := g.Node(op.ID)
+		if !ok {
+			return fmt.Errorf("node %q does not exist", op.ID)
+		}
+		if op.Key == "" {
+			return fmt.Errorf("set_param requires a key")
+		}
+		if op.Value == nil {
+			delete(node.Params, op.Key)
+		} else {
+			node.Params[op.Key] = op.Value
+		}
+
+	case OpConnect:
+		conn := op.Connection
+		if conn == nil || conn.ID == "" {
+			return fmt.Errorf("connect requires a connection with an id")
+		}
+		if g.connectionIndex(conn.ID) >= 0 {
+			return fmt.Errorf("connection %q already exists", conn.ID)
+		}
+		if _, ok := g.Node(conn.From); !ok {
+			return fmt.Errorf("source node %q does not exist", conn.From)
+		}
+		if _, ok := g.Node(conn.To); !ok {
+			return fmt.Errorf("target node %q does not exist", conn.To)
+		}
+		if conn.From == conn.To {
+			return fmt.Errorf("node %q cannot connect to itself", conn.From)
+		}
+		g.Connections = append(g.Connections, *conn)
+
+	case OpDisconnect:
+		index := g.connectionIndex(op.ID)
+		if index < 0 {
+			return fmt.Errorf("connection %q does not exist", op.ID)
+		}
+		g.Connections = append(g.Connections[:index], g.Connections[index+1:]...)
+
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+
+	return nil
+}
+
+func (g *Graph) nodeIndex(id string) int {
+	for i := range g.Nodes {
+		if g.Nodes[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Graph) connectionIndex(id string) int {
+	for i := range g.Connections {
+		if g.Connections[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
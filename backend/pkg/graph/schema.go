@@ -0,0 +1,440 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type ParamKind string
+
+const (
+	KindNumber  ParamKind = "number"
+	KindInteger ParamKind = "integer"
+	KindBool    ParamKind = "boolean"
+	KindString  ParamKind = "string"
+	KindEnum    ParamKind = "enum"
+	KindSteps   ParamKind = "steps"
+)
+
+type ParamSpec struct {
+	Kind   ParamKind `json:"kind"`
+	Min    *float64  `json:"min,omitempty"`
+	Max    *float64  `json:"max,omitempty"`
+	Values []string  `json:"values,omitempty"`
+}
+
+// BlockSpec describes what a block accepts. AudioInputs and ModPorts are the
+// number of addressable ports (to_port_index); the mixer's depend on its
+// channel count and are resolved per node.
+type BlockSpec struct {
+	Params      map[string]ParamSpec `json:"params"`
+	AudioInputs int                  `json:"audio_inputs"`
+	ModPorts    int                  `json:"mod_ports"`
+	AudioOutput bool                 `json:"audio_output"`
+	Triggerable bool                 `json:"triggerable"`
+
+	// prefixParams matches numbered params such as the mixer's gain_0..gain_N.
+	prefixParams map[string]ParamSpec
+}
+
+const (
+	MaxMixerChannels  = 12
+	MaxSequencerSteps = 64
+
+	// mixerMasterPort is the to_port_index an LFO uses to reach the mixer's
+	// master gain instead of a channel.
+	mixerMasterPort = -1
+)
+
+func number(min, max float64) ParamSpec {
+	return ParamSpec{Kind: KindNumber, Min: &min, Max: &max}
+}
+
+func integer(min, max float64) ParamSpec {
+	return ParamSpec{Kind: KindInteger, Min: &min, Max: &max}
+}
+
+func enum(values ...string) ParamSpec {
+	return ParamSpec{Kind: KindEnum, Values: values}
+}
+
+var (
+	boolean = ParamSpec{Kind: KindBool}
+	text    = ParamSpec{Kind: KindString}
+	waves   = enum("sine", "square", "sawtooth", "triangle")
+)
+
+// Blocks mirrors the studio's block implementations. Ranges are the widest
+// values the Web Audio nodes accept sensibly, which is looser than the
+// studio's sliders so that automation and imported patches still validate.
+var Blocks = map[string]BlockSpec{
+	"oscillator": {
+		Params: map[string]ParamSpec{
+			"type":      waves,
+			"frequency": number(0, 24000),
+			"detune":    number(-1200, 1200),
+			"gain":      number(0, 1),
+		},
+		ModPorts:    1,
+		AudioOutput: true,
+		Triggerable: true,
+	},
+	"sampler": {
+		Params: map[string]ParamSpec{
+			"gain":         number(0, 1),
+			"playbackRate": number(0.25, 2),
+			"loop":         boolean,
+			"loopStart":    number(0, 3600),
+			"loopEnd":      number(0, 3600),
+			"sampleUrl":    text,
+			"sampleName":   text,
+			"sampleId":     text,
+		},
+		AudioOutput: true,
+		Triggerable: true,
+	},
+	"filter": {
+		Params: map[string]ParamSpec{
+			"type":      enum("lowpass", "highpass", "bandpass", "lowshelf", "highshelf", "peaking", "notch", "allpass"),
+			"frequency": number(10, 24000),
+			"q":         number(0.0001, 1000),
+			"gain":      number(-40, 40),
+		},
+		AudioInputs: 1,
+		ModPorts:    3,
+		AudioOutput: true,
+	},
+	"delay": {
+		Params: map[string]ParamSpec{
+			"time":     number(0, 5),
+			"feedback": number(0, 0.99),
+			"mix":      number(0, 1),
+		},
+		AudioInputs: 1,
+		ModPorts:    3,
+		AudioOutput: true,
+	},
+	"reverb": {
+		Params: map[string]ParamSpec{
+			"size":        number(0.1, 5),
+			"decay":       number(0.1, 10),
+			"mix":         number(0, 1),
+			"normalize":   boolean,
+			"impulseUrl":  text,
+			"impulseId":   text,
+			"impulseName": text,
+		},
+		AudioInputs: 1,
+		AudioOutput: true,
+	},
+	"mixer": {
+		Params: map[string]ParamSpec{
+			"channels": integer(1, MaxMixerChannels),
+			"master":   number(0, 2),
+		},
+		AudioOutput: true,
+		prefixParams: map[string]ParamSpec{
+			"gain_": number(0, 2),
+		},
+	},
+	"lfo": {
+		Params: map[string]ParamSpec{
+			"frequency": number(0.01, 40),
+			"depth":     number(0, 1),
+			"offset":    number(-1, 1),
+			"waveform":  waves,
+			"active":    boolean,
+		},
+	},
+	"sequencer": {
+		Params: map[string]ParamSpec{
+			"bpm":         number(20, 300),
+			"stepsPerBar": integer(1, MaxSequencerSteps),
+			"swing":       number(0, 0.5),
+			"playing":     boolean,
+			"steps":       {Kind: KindSteps},
+		},
+	},
+	"master": {
+		Params: map[string]ParamSpec{
+			"volume":        number(0, 2),
+			"clipThreshold": number(0.1, 4),
+		},
+		AudioInputs: 1,
+		ModPorts:    1,
+	},
+}
+
+func (s BlockSpec) param(key string) (ParamSpec, bool) {
+	if spec, ok := s.Params[key]; ok {
+		return spec, true
+	}
+	for prefix, spec := range s.prefixParams {
+		if index, ok := strings.CutPrefix(key, prefix); ok {
+			if n, err := strconv.Atoi(index); err == nil && n >= 0 && n < MaxMixerChannels {
+				return spec, true
+			}
+		}
+	}
+	return ParamSpec{}, false
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Field + ": " + e.Errors[0].Message
+	}
+	return fmt.Sprintf("%d validation errors", len(e.Errors))
+}
+
+// ValidateJSON parses raw graph_data and validates it. Errors are always a
+// *ValidationError, with malformed JSON reported against the root field.
+func ValidateJSON(data []byte) (*Graph, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil || probe == nil {
+		return nil, &ValidationError{Errors: []FieldError{{Field: "graph_data", Message: "must be an object with nodes and connections"}}}
+	}
+
+	g, err := Parse(data)
+	if err != nil {
+		return nil, &ValidationError{Errors: []FieldError{{Field: "graph_data", Message: err.Error()}}}
+	}
+	if err := Validate(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Validate checks node params against the block schema and connections
+// against the routing rules the audio engine applies: LFOs modulate, sequencers
+// trigger, and everything else carries audio into a block with inputs.
+// Params the schema does not know are left alone, since older patches carry
+// keys the studio no longer reads.
+func Validate(g *Graph) error {
+	v := &validator{}
+
+	nodes := make(map[string]*Node, len(g.Nodes))
+	for i := range g.Nodes {
+		node := &g.Nodes[i]
+		field := fmt.Sprintf("nodes[%d]", i)
+
+		if node.ID == "" {
+			v.add(field+".id", "is required")
+		} else if _, dup := nodes[node.ID]; dup {
+			v.add(field+".id", fmt.Sprintf("duplicate node id %q", node.ID))
+		} else {
+			nodes[node.ID] = node
+		}
+
+		spec, ok := Blocks[node.Type]
+		if !ok {
+			v.add(field+".type", fmt.Sprintf("unknown block type %q", node.Type))
+			continue
+		}
+		v.params(field+".params", spec, node.Params)
+	}
+
+	connIDs := make(map[string]bool, len(g.Connections))
+	for i, conn := range g.Connections {
+		field := fmt.Sprintf("connections[%d]", i)
+
+		if conn.ID == "" {
+			v.add(field+".id", "is required")
+		} else if connIDs[conn.ID] {
+			v.add(field+".id", fmt.Sprintf("duplicate connection id %q", conn.ID))
+		}
+		connIDs[conn.ID] = true
+
+		from, okFrom := nodes[conn.From]
+		if !okFrom {
+			v.add(field+".from", fmt.Sprintf("node %q does not exist", conn.From))
+		}
+		to, okTo := nodes[conn.To]
+		if !okTo {
+			v.add(field+".to", fmt.Sprintf("node %q does not exist", conn.To))
+		}
+		if !okFrom || !okTo {
+			continue
+		}
+		if conn.From == conn.To {
+			v.add(field, "a block cannot connect to itself")
+			continue
+		}
+		v.connection(field, from, to, conn.ToPortIndex)
+	}
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: message})
+}
+
+func (v *validator) params(field string, spec BlockSpec, params map[string]interface{}) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		p, ok := spec.param(key)
+		if !ok {
+			continue
+		}
+		if msg := checkParam(p, params[key]); msg != "" {
+			v.add(field+"."+key, msg)
+		}
+	}
+}
+
+func (v *validator) connection(field string, from, to *Node, port *int) {
+	target := Blocks[to.Type]
+
+	switch from.Type {
+	case "lfo":
+		ports := target.ModPorts
+		if to.Type == "mixer" {
+			ports = mixerChannels(to)
+			if port == nil || *port == mixerMasterPort {
+				return
+			}
+		}
+		if ports == 0 {
+			v.add(field+".to", fmt.Sprintf("an lfo cannot modulate a %s", to.Type))
+			return
+		}
+		v.port(field, port, ports)
+
+	case "sequencer":
+		if !target.Triggerable {
+			v.add(field+".to", fmt.Sprintf("a sequencer cannot trigger a %s", to.Type))
+		}
+
+	default:
+		if !Blocks[from.Type].AudioOutput {
+			v.add(field+".from", fmt.Sprintf("a %s has no audio output", from.Type))
+			return
+		}
+		ports := target.AudioInputs
+		if to.Type == "mixer" {
+			ports = mixerChannels(to)
+		}
+		if ports == 0 {
+			v.add(field+".to", fmt.Sprintf("a %s has no audio input", to.Type))
+			return
+		}
+		v.port(field, port, ports)
+	}
+}
+
+func (v *validator) port(field string, port *int, ports int) {
+	if port != nil && (*port < 0 || *port >= ports) {
+		v.add(field+".to_port_index", fmt.Sprintf("must be between 0 and %d", ports-1))
+	}
+}
+
+func mixerChannels(n *Node) int {
+	return int(math.Min(MaxMixerChannels, math.Max(1, math.Round(n.Float("channels", 4)))))
+}
+
+// checkParam returns a message describing why value does not satisfy spec, or
+// "" if it does. Numbers may arrive as numeric strings, which is how a few
+// blocks have historically stored them.
+func checkParam(spec ParamSpec, value interface{}) string {
+	switch spec.Kind {
+	case KindNumber, KindInteger:
+		f, ok := toFloat(value)
+		if !ok {
+			return "must be a number"
+		}
+		if spec.Kind == KindInteger && f != math.Trunc(f) {
+			return "must be an integer"
+		}
+		if (spec.Min != nil && f < *spec.Min) || (spec.Max != nil && f > *spec.Max) {
+			return fmt.Sprintf("must be between %g and %g", *spec.Min, *spec.Max)
+		}
+
+	case KindBool:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+
+	case KindString:
+		if _, ok := value.(string); !ok {
+			return "must be a string"
+		}
+
+	case KindEnum:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(spec.Values, s) {
+			return fmt.Sprintf("must be one of %s", strings.Join(spec.Values, ", "))
+		}
+
+	case KindSteps:
+		return checkSteps(value)
+	}
+	return ""
+}
+
+func checkSteps(value interface{}) string {
+	steps, ok := value.([]interface{})
+	if !ok {
+		return "must be an array of steps"
+	}
+	if len(steps) > MaxSequencerSteps {
+		return fmt.Sprintf("must have at most %d steps", MaxSequencerSteps)
+	}
+
+	for i, raw := range steps {
+		step, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("step %d must be an object", i)
+		}
+		if active, ok := step["active"]; ok {
+			if _, isBool := active.(bool); !isBool {
+				return fmt.Sprintf("step %d: active must be a boolean", i)
+			}
+		}
+		for _, key := range []string{"velocity", "probability"} {
+			raw, ok := step[key]
+			if !ok {
+				continue
+			}
+			if f, isNum := toFloat(raw); !isNum || f < 0 || f > 1 {
+				return fmt.Sprintf("step %d: %s must be between 0 and 1", i, key)
+			}
+		}
+	}
+	return ""
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	return 0, false
+}
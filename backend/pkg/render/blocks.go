@@ -0,0 +1,585 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+type signal struct {
+	port int
+	buf  []float64
+}
+
+type blockIO struct {
+	frame  int64
+	inputs []signal
+	mods   []signal
+	out    []float64
+}
+
+func (io *blockIO) sumInputs() {
+	for _, in := range io.inputs {
+		for i, s := range in.buf {
+			io.out[i] += s
+		}
+	}
+}
+
+// modulation sums every LFO routed to the given target into dst, scaled the
+// same way the studio blocks scale their modulation gain nodes. The LFO port
+// index is clamped into the block's target list, as the frontend does.
+func (io *blockIO) modulation(target, targets int, scale float64, dst []float64) {
+	for _, mod := range io.mods {
+		if max(0, min(targets-1, mod.port)) != target {
+			continue
+		}
+		for i, s := range mod.buf {
+			dst[i] += s * scale
+		}
+	}
+}
+
+type processor interface {
+	process(io *blockIO)
+}
+
+type triggerEvent struct {
+	offset   int
+	velocity float64
+}
+
+type triggerable interface {
+	setTriggered(enabled bool)
+	trigger(ev triggerEvent)
+}
+
+func waveform(kind string, phase, phaseInc float64) float64 {
+	switch kind {
+	case "square":
+		v := 1.0
+		if phase >= 0.5 {
+			v = -1
+		}
+		v += polyBLEP(phase, phaseInc)
+		v -= polyBLEP(math.Mod(phase+0.5, 1), phaseInc)
+		return v
+	case "sawtooth":
+		return 2*phase - 1 - polyBLEP(phase, phaseInc)
+	case "triangle":
+		return 1 - 4*math.Abs(phase-0.5)
+	default:
+		return math.Sin(2 * math.Pi * phase)
+	}
+}
+
+func polyBLEP(t, dt float64) float64 {
+	if dt <= 0 {
+		return 0
+	}
+	if t < dt {
+		t /= dt
+		return t + t - t*t - 1
+	}
+	if t > 1-dt {
+		t = (t - 1) / dt
+		return t*t + t + t + 1
+	}
+	return 0
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+const (
+	envelopeAttack   = 0.01
+	envelopeDuration = 0.25
+)
+
+type oscillator struct {
+	kind       string
+	frequency  float64
+	baseGain   float64
+	sampleRate float64
+	phase      float64
+	started    bool
+	triggered  bool
+	pending    []triggerEvent
+	envStart   int64
+	envPeak    float64
+	envActive  bool
+	mod        []float64
+}
+
+func newOscillator(node *graph.Node, sampleRate float64) *oscillator {
+	frequency := node.Float("frequency", 440)
+	detune := node.Float("detune", 0)
+	return &oscillator{
+		kind:       node.String("type", "sine"),
+		frequency:  frequency * math.Pow(2, detune/1200),
+		baseGain:   node.Float("gain", 0.5),
+		sampleRate: sampleRate,
+		started:    true,
+		mod:        make([]float64, BlockSize),
+	}
+}
+
+func (o *oscillator) setTriggered(enabled bool) {
+	o.triggered = enabled
+	o.started = !enabled
+}
+
+func (o *oscillator) trigger(ev triggerEvent) {
+	o.pending = append(o.pending, ev)
+}
+
+func (o *oscillator) envelope(frame int64) float64 {
+	if !o.envActive {
+		return 0
+	}
+	t := float64(frame-o.envStart) / o.sampleRate
+	switch {
+	case t < envelopeAttack:
+		return o.envPeak * t / envelopeAttack
+	case t < envelopeAttack+envelopeDuration:
+		return o.envPeak * (1 - (t-envelopeAttack)/envelopeDuration)
+	default:
+		o.envActive = false
+		return 0
+	}
+}
+
+func (o *oscillator) process(io *blockIO) {
+	clear(o.mod)
+	io.modulation(0, 1, 1, o.mod)
+	sort.Slice(o.pending, func(i, j int) bool { return o.pending[i].offset < o.pending[j].offset })
+
+	phaseInc := o.frequency / o.sampleRate
+	next := 0
+	for i := range io.out {
+		for next < len(o.pending) && o.pending[next].offset <= i {
+			ev := o.pending[next]
+			o.started = true
+			o.envActive = true
+			o.envStart = io.frame + int64(i)
+			o.envPeak = o.baseGain * clamp(ev.velocity, 0, 1)
+			next++
+		}
+
+		gain := o.baseGain
+		if o.triggered {
+			gain = o.envelope(io.frame + int64(i))
+		}
+		gain += o.mod[i]
+
+		s := 0.0
+		for _, in := range io.inputs {
+			s += in.buf[i]
+		}
+		if o.started {
+			s += waveform(o.kind, o.phase, phaseInc)
+			o.phase += phaseInc
+			o.phase -= math.Floor(o.phase)
+		}
+		io.out[i] = s * gain
+	}
+	o.pending = o.pending[:0]
+}
+
+var filterModScale = [...]float64{400, 5, 12}
+
+type filter struct {
+	kind       string
+	frequency  float64
+	q          float64
+	gain       float64
+	sampleRate float64
+	x1, x2     float64
+	y1, y2     float64
+	mod        [3][]float64
+}
+
+func newFilter(node *graph.Node, sampleRate float64) *filter {
+	f := &filter{
+		kind:       node.String("type", "lowpass"),
+		frequency:  node.Float("frequency", 1000),
+		q:          node.Float("q", 1),
+		gain:       node.Float("gain", 0),
+		sampleRate: sampleRate,
+	}
+	for i := range f.mod {
+		f.mod[i] = make([]float64, BlockSize)
+	}
+	return f
+}
+
+// coefficients follows the biquad formulas from the Web Audio specification,
+// including its use of decibels for the lowpass/highpass Q.
+func (f *filter) coefficients(frequency, q, gain float64) (b0, b1, b2, a1, a2 float64) {
+	nyquist := f.sampleRate / 2
+	frequency = clamp(frequency, 0, nyquist)
+	w0 := 2 * math.Pi * frequency / f.sampleRate
+	cosW := math.Cos(w0)
+	sinW := math.Sin(w0)
+	A := math.Pow(10, gain/40)
+	alphaQ := sinW / (2 * math.Max(q, 1e-4))
+	alphaQdB := sinW / (2 * math.Pow(10, q/20))
+	alphaS := sinW / 2 * math.Sqrt2
+	sqrtA := math.Sqrt(A)
+
+	var a0 float64
+	switch f.kind {
+	case "highpass":
+		b0, b1, b2 = (1+cosW)/2, -(1 + cosW), (1+cosW)/2
+		a0, a1, a2 = 1+alphaQdB, -2*cosW, 1-alphaQdB
+	case "bandpass":
+		b0, b1, b2 = alphaQ, 0, -alphaQ
+		a0, a1, a2 = 1+alphaQ, -2*cosW, 1-alphaQ
+	case "notch":
+		b0, b1, b2 = 1, -2*cosW, 1
+		a0, a1, a2 = 1+alphaQ, -2*cosW, 1-alphaQ
+	case "allpass":
+		b0, b1, b2 = 1-alphaQ, -2*cosW, 1+alphaQ
+		a0, a1, a2 = 1+alphaQ, -2*cosW, 1-alphaQ
+	case "peaking":
+		b0, b1, b2 = 1+alphaQ*A, -2*cosW, 1-alphaQ*A
+		a0, a1, a2 = 1+alphaQ/A, -2*cosW, 1-alphaQ/A
+	case "lowshelf":
+		b0 = A * ((A + 1) - (A-1)*cosW + 2*sqrtA*alphaS)
+		b1 = 2 * A * ((A - 1) - (A+1)*cosW)
+		b2 = A * ((A + 1) - (A-1)*cosW - 2*sqrtA*alphaS)
+		a0 = (A + 1) + (A-1)*cosW + 2*sqrtA*alphaS
+		a1 = -2 * ((A - 1) + (A+1)*cosW)
+		a2 = (A + 1) + (A-1)*cosW - 2*sqrtA*alphaS
+	case "highshelf":
+		b0 = A * ((A + 1) + (A-1)*cosW + 2*sqrtA*alphaS)
+		b1 = -2 * A * ((A - 1) + (A+1)*cosW)
+		b2 = A * ((A + 1) + (A-1)*cosW - 2*sqrtA*alphaS)
+		a0 = (A + 1) - (A-1)*cosW + 2*sqrtA*alphaS
+		a1 = 2 * ((A - 1) - (A+1)*cosW)
+		a2 = (A + 1) - (A-1)*cosW - 2*sqrtA*alphaS
+	default:
+		b0, b1, b2 = (1-cosW)/2, 1-cosW, (1-cosW)/2
+		a0, a1, a2 = 1+alphaQdB, -2*cosW, 1-alphaQdB
+	}
+
+	return b0 / a0, b1 / a0, b2 / a0, a1 / a0, a2 / a0
+}
+
+func (f *filter) process(io *blockIO) {
+	for i := range f.mod {
+		clear(f.mod[i])
+		io.modulation(i, len(f.mod), filterModScale[i], f.mod[i])
+	}
+
+	b0, b1, b2, a1, a2 := f.coefficients(
+		f.frequency+f.mod[0][0],
+		f.q+f.mod[1][0],
+		f.gain+f.mod[2][0],
+	)
+
+	io.sumInputs()
+	for i, x := range io.out {
+		y := b0*x + b1*f.x1 + b2*f.x2 - a1*f.y1 - a2*f.y2
+		f.x2, f.x1 = f.x1, x
+		f.y2, f.y1 = f.y1, y
+		io.out[i] = y
+	}
+}
+
+const maxDelaySeconds = 5.0
+
+var delayModScale = [...]float64{0.25, 0.5, 0.5}
+
+type delay struct {
+	time       float64
+	feedback   float64
+	mix        float64
+	sampleRate float64
+	line       []float64
+	write      int
+	mod        [3][]float64
+}
+
+func newDelay(node *graph.Node, sampleRate float64) *delay {
+	d := &delay{
+		time:       node.Float("time", 0.25),
+		feedback:   node.Float("feedback", 0.3),
+		mix:        node.Float("mix", 0.5),
+		sampleRate: sampleRate,
+		line:       make([]float64, int(maxDelaySeconds*sampleRate)+2),
+	}
+	for i := range d.mod {
+		d.mod[i] = make([]float64, BlockSize)
+	}
+	return d
+}
+
+func (d *delay) read(samples float64) float64 {
+	pos := float64(d.write) - samples
+	for pos < 0 {
+		pos += float64(len(d.line))
+	}
+	i := int(pos)
+	frac := pos - float64(i)
+	a := d.line[i%len(d.line)]
+	b := d.line[(i+1)%len(d.line)]
+	return a + (b-a)*frac
+}
+
+func (d *delay) process(io *blockIO) {
+	for i := range d.mod {
+		clear(d.mod[i])
+		io.modulation(i, len(d.mod), delayModScale[i], d.mod[i])
+	}
+
+	dry := 1 - d.mix
+	for i := range io.out {
+		x := 0.0
+		for _, in := range io.inputs {
+			x += in.buf[i]
+		}
+
+		seconds := clamp(d.time+d.mod[0][i], 0, maxDelaySeconds)
+		delayed := d.read(math.Max(1, seconds*d.sampleRate))
+
+		d.line[d.write] = x + delayed*(d.feedback+d.mod[1][i])
+		d.write = (d.write + 1) % len(d.line)
+
+		io.out[i] = x*dry + delayed*(d.mix+d.mod[2][i])
+	}
+}
+
+const mixerModScale = 0.5
+
+type mixer struct {
+	master   float64
+	gains    []float64
+	channels []int
+	mod      []float64
+}
+
+// newMixer assigns inputs to channels the way MixerBlock.allocateChannel does:
+// an explicit port index claims that channel, everything else takes the first
+// free channel and grows the mixer when none is left. Explicit ports must lie
+// within the declared channel count, and the mixer never grows past
+// graph.MaxMixerChannels.
+func newMixer(node *graph.Node, inputs []input) (*mixer, error) {
+	count := int(clamp(math.Round(node.Float("channels", 4)), 1, graph.MaxMixerChannels))
+	m := &mixer{
+		master:   node.Float("master", 1),
+		channels: make([]int, len(inputs)),
+		mod:      make([]float64, BlockSize),
+	}
+
+	used := map[int]bool{}
+	for i, in := range inputs {
+		m.channels[i] = -1
+		if in.port >= 0 {
+			if in.port >= count {
+				return nil, fmt.Errorf("mixer %s: input port %d out of range (%d channels)", node.ID, in.port, count)
+			}
+			m.channels[i] = in.port
+			used[in.port] = true
+		}
+	}
+	for i := range inputs {
+		if m.channels[i] >= 0 {
+			continue
+		}
+		ch := 0
+		for used[ch] {
+			ch++
+		}
+		if ch >= graph.MaxMixerChannels {
+			return nil, fmt.Errorf("mixer %s: more than %d inputs", node.ID, graph.MaxMixerChannels)
+		}
+		m.channels[i] = ch
+		used[ch] = true
+		count = max(count, ch+1)
+	}
+
+	m.gains = make([]float64, count)
+	for i := range m.gains {
+		m.gains[i] = node.Float("gain_"+strconv.Itoa(i), 1)
+	}
+	return m, nil
+}
+
+func (m *mixer) process(io *blockIO) {
+	clear(m.mod)
+	for _, mod := range io.mods {
+		if mod.port >= 0 {
+			continue
+		}
+		for i, s := range mod.buf {
+			m.mod[i] += s * mixerModScale
+		}
+	}
+
+	for n, in := range io.inputs {
+		ch := m.channels[n]
+		for i, s := range in.buf {
+			gain := m.gains[ch]
+			for _, mod := range io.mods {
+				if mod.port == ch {
+					gain += mod.buf[i] * mixerModScale
+				}
+			}
+			io.out[i] += s * gain
+		}
+	}
+
+	for i := range io.out {
+		io.out[i] *= m.master + m.mod[i]
+	}
+}
+
+type lfo struct {
+	kind       string
+	frequency  float64
+	depth      float64
+	offset     float64
+	sampleRate float64
+	phase      float64
+}
+
+func newLFO(node *graph.Node, sampleRate float64) *lfo {
+	depth := clamp(node.Float("depth", 0.5), 0, 1)
+	if !node.Bool("active", true) {
+		depth = 0
+	}
+	return &lfo{
+		kind:       node.String("waveform", "sine"),
+		frequency:  clamp(node.Float("frequency", 2), 0.01, 40),
+		depth:      depth,
+		offset:     clamp(node.Float("offset", 0.5), -1, 1),
+		sampleRate: sampleRate,
+	}
+}
+
+func (l *lfo) process(io *blockIO) {
+	phaseInc := l.frequency / l.sampleRate
+	for i := range io.out {
+		io.out[i] = l.depth*waveform(l.kind, l.phase, phaseInc) + l.offset
+		l.phase += phaseInc
+		l.phase -= math.Floor(l.phase)
+	}
+}
+
+type step struct {
+	active      bool
+	velocity    float64
+	probability float64
+}
+
+type sequencer struct {
+	steps         []step
+	framesPerStep float64
+	swingFrames   float64
+	current       int
+	nextFrame     float64
+	rng           *rand.Rand
+	events        []triggerEvent
+}
+
+func newSequencer(node *graph.Node, sampleRate float64, rng *rand.Rand) *sequencer {
+	bpm := node.Float("bpm", 120)
+	if bpm <= 0 {
+		bpm = 120
+	}
+	stepsPerBar := math.Max(1, math.Round(node.Float("stepsPerBar", 16)))
+	swing := clamp(node.Float("swing", 0), 0, 0.5)
+
+	framesPerStep := 60 / bpm / (stepsPerBar / 4) * sampleRate
+
+	return &sequencer{
+		steps:         parseSteps(node.Params["steps"]),
+		framesPerStep: framesPerStep,
+		swingFrames:   framesPerStep * swing,
+		rng:           rng,
+	}
+}
+
+func parseSteps(raw interface{}) []step {
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		steps := make([]step, 16)
+		for i := range steps {
+			steps[i] = step{active: i%4 == 0, velocity: 1, probability: 1}
+		}
+		return steps
+	}
+
+	steps := make([]step, 0, len(list))
+	for _, item := range list {
+		fields, _ := item.(map[string]interface{})
+		n := graph.Node{Params: fields}
+		steps = append(steps, step{
+			active:      n.Bool("active", false),
+			velocity:    clamp(n.Float("velocity", 1), 0, 1),
+			probability: clamp(n.Float("probability", 1), 0, 1),
+		})
+	}
+	return steps
+}
+
+func (s *sequencer) process(io *blockIO) {
+	s.events = s.events[:0]
+	end := float64(io.frame + BlockSize)
+
+	for s.nextFrame < end {
+		st := s.steps[s.current]
+		if st.active && (st.probability >= 1 || s.rng.Float64() <= st.probability) {
+			offset := max(0, int(s.nextFrame-float64(io.frame)))
+			s.events = append(s.events, triggerEvent{offset: offset, velocity: st.velocity})
+		}
+
+		interval := s.framesPerStep - s.swingFrames
+		if s.current%2 == 1 {
+			interval = s.framesPerStep + s.swingFrames
+		}
+		s.current = (s.current + 1) % len(s.steps)
+		s.nextFrame += math.Max(1, interval)
+	}
+}
+
+const masterModScale = 0.5
+
+type master struct {
+	volume float64
+	amount float64
+	mod    []float64
+}
+
+func newMaster(node *graph.Node) *master {
+	return &master{
+		volume: clamp(node.Float("volume", 0.8), 0, 2),
+		amount: clamp(node.Float("clipThreshold", 0.8), 0.1, 4),
+		mod:    make([]float64, BlockSize),
+	}
+}
+
+func (m *master) process(io *blockIO) {
+	clear(m.mod)
+	io.modulation(0, 1, masterModScale, m.mod)
+	io.sumInputs()
+
+	for i, s := range io.out {
+		x := clamp(s*(m.volume+m.mod[i]), -1, 1) * m.amount
+		io.out[i] = x / (1 + math.Abs(x))
+	}
+}
+
+// passthrough stands in for blocks whose audio comes from uploaded files
+// (sampler, reverb impulses); their input is forwarded unchanged.
+type passthrough struct{}
+
+func (p *passthrough) process(io *blockIO) {
+	io.sumInputs()
+}
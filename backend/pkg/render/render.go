@@ -0,0 +1,284 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+const (
+	BlockSize         = 128
+	DefaultSampleRate = 48000
+	DefaultBPM        = 120
+	DefaultBars       = 4
+
+	progressInterval = 64
+)
+
+var ErrNoMaster = errors.New("graph has no master block")
+
+type Options struct {
+	SampleRate int
+	Duration   time.Duration
+	BPM        int
+	Seed       int64
+	Progress   func(fraction float64)
+}
+
+type Buffer struct {
+	SampleRate int
+	Samples    []float32
+}
+
+func (b *Buffer) Duration() time.Duration {
+	if b.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(len(b.Samples)) / float64(b.SampleRate) * float64(time.Second))
+}
+
+func (o Options) withDefaults() Options {
+	if o.SampleRate <= 0 {
+		o.SampleRate = DefaultSampleRate
+	}
+	if o.BPM <= 0 {
+		o.BPM = DefaultBPM
+	}
+	if o.Duration <= 0 {
+		beats := float64(DefaultBars * 4)
+		o.Duration = time.Duration(beats * 60 / float64(o.BPM) * float64(time.Second))
+	}
+	if o.Seed == 0 {
+		o.Seed = 1
+	}
+	return o
+}
+
+// Render runs the graph offline, the same way the studio's Web Audio graph
+// would play it after pressing play, and returns the master output as mono PCM.
+func Render(ctx context.Context, g *graph.Graph, opts Options) (*Buffer, error) {
+	opts = opts.withDefaults()
+
+	e, err := newEngine(g, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	total := int(math.Ceil(opts.Duration.Seconds() * float64(opts.SampleRate)))
+	samples := make([]float32, total)
+
+	for start := 0; start < total; start += BlockSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		out := e.processBlock(int64(start))
+		n := min(BlockSize, total-start)
+		for i := 0; i < n; i++ {
+			samples[start+i] = float32(out[i])
+		}
+
+		if opts.Progress != nil && (start/BlockSize)%progressInterval == 0 {
+			opts.Progress(float64(start+n) / float64(total))
+		}
+	}
+
+	if opts.Progress != nil {
+		opts.Progress(1)
+	}
+
+	return &Buffer{SampleRate: opts.SampleRate, Samples: samples}, nil
+}
+
+type input struct {
+	port int
+	src  *voice
+}
+
+type voice struct {
+	node    *graph.Node
+	proc    processor
+	inputs  []input
+	mods    []input
+	targets []*voice
+	out     []float64
+	prev    []float64
+	state   int
+}
+
+const (
+	unvisited = iota
+	visiting
+	processed
+)
+
+type engine struct {
+	sampleRate float64
+	voices     []*voice
+	sequencers []*voice
+	masters    []*voice
+	mix        []float64
+}
+
+func newEngine(g *graph.Graph, opts Options) (*engine, error) {
+	e := &engine{
+		sampleRate: float64(opts.SampleRate),
+		mix:        make([]float64, BlockSize),
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	byID := make(map[string]*voice, len(g.Nodes))
+	for i := range g.Nodes {
+		node := &g.Nodes[i]
+		v := &voice{
+			node: node,
+			out:  make([]float64, BlockSize),
+			prev: make([]float64, BlockSize),
+		}
+		byID[node.ID] = v
+		e.voices = append(e.voices, v)
+	}
+
+	for _, conn := range g.Connections {
+		from, ok := byID[conn.From]
+		if !ok {
+			continue
+		}
+		to, ok := byID[conn.To]
+		if !ok {
+			continue
+		}
+
+		port := -1
+		if conn.ToPortIndex != nil {
+			port = *conn.ToPortIndex
+		}
+
+		switch from.node.Type {
+		case "lfo":
+			to.mods = append(to.mods, input{port: port, src: from})
+		case "sequencer":
+			from.targets = append(from.targets, to)
+		default:
+			to.inputs = append(to.inputs, input{port: port, src: from})
+		}
+	}
+
+	for _, v := range e.voices {
+		proc, err := newProcessor(v, e.sampleRate, rng)
+		if err != nil {
+			return nil, err
+		}
+		v.proc = proc
+
+		switch v.node.Type {
+		case "sequencer":
+			e.sequencers = append(e.sequencers, v)
+		case "master":
+			e.masters = append(e.masters, v)
+		}
+	}
+
+	if len(e.masters) == 0 {
+		return nil, ErrNoMaster
+	}
+
+	for _, seq := range e.sequencers {
+		for _, target := range seq.targets {
+			if t, ok := target.proc.(triggerable); ok {
+				t.setTriggered(true)
+			}
+		}
+	}
+
+	return e, nil
+}
+
+func (e *engine) processBlock(frame int64) []float64 {
+	for _, v := range e.voices {
+		v.state = unvisited
+	}
+
+	for _, seq := range e.sequencers {
+		e.evaluate(seq, frame)
+		events := seq.proc.(*sequencer).events
+		for _, target := range seq.targets {
+			if t, ok := target.proc.(triggerable); ok {
+				for _, ev := range events {
+					t.trigger(ev)
+				}
+			}
+		}
+	}
+
+	clear(e.mix)
+	for _, master := range e.masters {
+		e.evaluate(master, frame)
+		for i, s := range master.out {
+			e.mix[i] += s
+		}
+	}
+
+	// Nodes that do not feed the master still advance, so that their state
+	// (phase, delay lines) matches a graph that is wired up mid-render.
+	for _, v := range e.voices {
+		e.evaluate(v, frame)
+	}
+
+	return e.mix
+}
+
+// evaluate renders a voice for the current block. A voice reached again while
+// it is still being evaluated is part of a feedback loop and contributes its
+// previous block, which mirrors the one-quantum delay Web Audio imposes on cycles.
+func (e *engine) evaluate(v *voice, frame int64) []float64 {
+	if v.state != unvisited {
+		return v.out
+	}
+
+	v.state = visiting
+
+	io := &blockIO{frame: frame}
+	for _, in := range v.inputs {
+		io.inputs = append(io.inputs, signal{port: in.port, buf: e.evaluate(in.src, frame)})
+	}
+	for _, mod := range v.mods {
+		io.mods = append(io.mods, signal{port: mod.port, buf: e.evaluate(mod.src, frame)})
+	}
+
+	v.prev, v.out = v.out, v.prev
+	io.out = v.out
+	clear(io.out)
+	v.proc.process(io)
+
+	v.state = processed
+	return v.out
+}
+
+func newProcessor(v *voice, sampleRate float64, rng *rand.Rand) (processor, error) {
+	switch v.node.Type {
+	case "oscillator":
+		return newOscillator(v.node, sampleRate), nil
+	case "filter":
+		return newFilter(v.node, sampleRate), nil
+	case "delay":
+		return newDelay(v.node, sampleRate), nil
+	case "mixer":
+		return newMixer(v.node, v.inputs)
+	case "lfo":
+		return newLFO(v.node, sampleRate), nil
+	case "sequencer":
+		return newSequencer(v.node, sampleRate, rng), nil
+	case "master":
+		return newMaster(v.node), nil
+	case "sampler", "reverb":
+		return &passthrough{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported block type %q", v.node.Type)
+	}
+}
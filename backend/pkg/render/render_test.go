@@ -0,0 +1,155 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/theosov/hexa/pkg/graph"
+)
+
+func port(i int) *int {
+	return &i
+}
+
+func node(id, kind string, params map[string]interface{}) graph.Node {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return graph.Node{ID: id, Type: kind, Params: params}
+}
+
+func connect(from, to string, toPort *int) graph.Connection {
+	return graph.Connection{ID: from + "-" + to, From: from, To: to, ToPortIndex: toPort}
+}
+
+func TestRenderRequiresMaster(t *testing.T) {
+	g := &graph.Graph{Nodes: []graph.Node{node("osc", "oscillator", nil)}}
+	if _, err := Render(context.Background(), g, Options{Duration: time.Millisecond}); !errors.Is(err, ErrNoMaster) {
+		t.Fatalf("got %v, want ErrNoMaster", err)
+	}
+}
+
+func TestRenderOscillatorToMaster(t *testing.T) {
+	g := &graph.Graph{
+		Nodes: []graph.Node{
+			node("osc", "oscillator", map[string]interface{}{"frequency": 440.0}),
+			node("out", "master", nil),
+		},
+		Connections: []graph.Connection{connect("osc", "out", nil)},
+	}
+
+	buf, err := Render(context.Background(), g, Options{SampleRate: 8000, Duration: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.Samples) != 800 {
+		t.Fatalf("got %d samples, want 800", len(buf.Samples))
+	}
+
+	var peak float64
+	for _, s := range buf.Samples {
+		if math.IsNaN(float64(s)) || s < -1 || s > 1 {
+			t.Fatalf("sample %v out of range", s)
+		}
+		peak = math.Max(peak, math.Abs(float64(s)))
+	}
+	if peak == 0 {
+		t.Error("output is silent")
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	g := &graph.Graph{Nodes: []graph.Node{node("out", "master", nil)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Render(ctx, g, Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestRenderUnsupportedBlock(t *testing.T) {
+	g := &graph.Graph{Nodes: []graph.Node{node("x", "theremin", nil), node("out", "master", nil)}}
+	if _, err := Render(context.Background(), g, Options{}); err == nil {
+		t.Fatal("expected an error for an unknown block type")
+	}
+}
+
+func mixerInputs(ports ...int) []input {
+	inputs := make([]input, len(ports))
+	for i, p := range ports {
+		inputs[i] = input{port: p}
+	}
+	return inputs
+}
+
+func TestMixerChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		ports    []int
+		channels []int
+		gains    int
+	}{
+		{"default count", nil, []int{-1, -1}, []int{0, 1}, 4},
+		{"explicit ports are claimed first", nil, []int{-1, 0, 2}, []int{1, 0, 2}, 4},
+		{"grows when full", map[string]interface{}{"channels": 2.0}, []int{-1, -1, -1}, []int{0, 1, 2}, 3},
+		{"count is clamped", map[string]interface{}{"channels": 1e9}, nil, []int{}, graph.MaxMixerChannels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := node("mix", "mixer", tt.params)
+			m, err := newMixer(&n, mixerInputs(tt.ports...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.channels, tt.channels) {
+				t.Errorf("channels = %v, want %v", m.channels, tt.channels)
+			}
+			if len(m.gains) != tt.gains {
+				t.Errorf("%d gains, want %d", len(m.gains), tt.gains)
+			}
+		})
+	}
+}
+
+func TestMixerRejectsPortBeyondChannels(t *testing.T) {
+	n := node("mix", "mixer", map[string]interface{}{"channels": 4.0})
+	if _, err := newMixer(&n, mixerInputs(4)); err == nil {
+		t.Error("port 4 accepted on a 4 channel mixer")
+	}
+	if _, err := newMixer(&n, mixerInputs(1<<30)); err == nil {
+		t.Error("huge port accepted")
+	}
+}
+
+func TestMixerRejectsTooManyInputs(t *testing.T) {
+	ports := make([]int, graph.MaxMixerChannels+1)
+	for i := range ports {
+		ports[i] = -1
+	}
+	n := node("mix", "mixer", nil)
+	if _, err := newMixer(&n, mixerInputs(ports...)); err == nil {
+		t.Errorf("%d inputs accepted", len(ports))
+	}
+}
+
+func TestRenderRejectsOutOfRangeMixerEdge(t *testing.T) {
+	g := &graph.Graph{
+		Nodes: []graph.Node{
+			node("osc", "oscillator", nil),
+			node("mix", "mixer", nil),
+			node("out", "master", nil),
+		},
+		Connections: []graph.Connection{
+			connect("osc", "mix", port(1<<30)),
+			connect("mix", "out", nil),
+		},
+	}
+	if _, err := Render(context.Background(), g, Options{Duration: time.Millisecond}); err == nil {
+		t.Fatal("expected an error for an out-of-range mixer port")
+	}
+}
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WriteWAV encodes the buffer as a mono 32-bit float WAV file.
+func WriteWAV(w io.Writer, buf *Buffer) error {
+	const (
+		formatFloat   = 3
+		channels      = 1
+		bitsPerSample = 32
+	)
+
+	dataSize := uint32(len(buf.Samples) * bitsPerSample / 8)
+	blockAlign := uint16(channels * bitsPerSample / 8)
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		36 + dataSize,
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(formatFloat),
+		uint16(channels),
+		uint32(buf.SampleRate),
+		uint32(buf.SampleRate) * uint32(blockAlign),
+		blockAlign,
+		uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	data := make([]byte, 4*len(buf.Samples))
+	for i, s := range buf.Samples {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(s))
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -55,6 +55,14 @@ func (m *MinIOClient) GetFile(ctx context.Context, objectName string) (*minio.Ob
 	return m.client.GetObject(ctx, m.bucketName, objectName, minio.GetObjectOptions{})
 }
 
+func (m *MinIOClient) CopyFile(ctx context.Context, srcObject, dstObject string) error {
+	_, err := m.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.bucketName, Object: dstObject},
+		minio.CopySrcOptions{Bucket: m.bucketName, Object: srcObject},
+	)
+	return err
+}
+
 func (m *MinIOClient) DeleteFile(ctx context.Context, objectName string) error {
 	return m.client.RemoveObject(ctx, m.bucketName, objectName, minio.RemoveObjectOptions{})
 }
@@ -63,6 +71,12 @@ func (m *MinIOClient) GetPresignedURL(ctx context.Context, objectName string, ex
 	return m.client.PresignedGetObject(ctx, m.bucketName, objectName, expires, nil)
 }
 
+func (m *MinIOClient) GetPresignedDownloadURL(ctx context.Context, objectName, filename string, expires time.Duration) (*url.URL, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	return m.client.PresignedGetObject(ctx, m.bucketName, objectName, expires, params)
+}
+
 func (m *MinIOClient) ListFiles(ctx context.Context, prefix string) ([]string, error) {
 	var files []string
 
@@ -0,0 +1,180 @@
+// Package upload validates uploaded audio by its content rather than the
+// Content-Type the client sends: the format is detected from magic bytes and
+// checked against per-format size and duration limits.
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/theosov/hexa/pkg/audio"
+)
+
+// sniffLen is how much of a file Sniff needs to see.
+const sniffLen = 64
+
+// Rejection is a reason a file is refused. Any other error returned by
+// Check is a server-side failure. Reason is safe to show the client; Err,
+// when set, is the underlying cause, which may carry tool output and should
+// only be logged.
+type Rejection struct {
+	Reason string
+	Err    error
+}
+
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+func (r *Rejection) Unwrap() error {
+	return r.Err
+}
+
+func reject(format string, args ...interface{}) error {
+	return &Rejection{Reason: fmt.Sprintf(format, args...)}
+}
+
+type Format struct {
+	Name      string
+	MimeType  string
+	Extension string
+}
+
+var (
+	WAV  = Format{Name: "wav", MimeType: "audio/wav", Extension: ".wav"}
+	AIFF = Format{Name: "aiff", MimeType: "audio/aiff", Extension: ".aiff"}
+	FLAC = Format{Name: "flac", MimeType: "audio/flac", Extension: ".flac"}
+	MP3  = Format{Name: "mp3", MimeType: "audio/mpeg", Extension: ".mp3"}
+	OGG  = Format{Name: "ogg", MimeType: "audio/ogg", Extension: ".ogg"}
+	WebM = Format{Name: "webm", MimeType: "audio/webm", Extension: ".webm"}
+)
+
+// Sniff identifies the format of a file from its first bytes.
+func Sniff(header []byte) (Format, bool) {
+	switch {
+	case len(header) >= 12 && (bytes.HasPrefix(header, []byte("RIFF")) || bytes.HasPrefix(header, []byte("RF64"))) &&
+		bytes.Equal(header[8:12], []byte("WAVE")):
+		return WAV, true
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("FORM")) &&
+		(bytes.Equal(header[8:12], []byte("AIFF")) || bytes.Equal(header[8:12], []byte("AIFC"))):
+		return AIFF, true
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FLAC, true
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return OGG, true
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}) && bytes.Contains(header, []byte("webm")):
+		return WebM, true
+	case bytes.HasPrefix(header, []byte("ID3")) || isMPEGFrame(header):
+		return MP3, true
+	}
+	return Format{}, false
+}
+
+// isMPEGFrame matches an MPEG audio frame header: an 11-bit sync word and a
+// layer other than the reserved one, which is what AAC's ADTS headers use.
+func isMPEGFrame(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0
+}
+
+type Limit struct {
+	MaxSize     int64
+	MaxDuration time.Duration
+}
+
+// Policy lists the formats accepted for one kind of upload and their limits.
+type Policy struct {
+	Kind   string
+	Limits map[Format]Limit
+}
+
+// Samples allows a few minutes of audio; compressed formats get less room
+// since they need far fewer bytes for the same length.
+var Samples = Policy{
+	Kind: "sample",
+	Limits: map[Format]Limit{
+		WAV:  {MaxSize: 50 << 20, MaxDuration: 5 * time.Minute},
+		AIFF: {MaxSize: 50 << 20, MaxDuration: 5 * time.Minute},
+		FLAC: {MaxSize: 30 << 20, MaxDuration: 5 * time.Minute},
+		MP3:  {MaxSize: 10 << 20, MaxDuration: 5 * time.Minute},
+		OGG:  {MaxSize: 10 << 20, MaxDuration: 5 * time.Minute},
+		WebM: {MaxSize: 10 << 20, MaxDuration: 5 * time.Minute},
+	},
+}
+
+// Impulses are reverb responses, which even for large halls last seconds.
+var Impulses = Policy{
+	Kind: "impulse",
+	Limits: map[Format]Limit{
+		WAV:  {MaxSize: 20 << 20, MaxDuration: 30 * time.Second},
+		AIFF: {MaxSize: 20 << 20, MaxDuration: 30 * time.Second},
+		FLAC: {MaxSize: 15 << 20, MaxDuration: 30 * time.Second},
+		MP3:  {MaxSize: 5 << 20, MaxDuration: 30 * time.Second},
+		OGG:  {MaxSize: 5 << 20, MaxDuration: 30 * time.Second},
+		WebM: {MaxSize: 5 << 20, MaxDuration: 30 * time.Second},
+	},
+}
+
+// MaxSize is the largest file any format of the policy accepts, for
+// rejecting oversized uploads before reading them.
+func (p Policy) MaxSize() int64 {
+	var largest int64
+	for _, limit := range p.Limits {
+		largest = max(largest, limit.MaxSize)
+	}
+	return largest
+}
+
+func (p Policy) formatNames() string {
+	var names []string
+	for _, f := range []Format{WAV, AIFF, FLAC, MP3, OGG, WebM} {
+		if _, ok := p.Limits[f]; ok {
+			names = append(names, f.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Result is an accepted file: its detected format and decoded metadata.
+type Result struct {
+	Format Format
+	Info   *audio.Info
+}
+
+// Check reads r, a file of the given size, and accepts it if its content is
+// one of the policy's formats within that format's limits and decodes in
+// full. The Content-Type the client claimed plays no part.
+func (p Policy) Check(ctx context.Context, r io.Reader, size int64) (*Result, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	header, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	format, ok := Sniff(header)
+	limit, allowed := p.Limits[format]
+	if !ok || !allowed {
+		return nil, reject("invalid file type (allowed: %s)", p.formatNames())
+	}
+	if size > limit.MaxSize {
+		return nil, reject("%s file too large (max %dMB)", format.Name, limit.MaxSize/1024/1024)
+	}
+
+	info, err := audio.ProbeReader(ctx, br)
+	if errors.Is(err, audio.ErrUndecodable) {
+		return nil, &Rejection{Reason: audio.ErrUndecodable.Error(), Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Duration(info.Duration*float64(time.Second)) > limit.MaxDuration {
+		return nil, reject("%s too long (max %s)", p.Kind, limit.MaxDuration)
+	}
+
+	return &Result{Format: format, Info: info}, nil
+}
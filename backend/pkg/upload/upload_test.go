@@ -0,0 +1,110 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func riff(kind string) []byte {
+	return append([]byte("RIFF\x24\x00\x00\x00"+kind), "fmt "...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   Format
+		ok     bool
+	}{
+		{"wav", riff("WAVE"), WAV, true},
+		{"rf64 wav", append([]byte("RF64\xff\xff\xff\xffWAVE"), "ds64"...), WAV, true},
+		{"riff avi", riff("AVI "), Format{}, false},
+		{"riff cut short", []byte("RIFF\x24\x00\x00\x00WA"), Format{}, false},
+		{"aiff", []byte("FORM\x00\x00\x10\x00AIFFCOMM"), AIFF, true},
+		{"aifc", []byte("FORM\x00\x00\x10\x00AIFCFVER"), AIFF, true},
+		{"iff image", []byte("FORM\x00\x00\x10\x00ILBMBMHD"), Format{}, false},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), FLAC, true},
+		{"ogg", []byte("OggS\x00\x02\x00\x00"), OGG, true},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), WebM, true},
+		{"matroska", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88matroska"), Format{}, false},
+		{"mp3 with id3 tag", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), MP3, true},
+		{"mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x64}, MP3, true},
+		{"mpeg-2 layer 2 frame", []byte{0xFF, 0xF4, 0x90, 0x64}, MP3, true},
+		{"adts aac", []byte{0xFF, 0xF1, 0x50, 0x80}, Format{}, false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), Format{}, false},
+		{"text", []byte("hello, world"), Format{}, false},
+		{"empty", nil, Format{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Sniff(tt.header)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Sniff = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsMPEGFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{"mpeg-1 layer 3", []byte{0xFF, 0xFB}, true},
+		{"mpeg-1 layer 1", []byte{0xFF, 0xFF}, true},
+		{"mpeg-2.5 layer 3", []byte{0xFF, 0xE3}, true},
+		{"reserved layer", []byte{0xFF, 0xF9}, false},
+		{"adts", []byte{0xFF, 0xF1}, false},
+		{"partial sync word", []byte{0xFF, 0xC0}, false},
+		{"no sync", []byte{0x7F, 0xFB}, false},
+		{"one byte", []byte{0xFF}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMPEGFrame(tt.header); got != tt.want {
+				t.Errorf("isMPEGFrame(% x) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// Check decides on content alone, so files whose names claim another format
+// are refused before anything is decoded.
+func TestCheckRejectsSpoofedFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		data   []byte
+		size   int64
+	}{
+		{"png named kick.wav", Samples, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 1024},
+		{"script named hall.wav", Impulses, []byte("#!/bin/sh\nrm -rf /\n"), 19},
+		{"empty file", Samples, nil, 0},
+		{"wav over the impulse limit", Impulses, riff("WAVE"), Impulses.Limits[WAV].MaxSize + 1},
+		{"mp3 over the sample limit", Samples, []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), Samples.Limits[MP3].MaxSize + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.policy.Check(context.Background(), bytes.NewReader(tt.data), tt.size)
+			var rejection *Rejection
+			if !errors.As(err, &rejection) {
+				t.Fatalf("Check error = %v, want a Rejection", err)
+			}
+		})
+	}
+}
+
+func TestPolicyLimitsFormat(t *testing.T) {
+	policy := Policy{Kind: "sample", Limits: map[Format]Limit{WAV: {MaxSize: 1 << 20}}}
+	_, err := policy.Check(context.Background(), bytes.NewReader([]byte("fLaC\x00\x00\x00\x22")), 8)
+	var rejection *Rejection
+	if !errors.As(err, &rejection) {
+		t.Fatalf("Check error = %v, want a Rejection", err)
+	}
+	if want := "invalid file type (allowed: wav)"; rejection.Reason != want {
+		t.Errorf("Reason = %q, want %q", rejection.Reason, want)
+	}
+}
@@ -2,7 +2,7 @@ import type { User, TokenPair, APIError } from "./types/auth";
 import type { ImpulseResponse } from "./types/impulse";
 import type { Sample } from "./types/sample";
 import type { Scene } from "./types/scene";
-import type { Track, CreateTrackInput, UpdateTrackInput, GraphData } from "./types/track";
+import type { Track, TrackPage, CreateTrackInput, UpdateTrackInput, GraphData } from "./types/track";
 
 
 const API_URL = import.meta.env.VITE_API_URL || "http://localhost:3000";
@@ -139,8 +139,9 @@ class APIClient {
     });
   }
 
-  async listTracks(): Promise<Track[]> {
-    return this.request<Track[]>("/api/tracks");
+  async listTracks(params: Record<string, string> = {}): Promise<TrackPage> {
+    const query = new URLSearchParams(params).toString();
+    return this.request<TrackPage>(query ? `/api/tracks?${query}` : "/api/tracks");
   }
 
   async getTrack(id: string): Promise<Track> {
@@ -178,14 +179,17 @@ class APIClient {
     return this.request<Track>(`/api/public/${id}`);
   }
 
+  // Uploads to the user's sample library when trackId is null.
   async uploadSample(
-    trackId: string,
+    trackId: string | null,
     file: File,
     onProgress?: (progress: number) => void,
   ): Promise<Sample> {
     const formData = new FormData();
     formData.append("file", file);
-    formData.append("track_id", trackId);
+    if (trackId) {
+      formData.append("track_id", trackId);
+    }
 
     return new Promise((resolve, reject) => {
       const xhr = new XMLHttpRequest();
@@ -231,6 +235,32 @@ class APIClient {
     return this.request<Sample[]>(`/api/tracks/${trackId}/samples`);
   }
 
+  async listLibrarySamples(
+    params: { q?: string; limit?: number; offset?: number } = {},
+  ): Promise<Sample[]> {
+    const query = new URLSearchParams();
+    if (params.q) query.set("q", params.q);
+    if (params.limit) query.set("limit", String(params.limit));
+    if (params.offset) query.set("offset", String(params.offset));
+    const suffix = query.toString() ? `?${query}` : "";
+    return this.request<Sample[]>(`/api/samples/library${suffix}`);
+  }
+
+  async attachSample(trackId: string, sampleId: string): Promise<Sample> {
+    return this.request<Sample>(`/api/tracks/${trackId}/samples/${sampleId}`, {
+      method: "POST",
+    });
+  }
+
+  async detachSample(
+    trackId: string,
+    sampleId: string,
+  ): Promise<{ message: string }> {
+    return this.request(`/api/tracks/${trackId}/samples/${sampleId}`, {
+      method: "DELETE",
+    });
+  }
+
   async uploadImpulse(
     trackId: string,
     file: File,
@@ -3,6 +3,7 @@ export interface Sample {
   filename: string;
   size: number;
   url: string;
+  library?: boolean;
   created_at: string;
 }
 
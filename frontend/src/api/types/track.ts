@@ -10,7 +10,13 @@ export interface Track {
   updated_at: string;
 }
 
+export interface TrackPage {
+  tracks: Track[];
+  next_cursor: string | null;
+}
+
 export interface GraphData {
+  version?: number;
   nodes: Array<{
     id: string;
     type: string;
@@ -25,13 +25,16 @@ export function HomePage() {
   const navigate = useNavigate();
 
   const [tracks, setTracks] = createSignal<Track[]>([]);
+  const [nextCursor, setNextCursor] = createSignal<string | null>(null);
   const [isLoading, setIsLoading] = createSignal(true);
+  const [isLoadingMore, setIsLoadingMore] = createSignal(false);
 
   const loadTracks = async () => {
     setIsLoading(true);
     try {
       const data = await apiClient.listTracks();
-      setTracks(data);
+      setTracks(data.tracks);
+      setNextCursor(data.next_cursor);
     } catch (error) {
       console.error("Failed to load tracks:", error);
     } finally {
@@ -39,6 +42,22 @@ export function HomePage() {
     }
   };
 
+  const loadMoreTracks = async () => {
+    const cursor = nextCursor();
+    if (!cursor || isLoadingMore()) return;
+
+    setIsLoadingMore(true);
+    try {
+      const data = await apiClient.listTracks({ cursor });
+      setTracks([...tracks(), ...data.tracks]);
+      setNextCursor(data.next_cursor);
+    } catch (error) {
+      console.error("Failed to load more tracks:", error);
+    } finally {
+      setIsLoadingMore(false);
+    }
+  };
+
   onMount(() => {
     loadTracks();
   });
@@ -126,6 +145,14 @@ export function HomePage() {
                 {(track) => <TrackCard track={track} onDelete={handleDeleteTrack} />}
               </For>
             </div>
+
+            <Show when={nextCursor()}>
+              <Horizontal justify="center">
+                <Button onClick={loadMoreTracks} variant="secondary" disabled={isLoadingMore()}>
+                  {isLoadingMore() ? "Loading..." : "Load more"}
+                </Button>
+              </Horizontal>
+            </Show>
           </Show>
         </Show>
       </Vertical>